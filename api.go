@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ==================== JSON API（/api/v1） ====================
+
+const tokenTTL = 24 * time.Hour // JWT 有效期
+
+// jwtSecret 签名密钥，取配置 jwt_secret
+var jwtSecret []byte
+
+// initJWTSecret 读取签名密钥，没有配置时随机生成（重启后旧令牌全部失效）
+func initJWTSecret() {
+	if cfg.JWTSecret != "" {
+		jwtSecret = []byte(cfg.JWTSecret)
+		return
+	}
+	slog.Warn("未配置 jwt_secret，使用随机密钥，重启后已签发的令牌将失效")
+	jwtSecret = []byte(randomToken(32))
+}
+
+// tokenClaims JWT 载荷：sub 为用户ID，另外带上角色方便客户端判断
+type tokenClaims struct {
+	Role string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// apiError 统一的错误返回格式，带上请求 ID，方便对照服务端日志
+func apiError(c *gin.Context, code int, msg string) {
+	c.AbortWithStatusJSON(code, gin.H{"error": msg, "request_id": c.GetString("requestID")})
+}
+
+// wantsJSON 判断请求方是否期望 JSON（fetch/XHR 调用页面接口时）
+func wantsJSON(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "application/json") ||
+		c.GetHeader("X-Requested-With") == "XMLHttpRequest"
+}
+
+// isAPIPath 是否是 API 的地址（/api/ 下和 /graphql），这些地址出错时返回 JSON，不用 Cookie 认证
+func isAPIPath(c *gin.Context) bool {
+	return strings.HasPrefix(c.Request.URL.Path, "/api/") || c.Request.URL.Path == "/graphql"
+}
+
+// ---------- 签发令牌 ----------
+
+// issueToken 用户名密码换取 JWT：POST /api/v1/token
+func issueToken(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" form:"username"`
+		Password string `json:"password" form:"password"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+		return
+	}
+
+	var user User
+	if err := dbFor(c).Where("username = ?", req.Username).First(&user).Error; err != nil ||
+		bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+		apiError(c, http.StatusUnauthorized, tr(c, "error.bad_credentials"))
+		return
+	}
+
+	expires := time.Now().Add(tokenTTL)
+	claims := tokenClaims{
+		Role: user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(user.ID), 10),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.token_failed"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expires,
+	})
+}
+
+// parseToken 校验 JWT 并返回对应的用户
+func parseToken(raw string) (*User, error) {
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid subject")
+	}
+	// 每次都查库，用户被删除或降级后令牌立即失效
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ---------- 中间件 ----------
+
+// jwtRequired 校验 Authorization: Bearer <token>，通过后把用户放入上下文
+func jwtRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		raw := strings.TrimPrefix(auth, "Bearer ")
+		if auth == "" || raw == auth {
+			apiError(c, http.StatusUnauthorized, tr(c, "error.token_missing"))
+			return
+		}
+		user, err := parseToken(raw)
+		if err != nil {
+			apiError(c, http.StatusUnauthorized, tr(c, "error.token_invalid"))
+			return
+		}
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// apiAdminRequired API 版的管理员校验，返回 JSON 而不是跳转
+func apiAdminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !currentUser(c).IsAdmin() {
+			apiError(c, http.StatusForbidden, tr(c, "error.admin_required"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// ---------- 景点接口 ----------
+
+// apiListSpots 景点列表：GET /api/v1/spots，筛选条件见 filter.go；
+// 带 limit 或 after 参数时分页返回（见 cursor.go），否则返回全部
+func apiListSpots(c *gin.Context) {
+	var spots []Spot
+	q := filterSpots(c, dbFor(c).Scopes(published).Preload("Tags"))
+	if !wantsCursor(c) {
+		// 不分页时和首页一样缓存查询结果（见 cache.go）
+		spots = cachedSpots(c, "api", func() []Spot {
+			q.Order(spotOrder(c)).Find(&spots)
+			return spots
+		})
+		spots = filterOpenNow(c, spots)
+		localizeSpots(c, spots)
+		c.JSON(http.StatusOK, gin.H{"spots": spots})
+		return
+	}
+
+	limit, ok := limitParam(c)
+	if !ok {
+		return
+	}
+	sort := sortParam(c)
+	r, ok := rankingFor(sort).(keysetRanking)
+	if !ok || strings.HasPrefix(sort, "price_") {
+		apiError(c, http.StatusBadRequest, tr(c, "error.sort_not_paginated", strings.Join(keysetRankingNames(), ", ")))
+		return
+	}
+	q, err := afterCursor(q, r.Keys(), c.Query("after"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	// 多查一条，判断还有没有下一页
+	q.Limit(limit + 1).Find(&spots)
+	resp := gin.H{}
+	if len(spots) > limit {
+		spots = spots[:limit]
+		next, err := encodeCursor(&spots[limit-1], r.Keys())
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, tr(c, "error.cursor_failed"))
+			return
+		}
+		resp["next_cursor"] = next
+	}
+	// open_now 在查出来之后过滤，所以这时一页可能不满 limit 条
+	spots = filterOpenNow(c, spots)
+	localizeSpots(c, spots)
+	resp["spots"] = spots
+	c.JSON(http.StatusOK, resp)
+}
+
+// withQuery 复制一份请求上下文，换上 values 作为查询参数，这样可以直接用 REST 接口的筛选、排序函数
+func withQuery(c *gin.Context, values url.Values) *gin.Context {
+	cc := c.Copy()
+	cc.Request = c.Request.Clone(c.Request.Context())
+	cc.Request.URL.RawQuery = values.Encode()
+	return cc
+}
+
+// spotsPage 按 values 里的筛选条件（同 GET /api/v1/spots，另外支持关键词 q）和 sort 游标分页取一页景点，
+// next 是下一页的游标，最后一页时为空；有关键词时也按 sort 排序，不按相关度。GraphQL 和 gRPC 共用
+func spotsPage(c *gin.Context, values url.Values, limit int, after string) (spots []Spot, next string, err error) {
+	c = withQuery(c, values)
+	sort := sortParam(c)
+	r, ok := rankingFor(sort).(keysetRanking)
+	if !ok || strings.HasPrefix(sort, "price_") {
+		return nil, "", errors.New(tr(c, "error.sort_not_paginated", strings.Join(keysetRankingNames(), ", ")))
+	}
+	q, _ := searchKeyword(filterSpots(c, dbFor(c).Scopes(published).Preload("Tags")), strings.TrimSpace(c.Query("q")))
+	if q, err = afterCursor(q, r.Keys(), after); err != nil {
+		return nil, "", err
+	}
+	q.Limit(limit + 1).Find(&spots)
+	if len(spots) > limit {
+		spots = spots[:limit]
+		if next, err = encodeCursor(&spots[limit-1], r.Keys()); err != nil {
+			return nil, "", errors.New(tr(c, "error.cursor_failed"))
+		}
+	}
+	spots = filterOpenNow(c, spots)
+	localizeSpots(c, spots)
+	return spots, next, nil
+}
+
+func apiGetSpot(c *gin.Context) {
+	spot, err := cachedSpot("api", c.Param("id"), func() (*Spot, error) {
+		var spot Spot
+		err := dbFor(c).Scopes(published).Preload("Images", func(tx *gorm.DB) *gorm.DB { return tx.Order("position, id") }).
+			Preload("Tags").First(&spot, c.Param("id")).Error
+		return &spot, err
+	})
+	if err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	localizeSpot(c, spot)
+	c.JSON(http.StatusOK, spot)
+}
+
+func apiCreateSpot(c *gin.Context) {
+	var in spotInput
+	if !bindSpotJSON(c, &in) {
+		return
+	}
+	spot, msg := createSpot(c, &in)
+	if msg != "" {
+		apiError(c, http.StatusInternalServerError, msg)
+		return
+	}
+	c.JSON(http.StatusCreated, spot)
+}
+
+// createSpot 保存新景点和标签，记操作日志并通知审核；出错时返回错误提示。REST 和 GraphQL 共用
+func createSpot(c *gin.Context, in *spotInput) (Spot, string) {
+	spot := in.spot()
+	if err := dbFor(c).Create(&spot).Error; err != nil {
+		return spot, tr(c, "error.save_failed")
+	}
+	if err := setSpotTags(&spot, in.Tags); err != nil {
+		return spot, tr(c, "error.tags_save_failed")
+	}
+	recordAudit(c, auditCreate, spot.ID, nil, spot)
+	notifySubmission(c, &spot)
+	return spot, ""
+}
+
+func apiUpdateSpot(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).Preload("Tags").First(&spot, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	var in spotInput
+	if !bindSpotJSON(c, &in) {
+		return
+	}
+	if msg := updateSpot(c, &spot, &in); msg != "" {
+		apiError(c, http.StatusInternalServerError, msg)
+		return
+	}
+	c.JSON(http.StatusOK, spot)
+}
+
+// updateSpot 按 in 修改景点并记操作日志，出错时返回错误提示。REST 和 GraphQL 共用
+func updateSpot(c *gin.Context, spot *Spot, in *spotInput) string {
+	// 和表单更新一样，空字段不修改，修改前的内容存为历史版本
+	before := *spot
+	if err := updateSpotWithRevision(spot, in.spot(), currentUser(c), false); err != nil {
+		return tr(c, "error.save_failed")
+	}
+	// 上面会跳过零值，明确传了 "is_free": false 时单独取消免费
+	if in.IsFree != nil && !*in.IsFree && spot.IsFree {
+		if err := dbFor(c).Model(spot).Update("is_free", false).Error; err != nil {
+			return tr(c, "error.save_failed")
+		}
+	}
+	// 明确传了空的 best_months 时清空最佳季节
+	if in.BestMonths != nil && len(in.BestMonths) == 0 && spot.BestMonths != 0 {
+		if err := dbFor(c).Model(spot).Update("best_months", 0).Error; err != nil {
+			return tr(c, "error.save_failed")
+		}
+	}
+	// 没有传 tags 时不修改标签，传空数组时去掉所有标签
+	if in.Tags != nil {
+		if err := setSpotTags(spot, in.Tags); err != nil {
+			return tr(c, "error.tags_save_failed")
+		}
+	}
+	recordAudit(c, auditUpdate, spot.ID, before, *spot)
+	return ""
+}
+
+func apiDeleteSpot(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).First(&spot, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	deleteSpot(c, &spot)
+	c.Status(http.StatusNoContent)
+}
+
+// deleteSpot 把景点移到回收站并记操作日志。REST 和 GraphQL 共用
+func deleteSpot(c *gin.Context, spot *Spot) {
+	dbFor(c).Delete(spot)
+	updateSpotTagCounts(spot.ID)
+	recordAudit(c, auditDelete, spot.ID, *spot, nil)
+}
+
+func apiRecommendSpot(c *gin.Context) {
+	count, err := recommendSpot(c.Param("id"), visitorKeys(c), c.ClientIP())
+	recordRecommendAudit(c, auditRecommend, c.Param("id"), count, err)
+	recommendResponse(c, count, err)
+}
+
+func apiUndoRecommend(c *gin.Context) {
+	count, err := undoRecommend(c.Param("id"), visitorKeys(c))
+	recordRecommendAudit(c, auditUnrecommend, c.Param("id"), count, err)
+	recommendResponse(c, count, err)
+}
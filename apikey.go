@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== API Key（第三方接入） ====================
+
+const (
+	defaultKeyRateLimit = 60          // 默认每个 Key 每分钟最多请求次数
+	keyTouchInterval    = time.Minute // 最后使用时间最多这么久写一次库，不用每个请求都写
+)
+
+// APIKey 模型：发给合作方的访问密钥
+// 数据库只保存密钥的 SHA-256，明文只在创建时展示一次
+type APIKey struct {
+	ID         uint   `gorm:"primaryKey"`
+	Name       string // 备注，例如合作方名称
+	Prefix     string // 密钥前几位，方便在列表中辨认
+	KeyHash    string `gorm:"uniqueIndex"`
+	RateLimit  int    // 每分钟最多请求次数
+	Revoked    bool   // 是否已吊销
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// hashAPIKey 计算密钥的哈希
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ---------- 按 Key 限流（固定一分钟窗口） ----------
+
+type keyWindow struct {
+	start time.Time
+	count int
+}
+
+var (
+	keyWindowsMu sync.Mutex
+	keyWindows   = map[uint]*keyWindow{}
+)
+
+// allowKey 判断该 Key 在当前窗口内是否还能请求，不能时返回需要等待的秒数
+func allowKey(k *APIKey) (bool, int) {
+	keyWindowsMu.Lock()
+	defer keyWindowsMu.Unlock()
+
+	now := time.Now()
+	w, ok := keyWindows[k.ID]
+	if !ok || now.Sub(w.start) >= time.Minute {
+		w = &keyWindow{start: now}
+		keyWindows[k.ID] = w
+	}
+	if w.count >= k.RateLimit {
+		return false, int(time.Minute-now.Sub(w.start))/int(time.Second) + 1
+	}
+	w.count++
+	return true, 0
+}
+
+// apiKeyAuth 读接口的 X-API-Key 校验
+// 不带 Key 的请求照常匿名访问；带了 Key 就必须有效，并按 Key 限流
+func apiKeyAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader("X-API-Key"))
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		var k APIKey
+		if err := dbFor(c).Where("key_hash = ? AND revoked = ?", hashAPIKey(key), false).First(&k).Error; err != nil {
+			apiError(c, http.StatusUnauthorized, tr(c, "error.api_key_invalid"))
+			return
+		}
+		if ok, wait := allowKey(&k); !ok {
+			c.Header("Retry-After", strconv.Itoa(wait))
+			apiError(c, http.StatusTooManyRequests, tr(c, "error.too_many_requests"))
+			return
+		}
+
+		if now := time.Now(); k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= keyTouchInterval {
+			dbFor(c).Model(&k).UpdateColumn("last_used_at", now)
+		}
+		c.Set("apiKey", &k)
+		c.Next()
+	}
+}
+
+// ---------- 管理页面 ----------
+
+func showAPIKeys(c *gin.Context) {
+	var keys []APIKey
+	dbFor(c).Order("id desc").Find(&keys)
+	render(c, http.StatusOK, "apikeys.html", gin.H{
+		"title": tr(c, "apikeys.title"),
+		"keys":  keys,
+	})
+}
+
+// createAPIKey 生成新 Key，明文只在这次响应中显示
+func createAPIKey(c *gin.Context) {
+	name := sanitizeText(c.PostForm("name"))
+	limit, err := strconv.Atoi(c.PostForm("rate_limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultKeyRateLimit
+	}
+
+	plain := "sk_" + randomToken(24)
+	k := APIKey{
+		Name:      name,
+		Prefix:    plain[:10],
+		KeyHash:   hashAPIKey(plain),
+		RateLimit: limit,
+	}
+	dbFor(c).Create(&k)
+
+	var keys []APIKey
+	dbFor(c).Order("id desc").Find(&keys)
+	render(c, http.StatusOK, "apikeys.html", gin.H{
+		"title":  tr(c, "apikeys.title"),
+		"keys":   keys,
+		"newKey": plain,
+	})
+}
+
+func revokeAPIKey(c *gin.Context) {
+	dbFor(c).Model(&APIKey{}).Where("id = ?", c.Param("id")).Update("revoked", true)
+	c.Redirect(http.StatusFound, "/admin/apikeys")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	ginrender "github.com/gin-gonic/gin/render"
+)
+
+// ==================== 模板和静态文件 ====================
+
+// 模板（templates 目录，包括邮件模板）和静态站点（static 目录）编译时用 go:embed 打包进程序，
+// 只复制一个可执行文件就能部署，从哪个目录启动都能找到模板。
+// 开发时打开 server.dev（参数 -dev），改为从 server.template_dir / static_dir 读磁盘上的文件，
+// 页面模板每次渲染都重新加载，改了模板刷新页面就能看到，不用重新编译。
+// 邮件模板每次发送时都重新解析，两种方式都一样。
+// 配置了主题（server.theme_dir，见 theme.go）时，主题里的同名文件优先，两种方式都一样。
+
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// templateFS 模板文件，路径相对于模板目录（index.html、email/digest.txt）
+func templateFS() fs.FS {
+	if cfg.Server.Dev {
+		return withTheme(os.DirFS(cfg.Server.TemplateDir), "templates")
+	}
+	sub, _ := fs.Sub(embeddedAssets, "templates")
+	return withTheme(sub, "templates")
+}
+
+// staticFS 静态站点的文件
+func staticFS() http.FileSystem {
+	if cfg.Server.Dev {
+		return http.FS(withTheme(os.DirFS(cfg.Server.StaticDir), "static"))
+	}
+	sub, _ := fs.Sub(embeddedAssets, "static")
+	return http.FS(withTheme(sub, "static"))
+}
+
+// loadTemplates 加载页面模板，模板辅助函数要在这之前用 SetFuncMap 设置。
+// 每种语言解析一份，模板里的 t 函数取这种语言的文字（见 i18n.go）
+func loadTemplates(r *gin.Engine) {
+	h := localizedHTML{funcs: r.FuncMap, sets: map[string]*template.Template{}}
+	if !cfg.Server.Dev {
+		for code := range catalogs {
+			h.sets[code] = template.Must(h.parse(code))
+		}
+	}
+	r.HTMLRender = h
+}
+
+// localizedHTML 按页面数据里的 lang 选择对应语言的模板
+type localizedHTML struct {
+	funcs template.FuncMap
+	sets  map[string]*template.Template // 开发模式下为空，每次渲染都重新解析
+}
+
+func (h localizedHTML) parse(locale string) (*template.Template, error) {
+	return template.New("").Funcs(h.funcs).Funcs(template.FuncMap{"t": translator(locale), "timeAgo": timeAgoIn(locale)}).ParseFS(templateFS(), "*.html")
+}
+
+func (h localizedHTML) Instance(name string, data interface{}) ginrender.Render {
+	locale := cfg.Locale
+	if d, ok := data.(gin.H); ok {
+		if code, ok := d["lang"].(string); ok && catalogs[code] != nil {
+			locale = code
+		}
+	}
+	tmpl, ok := h.sets[locale]
+	if !ok {
+		tmpl = template.Must(h.parse(locale))
+	}
+	return ginrender.HTML{Template: tmpl, Name: name, Data: data}
+}
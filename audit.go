@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 操作日志 ====================
+
+// 每次新增/修改/删除/推荐景点都追加一条记录：谁、做了什么、改前改后的内容。
+// 日志只增不改，彻底删除景点时也不会删除它的日志。
+
+// 操作类型
+const (
+	auditCreate      = "create"
+	auditUpdate      = "update"
+	auditDelete      = "delete"
+	auditRestore     = "restore"
+	auditPurge       = "purge"
+	auditRollback    = "rollback"
+	auditRecommend   = "recommend"
+	auditUnrecommend = "unrecommend"
+	auditPublish     = "publish"
+	auditReject      = "reject"
+)
+
+// auditActionLabels 操作类型在页面上显示的名称（locales/ 里的键），顺序即筛选下拉框的顺序
+var auditActionLabels = []struct{ Action, Label string }{
+	{auditCreate, "audit.action.create"},
+	{auditUpdate, "audit.action.update"},
+	{auditRollback, "audit.action.rollback"},
+	{auditDelete, "audit.action.delete"},
+	{auditRestore, "audit.action.restore"},
+	{auditPurge, "audit.action.purge"},
+	{auditRecommend, "audit.action.recommend"},
+	{auditUnrecommend, "audit.action.unrecommend"},
+	{auditPublish, "audit.action.publish"},
+	{auditReject, "audit.action.reject"},
+}
+
+// AuditEntry 一条操作记录
+// Before/After 是操作前后的 JSON 快照，没有的一侧为空
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ActorID   *uint     `json:"actor_id"`           // 登录用户的ID，访客为 nil
+	Actor     string    `gorm:"index" json:"actor"` // 用户名，访客为访客标识（c:.../ip:...）
+	Action    string    `gorm:"index" json:"action"`
+	SpotID    uint      `gorm:"index" json:"spot_id"`
+	Before    string    `json:"-"`
+	After     string    `json:"-"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// MarshalJSON 导出时快照直接嵌成 JSON 对象，而不是转义后的字符串
+func (e AuditEntry) MarshalJSON() ([]byte, error) {
+	type plain AuditEntry
+	return json.Marshal(struct {
+		plain
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	}{plain(e), rawSnapshot(e.Before), rawSnapshot(e.After)})
+}
+
+func rawSnapshot(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
+// ActionLabel 操作类型的名称在 locales/ 里的键，模板里用 {{t .ActionLabel}}
+func (e AuditEntry) ActionLabel() string {
+	for _, a := range auditActionLabels {
+		if a.Action == e.Action {
+			return a.Label
+		}
+	}
+	return e.Action
+}
+
+// snapshot 把操作前/后的对象序列化，nil 返回空字符串
+func snapshot(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// writeAudit 保存一条记录；写日志失败不影响操作本身，只打印错误
+func writeAudit(e AuditEntry, before, after interface{}) {
+	e.Before = snapshot(before)
+	e.After = snapshot(after)
+	if err := db.Create(&e).Error; err != nil {
+		slog.Error("写入操作日志失败", "err", err)
+	}
+	spotEvents.inc(e.Action)
+	// 修改已经提交，再让查询缓存失效一次（见 cache.go）
+	queryCache.invalidate()
+	notifyAudit(e)
+}
+
+// recordAudit 记录当前请求做的一次操作，操作人取登录用户，没有登录时取访客标识
+func recordAudit(c *gin.Context, action string, spotID uint, before, after interface{}) {
+	e := AuditEntry{Action: action, SpotID: spotID, IP: c.ClientIP()}
+	if user := currentUser(c); user != nil {
+		e.ActorID = &user.ID
+		e.Actor = user.Username
+	} else {
+		e.Actor = visitorKeys(c)[0]
+	}
+	writeAudit(e, before, after)
+}
+
+// recordRecommendAudit 推荐/取消推荐成功后记录，快照只有推荐次数
+func recordRecommendAudit(c *gin.Context, action, spotID string, count int, err error) {
+	if err != nil {
+		return
+	}
+	id, _ := strconv.ParseUint(spotID, 10, 64)
+	recordAudit(c, action, uint(id), nil, gin.H{"recommend_count": count})
+	if action == auditRecommend {
+		notifyRecommend(uint(id), count)
+	}
+}
+
+// ---------- 页面 ----------
+
+const auditPageSize = 50
+
+// auditQuery 按 action / actor / spot_id 筛选，三个条件都可以不填
+func auditQuery(c *gin.Context) *gorm.DB {
+	q := dbFor(c).Model(&AuditEntry{})
+	if v := c.Query("action"); v != "" {
+		q = q.Where("action = ?", v)
+	}
+	if v := c.Query("actor"); v != "" {
+		q = q.Where("actor = ?", v)
+	}
+	if v := c.Query("spot_id"); v != "" {
+		q = q.Where("spot_id = ?", v)
+	}
+	return q
+}
+
+// showAudit 操作日志：GET /admin/audit
+func showAudit(c *gin.Context) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	var total int64
+	auditQuery(c).Count(&total)
+	var entries []AuditEntry
+	auditQuery(c).Order("id desc").Limit(auditPageSize).Offset((page - 1) * auditPageSize).Find(&entries)
+
+	// 翻页和导出链接保留筛选条件
+	q := c.Request.URL.Query()
+	q.Del("page")
+	filter := q.Encode()
+	pageURL := "/admin/audit?page="
+	if filter != "" {
+		pageURL = "/admin/audit?" + filter + "&page="
+	}
+	render(c, http.StatusOK, "audit.html", gin.H{
+		"title":     tr(c, "nav.admin.audit"),
+		"entries":   entries,
+		"actions":   auditActionLabels,
+		"action":    c.Query("action"),
+		"actor":     c.Query("actor"),
+		"spotID":    c.Query("spot_id"),
+		"exportURL": "/admin/audit/export?" + filter,
+		"pageURL":   pageURL,
+		"page":      page,
+		"prevPage":  page - 1,
+		"nextPage":  auditNextPage(page, total),
+	})
+}
+
+// auditNextPage 还有下一页时返回下一页页码，否则返回0
+func auditNextPage(page int, total int64) int {
+	if int64(page*auditPageSize) < total {
+		return page + 1
+	}
+	return 0
+}
+
+// exportAudit 按同样的筛选条件导出全部记录：GET /admin/audit/export
+func exportAudit(c *gin.Context) {
+	var entries []AuditEntry
+	auditQuery(c).Order("id asc").Find(&entries)
+	c.Header("Content-Disposition", `attachment; filename="audit-`+time.Now().Format("20060102")+`.json"`)
+	c.JSON(http.StatusOK, entries)
+}
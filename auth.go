@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ==================== 用户与权限 ====================
+
+// 用户角色
+const (
+	RoleUser  = "user"  // 普通用户
+	RoleAdmin = "admin" // 管理员，可以修改和删除景点
+)
+
+// User 模型（用户表）
+type User struct {
+	ID           uint   `gorm:"primaryKey"`  // 用户ID
+	Username     string `gorm:"uniqueIndex"` // 用户名，唯一
+	PasswordHash string // bcrypt 加密后的密码
+	Role         string // 角色：user / admin
+	CreatedAt    time.Time
+}
+
+// IsAdmin 判断是否为管理员（nil 表示未登录）
+func (u *User) IsAdmin() bool {
+	return u != nil && u.Role == RoleAdmin
+}
+
+// Session 登录会话，Cookie 中只保存随机令牌，用户信息放在数据库
+type Session struct {
+	Token     string `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index"`
+	ExpiresAt time.Time
+}
+
+const (
+	sessionCookie = "session"          // 会话Cookie名称
+	sessionTTL    = 7 * 24 * time.Hour // 会话有效期
+)
+
+// randomToken 生成 n 字节的随机十六进制字符串
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		fatal("无法生成随机数", "err", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ensureAdmin 保证系统中至少有一个管理员账号
+// 用户名/密码取配置 admin.username / admin.password，
+// 没有设置密码时随机生成一个并打印到日志
+func ensureAdmin() {
+	var count int64
+	db.Model(&User{}).Where("role = ?", RoleAdmin).Count(&count)
+	if count > 0 {
+		return
+	}
+
+	username := cfg.Admin.Username
+	password := cfg.Admin.Password
+	if password == "" {
+		password = randomToken(6)
+		slog.Warn("已创建管理员账号，请登录后尽快修改初始密码", "username", username, "password", password)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		fatal("无法创建管理员账号", "err", err)
+	}
+	db.Create(&User{Username: username, PasswordHash: string(hash), Role: RoleAdmin})
+}
+
+// ---------- 中间件 ----------
+
+// loadUser 根据会话Cookie查出当前用户，放入上下文（key: "user"）
+func loadUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, err := c.Cookie(sessionCookie); err == nil && token != "" {
+			var s Session
+			if dbFor(c).Where("token = ? AND expires_at > ?", token, time.Now()).First(&s).Error == nil {
+				var u User
+				if dbFor(c).First(&u, s.UserID).Error == nil {
+					c.Set("user", &u)
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// currentUser 返回当前登录用户，未登录返回 nil
+func currentUser(c *gin.Context) *User {
+	if v, ok := c.Get("user"); ok {
+		return v.(*User)
+	}
+	return nil
+}
+
+// adminRequired 只允许管理员访问
+// 未登录跳转到登录页，已登录但不是管理员返回403
+func adminRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user == nil {
+			c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(c.Request.URL.Path))
+			c.Abort()
+			return
+		}
+		if !user.IsAdmin() {
+			c.String(http.StatusForbidden, tr(c, "error.admin_required"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// render 渲染模板，统一注入当前用户等公共数据
+func render(c *gin.Context, code int, name string, data gin.H) {
+	if data == nil {
+		data = gin.H{}
+	}
+	ensureVisitorCookie(c)
+	user := currentUser(c)
+	data["user"] = user
+	data["isAdmin"] = user.IsAdmin()
+	data["notifications"] = summarizeNotifications(user) // 页面顶部的铃铛，未登录为 nil
+	data["currentPath"] = c.Request.URL.RequestURI()     // 铃铛里的表单提交后回到当前页面
+	data["csrfToken"] = c.GetString("csrfToken")
+	data["captcha"] = newCaptchaChallenge(c) // 首页添加景点的表单用，不需要验证码时为 nil
+	data["query"] = c.Request.URL.Query()    // 当前的查询参数，筛选表单用来回填
+	data["lang"] = currentLocale(c)          // 页面语言，选择对应语言的模板
+	c.HTML(code, name, data)
+}
+
+// ---------- 登录 / 注册 / 退出 ----------
+
+// safeNext 只允许站内跳转，防止开放重定向。
+// 浏览器会把 \ 当成 /、去掉地址里的制表符和换行，所以 /\evil.com、/\t/evil.com 也会跳到别的网站，一起拒绝
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	if strings.IndexFunc(next, unicode.IsControl) >= 0 {
+		return "/"
+	}
+	if u, err := url.Parse(next); err != nil || u.Scheme != "" || u.Host != "" {
+		return "/"
+	}
+	return next
+}
+
+// absoluteURL 站内路径对应的完整地址，用当前请求的域名（反向代理后面时看 X-Forwarded-Proto）
+func absoluteURL(c *gin.Context, path string) string {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + path
+}
+
+// startSession 创建会话并写入Cookie
+func startSession(c *gin.Context, user *User) {
+	s := Session{
+		Token:     randomToken(32),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(sessionTTL),
+	}
+	dbFor(c).Create(&s)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(sessionCookie, s.Token, int(sessionTTL.Seconds()), "/", "", secureCookie(c), true)
+}
+
+func showLogin(c *gin.Context) {
+	render(c, http.StatusOK, "login.html", gin.H{
+		"next":      c.Query("next"),
+		"providers": providerList(),
+	})
+}
+
+func doLogin(c *gin.Context) {
+	username := strings.TrimSpace(c.PostForm("username"))
+	password := c.PostForm("password")
+	next := c.PostForm("next")
+
+	var user User
+	if err := dbFor(c).Where("username = ?", username).First(&user).Error; err != nil ||
+		bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		render(c, http.StatusUnauthorized, "login.html", gin.H{
+			"next":      next,
+			"error":     tr(c, "login.failed"),
+			"providers": providerList(),
+		})
+		return
+	}
+
+	startSession(c, &user)
+	c.Redirect(http.StatusFound, safeNext(next))
+}
+
+func showRegister(c *gin.Context) {
+	render(c, http.StatusOK, "register.html", nil)
+}
+
+func doRegister(c *gin.Context) {
+	username := sanitizeText(c.PostForm("username"))
+	password := c.PostForm("password")
+
+	fail := func(msg string) {
+		render(c, http.StatusBadRequest, "register.html", gin.H{"error": msg, "username": username})
+	}
+	if username == "" || len(password) < 6 {
+		fail(tr(c, "register.invalid"))
+		return
+	}
+	var count int64
+	dbFor(c).Model(&User{}).Where("username = ?", username).Count(&count)
+	if count > 0 {
+		fail(tr(c, "register.taken"))
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		fail(tr(c, "register.failed"))
+		return
+	}
+	// 注册的用户都是普通用户，管理员只能通过 ensureAdmin 或数据库设置
+	user := User{Username: username, PasswordHash: string(hash), Role: RoleUser}
+	if err := dbFor(c).Create(&user).Error; err != nil {
+		fail(tr(c, "register.failed"))
+		return
+	}
+
+	startSession(c, &user)
+	c.Redirect(http.StatusFound, "/")
+}
+
+func doLogout(c *gin.Context) {
+	if token, err := c.Cookie(sessionCookie); err == nil {
+		dbFor(c).Where("token = ?", token).Delete(&Session{})
+	}
+	c.SetCookie(sessionCookie, "", -1, "/", "", secureCookie(c), true)
+	c.Redirect(http.StatusFound, "/")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ==================== 数据库备份 ====================
+
+// 使用 SQLite 时，后台每隔 backup.interval 把数据库复制成一个快照文件，保存在 backup.dir，
+// 只保留最近 backup.keep 个。复制用的是 SQLite 的在线备份接口，不是直接复制文件：
+// 备份期间服务照常读写，得到的快照是某一时刻完整一致的数据库（直接复制文件可能复制到写了一半的数据）。
+// 管理员可以在 /admin/backups 立即备份、下载快照。
+// MySQL / PostgreSQL 请用 mysqldump / pg_dump 等数据库自己的工具，或者 /admin/dump（见 dump.go）。
+
+// backupNamePattern 快照文件名，如 spots-20261015-030000.db，按文件名排序就是按时间排序
+var backupNamePattern = regexp.MustCompile(`^spots-\d{8}-\d{6}\.db$`)
+
+// backupMu 同一时间只做一次备份
+var backupMu sync.Mutex
+
+// backupSnapshot 一个快照文件
+type backupSnapshot struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// SizeText 文件大小，如 1.5 MB
+func (b backupSnapshot) SizeText() string {
+	if b.Size < 1<<20 {
+		return fmt.Sprintf("%.1f KB", float64(b.Size)/(1<<10))
+	}
+	return fmt.Sprintf("%.1f MB", float64(b.Size)/(1<<20))
+}
+
+// backupsSupported 当前数据库是否支持快照
+func backupsSupported() bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// createBackup 立即备份一次，返回快照文件名，然后删除多余的旧快照
+func createBackup() (string, error) {
+	if !backupsSupported() {
+		return "", errors.New("只有 SQLite 数据库支持快照备份")
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	if err := os.MkdirAll(cfg.Backup.Dir, 0o755); err != nil {
+		return "", err
+	}
+	name := "spots-" + time.Now().Format("20060102-150405") + ".db"
+	path := filepath.Join(cfg.Backup.Dir, name)
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := backupSQLite(tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := pruneBackups(); err != nil {
+		slog.Error("删除旧的数据库快照失败", "err", err)
+	}
+	return name, nil
+}
+
+// backupSQLite 用 SQLite 的在线备份接口把当前数据库复制到 dest
+func backupSQLite(dest string) error {
+	ctx := context.Background()
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	src, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	destDB, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+	dst, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	return dst.Raw(func(dstConn interface{}) error {
+		return src.Raw(func(srcConn interface{}) error {
+			from, ok := srcConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("不支持的 SQLite 连接类型 %T", srcConn)
+			}
+			b, err := dstConn.(*sqlite3.SQLiteConn).Backup("main", from, "main")
+			if err != nil {
+				return err
+			}
+			// -1 表示一次复制所有页
+			if _, err := b.Step(-1); err != nil {
+				b.Finish()
+				return err
+			}
+			return b.Finish()
+		})
+	})
+}
+
+// listBackups 所有快照，最新的在前
+func listBackups() ([]backupSnapshot, error) {
+	entries, err := os.ReadDir(cfg.Backup.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []backupSnapshot
+	for _, e := range entries {
+		if e.IsDir() || !backupNamePattern.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, backupSnapshot{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name > list[j].Name })
+	return list, nil
+}
+
+// pruneBackups 只保留最近 backup.keep 个快照
+func pruneBackups() error {
+	list, err := listBackups()
+	if err != nil {
+		return err
+	}
+	for i := cfg.Backup.Keep; i < len(list); i++ {
+		if err := os.Remove(filepath.Join(cfg.Backup.Dir, list[i].Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backupJob 定时任务：每隔 backup.interval 备份一次数据库，启动时不备份
+func backupJob() *scheduledJob {
+	j := &scheduledJob{
+		Name:     "backup",
+		Title:    "job.backup",
+		Interval: cfg.Backup.Interval,
+		Delay:    true,
+		Run: func() (string, error) {
+			name, err := createBackup()
+			if err != nil {
+				return "", err
+			}
+			return "已备份数据库: " + name, nil
+		},
+	}
+	switch {
+	case cfg.Backup.Interval <= 0:
+		j.Disabled = "job.disabled.backup_interval"
+	case !backupsSupported():
+		j.Disabled = "job.disabled.not_sqlite"
+	}
+	return j
+}
+
+// ---------- 页面 ----------
+
+// showBackups 快照列表：GET /admin/backups
+func showBackups(c *gin.Context) {
+	renderBackups(c, http.StatusOK, "")
+}
+
+func renderBackups(c *gin.Context, status int, errMsg string) {
+	list, err := listBackups()
+	if err != nil {
+		slog.Error("读取数据库快照失败", "err", err)
+	}
+	render(c, status, "backups.html", gin.H{
+		"title":     tr(c, "backups.title"),
+		"supported": backupsSupported(),
+		"backups":   list,
+		"interval":  cfg.Backup.Interval,
+		"keep":      cfg.Backup.Keep,
+		"error":     errMsg,
+		"restored":  c.Query("restored"),
+	})
+}
+
+// backupNow 立即备份：POST /admin/backups
+func backupNow(c *gin.Context) {
+	name, err := createBackup()
+	if err != nil {
+		slog.Error("备份数据库失败", "err", err)
+		renderBackups(c, http.StatusInternalServerError, "备份失败："+err.Error())
+		return
+	}
+	slog.Info("已备份数据库", "file", name)
+	c.Redirect(http.StatusFound, "/admin/backups")
+}
+
+// downloadBackup 下载快照：GET /admin/backups/:name，name 为 latest 时下载最新的一个
+func downloadBackup(c *gin.Context) {
+	name := c.Param("name")
+	if name == "latest" {
+		list, err := listBackups()
+		if err != nil || len(list) == 0 {
+			c.String(http.StatusNotFound, tr(c, "error.no_backups"))
+			return
+		}
+		name = list[0].Name
+	}
+	if !backupNamePattern.MatchString(name) {
+		c.String(http.StatusNotFound, tr(c, "error.backup_not_found"))
+		return
+	}
+	path := filepath.Join(cfg.Backup.Dir, name)
+	if _, err := os.Stat(path); err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.backup_not_found"))
+		return
+	}
+	c.FileAttachment(path, name)
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 查询缓存 ====================
+
+// 首页景点列表、搜索结果和 API 列表每次请求都要按排序查一遍所有景点。配置了 cache.driver 后，
+// 查询结果（不是渲染好的页面，页面里有当前用户、CSRF 令牌等每个人不一样的内容）按查询参数缓存 cache.ttl，
+// 同样的筛选条件在缓存期间不再查数据库。景点详情（页面和 API）也按 slug / ID 缓存，管理员看的不缓存。
+//
+//	redis   多个实例共用，见 redis.go
+//	memory  存在进程内存里，只有一个实例时不需要 Redis
+//
+// 失效：缓存的键里带着一个“版本号”，景点、标签、图片、排序设置有任何增删改（在 GORM 的回调里判断，
+// 推荐、评分、收藏这些直接用 SQL 更新计数的也算），版本号加一，之前的缓存就都用不上了，到期后自动删除。
+// GORM 的回调在事务提交之前执行，这时别的请求还可能把旧数据写回缓存，
+// 所以新增、修改、删除、推荐等操作成功后写操作日志时（writeAudit）再让缓存失效一次。
+// 多个实例共用一个 Redis 时，一个实例上的修改对所有实例生效。
+// 缓存服务出错时直接查数据库，不影响页面，只记日志。
+
+// cacheStore 缓存的存储
+type cacheStore interface {
+	// Get 取值，键不存在时返回 errCacheMiss
+	Get(key string) ([]byte, error)
+	// Set 设置值和过期时间
+	Set(key string, value []byte, ttl time.Duration) error
+	// Incr 计数加一，返回加之后的值，键不存在时从 0 开始
+	Incr(key string) (int64, error)
+}
+
+// errCacheMiss 缓存里没有
+var errCacheMiss = errors.New("cache miss")
+
+const cacheVersionKey = "spots:version"
+
+// queryCache 当前使用的查询缓存，没有启用时为 nil，由 initCache 设置
+var queryCache *spotCache
+
+// spotCache 景点查询结果的缓存
+type spotCache struct {
+	store  cacheStore
+	prefix string
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	lastError time.Time // 上一次记缓存出错日志的时间，缓存服务不可用时每分钟只记一条
+}
+
+// initCache 按配置创建查询缓存
+func initCache() error {
+	var store cacheStore
+	prefix := ""
+	switch cfg.Cache.Driver {
+	case "", "none":
+		return nil
+	case "memory":
+		store = newMemoryStore(cfg.Cache.Memory.MaxEntries)
+	case "redis":
+		r := &redisStore{newRedisClient(cfg.Cache.Redis.Addr, cfg.Cache.Redis.Password, cfg.Cache.Redis.DB)}
+		// 启动时连不上只是警告：缓存不是必需的，Redis 恢复后自动开始使用
+		if err := r.client.Ping(); err != nil {
+			slog.Warn("连接 Redis 失败，暂时不使用缓存", "addr", cfg.Cache.Redis.Addr, "err", err)
+		}
+		store = r
+		prefix = cfg.Cache.Redis.Prefix
+	default:
+		return fmt.Errorf("不支持的缓存方式 %q（可选 none / memory / redis）", cfg.Cache.Driver)
+	}
+	queryCache = &spotCache{store: store, prefix: prefix, ttl: cfg.Cache.TTL}
+	slog.Info("查询缓存", "driver", cfg.Cache.Driver, "ttl", cfg.Cache.TTL)
+	return nil
+}
+
+// version 当前的版本号，取不到时返回 false
+func (s *spotCache) version() (string, bool) {
+	v, err := s.store.Get(s.prefix + cacheVersionKey)
+	if errors.Is(err, errCacheMiss) {
+		return "0", true
+	}
+	if err != nil {
+		s.logError(err)
+		return "", false
+	}
+	return string(v), true
+}
+
+// get 读取缓存，解码到 dst，没有缓存或者出错时返回 false
+func (s *spotCache) get(key string, dst interface{}) bool {
+	data, err := s.store.Get(key)
+	if err != nil {
+		if !errors.Is(err, errCacheMiss) {
+			s.logError(err)
+			cacheRequests.inc("error")
+		} else {
+			cacheRequests.inc("miss")
+		}
+		return false
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(dst); err != nil {
+		// 多半是升级后结构变了，当作没有缓存
+		cacheRequests.inc("miss")
+		return false
+	}
+	cacheRequests.inc("hit")
+	return true
+}
+
+// set 写入缓存，出错只记日志
+func (s *spotCache) set(key string, value interface{}) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		slog.Error("编码缓存内容失败", "err", err)
+		return
+	}
+	if err := s.store.Set(key, buf.Bytes(), s.ttl); err != nil {
+		s.logError(err)
+	}
+}
+
+// invalidate 版本号加一，之前的缓存都失效；没有启用缓存时什么也不做
+func (s *spotCache) invalidate() {
+	if s == nil {
+		return
+	}
+	if _, err := s.store.Incr(s.prefix + cacheVersionKey); err != nil {
+		s.logError(err)
+	}
+}
+
+func (s *spotCache) logError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.lastError) < time.Minute {
+		return
+	}
+	s.lastError = time.Now()
+	slog.Warn("缓存服务出错，直接查询数据库", "driver", cfg.Cache.Driver, "err", err)
+}
+
+// key 当前版本下的缓存键，缓存服务出错时返回 false
+func (s *spotCache) key(kind, id string) (string, bool) {
+	version, ok := s.version()
+	if !ok {
+		return "", false
+	}
+	return s.prefix + "spots:" + version + ":" + kind + ":" + id, true
+}
+
+// cachedSpots 按页面类型和查询参数缓存景点列表，没有启用缓存或者缓存里没有时调用 load 查询
+func cachedSpots(c *gin.Context, kind string, load func() []Spot) []Spot {
+	s := queryCache
+	if s == nil {
+		return load()
+	}
+	// 查询参数编码时按名字排好序，顺序不同的同一组条件是同一个键
+	key, ok := s.key(kind, c.Request.URL.Query().Encode())
+	if !ok {
+		return load()
+	}
+	var spots []Spot
+	if s.get(key, &spots) {
+		return spots
+	}
+	spots = load()
+	s.set(key, spots)
+	return spots
+}
+
+// cachedSpot 按页面类型和 slug / ID 缓存一个景点，查询出错（找不到等）时不缓存
+func cachedSpot(kind, id string, load func() (*Spot, error)) (*Spot, error) {
+	s := queryCache
+	if s == nil {
+		return load()
+	}
+	key, ok := s.key(kind, id)
+	if !ok {
+		return load()
+	}
+	var spot Spot
+	if s.get(key, &spot) {
+		return &spot, nil
+	}
+	found, err := load()
+	if err == nil {
+		s.set(key, found)
+	}
+	return found, err
+}
+
+// ---------- 进程内存 ----------
+
+// memoryStore 把缓存存在进程内存里，条目数有上限，过期的每分钟清理一次。
+// 取出的值和 Redis 一样是编码后的字节，调用方拿到的是副本，改了也不影响缓存
+type memoryStore struct {
+	mu         sync.Mutex
+	items      map[string]memoryItem
+	maxEntries int
+}
+
+type memoryItem struct {
+	value   []byte
+	expires time.Time // 零值表示不过期（版本号）
+}
+
+func newMemoryStore(maxEntries int) *memoryStore {
+	m := &memoryStore{items: map[string]memoryItem{}, maxEntries: maxEntries}
+	go m.cleanup()
+	return m
+}
+
+func (m *memoryStore) Get(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	it, ok := m.items[key]
+	if !ok || (!it.expires.IsZero() && time.Now().After(it.expires)) {
+		return nil, errCacheMiss
+	}
+	return it.value, nil
+}
+
+func (m *memoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[key]; !ok && len(m.items) >= m.maxEntries {
+		m.evict()
+	}
+	m.items[key] = memoryItem{value: value, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *memoryStore) Incr(key string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, _ := strconv.ParseInt(string(m.items[key].value), 10, 64)
+	n++
+	m.items[key] = memoryItem{value: []byte(strconv.FormatInt(n, 10))}
+	return n, nil
+}
+
+// evict 满了：先删过期的，还是满的话随便删掉一批（map 的遍历顺序是随机的），调用时要持有锁
+func (m *memoryStore) evict() {
+	now := time.Now()
+	for k, it := range m.items {
+		if !it.expires.IsZero() && now.After(it.expires) {
+			delete(m.items, k)
+		}
+	}
+	for k, it := range m.items {
+		if len(m.items) < m.maxEntries*9/10 {
+			break
+		}
+		if !it.expires.IsZero() {
+			delete(m.items, k)
+		}
+	}
+}
+
+// cleanup 每分钟删掉过期的条目，版本号变了之后旧的缓存不会再被读到，靠这里释放内存
+func (m *memoryStore) cleanup() {
+	for range time.Tick(time.Minute) {
+		m.mu.Lock()
+		now := time.Now()
+		for k, it := range m.items {
+			if !it.expires.IsZero() && now.After(it.expires) {
+				delete(m.items, k)
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// ---------- Redis ----------
+
+// redisStore 用 Redis 存缓存
+type redisStore struct {
+	client *redisClient
+}
+
+func (r *redisStore) Get(key string) ([]byte, error) {
+	v, err := r.client.Get(key)
+	if errors.Is(err, errRedisNil) {
+		return nil, errCacheMiss
+	}
+	return v, err
+}
+
+func (r *redisStore) Set(key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(key, value, ttl)
+}
+
+func (r *redisStore) Incr(key string) (int64, error) {
+	return r.client.Incr(key)
+}
+
+// ---------- 失效 ----------
+
+// cachedTables 这些表有增删改时缓存失效
+var cachedTables = map[string]bool{
+	"spots":       true,
+	"tags":        true,
+	"spot_tags":   true,
+	"spot_images": true,
+	"settings":    true, // 首页默认排序
+}
+
+// cacheInvalidation GORM 插件：cachedTables 里的表有增删改时让缓存失效
+type cacheInvalidation struct{}
+
+func (cacheInvalidation) Name() string { return "cache" }
+
+func (cacheInvalidation) Initialize(db *gorm.DB) error {
+	after := func(tx *gorm.DB) {
+		if queryCache == nil || tx.Error != nil {
+			return
+		}
+		if cachedTables[tx.Statement.Table] || cachedTables[modifiedTable(tx.Statement.SQL.String())] {
+			queryCache.invalidate()
+		}
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().After("gorm:create").Register("cache:after_create", after),
+		cb.Update().After("gorm:update").Register("cache:after_update", after),
+		cb.Delete().After("gorm:delete").Register("cache:after_delete", after),
+		cb.Raw().After("gorm:raw").Register("cache:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// modifiedTable 直接执行的 SQL（UPDATE spots SET ...）修改的表名，不是增删改时返回空
+func modifiedTable(sql string) string {
+	fields := strings.Fields(strings.ToLower(sql))
+	var name string
+	switch {
+	case len(fields) >= 2 && fields[0] == "update":
+		name = fields[1]
+	case len(fields) >= 3 && (fields[0] == "insert" || fields[0] == "delete") &&
+		(fields[1] == "into" || fields[1] == "from"):
+		name = fields[2]
+	}
+	if unquoted, err := strconv.Unquote(name); err == nil {
+		return unquoted
+	}
+	return strings.Trim(name, "`")
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 验证码 ====================
+
+// 未登录访客在首页添加景点时需要先通过验证码，防止机器人批量提交。用哪种验证码由 captcha.provider 决定：
+//
+//	math       默认，内置的算术题，不依赖外部服务
+//	hcaptcha   hCaptcha，需要 site_key / secret_key
+//	turnstile  Cloudflare Turnstile，需要 site_key / secret_key
+//	none       不使用验证码
+//
+// 登录用户不需要验证码。hCaptcha 和 Turnstile 要加载外部脚本，需要在 security_headers 的 CSP 里放开对应的域名。
+
+// errCaptcha 验证码没有通过
+var errCaptcha = errors.New("captcha failed")
+
+// captchaProvider 验证码的实现
+type captchaProvider interface {
+	// Challenge 生成表单里显示的验证码
+	Challenge() *captchaChallenge
+	// Verify 校验表单里提交的答案，没有通过时返回 errCaptcha，调用验证服务失败时返回其他错误
+	Verify(c *gin.Context) error
+}
+
+// captchaChallenge 模板里显示验证码需要的数据，Provider 决定显示哪种控件
+type captchaChallenge struct {
+	Provider string
+	SiteKey  string // hcaptcha / turnstile
+	Question string // math：题目，如 3 + 5 = ?
+	Token    string // math：签名后的题目，和答案一起提交
+}
+
+// captcha 当前使用的验证码，为 nil 时不需要验证码，由 initCaptcha 设置
+var captcha captchaProvider
+
+// initCaptcha 根据配置创建验证码
+func initCaptcha() error {
+	c := cfg.Captcha
+	switch c.Provider {
+	case "none":
+		captcha = nil
+	case "", "math":
+		captcha = newMathCaptcha()
+	case "hcaptcha":
+		captcha = &siteverifyCaptcha{
+			provider:  "hcaptcha",
+			verifyURL: "https://api.hcaptcha.com/siteverify",
+			field:     "h-captcha-response",
+			siteKey:   c.SiteKey,
+			secret:    c.SecretKey,
+		}
+	case "turnstile":
+		captcha = &siteverifyCaptcha{
+			provider:  "turnstile",
+			verifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+			field:     "cf-turnstile-response",
+			siteKey:   c.SiteKey,
+			secret:    c.SecretKey,
+		}
+	default:
+		return fmt.Errorf("不支持的验证码 %q（可选 math / hcaptcha / turnstile / none）", c.Provider)
+	}
+	if s, ok := captcha.(*siteverifyCaptcha); ok && (s.siteKey == "" || s.secret == "") {
+		return fmt.Errorf("%s 需要配置 site_key 和 secret_key", s.provider)
+	}
+	slog.Info("验证码", "provider", c.Provider)
+	return nil
+}
+
+// captchaRequired 当前访客提交表单时是否需要验证码
+func captchaRequired(c *gin.Context) bool {
+	return captcha != nil && currentUser(c) == nil
+}
+
+// newCaptchaChallenge 给当前访客生成验证码，不需要时返回 nil（模板里就不显示）
+func newCaptchaChallenge(c *gin.Context) *captchaChallenge {
+	if !captchaRequired(c) {
+		return nil
+	}
+	return captcha.Challenge()
+}
+
+// verifyCaptcha 校验当前请求的验证码，不需要验证码时直接通过
+func verifyCaptcha(c *gin.Context) error {
+	if !captchaRequired(c) {
+		return nil
+	}
+	return captcha.Verify(c)
+}
+
+// ---------- 内置算术题 ----------
+
+// 题目和答案不存在服务端：表单里带着 过期时间.随机数.签名，签名里包含答案，
+// 提交时用访客填写的答案重新计算签名。用过的题目记下来，过期前不能再用。
+
+const mathCaptchaTTL = 10 * time.Minute // 题目的有效期
+
+type mathCaptcha struct {
+	key []byte // 签名密钥，每次启动随机生成
+
+	mu   sync.Mutex
+	used map[string]time.Time // 已经用过的题目 → 过期时间
+}
+
+func newMathCaptcha() *mathCaptcha {
+	return &mathCaptcha{key: []byte(randomToken(32)), used: map[string]time.Time{}}
+}
+
+func (m *mathCaptcha) sign(payload string, answer int) string {
+	mac := hmac.New(sha256.New, m.key)
+	fmt.Fprintf(mac, "%s.%d", payload, answer)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// randIntn 0 ~ n-1 的随机数
+func randIntn(n int) int {
+	v, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		fatal("无法生成随机数", "err", err)
+	}
+	return int(v.Int64())
+}
+
+// Challenge 出一道 20 以内的加减法或 10 以内的乘法
+func (m *mathCaptcha) Challenge() *captchaChallenge {
+	a, b := randIntn(20)+1, randIntn(20)+1
+	var question string
+	var answer int
+	switch randIntn(3) {
+	case 0:
+		question, answer = fmt.Sprintf("%d + %d = ?", a, b), a+b
+	case 1:
+		if a < b {
+			a, b = b, a
+		}
+		question, answer = fmt.Sprintf("%d - %d = ?", a, b), a-b
+	default:
+		a, b = a%9+1, b%9+1
+		question, answer = fmt.Sprintf("%d × %d = ?", a, b), a*b
+	}
+	payload := strconv.FormatInt(time.Now().Add(mathCaptchaTTL).Unix(), 10) + "." + randomToken(8)
+	return &captchaChallenge{
+		Provider: "math",
+		Question: question,
+		Token:    payload + "." + m.sign(payload, answer),
+	}
+}
+
+// Verify 表单字段 captcha_token 和 captcha_answer
+func (m *mathCaptcha) Verify(c *gin.Context) error {
+	token := c.PostForm("captcha_token")
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return errCaptcha
+	}
+	payload, sig := token[:i], token[i+1:]
+	expires, err := strconv.ParseInt(strings.SplitN(payload, ".", 2)[0], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return errCaptcha
+	}
+	answer, err := strconv.Atoi(strings.TrimSpace(c.PostForm("captcha_answer")))
+	if err != nil || !hmac.Equal([]byte(sig), []byte(m.sign(payload, answer))) {
+		return errCaptcha
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.used[payload]; ok {
+		return errCaptcha
+	}
+	now := time.Now()
+	for k, exp := range m.used {
+		if now.After(exp) {
+			delete(m.used, k)
+		}
+	}
+	m.used[payload] = time.Unix(expires, 0)
+	return nil
+}
+
+// ---------- hCaptcha / Turnstile ----------
+
+// 两者的接口一样：页面上的控件把令牌放进表单字段 field，服务端带着密钥调用 siteverify 校验
+
+type siteverifyCaptcha struct {
+	provider  string
+	verifyURL string
+	field     string // 控件提交令牌的表单字段
+	siteKey   string
+	secret    string
+}
+
+// captchaClient 调用验证服务用的 HTTP 客户端
+var captchaClient = &http.Client{Timeout: 10 * time.Second}
+
+func (s *siteverifyCaptcha) Challenge() *captchaChallenge {
+	return &captchaChallenge{Provider: s.provider, SiteKey: s.siteKey}
+}
+
+func (s *siteverifyCaptcha) Verify(c *gin.Context) error {
+	response := c.PostForm(s.field)
+	if response == "" {
+		return errCaptcha
+	}
+	resp, err := captchaClient.PostForm(s.verifyURL, url.Values{
+		"secret":   {s.secret},
+		"response": {response},
+		"remoteip": {c.ClientIP()},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%s 返回格式错误: %w", s.provider, err)
+	}
+	if !result.Success {
+		return errCaptcha
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==================== 打卡 ====================
+
+// 登录用户可以标记去过的景点（可以填游玩日期和备注），在 /visited 查看自己的足迹。
+// 每个用户对每个景点只有一条打卡记录，再次打卡时修改日期和备注。
+// “N 人来过”存在 spots.checkin_count 里，打卡变化时重新统计。
+
+const maxCheckinNote = 500
+
+// CheckIn 打卡记录
+type CheckIn struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	UserID    uint      `gorm:"uniqueIndex:idx_checkin_user_spot" json:"-"`
+	SpotID    uint      `gorm:"uniqueIndex:idx_checkin_user_spot;index" json:"spot_id"`
+	VisitedOn string    `gorm:"size:10" json:"visited_on"` // 游玩日期，如 2026-10-01
+	Note      string    `gorm:"type:text" json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+var (
+	errVisitedOn   = errors.New("游玩日期格式应为 2026-10-01，且不能晚于今天")
+	errCheckinNote = errors.New("备注不能超过500个字符")
+)
+
+// checkinInput 打卡时提交的字段，都可以不填，日期默认是今天
+type checkinInput struct {
+	VisitedOn string `json:"visited_on" form:"visited_on"`
+	Note      string `json:"note" form:"note"`
+}
+
+// valid 检查日期和备注，没有填日期时用今天（按配置的时区）
+func (in *checkinInput) valid() error {
+	today := time.Now().In(timezone).Format("2006-01-02")
+	in.VisitedOn = strings.TrimSpace(in.VisitedOn)
+	if in.VisitedOn == "" {
+		in.VisitedOn = today
+	}
+	if _, err := time.Parse("2006-01-02", in.VisitedOn); err != nil || in.VisitedOn > today {
+		return errVisitedOn
+	}
+	in.Note = sanitizeText(in.Note)
+	if utf8.RuneCountInString(in.Note) > maxCheckinNote {
+		return errCheckinNote
+	}
+	return nil
+}
+
+// checkinSpot 打卡（已经打过卡时修改日期和备注），返回更新后的景点（含打卡人数）
+func checkinSpot(user *User, id string, in checkinInput) (Spot, error) {
+	var spot Spot
+	if user == nil {
+		return spot, errLoginRequired
+	}
+	spotID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return spot, gorm.ErrRecordNotFound
+	}
+	if err := in.valid(); err != nil {
+		return spot, err
+	}
+
+	err = retryTransaction(db, func(tx *gorm.DB) error {
+		if err := tx.Scopes(published).Select("id").First(&spot, spotID).Error; err != nil {
+			return err
+		}
+		checkin := CheckIn{UserID: user.ID, SpotID: uint(spotID), VisitedOn: in.VisitedOn, Note: in.Note}
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "spot_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"visited_on", "note", "updated_at"}),
+		}).Create(&checkin).Error; err != nil {
+			return err
+		}
+		return updateCheckinCount(tx, &spot)
+	})
+	return spot, err
+}
+
+// undoCheckin 取消打卡，没有打过卡也不算错误
+func undoCheckin(user *User, id string) (Spot, error) {
+	var spot Spot
+	if user == nil {
+		return spot, errLoginRequired
+	}
+	err := retryTransaction(db, func(tx *gorm.DB) error {
+		if err := tx.Scopes(published).Select("id").First(&spot, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND spot_id = ?", user.ID, spot.ID).Delete(&CheckIn{}).Error; err != nil {
+			return err
+		}
+		return updateCheckinCount(tx, &spot)
+	})
+	return spot, err
+}
+
+// updateCheckinCount 重新统计景点的打卡人数，并读回 spot
+func updateCheckinCount(tx *gorm.DB, spot *Spot) error {
+	if err := tx.Exec(`UPDATE spots SET checkin_count =
+		(SELECT COUNT(*) FROM check_ins WHERE check_ins.spot_id = spots.id) WHERE id = ?`, spot.ID).Error; err != nil {
+		return err
+	}
+	return tx.Select("id", "checkin_count").First(spot, spot.ID).Error
+}
+
+// myCheckin 当前用户在这个景点的打卡，没有登录或没有打卡时为 nil
+func myCheckin(c *gin.Context, spotID uint) *CheckIn {
+	user := currentUser(c)
+	if user == nil {
+		return nil
+	}
+	var checkin CheckIn
+	if err := dbFor(c).Where("user_id = ? AND spot_id = ?", user.ID, spotID).First(&checkin).Error; err != nil {
+		return nil
+	}
+	return &checkin
+}
+
+// visitedItem 足迹里的一条：景点和打卡信息
+type visitedItem struct {
+	Spot    Spot    `json:"spot"`
+	CheckIn CheckIn `json:"checkin"`
+}
+
+// userCheckins 用户去过的已发布景点，按游玩日期从近到远
+func userCheckins(userID uint) []visitedItem {
+	var checkins []CheckIn
+	db.Joins("JOIN spots ON spots.id = check_ins.spot_id AND spots.deleted_at IS NULL").
+		Where("check_ins.user_id = ? AND spots.status = ?", userID, SpotPublished).
+		Order("check_ins.visited_on desc, check_ins.id desc").Find(&checkins)
+	if len(checkins) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(checkins))
+	for i, ck := range checkins {
+		ids[i] = ck.SpotID
+	}
+	var spots []Spot
+	db.Preload("Tags").Where("id IN ?", ids).Find(&spots)
+	byID := make(map[uint]Spot, len(spots))
+	for _, s := range spots {
+		byID[s.ID] = s
+	}
+	items := make([]visitedItem, 0, len(checkins))
+	for _, ck := range checkins {
+		items = append(items, visitedItem{Spot: byID[ck.SpotID], CheckIn: ck})
+	}
+	return items
+}
+
+// checkinForm 打卡：POST /checkin/:id，表单字段 visited_on、note 都可以不填
+// 未登录时跳转到登录页，完成后回到 next 指定的页面
+func checkinForm(c *gin.Context) {
+	var in checkinInput
+	c.ShouldBind(&in)
+	spot, err := checkinSpot(currentUser(c), c.Param("id"), in)
+	checkinFormResult(c, spot, err)
+}
+
+// undoCheckinForm 取消打卡：POST /checkin/:id/undo
+func undoCheckinForm(c *gin.Context) {
+	spot, err := undoCheckin(currentUser(c), c.Param("id"))
+	checkinFormResult(c, spot, err)
+}
+
+func checkinFormResult(c *gin.Context, spot Spot, err error) {
+	if wantsJSON(c) {
+		checkinResponse(c, spot, err)
+		return
+	}
+	next := safeNext(c.PostForm("next"))
+	switch {
+	case errors.Is(err, errLoginRequired):
+		c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(next))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.String(http.StatusNotFound, tr(c, "error.spot_id_not_found", c.Param("id")))
+	case errors.Is(err, errVisitedOn), errors.Is(err, errCheckinNote):
+		c.String(http.StatusBadRequest, err.Error())
+	case err != nil:
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+	default:
+		c.Redirect(http.StatusFound, next)
+	}
+}
+
+// showVisited 我的足迹：GET /visited
+func showVisited(c *gin.Context) {
+	if !loginFirst(c, "/visited") {
+		return
+	}
+	items := userCheckins(currentUser(c).ID)
+	render(c, http.StatusOK, "visited.html", gin.H{
+		"title": tr(c, "nav.visited"),
+		"items": items,
+	})
+}
+
+// apiListCheckins 当前用户的足迹：GET /api/v1/checkins
+func apiListCheckins(c *gin.Context) {
+	items := userCheckins(currentUser(c).ID)
+	if items == nil {
+		items = []visitedItem{}
+	}
+	c.JSON(http.StatusOK, gin.H{"checkins": items})
+}
+
+// apiCheckinSpot 打卡：POST /api/v1/spots/:id/checkin，请求体 {"visited_on": "2026-10-01", "note": "..."}，可以为空
+func apiCheckinSpot(c *gin.Context) {
+	var in checkinInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&in); err != nil {
+			apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+			return
+		}
+	}
+	spot, err := checkinSpot(currentUser(c), c.Param("id"), in)
+	checkinResponse(c, spot, err)
+}
+
+// apiUndoCheckin 取消打卡：POST /api/v1/spots/:id/checkin/undo
+func apiUndoCheckin(c *gin.Context) {
+	spot, err := undoCheckin(currentUser(c), c.Param("id"))
+	checkinResponse(c, spot, err)
+}
+
+// checkinResponse 把打卡的结果转成 JSON 响应
+func checkinResponse(c *gin.Context, spot Spot, err error) {
+	switch {
+	case errors.Is(err, errLoginRequired):
+		apiError(c, http.StatusUnauthorized, tr(c, "error.login_required"))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+	case errors.Is(err, errVisitedOn), errors.Is(err, errCheckinNote):
+		apiError(c, http.StatusBadRequest, err.Error())
+	case err != nil:
+		apiError(c, http.StatusInternalServerError, tr(c, "error.action_failed"))
+	default:
+		c.JSON(http.StatusOK, gin.H{"id": spot.ID, "checkin_count": spot.CheckinCount})
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 评论 ====================
+
+// 访客在详情页分享游玩体验。登录用户以用户名发表，未登录时填写昵称（不填显示为“游客”）；
+// 评论按时间倒序分页显示，管理员可以删除。
+// 评论可以回复，回复按时间顺序嵌套显示在被回复的评论下面。同一个讨论串里的评论都记录了
+// 第一条评论的ID（RootID），一次查询就能取出整串。嵌套层数由 comments.max_depth 限制，
+// 超过的回复和被回复的评论显示在同一层（数据库里仍然记录真实的 ParentID，调整配置后重新按层数显示）。
+
+const (
+	commentPageSize  = 20   // 每页评论数
+	maxCommentLength = 2000 // 评论最多的字符数
+	maxAuthorLength  = 30   // 昵称最多的字符数
+)
+
+// Comment 评论
+type Comment struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SpotID    uint      `gorm:"index" json:"spot_id"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"` // 回复的评论，nil 表示不是回复
+	RootID    *uint     `gorm:"index" json:"-"`         // 讨论串的第一条评论，nil 表示自己就是第一条
+	UserID    *uint     `json:"-"`                      // 登录用户发表时记录，未登录为 nil
+	Author    string    `gorm:"size:50" json:"author"`
+	Body      string    `gorm:"type:text" json:"body"`
+	IP        string    `gorm:"size:45" json:"-"`
+	Status    string    `gorm:"size:20;index" json:"status"` // 审核状态，见 comment_moderation.go，只显示已通过的
+	CreatedAt time.Time `json:"created_at"`
+
+	Replies    []*Comment `gorm:"-" json:"replies,omitempty"`     // 嵌套的回复，查询时组装
+	ReplyCount int        `gorm:"-" json:"reply_count,omitempty"` // 讨论串里的回复总数（只有第一条评论有）
+}
+
+// commentPage 景点的一页评论，按讨论串分页
+type commentPage struct {
+	Comments []*Comment `json:"comments"`
+	Page     int        `json:"page,omitempty"`      // 游标分页时为 0
+	Total    int64      `json:"total"`               // 讨论串（不是回复的评论）数
+	Count    int64      `json:"count"`               // 包括回复在内的评论总数
+	PrevPage int        `json:"-"`                   // 第一页时为 0
+	NextPage int        `json:"next_page,omitempty"` // 没有下一页时为 0
+
+	NextCursor string `json:"next_cursor,omitempty"` // 游标分页时下一页的 after 参数，见 cursor.go
+}
+
+// commentKeys 讨论串的排序，新的在前
+var commentKeys = []sortKey{{"id", true}}
+
+// spotComments 取景点的第 page 页讨论串（从 1 开始），新的在前；
+// collapsed 为 true 时只返回每串的第一条评论和回复数，不带回复
+func spotComments(spotID uint, page int, collapsed bool) commentPage {
+	if page < 1 {
+		page = 1
+	}
+	p := commentPage{Comments: []*Comment{}, Page: page, PrevPage: page - 1}
+	visible := db.Model(&Comment{}).Where("spot_id = ? AND status = ?", spotID, CommentApproved)
+	visible.Count(&p.Count)
+	q := visible.Where("parent_id IS NULL")
+	q.Count(&p.Total)
+	var roots []Comment
+	q.Order("id desc").Limit(commentPageSize).Offset((page - 1) * commentPageSize).Find(&roots)
+	if int64(page*commentPageSize) < p.Total {
+		p.NextPage = page + 1
+	}
+	fillComments(&p, roots, collapsed)
+	return p
+}
+
+// spotCommentsAfter 游标分页取景点的讨论串，after 为空时是第一页
+func spotCommentsAfter(spotID uint, after string, limit int, collapsed bool) (commentPage, error) {
+	p := commentPage{Comments: []*Comment{}}
+	visible := db.Model(&Comment{}).Where("spot_id = ? AND status = ?", spotID, CommentApproved)
+	visible.Count(&p.Count)
+	q := visible.Where("parent_id IS NULL")
+	q.Count(&p.Total)
+	q, err := afterCursor(q, commentKeys, after)
+	if err != nil {
+		return p, err
+	}
+	var roots []Comment
+	q.Limit(limit + 1).Find(&roots)
+	if len(roots) > limit {
+		roots = roots[:limit]
+		if p.NextCursor, err = encodeCursor(&roots[limit-1], commentKeys); err != nil {
+			return p, err
+		}
+	}
+	fillComments(&p, roots, collapsed)
+	return p, nil
+}
+
+// fillComments 给一页讨论串加上回复（collapsed 时只加回复数），放到 p.Comments
+func fillComments(p *commentPage, roots []Comment, collapsed bool) {
+	if len(roots) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(roots))
+	for i, r := range roots {
+		ids[i] = r.ID
+	}
+	var replies []Comment
+	if !collapsed {
+		db.Where("root_id IN ? AND status = ?", ids, CommentApproved).Order("id").Find(&replies)
+	}
+	p.Comments = commentTree(roots, replies)
+	if collapsed {
+		var counts []struct {
+			RootID uint
+			N      int
+		}
+		db.Model(&Comment{}).Select("root_id, COUNT(*) AS n").Where("root_id IN ? AND status = ?", ids, CommentApproved).Group("root_id").Scan(&counts)
+		n := make(map[uint]int, len(counts))
+		for _, c := range counts {
+			n[c.RootID] = c.N
+		}
+		for _, r := range p.Comments {
+			r.ReplyCount = n[r.ID]
+		}
+	}
+}
+
+// commentTree 把回复挂到被回复的评论下面，返回 roots 对应的节点
+// replies 必须按ID从小到大排列（被回复的评论总在回复之前）；找不到被回复评论的忽略。
+// 超过 comments.max_depth 层的回复挂在被回复评论的上一层，和它显示在同一层
+func commentTree(roots, replies []Comment) []*Comment {
+	nodes := make(map[uint]*Comment, len(roots)+len(replies))
+	depth := make(map[uint]int, len(roots)+len(replies))
+	container := make(map[uint]*Comment, len(replies)) // 回复实际挂在哪条评论下面
+	out := make([]*Comment, len(roots))
+	for i := range roots {
+		out[i] = &roots[i]
+		nodes[roots[i].ID] = &roots[i]
+	}
+	for i := range replies {
+		r := &replies[i]
+		parent := nodes[*r.ParentID]
+		if parent == nil {
+			continue
+		}
+		d := depth[parent.ID] + 1
+		if d > cfg.Comments.MaxDepth {
+			parent, d = container[parent.ID], depth[parent.ID]
+		}
+		parent.Replies = append(parent.Replies, r)
+		nodes[r.ID], depth[r.ID], container[r.ID] = r, d, parent
+	}
+	for _, root := range out {
+		root.ReplyCount = countReplies(root)
+	}
+	return out
+}
+
+func countReplies(c *Comment) int {
+	n := len(c.Replies)
+	for _, r := range c.Replies {
+		n += countReplies(r)
+	}
+	return n
+}
+
+// pageParam 查询参数 page，不是正整数时为 1
+func pageParam(c *gin.Context) int {
+	page, _ := strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		return 1
+	}
+	return page
+}
+
+// newComment 清洗并校验评论，登录用户的昵称用用户名，审核状态见 newCommentStatus
+// parentID 不为 0 时是回复，被回复的评论必须属于同一个景点并且已经显示出来
+func newComment(c *gin.Context, spotID uint, parentID uint, author, body string) (Comment, string) {
+	comment := Comment{SpotID: spotID, Author: sanitizeText(author), Body: sanitizeText(body), IP: c.ClientIP(),
+		Status: newCommentStatus(c)}
+	if parentID != 0 {
+		var parent Comment
+		err := dbFor(c).Where("id = ? AND spot_id = ? AND status = ?", parentID, spotID, CommentApproved).First(&parent).Error
+		if err != nil {
+			return comment, "回复的评论不存在"
+		}
+		comment.ParentID = &parent.ID
+		comment.RootID = parent.RootID
+		if comment.RootID == nil {
+			comment.RootID = &parent.ID
+		}
+	}
+	if user := currentUser(c); user != nil {
+		comment.UserID = &user.ID
+		comment.Author = user.Username
+	}
+	if comment.Author == "" {
+		comment.Author = "游客"
+	}
+	switch {
+	case comment.Body == "":
+		return comment, "评论内容不能为空"
+	case utf8.RuneCountInString(comment.Body) > maxCommentLength:
+		return comment, "评论不能超过" + strconv.Itoa(maxCommentLength) + "个字符"
+	case utf8.RuneCountInString(comment.Author) > maxAuthorLength:
+		return comment, "昵称不能超过" + strconv.Itoa(maxAuthorLength) + "个字符"
+	}
+	return comment, ""
+}
+
+// addComment 发表评论：POST /spot/:slug/comments
+func addComment(c *gin.Context) {
+	spot, err := findSpot(c, c.Param("slug"))
+	if err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.spot_slug_not_found", c.Param("slug")))
+		return
+	}
+	parentID, _ := strconv.ParseUint(c.PostForm("parent_id"), 10, 64)
+	comment, msg := newComment(c, spot.ID, uint(parentID), c.PostForm("author"), c.PostForm("body"))
+	if msg != "" {
+		c.String(http.StatusBadRequest, msg)
+		return
+	}
+	if err := dbFor(c).Create(&comment).Error; err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	notifyComment(&comment, false)
+	next := "/spot/" + url.PathEscape(spot.Slug)
+	if comment.Status == CommentPending {
+		next += "?comment=pending"
+	}
+	c.Redirect(http.StatusFound, next+"#comments")
+}
+
+// deleteComment 删除评论和它下面的所有回复（管理员）：POST /admin/comments/:id/delete
+func deleteComment(c *gin.Context) {
+	var comment Comment
+	if err := dbFor(c).First(&comment, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.comment_not_found"))
+		return
+	}
+	ids := []uint{comment.ID}
+	for parents := ids; len(parents) > 0; {
+		var children []uint
+		dbFor(c).Model(&Comment{}).Where("parent_id IN ?", parents).Pluck("id", &children)
+		ids = append(ids, children...)
+		parents = children
+	}
+	dbFor(c).Where("id IN ?", ids).Delete(&Comment{})
+	c.Redirect(http.StatusFound, safeNext(c.PostForm("next")))
+}
+
+// ---------- 接口 ----------
+
+// apiListComments 景点的评论：GET /api/v1/spots/:id/comments?page=N，也可以用 ?limit=&after= 游标分页
+// collapsed=1 时折叠讨论串，只返回第一条评论和 reply_count，回复用 apiCommentReplies 展开
+func apiListComments(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).Scopes(published).First(&spot, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	collapsed := c.Query("collapsed") == "1"
+	if !wantsCursor(c) {
+		c.JSON(http.StatusOK, spotComments(spot.ID, pageParam(c), collapsed))
+		return
+	}
+	limit, ok := limitParam(c)
+	if !ok {
+		return
+	}
+	p, err := spotCommentsAfter(spot.ID, c.Query("after"), limit, collapsed)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// apiCommentReplies 展开一条评论下面的回复：GET /api/v1/comments/:id/replies
+func apiCommentReplies(c *gin.Context) {
+	var comment Comment
+	if err := dbFor(c).Where("status = ?", CommentApproved).First(&comment, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.comment_not_found"))
+		return
+	}
+	rootID := comment.ID
+	if comment.RootID != nil {
+		rootID = *comment.RootID
+	}
+	// 这条评论的回复都在同一个讨论串里，并且ID比它大
+	var thread []Comment
+	dbFor(c).Where("root_id = ? AND id > ? AND status = ?", rootID, comment.ID, CommentApproved).Order("id").Find(&thread)
+	node := commentTree([]Comment{comment}, thread)[0]
+	replies := node.Replies
+	if replies == nil {
+		replies = []*Comment{}
+	}
+	c.JSON(http.StatusOK, gin.H{"id": comment.ID, "replies": replies, "reply_count": node.ReplyCount})
+}
+
+// apiCreateComment 发表评论：POST /api/v1/spots/:id/comments，作者为当前用户
+func apiCreateComment(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).Scopes(published).First(&spot, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	var in struct {
+		ParentID uint   `json:"parent_id"` // 回复的评论，不传表示不是回复
+		Body     string `json:"body"`
+	}
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+		return
+	}
+	comment, msg := newComment(c, spot.ID, in.ParentID, "", in.Body)
+	if msg != "" {
+		apiError(c, http.StatusBadRequest, msg)
+		return
+	}
+	if err := dbFor(c).Create(&comment).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	notifyComment(&comment, false)
+	c.JSON(http.StatusCreated, comment)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 评论审核 ====================
+
+// comments.moderation 决定新评论什么时候显示：
+//   - post（默认）先发后审：评论直接显示，管理员发现问题后在 /admin/comments 驳回
+//   - pre  先审后发：评论进入待审核队列，管理员通过后才显示
+//
+// 管理员发表的评论总是直接通过。驳回的评论不删除，可以在审核页面重新通过；
+// 被驳回评论下面的回复也随之不显示。
+
+// 评论的审核状态
+const (
+	CommentPending  = "pending"  // 待审核
+	CommentApproved = "approved" // 已通过，显示在详情页
+	CommentRejected = "rejected" // 已驳回
+)
+
+// commentStatusLabels 审核页面显示的状态名称（locales/ 里的键），顺序即页面上的筛选顺序
+var commentStatusLabels = []struct{ Status, Label string }{
+	{CommentPending, "moderation.status.pending"},
+	{CommentApproved, "moderation.status.approved"},
+	{CommentRejected, "moderation.status.rejected"},
+}
+
+const moderationPageSize = 50
+
+// newCommentStatus 新评论的审核状态
+func newCommentStatus(c *gin.Context) string {
+	if cfg.Comments.Moderation == "pre" && !currentUser(c).IsAdmin() {
+		return CommentPending
+	}
+	return CommentApproved
+}
+
+// moderationItem 审核页面的一条评论，带上景点名称
+type moderationItem struct {
+	Comment
+	SpotName string
+	SpotSlug string
+}
+
+// showModeration 评论审核：GET /admin/comments?status=pending&page=N
+func showModeration(c *gin.Context) {
+	status := c.DefaultQuery("status", CommentPending)
+	page := pageParam(c)
+
+	q := dbFor(c).Model(&Comment{}).Where("comments.status = ?", status)
+	var total int64
+	q.Count(&total)
+	var items []moderationItem
+	q.Select("comments.*, spots.name AS spot_name, spots.slug AS spot_slug").
+		Joins("LEFT JOIN spots ON spots.id = comments.spot_id").
+		Order("comments.id desc").Limit(moderationPageSize).Offset((page - 1) * moderationPageSize).
+		Scan(&items)
+
+	nextPage := 0
+	if int64(page*moderationPageSize) < total {
+		nextPage = page + 1
+	}
+	var pending int64
+	dbFor(c).Model(&Comment{}).Where("status = ?", CommentPending).Count(&pending)
+	render(c, http.StatusOK, "comments.html", gin.H{
+		"title":      tr(c, "nav.admin.comments"),
+		"items":      items,
+		"statuses":   commentStatusLabels,
+		"status":     status,
+		"pending":    pending,
+		"moderation": cfg.Comments.Moderation,
+		"pageURL":    "/admin/comments?status=" + url.QueryEscape(status) + "&page=",
+		"prevPage":   page - 1,
+		"nextPage":   nextPage,
+	})
+}
+
+// approveComment 通过：POST /admin/comments/:id/approve
+func approveComment(c *gin.Context) {
+	setCommentStatus(c, CommentApproved)
+}
+
+// rejectComment 驳回：POST /admin/comments/:id/reject
+func rejectComment(c *gin.Context) {
+	setCommentStatus(c, CommentRejected)
+}
+
+func setCommentStatus(c *gin.Context, status string) {
+	var comment Comment
+	if err := dbFor(c).First(&comment, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.comment_not_found"))
+		return
+	}
+	if comment.Status != status {
+		if err := dbFor(c).Model(&comment).Update("status", status).Error; err != nil {
+			c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+			return
+		}
+		notifyComment(&comment, true)
+	}
+	c.Redirect(http.StatusFound, safeNext(c.PostForm("next")))
+}
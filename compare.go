@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 景点对比 ====================
+
+// GET /compare?ids=1,3,5 把几个景点的票价、交通、评分、推荐次数等放在一张表里对比，
+// 列的顺序和 ids 的顺序一致；不存在或未发布的景点直接跳过。
+
+const maxCompare = 4 // 最多同时对比的景点数
+
+var errTooManyCompare = fmt.Errorf("最多同时对比%d个景点", maxCompare)
+
+// parseCompareIDs 解析 ids 参数（逗号分隔），去掉重复的，保持原来的顺序
+func parseCompareIDs(s string) ([]uint, error) {
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil || id == 0 {
+			return nil, errors.New("ids 必须是逗号分隔的景点ID")
+		}
+		if seen[uint(id)] {
+			continue
+		}
+		seen[uint(id)] = true
+		ids = append(ids, uint(id))
+	}
+	if len(ids) > maxCompare {
+		return nil, errTooManyCompare
+	}
+	return ids, nil
+}
+
+// compareSpots 按 ids 的顺序查出要对比的已发布景点
+func compareSpots(ids []uint) []Spot {
+	if len(ids) == 0 {
+		return nil
+	}
+	var found []Spot
+	db.Scopes(published).Preload("Tags").Where("id IN ?", ids).Find(&found)
+	byID := make(map[uint]Spot, len(found))
+	for _, s := range found {
+		byID[s.ID] = s
+	}
+	spots := make([]Spot, 0, len(found))
+	for _, id := range ids {
+		if s, ok := byID[id]; ok {
+			spots = append(spots, s)
+		}
+	}
+	return spots
+}
+
+// compareIDsParam 对比页面里去掉或加入一个景点后的 ids 参数
+func compareIDsParam(spots []Spot, skip uint) string {
+	parts := make([]string, 0, len(spots))
+	for _, s := range spots {
+		if s.ID != skip {
+			parts = append(parts, strconv.FormatUint(uint64(s.ID), 10))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// showCompare 对比页面：GET /compare?ids=1,3,5，用 fetch 调用时返回 JSON
+func showCompare(c *gin.Context) {
+	ids, err := parseCompareIDs(c.Query("ids"))
+	if err != nil {
+		if wantsJSON(c) {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	spots := compareSpots(ids)
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, gin.H{"spots": spots})
+		return
+	}
+
+	// 还能加入对比的景点，页面底部的下拉框用
+	var choices []Spot
+	if len(spots) < maxCompare {
+		q := dbFor(c).Scopes(published).Select("id", "name").Order("name")
+		if len(spots) > 0 {
+			q = q.Where("id NOT IN ?", ids)
+		}
+		q.Find(&choices)
+	}
+	removeURLs := make(map[uint]string, len(spots))
+	for _, s := range spots {
+		removeURLs[s.ID] = "/compare?ids=" + compareIDsParam(spots, s.ID)
+	}
+	render(c, http.StatusOK, "compare.html", gin.H{
+		"title":      tr(c, "compare.title"),
+		"spots":      spots,
+		"ids":        compareIDsParam(spots, 0),
+		"removeURLs": removeURLs,
+		"choices":    choices,
+		"max":        maxCompare,
+	})
+}
+
+// apiCompareSpots 对比接口：GET /api/v1/spots/compare?ids=1,3,5
+func apiCompareSpots(c *gin.Context) {
+	ids, err := parseCompareIDs(c.Query("ids"))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(ids) == 0 {
+		apiError(c, http.StatusBadRequest, tr(c, "error.ids_missing"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"spots": compareSpots(ids)})
+}
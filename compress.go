@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 响应压缩 ====================
+
+// 浏览器在 Accept-Encoding 里声明支持 gzip 或 deflate 时，把页面、JSON、CSS 等文本内容压缩后再发送。
+// 响应先缓冲 compression.min_size 个字节：不到这个大小就结束的响应原样发送；
+// 超过后按 Content-Type 决定是否压缩，图片、压缩包、xlsx 等已经压缩过的内容原样发送。
+// 流式输出（导出 CSV 等）调用 Flush 时会把已经压缩的部分立即发出去。
+
+// compressibleTypes 值得压缩的内容类型，另外所有 text/* 和 +json、+xml 结尾的也压缩
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/javascript": true,
+	"application/xml":        true,
+	"application/x-ndjson":   true,
+	"image/svg+xml":          true,
+}
+
+// compressible 判断这种内容类型是否值得压缩
+func compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mt, "text/") || compressibleTypes[mt] ||
+		strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml")
+}
+
+// negotiateEncoding 从 Accept-Encoding 里选压缩方式，优先 gzip，都不支持时返回空
+func negotiateEncoding(header string) string {
+	accepted := map[string]bool{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		accepted[name] = true
+	}
+	switch {
+	case accepted["gzip"], accepted["*"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	}
+	return ""
+}
+
+// 复用压缩器，压缩器内部的缓冲区不小，每个请求新建一个开销大
+var (
+	gzipWriters sync.Pool
+	zlibWriters sync.Pool
+)
+
+// compressResponses 按 Accept-Encoding 压缩响应
+func compressResponses() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		// HEAD 没有响应体；Range 请求的字节范围是对原始内容的，压缩后就对不上了
+		if encoding == "" || c.Request.Method == http.MethodHead || c.GetHeader("Range") != "" {
+			c.Next()
+			return
+		}
+		w := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = w
+		c.Next()
+		w.close()
+		c.Writer = w.ResponseWriter
+	}
+}
+
+// compressWriter 缓冲响应的开头，决定是否压缩后再写出
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	buf      bytes.Buffer
+	decided  bool           // 是否已经决定了压缩与否
+	enc      io.WriteCloser // 压缩时的压缩器，不压缩时为 nil
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf.Write(p)
+		if w.buf.Len() < cfg.Compression.MinSize {
+			return len(p), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 还没决定是否压缩时不发送响应头，等决定后再发（要先加上 Content-Encoding）
+func (w *compressWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Written 缓冲里有内容就算已经开始输出
+func (w *compressWriter) Written() bool {
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Flush 流式输出时不再等缓冲满，直接决定是否压缩并把已有的内容发出去
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide 决定是否压缩，写出响应头和缓冲的内容；large 为 false 表示整个响应不到 min_size
+func (w *compressWriter) decide(large bool) error {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && w.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+	ok := compressible(h.Get("Content-Type"))
+	if ok {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	status := w.Status()
+	if ok && large && h.Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified && status != http.StatusPartialContent {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		// 内容变了，强校验的 ETag 不能再用，改成弱校验
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.enc = newCompressor(w.encoding, w.ResponseWriter)
+	}
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if w.enc != nil {
+		_, err = w.enc.Write(w.buf.Bytes())
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+	return err
+}
+
+// close 响应结束：把没写出的内容写出去，压缩时结束压缩流并把压缩器放回池里
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+		w.ResponseWriter.WriteHeaderNow()
+	}
+	if w.enc == nil {
+		return
+	}
+	w.enc.Close()
+	switch enc := w.enc.(type) {
+	case *gzip.Writer:
+		gzipWriters.Put(enc)
+	case *zlib.Writer:
+		zlibWriters.Put(enc)
+	}
+}
+
+// newCompressor 从池里取一个压缩器，输出到 dst。
+// HTTP 的 deflate 指的是 zlib 格式（RFC 1950，带头部和校验和），不是裸的 deflate 数据，所以用 compress/zlib
+func newCompressor(encoding string, dst io.Writer) io.WriteCloser {
+	if encoding == "deflate" {
+		if zw, ok := zlibWriters.Get().(*zlib.Writer); ok {
+			zw.Reset(dst)
+			return zw
+		}
+		zw, _ := zlib.NewWriterLevel(dst, cfg.Compression.Level)
+		return zw
+	}
+	if gw, ok := gzipWriters.Get().(*gzip.Writer); ok {
+		gw.Reset(dst)
+		return gw
+	}
+	gw, _ := gzip.NewWriterLevel(dst, cfg.Compression.Level)
+	return gw
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 跨域（CORS） ====================
+
+// 其他网站的前端用 fetch 调用 /api/v1 时，浏览器要求响应里有 Access-Control-Allow-Origin 等响应头，否则拦下响应。
+// 只有 cors.allowed_origins 里的来源可以跨域调用；带 Authorization、X-API-Key 等请求头或者 PUT / DELETE 时，
+// 浏览器先发一个 OPTIONS 预检请求，这里直接回答允许的方法和请求头，不再往下处理。
+// 页面（表单、登录）不开放跨域，只对 API 路由组生效。
+
+// corsMiddleware 按 cfg.CORS 处理跨域请求
+func corsMiddleware() gin.HandlerFunc {
+	conf := cfg.CORS
+	allowAll := false
+	origins := map[string]bool{}
+	for _, o := range conf.AllowedOrigins {
+		if o == "*" {
+			allowAll = true
+		}
+		origins[strings.ToLower(strings.TrimSuffix(o, "/"))] = true
+	}
+	methods := strings.Join(conf.AllowedMethods, ", ")
+	headers := strings.Join(conf.AllowedHeaders, ", ")
+	exposed := strings.Join(conf.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(conf.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		// 不同来源的响应头不一样，缓存要按 Origin 区分
+		c.Writer.Header().Add("Vary", "Origin")
+		origin := c.GetHeader("Origin")
+		if origin == "" || (!allowAll && !origins[strings.ToLower(origin)]) {
+			// 不是跨域请求，或者来源不允许：不加响应头，浏览器会拦下响应
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		if allowAll {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if conf.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		// 预检请求
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			}
+			if conf.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", maxAge)
+			}
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		if exposed != "" {
+			h.Set("Access-Control-Expose-Headers", exposed)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// ==================== 游标分页 ====================
+
+// 接口的列表可以用 ?limit=N&after=<游标> 分页：第一页只传 limit，响应里的 next_cursor 就是下一页的 after，
+// 没有 next_cursor 表示已经是最后一页。游标里记着上一页最后一条记录的排序字段值，
+// 下一页用 WHERE (k1, k2, id) 在它之后的条件查询（keyset 分页），不用 OFFSET：
+// 翻到后面的页也不会变慢，翻页期间有新增或删除也不会重复或漏掉记录。
+//
+// 游标对客户端是不透明的字符串（base64 编码的 JSON），换了排序方式后旧的游标不能再用。
+
+const (
+	cursorLimit    = 20  // 默认每页条数
+	cursorMaxLimit = 100 // limit 参数的上限
+)
+
+var errBadCursor = errors.New("游标无效")
+
+// sortKey 排序的一列，必须是不为 NULL 的数字或字符串列；最后一列要能唯一确定一条记录（一般是 id）。
+// 不要用时间列：SQLite 里时间按文本比较，游标里的时间和库里存的格式不一定相同
+type sortKey struct {
+	Column string
+	Desc   bool
+}
+
+// keysSQL 排序字段拼成 ORDER BY 的内容，如 "recommend_count DESC, id ASC"
+func keysSQL(keys []sortKey) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		if k.Desc {
+			parts[i] = k.Column + " DESC"
+		} else {
+			parts[i] = k.Column + " ASC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// cursorToken 游标的内容
+type cursorToken struct {
+	Keys   string        `json:"k"` // 排序方式，和当前请求的不一样时游标无效
+	Values []interface{} `json:"v"` // 上一页最后一条记录的排序字段值
+}
+
+// modelSchema 解析模型的字段，用来按列名取值
+func modelSchema(model interface{}) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// encodeCursor 根据一页的最后一条记录（结构体指针）生成下一页的游标
+func encodeCursor(last interface{}, keys []sortKey) (string, error) {
+	sch, err := modelSchema(last)
+	if err != nil {
+		return "", err
+	}
+	rv := reflect.Indirect(reflect.ValueOf(last))
+	token := cursorToken{Keys: keysSQL(keys), Values: make([]interface{}, len(keys))}
+	for i, k := range keys {
+		field := sch.LookUpField(k.Column)
+		if field == nil {
+			return "", errors.New("未知的排序字段 " + k.Column)
+		}
+		token.Values[i], _ = field.ValueOf(context.Background(), rv)
+	}
+	data, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// afterCursor 给查询加上排序，after 不为空时只查游标之后的记录；游标格式不对或排序方式不同时返回 errBadCursor
+func afterCursor(q *gorm.DB, keys []sortKey, after string) (*gorm.DB, error) {
+	q = q.Order(keysSQL(keys))
+	if after == "" {
+		return q, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(after)
+	if err != nil {
+		return nil, errBadCursor
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil || token.Keys != keysSQL(keys) || len(token.Values) != len(keys) {
+		return nil, errBadCursor
+	}
+	// (k1 之后) OR (k1 相等 AND k2 之后) OR ...
+	var ors []string
+	var vars []interface{}
+	for i, k := range keys {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, keys[j].Column+" = ?")
+			vars = append(vars, token.Values[j])
+		}
+		if k.Desc {
+			ands = append(ands, k.Column+" < ?")
+		} else {
+			ands = append(ands, k.Column+" > ?")
+		}
+		vars = append(vars, token.Values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return q.Where(strings.Join(ors, " OR "), vars...), nil
+}
+
+// limitParam 查询参数 limit，没有时为 cursorLimit；ok 为 false 时已经返回了 400
+func limitParam(c *gin.Context) (int, bool) {
+	v := c.Query("limit")
+	if v == "" {
+		return cursorLimit, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > cursorMaxLimit {
+		apiError(c, http.StatusBadRequest, tr(c, "error.limit_range", cursorMaxLimit))
+		return 0, false
+	}
+	return n, true
+}
+
+// wantsCursor 请求是否使用游标分页（带了 limit 或 after 参数）
+func wantsCursor(c *gin.Context) bool {
+	return c.Query("limit") != "" || c.Query("after") != ""
+}
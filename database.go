@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mattn/go-sqlite3"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// ==================== 数据库连接 ====================
+
+// openDatabase 根据配置选择数据库驱动
+//
+//	sqlite   默认，DSN 留空时使用 database.path（spots.db）
+//	mysql    DSN 例：user:pass@tcp(127.0.0.1:3306)/spots?charset=utf8mb4&parseTime=True&loc=Local
+//	postgres DSN 例：host=127.0.0.1 user=spots password=xxx dbname=spots port=5432 sslmode=disable
+func openDatabase() (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch cfg.Database.Driver {
+	case "", "sqlite":
+		dsn := cfg.Database.DSN
+		if dsn == "" {
+			dsn = cfg.Database.Path
+		}
+		dialector = sqlite.Open(sqliteDSN(dsn))
+	case "mysql":
+		dialector = mysql.Open(cfg.Database.DSN)
+	case "postgres":
+		dialector = postgres.Open(cfg.Database.DSN)
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动 %q（可选 sqlite / mysql / postgres）", cfg.Database.Driver)
+	}
+	// 数据库错误和慢查询写进日志（见 logging.go）
+	conn, err := gorm.Open(dialector, &gorm.Config{Logger: gormLogger{}})
+	if err != nil {
+		return nil, err
+	}
+	// 记录数据库操作耗时，见 metrics.go
+	if err := conn.Use(dbMetrics{}); err != nil {
+		return nil, err
+	}
+	// 请求里执行的 SQL 记为链路追踪的 span，见 tracing.go
+	if err := conn.Use(dbTracing{}); err != nil {
+		return nil, err
+	}
+	// 景点等有修改时让查询缓存失效，见 cache.go
+	if err := conn.Use(cacheInvalidation{}); err != nil {
+		return nil, err
+	}
+	// 每条 SQL 最多执行 database.query_timeout
+	if err := conn.Use(queryTimeout{}); err != nil {
+		return nil, err
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.Database.Pool.MaxOpen)
+	sqlDB.SetMaxIdleConns(cfg.Database.Pool.MaxIdle)
+	sqlDB.SetConnMaxLifetime(cfg.Database.Pool.MaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.Database.Pool.MaxIdleTime)
+	if conn.Dialector.Name() == "sqlite" {
+		logSQLitePragmas(conn)
+	}
+	return conn, nil
+}
+
+// ---------- 查询超时 ----------
+
+// 数据库卡住（锁表、网络断了、慢查询）时，没有超时的查询会一直等下去，
+// 请求越积越多，goroutine 和连接都耗光。queryTimeout 给每条 SQL 加上 database.query_timeout 的期限，
+// 超时后查询返回 context deadline exceeded，请求按数据库出错处理。
+// 请求里的查询用 dbFor 带上请求的 context，后台任务用的是 db，两种都有超时。
+// 迁移这种可能要跑很久的用 withoutQueryTimeout 去掉。
+
+// noQueryTimeoutKey context 里有这个键时不加超时
+type noQueryTimeoutKey struct{}
+
+// withoutQueryTimeout 返回不限制查询时间的 context
+func withoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noQueryTimeoutKey{}, true)
+}
+
+// queryTimeout GORM 插件：每条 SQL 执行前换成带期限的 context，执行完再换回来。
+// 不处理 Row / Rows：返回给调用方的结果集要在回调之后读，那时候 context 已经结束了
+type queryTimeout struct{}
+
+func (queryTimeout) Name() string { return "timeout" }
+
+func (queryTimeout) Initialize(db *gorm.DB) error {
+	const (
+		cancelKey = "timeout:cancel"
+		parentKey = "timeout:parent"
+	)
+	before := func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if cfg.Database.QueryTimeout <= 0 || ctx.Value(noQueryTimeoutKey{}) != nil {
+			return
+		}
+		timeoutCtx, cancel := context.WithTimeout(ctx, cfg.Database.QueryTimeout)
+		tx.InstanceSet(cancelKey, cancel)
+		tx.InstanceSet(parentKey, ctx)
+		tx.Statement.Context = timeoutCtx
+	}
+	// 换回原来的 context：同一个查询对象（q := db.Where(...)）还会接着执行别的 SQL
+	after := func(tx *gorm.DB) {
+		if v, ok := tx.InstanceGet(cancelKey); ok {
+			v.(context.CancelFunc)()
+		}
+		if v, ok := tx.InstanceGet(parentKey); ok {
+			tx.Statement.Context = v.(context.Context)
+		}
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("timeout:before_create", before),
+		cb.Create().After("gorm:create").Register("timeout:after_create", after),
+		cb.Query().Before("gorm:query").Register("timeout:before_query", before),
+		cb.Query().After("gorm:query").Register("timeout:after_query", after),
+		cb.Update().Before("gorm:update").Register("timeout:before_update", before),
+		cb.Update().After("gorm:update").Register("timeout:after_update", after),
+		cb.Delete().Before("gorm:delete").Register("timeout:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("timeout:after_delete", after),
+		cb.Raw().Before("gorm:raw").Register("timeout:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("timeout:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---------- SQLite ----------
+
+// SQLite 默认的回滚日志模式下，写的时候整个数据库都被锁住，同时有几个 POST 就会有请求直接失败（database is locked）。
+// 打开数据库时按 database.sqlite 设置：
+//
+//	journal_mode  WAL：读和写互不阻塞，只有写和写排队
+//	busy_timeout  数据库被锁时等多久，而不是立即报错
+//	foreign_keys  检查外键约束（SQLite 默认不检查）
+//
+// 这几个 PRAGMA 里 busy_timeout 和 foreign_keys 只对当前连接有效，所以写进 DSN 的参数，
+// 由驱动在连接池里每个连接打开时执行。事务一律用 BEGIN IMMEDIATE 开始，一开始就拿写锁：
+// 默认的 BEGIN 先读后写，两个事务都读过之后再写，其中一个不等 busy_timeout 就会失败。
+// 等了 busy_timeout 还是被锁的事务由 retryTransaction 重试。
+
+// sqliteDSN 在 DSN 后面加上 PRAGMA 参数，DSN 里已经写了的参数不覆盖
+func sqliteDSN(dsn string) string {
+	params := url.Values{}
+	if cfg.Database.SQLite.JournalMode != "" {
+		params.Set("_journal_mode", cfg.Database.SQLite.JournalMode)
+	}
+	params.Set("_busy_timeout", strconv.FormatInt(cfg.Database.SQLite.BusyTimeout.Milliseconds(), 10))
+	if cfg.Database.SQLite.ForeignKeys {
+		params.Set("_foreign_keys", "1")
+	} else {
+		params.Set("_foreign_keys", "0")
+	}
+	params.Set("_txlock", "immediate")
+
+	path, query, _ := strings.Cut(dsn, "?")
+	existing, _ := url.ParseQuery(query)
+	for name := range params {
+		if existing.Has(name) {
+			params.Del(name)
+		}
+	}
+	if query != "" {
+		return path + "?" + query + "&" + params.Encode()
+	}
+	return path + "?" + params.Encode()
+}
+
+// logSQLitePragmas 启动时把实际生效的设置写进日志；内存数据库等不支持 WAL 时 journal_mode 不是 wal
+func logSQLitePragmas(conn *gorm.DB) {
+	var journalMode string
+	var busyTimeout, foreignKeys int
+	conn.Raw("PRAGMA journal_mode").Scan(&journalMode)
+	conn.Raw("PRAGMA busy_timeout").Scan(&busyTimeout)
+	conn.Raw("PRAGMA foreign_keys").Scan(&foreignKeys)
+	if want := cfg.Database.SQLite.JournalMode; want != "" && !strings.EqualFold(journalMode, want) {
+		slog.Warn("SQLite 日志模式设置未生效", "want", want, "journal_mode", journalMode)
+	}
+	slog.Info("SQLite 设置", "journal_mode", journalMode,
+		"busy_timeout", time.Duration(busyTimeout)*time.Millisecond, "foreign_keys", foreignKeys == 1)
+}
+
+// isDatabaseLocked 是不是 SQLite 的数据库被锁错误，过一会儿重试就可能成功
+func isDatabaseLocked(err error) bool {
+	var se sqlite3.Error
+	return errors.As(err, &se) && (se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked)
+}
+
+// retryTransaction 执行事务，遇到数据库被锁时等一会儿重试，最多 database.sqlite.retries 次。
+// 失败的事务已经回滚，fn 会从头再执行一遍，所以 fn 里不能修改外面的变量（查询结果除外）
+func retryTransaction(q *gorm.DB, fn func(tx *gorm.DB) error) error {
+	for attempt := 1; ; attempt++ {
+		err := q.Transaction(fn)
+		if err == nil || !isDatabaseLocked(err) || attempt > cfg.Database.SQLite.Retries {
+			return err
+		}
+		// 等待时间逐次加长，加上随机的一段，免得几个请求同时重试又撞在一起
+		wait := time.Duration(attempt)*50*time.Millisecond + time.Duration(rand.Intn(50))*time.Millisecond
+		slog.WarnContext(q.Statement.Context, "数据库被锁，稍后重试", "attempt", attempt, "wait", wait)
+		time.Sleep(wait)
+	}
+}
+
+// dbFor 处理请求时用的数据库连接，带着请求的 context：SQL 出错时的日志有请求 ID，
+// 链路追踪里 SQL 算在这个请求下面。去掉了取消信号，客户端中途断开时已经开始的写操作照常完成
+func dbFor(c *gin.Context) *gorm.DB {
+	return db.WithContext(context.WithoutCancel(c.Request.Context()))
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 邮件周报 ====================
+
+// 访客在 /digest 填邮箱订阅，点确认邮件里的链接后生效（防止替别人订阅）。
+// 每周 digest.weekday 的 digest.hour 点（timezone 时区）给所有已确认的订阅者发一封周报：
+// 最近热门的景点（同 /trending）和上周新发布的景点。
+//
+// 每个订阅者有一个随机令牌，只保存在服务器上，确认链接和每封周报底部的退订链接都带着它；
+// 打开退订链接后还要点一下按钮才会退订，避免邮件客户端预取链接时误退订。
+// 上次发送的时间记在设置表里，服务重启不会重复发送，也不会漏发。
+
+const (
+	digestCheckInterval = 10 * time.Minute   // 后台任务检查是否到了发送时间的间隔
+	digestConfirmResend = 10 * time.Minute   // 同一个邮箱两次确认邮件的最短间隔
+	digestSettingKey    = "digest.last_sent" // 设置表里记录上次发送时间的项
+	digestSummaryLen    = 80                 // 周报里描述的最多字数
+)
+
+// DigestSubscriber 周报订阅者
+type DigestSubscriber struct {
+	ID            uint       `gorm:"primaryKey"`
+	Email         string     `gorm:"uniqueIndex;size:191"`
+	Token         string     `gorm:"uniqueIndex;size:64"` // 确认和退订用的随机令牌
+	Confirmed     bool       `gorm:"index"`               // 点过确认链接才会收到周报
+	Locale        string     `gorm:"size:10"`             // 订阅时的界面语言，邮件用这种语言写；为空时用默认语言
+	ConfirmSentAt time.Time  // 最近一次发确认邮件的时间
+	LastSentAt    *time.Time // 最近一次收到周报的时间
+	CreatedAt     time.Time
+}
+
+// digestItem 周报里的一个景点
+type digestItem struct {
+	Name    string
+	URL     string
+	Region  string
+	Summary string
+	Recent  int // 最近推荐的人数，只有热门景点有
+}
+
+// digestSlot 不晚于 now 的最近一个发送时间
+func digestSlot(now time.Time) time.Time {
+	now = now.In(timezone)
+	slot := time.Date(now.Year(), now.Month(), now.Day(), cfg.Digest.Hour, 0, 0, 0, timezone)
+	slot = slot.AddDate(0, 0, -((int(now.Weekday()) - cfg.Digest.Weekday + 7) % 7))
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -7)
+	}
+	return slot
+}
+
+// newDigestItem 把景点转成周报里的一项
+func newDigestItem(s *Spot, recent int) digestItem {
+	return digestItem{
+		Name:    s.Name,
+		URL:     mailURL("/spot/" + strconv.FormatUint(uint64(s.ID), 10)),
+		Region:  strings.TrimSpace(s.Province + " " + s.City),
+		Summary: truncateRunes(markdownText(s.Description), digestSummaryLen),
+		Recent:  recent,
+	}
+}
+
+// sendDigest 给所有已确认的订阅者发周报，since 之后发布的算新景点
+func sendDigest(since, now time.Time) error {
+	var trending, newest []digestItem
+	for _, t := range trendingSpots(now, cfg.Digest.Limit) {
+		trending = append(trending, newDigestItem(&t.Spot, t.Recent))
+	}
+	var spots []Spot
+	if err := db.Scopes(published).Where("created_at > ?", since).Order("id DESC").Limit(cfg.Digest.Limit).Find(&spots).Error; err != nil {
+		return err
+	}
+	for i := range spots {
+		newest = append(newest, newDigestItem(&spots[i], 0))
+	}
+	if len(trending) == 0 && len(newest) == 0 {
+		slog.Info("本周没有热门和新景点，不发周报")
+		return nil
+	}
+
+	var subscribers []DigestSubscriber
+	if err := db.Where("confirmed = ?", true).Order("id").Find(&subscribers).Error; err != nil {
+		return err
+	}
+	date := now.In(timezone).Format("2006-01-02")
+	sent := 0
+	for _, s := range subscribers {
+		locale := mailLocale(s.Locale)
+		unsubscribe := mailURL("/digest/unsubscribe?token=" + s.Token)
+		text, html, err := renderMail("digest", locale, gin.H{
+			"trending":       trending,
+			"newest":         newest,
+			"siteURL":        mailURL("/"),
+			"unsubscribeURL": unsubscribe,
+		})
+		if err != nil {
+			return err
+		}
+		err = sendMail(mailMessage{
+			To:      s.Email,
+			Subject: translate(locale, "mail.digest.subject", date),
+			Text:    text,
+			HTML:    html,
+			Headers: map[string]string{"List-Unsubscribe": "<" + unsubscribe + ">"},
+		})
+		if err != nil {
+			slog.Error("发送周报失败", "email", s.Email, "err", err)
+			continue
+		}
+		db.Model(&s).Update("last_sent_at", now)
+		sent++
+	}
+	slog.Info("已发送周报", "sent", sent, "subscribers", len(subscribers))
+	return nil
+}
+
+// runDigestIfDue 到了发送时间并且这一期还没发时发送周报
+// 第一次运行时只记下当前这一期，从下一期开始发，不会在部署后马上发一封
+func runDigestIfDue(now time.Time) error {
+	slot := digestSlot(now)
+	var s Setting
+	if err := db.Where("name = ?", digestSettingKey).Limit(1).Find(&s).Error; err != nil {
+		return err
+	}
+	if s.Value != "" {
+		last, err := time.Parse(time.RFC3339, s.Value)
+		if err == nil && !last.Before(slot) {
+			return nil
+		}
+	}
+	// 先记下这一期，发送中途出错或重启也不会给已经收到的人再发一次
+	if err := saveSetting(digestSettingKey, slot.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	if s.Value == "" {
+		return nil
+	}
+	return sendDigest(slot.AddDate(0, 0, -7), now)
+}
+
+// digestJob 定时任务：定期检查是否到了发送周报的时间，没有配置 SMTP 时不启用
+func digestJob() *scheduledJob {
+	j := &scheduledJob{
+		Name:     "digest",
+		Title:    "job.digest",
+		Interval: digestCheckInterval,
+		Run: func() (string, error) {
+			return "", runDigestIfDue(time.Now())
+		},
+	}
+	if !mailEnabled() {
+		j.Disabled = "job.disabled.no_smtp"
+	}
+	return j
+}
+
+// ---------- 页面 ----------
+
+// renderSubscribe 订阅页面，data 里的 message / error 是操作结果
+func renderSubscribe(c *gin.Context, status int, data gin.H) {
+	data["title"] = tr(c, "nav.digest")
+	data["enabled"] = mailEnabled()
+	render(c, status, "subscribe.html", data)
+}
+
+// showSubscribe 订阅周报：GET /digest
+func showSubscribe(c *gin.Context) {
+	renderSubscribe(c, http.StatusOK, gin.H{})
+}
+
+// subscribeDigest 提交邮箱：POST /digest/subscribe，发确认邮件
+func subscribeDigest(c *gin.Context) {
+	if !mailEnabled() {
+		renderSubscribe(c, http.StatusServiceUnavailable, gin.H{})
+		return
+	}
+	addr, err := mail.ParseAddress(strings.TrimSpace(c.PostForm("email")))
+	if err != nil || len(addr.Address) > 191 {
+		renderSubscribe(c, http.StatusBadRequest, gin.H{"error": tr(c, "digest.error.email")})
+		return
+	}
+	email := strings.ToLower(addr.Address)
+
+	var sub DigestSubscriber
+	if err := dbFor(c).Where("email = ?", email).Limit(1).Find(&sub).Error; err != nil {
+		renderSubscribe(c, http.StatusInternalServerError, gin.H{"error": tr(c, "digest.error.failed")})
+		return
+	}
+	sent := gin.H{"message": tr(c, "digest.message.sent", email)}
+	switch {
+	case sub.Confirmed:
+		renderSubscribe(c, http.StatusOK, gin.H{"message": tr(c, "digest.message.already", email)})
+		return
+	case sub.ID != 0 && time.Since(sub.ConfirmSentAt) < digestConfirmResend:
+		renderSubscribe(c, http.StatusOK, sent)
+		return
+	}
+
+	if sub.ID == 0 {
+		sub = DigestSubscriber{Email: email, Token: randomToken(24)}
+	}
+	// 邮件用订阅时的界面语言，重新订阅时改成这次的
+	sub.Locale = currentLocale(c)
+	sub.ConfirmSentAt = time.Now()
+	if err := dbFor(c).Save(&sub).Error; err != nil {
+		renderSubscribe(c, http.StatusInternalServerError, gin.H{"error": tr(c, "digest.error.failed")})
+		return
+	}
+	text, html, err := renderMail("confirm", sub.Locale, gin.H{
+		"email":      email,
+		"confirmURL": mailURL("/digest/confirm?token=" + sub.Token),
+	})
+	if err == nil {
+		err = sendMail(mailMessage{To: email, Subject: tr(c, "mail.confirm.subject"), Text: text, HTML: html})
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "发送确认邮件失败", "email", email, "err", err)
+		// 允许马上重试
+		dbFor(c).Model(&sub).Update("confirm_sent_at", sub.ConfirmSentAt.Add(-digestConfirmResend))
+		renderSubscribe(c, http.StatusInternalServerError, gin.H{"error": tr(c, "digest.error.send_failed")})
+		return
+	}
+	renderSubscribe(c, http.StatusOK, sent)
+}
+
+// findSubscriber 按令牌查找订阅者
+func findSubscriber(token string) (*DigestSubscriber, bool) {
+	if token == "" {
+		return nil, false
+	}
+	var sub DigestSubscriber
+	if err := db.Where("token = ?", token).Limit(1).Find(&sub).Error; err != nil || sub.ID == 0 {
+		return nil, false
+	}
+	return &sub, true
+}
+
+// confirmDigest 确认订阅：GET /digest/confirm?token=...
+func confirmDigest(c *gin.Context) {
+	sub, ok := findSubscriber(c.Query("token"))
+	if !ok {
+		renderSubscribe(c, http.StatusNotFound, gin.H{"error": tr(c, "digest.error.confirm_invalid")})
+		return
+	}
+	dbFor(c).Model(sub).Update("confirmed", true)
+	renderSubscribe(c, http.StatusOK, gin.H{"message": tr(c, "digest.message.confirmed", sub.Email)})
+}
+
+// showUnsubscribe 退订确认页面：GET /digest/unsubscribe?token=...
+func showUnsubscribe(c *gin.Context) {
+	sub, ok := findSubscriber(c.Query("token"))
+	if !ok {
+		renderSubscribe(c, http.StatusNotFound, gin.H{"error": tr(c, "digest.error.unsubscribe_invalid")})
+		return
+	}
+	renderSubscribe(c, http.StatusOK, gin.H{"unsubscribe": sub})
+}
+
+// unsubscribeDigest 退订：POST /digest/unsubscribe，删除订阅记录
+func unsubscribeDigest(c *gin.Context) {
+	sub, ok := findSubscriber(c.PostForm("token"))
+	if !ok {
+		renderSubscribe(c, http.StatusNotFound, gin.H{"error": tr(c, "digest.error.unsubscribe_invalid")})
+		return
+	}
+	dbFor(c).Delete(sub)
+	renderSubscribe(c, http.StatusOK, gin.H{"message": tr(c, "digest.message.unsubscribed", sub.Email)})
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== JSON 备份 ====================
+
+// GET /admin/dump 把所有数据导出成一个 JSON 文件，可以在另一个环境用
+// ./tourist-spots load <文件> 导入到空数据库，换服务器、从 SQLite 换到 MySQL / PostgreSQL 时不用复制数据库文件。
+//
+//	{
+//	  "format": "tourist-spots-dump",
+//	  "schema_version": 30,           // 导出时的数据库迁移版本，导入时必须相同
+//	  "created_at": "2026-10-15T10:00:00+08:00",
+//	  "tables": {"users": [{"id": 1, ...}], "spots": [...], ...}
+//	}
+//
+// 每张表按数据库里的列原样导出（包括软删除的记录和密码哈希），不经过模型的 JSON 字段，
+// 所以导入后和原来完全一样。登录会话、景点相似度（后台会重新计算）和迁移记录不导出。
+
+const dumpFormat = "tourist-spots-dump"
+
+// dumpTables 导出的表，按导入顺序排列（被引用的表在前）
+var dumpTables = []string{
+	"users",
+	"user_identities",
+	"api_keys",
+	"spots",
+	"tags",
+	"spot_tags",
+	"spot_images",
+	"spot_revisions",
+	"comments",
+	"ratings",
+	"recommendations",
+	"favorites",
+	"check_ins",
+	"itineraries",
+	"itinerary_stops",
+	"reports",
+	"audit_entries",
+	"settings",
+	"webhooks",
+	"digest_subscribers",
+	"notifications",
+}
+
+// dumpFile 导入时读取的备份文件
+type dumpFile struct {
+	Format        string                              `json:"format"`
+	SchemaVersion int                                 `json:"schema_version"`
+	CreatedAt     time.Time                           `json:"created_at"`
+	Tables        map[string][]map[string]interface{} `json:"tables"`
+}
+
+// schemaVersion 代码里最新的迁移版本
+func schemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// writeDump 把所有表写成 JSON，逐行查询、逐行写出，不把整张表读进内存
+func writeDump(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "{\"format\":%q,\"schema_version\":%d,\"created_at\":%q,\"tables\":{",
+		dumpFormat, schemaVersion(), time.Now().Format(time.RFC3339))
+	for i, table := range dumpTables {
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		fmt.Fprintf(bw, "\n%q:[", table)
+		if err := writeDumpTable(bw, table); err != nil {
+			return fmt.Errorf("导出 %s 失败: %w", table, err)
+		}
+		bw.WriteString("]")
+	}
+	bw.WriteString("\n}}\n")
+	return bw.Flush()
+}
+
+func writeDumpTable(w *bufio.Writer, table string) error {
+	rows, err := db.Table(table).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for n := 0; rows.Next(); n++ {
+		row := map[string]interface{}{}
+		if err := db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		for k, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[k] = string(b)
+			}
+		}
+		data, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			w.WriteString(",")
+		}
+		w.WriteString("\n")
+		w.Write(data)
+	}
+	return rows.Err()
+}
+
+// loadDump 把备份文件导入到空数据库，在一个事务里完成，出错时什么也不导入
+func loadDump(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var dump dumpFile
+	if err := dec.Decode(&dump); err != nil {
+		return fmt.Errorf("备份文件格式错误: %w", err)
+	}
+	if dump.Format != dumpFormat {
+		return errors.New("不是景点数据的备份文件")
+	}
+	if dump.SchemaVersion != schemaVersion() {
+		return fmt.Errorf("备份文件的数据库版本是 %d，当前程序是 %d，请用相同版本的程序导出和导入",
+			dump.SchemaVersion, schemaVersion())
+	}
+	known := map[string]bool{}
+	for _, table := range dumpTables {
+		known[table] = true
+	}
+	for table := range dump.Tables {
+		if !known[table] {
+			return fmt.Errorf("备份文件里有不认识的表 %s", table)
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range dumpTables {
+			var count int64
+			if err := tx.Table(table).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("表 %s 不是空的，只能导入到新数据库", table)
+			}
+		}
+		for _, table := range dumpTables {
+			rows := dump.Tables[table]
+			if len(rows) == 0 {
+				continue
+			}
+			if err := convertDumpRows(tx, table, rows); err != nil {
+				return err
+			}
+			if err := tx.Table(table).CreateInBatches(rows, 100).Error; err != nil {
+				return fmt.Errorf("导入 %s 失败: %w", table, err)
+			}
+			if err := resetSequence(tx, table, rows); err != nil {
+				return err
+			}
+			slog.Info("已导入", "table", table, "rows", len(rows))
+		}
+		return nil
+	})
+}
+
+// convertDumpRows 把 JSON 里的值转回数据库的类型：数字、时间、布尔。
+// 数据库里没有的列（旧版本留下的、迁移没有管理的列）丢掉，在日志里提示
+func convertDumpRows(tx *gorm.DB, table string, rows []map[string]interface{}) error {
+	columns, err := tx.Migrator().ColumnTypes(table)
+	if err != nil {
+		return err
+	}
+	types := map[string]string{}
+	for _, col := range columns {
+		types[col.Name()] = strings.ToLower(col.DatabaseTypeName())
+	}
+	dropped := map[string]bool{}
+	for _, row := range rows {
+		for k, v := range row {
+			typ, ok := types[k]
+			if !ok {
+				if !dropped[k] {
+					slog.Warn("表里没有这一列，忽略", "table", table, "column", k)
+					dropped[k] = true
+				}
+				delete(row, k)
+				continue
+			}
+			switch v := v.(type) {
+			case json.Number:
+				if i, err := v.Int64(); err == nil {
+					if strings.Contains(typ, "bool") {
+						row[k] = i != 0
+					} else {
+						row[k] = i
+					}
+				} else {
+					row[k], _ = v.Float64()
+				}
+			case string:
+				if strings.Contains(typ, "date") || strings.Contains(typ, "time") {
+					if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+						row[k] = t
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// resetSequence PostgreSQL 指定了 id 插入后，自增序列不会跟着变，要手动调到最大的 id 之后
+func resetSequence(tx *gorm.DB, table string, rows []map[string]interface{}) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	if _, ok := rows[0]["id"]; !ok {
+		return nil
+	}
+	return tx.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), (SELECT MAX(id) FROM "+table+"))", table).Error
+}
+
+// runLoadCommand 处理 load 子命令：./tourist-spots load <备份文件>
+func runLoadCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "用法: load <备份文件>")
+		os.Exit(2)
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		fatal("无法打开备份文件", "err", err)
+	}
+	defer f.Close()
+	if err := migrateUp(); err != nil {
+		fatal("数据库迁移失败", "err", err)
+	}
+	if err := loadDump(f); err != nil {
+		fatal("导入失败", "err", err)
+	}
+	slog.Info("导入完成")
+}
+
+// ---------- 页面 ----------
+
+// downloadDump 下载 JSON 备份：GET /admin/dump
+func downloadDump(c *gin.Context) {
+	c.Header("Content-Disposition", `attachment; filename="spots-dump-`+time.Now().Format("20060102")+`.json"`)
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := writeDump(c.Writer); err != nil {
+		// 响应已经开始发送，只能记日志，客户端会收到不完整的文件（导入时会报格式错误）
+		slog.ErrorContext(c.Request.Context(), "导出备份失败", "err", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== ETag / 条件请求 ====================
+
+// GET 请求的 200 响应按内容算一个弱 ETag；客户端下次带上 If-None-Match，内容没变就只返回 304，不发响应体。
+// 定时轮询 API 的客户端和来回翻页的浏览器都能省下流量。
+// 没有用 updated_at 算 Last-Modified：推荐数、浏览次数、评分这些计数直接在数据库里加减，不会更新 updated_at，
+// 列表里删除的景点也反映不出来，按内容算才不会让客户端拿到过时的数据。
+// 响应要整个缓冲下来才能算，超过 etagMaxSize 的和流式输出（导出等）不算 ETag，原样发送。
+
+const etagMaxSize = 1 << 20 // 1MB
+
+// conditionalGet 给 GET 响应加上 ETag，处理 If-None-Match
+func conditionalGet() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		w := &etagWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+		w.finish(c.GetHeader("If-None-Match"))
+	}
+}
+
+// etagWriter 缓冲整个响应，结束时算 ETag；太大或者要 Flush 时改为直接输出
+type etagWriter struct {
+	gin.ResponseWriter
+	buf         bytes.Buffer
+	passThrough bool
+}
+
+func (w *etagWriter) Write(p []byte) (int, error) {
+	if w.passThrough {
+		return w.ResponseWriter.Write(p)
+	}
+	if w.buf.Len()+len(p) > etagMaxSize {
+		if err := w.stopBuffering(); err != nil {
+			return 0, err
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+func (w *etagWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow 缓冲时不发送响应头，结束时可能要改成 304
+func (w *etagWriter) WriteHeaderNow() {
+	if w.passThrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *etagWriter) Written() bool {
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+func (w *etagWriter) Flush() {
+	w.stopBuffering()
+	w.ResponseWriter.Flush()
+}
+
+// stopBuffering 不再算 ETag，把缓冲的内容写出去
+func (w *etagWriter) stopBuffering() error {
+	if w.passThrough {
+		return nil
+	}
+	w.passThrough = true
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+// finish 响应结束：算 ETag，和 If-None-Match 一致时改为 304
+func (w *etagWriter) finish(ifNoneMatch string) {
+	if w.passThrough {
+		return
+	}
+	h := w.Header()
+	if w.Status() == http.StatusOK && w.buf.Len() > 0 && h.Get("ETag") == "" {
+		sum := fnv.New64a()
+		sum.Write(w.buf.Bytes())
+		etag := `W/"` + strconv.FormatUint(sum.Sum64(), 16) + `"`
+		h.Set("ETag", etag)
+		if etagMatch(ifNoneMatch, etag) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			w.ResponseWriter.WriteHeader(http.StatusNotModified)
+			w.ResponseWriter.WriteHeaderNow()
+			return
+		}
+	}
+	w.stopBuffering()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// etagMatch If-None-Match 里有没有这个 ETag，按弱比较（忽略 W/ 前缀）
+func etagMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ==================== 照片 EXIF 定位 ====================
+
+// 手机拍的照片通常在 EXIF 里带有拍摄地点。添加/编辑景点时选了照片，
+// 页面会先把照片发到 /media/exif 读取位置，有位置时询问是否填入经纬度
+
+// photoLocation 读取照片 EXIF 中的 GPS 坐标，没有或读取失败时 ok 为 false
+func photoLocation(data []byte) (lat, lng float64, ok bool) {
+	x, err := exif.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	lat, lng, err = x.LatLong()
+	if err != nil || (lat == 0 && lng == 0) {
+		return 0, 0, false
+	}
+	return lat, lng, true
+}
+
+// readPhotoLocation 读取上传照片的拍摄位置：POST /media/exif（字段 image）
+// 只读取不保存，照片在提交表单时才真正上传
+func readPhotoLocation(c *gin.Context) {
+	fh, err := c.FormFile("image")
+	if err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.photo_missing"))
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.photo_unreadable"))
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, int64(cfg.Upload.MaxSizeMB)<<20))
+	if err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.photo_unreadable"))
+		return
+	}
+	lat, lng, ok := photoLocation(data)
+	if !ok {
+		apiError(c, http.StatusNotFound, tr(c, "error.photo_no_location"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"latitude": lat, "longitude": lng})
+}
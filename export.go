@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 导出 ====================
+
+// GET /export?format=csv|xlsx 导出全部已发布景点，筛选参数和首页相同（见 filter.go）。
+// 分批查询、边查边写，景点再多也不会占用太多内存。
+// 导出的列包括导入用的所有列（见 import.go），改完后可以直接在 /admin/import 导入为新景点；
+// id 和统计数据是只读的，导入时忽略。
+// CSV 开头写 UTF-8 BOM，Excel 直接打开时中文不会乱码。
+
+const exportBatchSize = 500 // 每次从数据库读出的景点数
+
+// exportColumn 导出的一列，Value 返回单元格的值：字符串、int、int64、float64 或 nil（空）
+type exportColumn struct {
+	Header string
+	Value  func(s *Spot) interface{}
+}
+
+var exportColumns = []exportColumn{
+	{"id", func(s *Spot) interface{} { return int(s.ID) }},
+	{"name", func(s *Spot) interface{} { return s.Name }},
+	{"description", func(s *Spot) interface{} { return s.Description }},
+	{"ticket", func(s *Spot) interface{} { return s.Ticket }},
+	{"transport", func(s *Spot) interface{} { return s.Transport }},
+	{"province", func(s *Spot) interface{} { return s.Province }},
+	{"city", func(s *Spot) interface{} { return s.City }},
+	{"tags", func(s *Spot) interface{} { return s.TagNames() }},
+	{"image_url", func(s *Spot) interface{} { return s.ImageURL }},
+	{"adult_price", func(s *Spot) interface{} { return floatCell(s.AdultPrice) }},
+	{"child_price", func(s *Spot) interface{} { return floatCell(s.ChildPrice) }},
+	{"is_free", func(s *Spot) interface{} {
+		if s.IsFree {
+			return 1
+		}
+		return 0
+	}},
+	{"opening_hours", func(s *Spot) interface{} { return s.OpeningHours.Text() }},
+	{"best_months", func(s *Spot) interface{} {
+		months := s.BestMonths.List()
+		parts := make([]string, len(months))
+		for i, m := range months {
+			parts[i] = strconv.Itoa(m)
+		}
+		return strings.Join(parts, ",")
+	}},
+	{"latitude", func(s *Spot) interface{} { return floatCell(s.Latitude) }},
+	{"longitude", func(s *Spot) interface{} { return floatCell(s.Longitude) }},
+	{"recommend_count", func(s *Spot) interface{} { return s.RecommendCount }},
+	{"rating_avg", func(s *Spot) interface{} { return s.RatingAvg }},
+	{"rating_count", func(s *Spot) interface{} { return s.RatingCount }},
+	{"favorite_count", func(s *Spot) interface{} { return s.FavoriteCount }},
+	{"view_count", func(s *Spot) interface{} { return s.ViewCount }},
+	{"created_at", func(s *Spot) interface{} { return s.CreatedAt.Local().Format("2006-01-02 15:04:05") }},
+}
+
+// exportOnly 是否是只在导出文件里有的列（导入时忽略）
+func exportOnly(header string) bool {
+	for _, col := range importColumns {
+		if col.Header == header {
+			return false
+		}
+	}
+	for _, col := range exportColumns {
+		if col.Header == header {
+			return true
+		}
+	}
+	return false
+}
+
+// exportURL 按当前的筛选条件导出的地址，首页的导出链接用
+func exportURL(c *gin.Context, format string) string {
+	q := c.Request.URL.Query()
+	q.Del("sort")
+	q.Set("format", format)
+	return "/export?" + q.Encode()
+}
+
+// floatCell 可选的数字，nil 导出为空单元格
+func floatCell(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+// exportSpots 导出景点：GET /export?format=csv|xlsx，默认 csv
+func exportSpots(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "xlsx" {
+		c.String(http.StatusBadRequest, tr(c, "error.export_format"))
+		return
+	}
+	filename := "spots-" + time.Now().Format("20060102") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	header := make([]interface{}, len(exportColumns))
+	for i, col := range exportColumns {
+		header[i] = col.Header
+	}
+	var writeRow func([]interface{}) error
+	var flush func() error
+	switch format {
+	case "csv":
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(http.StatusOK)
+		c.Writer.WriteString(utf8BOM)
+		w := csv.NewWriter(c.Writer)
+		w.UseCRLF = true // Excel 习惯的换行
+		record := make([]string, len(exportColumns))
+		writeRow = func(values []interface{}) error {
+			for i, v := range values {
+				record[i] = exportText(v)
+			}
+			return w.Write(record)
+		}
+		flush = func() error {
+			w.Flush()
+			c.Writer.Flush()
+			return w.Error()
+		}
+	case "xlsx":
+		c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+		c.Status(http.StatusOK)
+		x, err := newXLSXWriter(c.Writer, "景点")
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "导出景点失败", "err", err)
+			return
+		}
+		writeRow = x.WriteRow
+		flush = func() error {
+			c.Writer.Flush()
+			return nil
+		}
+		defer func() {
+			if err := x.Close(); err != nil {
+				slog.ErrorContext(c.Request.Context(), "导出景点失败", "err", err)
+			}
+		}()
+	}
+
+	if err := writeRow(header); err != nil {
+		slog.ErrorContext(c.Request.Context(), "导出景点失败", "err", err)
+		return
+	}
+	values := make([]interface{}, len(exportColumns))
+	var batch []Spot
+	err := filterSpots(c, dbFor(c).Scopes(published)).Preload("Tags").
+		FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, spot := range filterOpenNow(c, batch) {
+				for i, col := range exportColumns {
+					values[i] = col.Value(&spot)
+				}
+				if err := writeRow(values); err != nil {
+					return err
+				}
+			}
+			return flush()
+		}).Error
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		// 响应已经开始发送，没法再返回错误页，只能记日志，客户端会收到不完整的文件
+		slog.ErrorContext(c.Request.Context(), "导出景点失败", "err", err)
+	}
+}
+
+// exportText 单元格的值转成 CSV 里的文本
+func exportText(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==================== 收藏 ====================
+
+// 登录用户可以收藏景点，在 /favorites 查看自己的收藏。和推荐不同，收藏只对登录用户开放，
+// 每个用户对每个景点最多一条。收藏人数存在 spots.favorite_count 里，收藏变化时重新统计。
+
+// Favorite 收藏记录
+type Favorite struct {
+	ID        uint `gorm:"primaryKey"`
+	UserID    uint `gorm:"uniqueIndex:idx_favorite_user_spot"`
+	SpotID    uint `gorm:"uniqueIndex:idx_favorite_user_spot;index"`
+	CreatedAt time.Time
+}
+
+// errLoginRequired 收藏等操作需要登录
+var errLoginRequired = errors.New("login required")
+
+// favoriteSpot 收藏（add 为 true）或取消收藏景点，返回更新后的景点（含收藏人数）
+// 重复收藏、取消没有收藏过的景点都不算错误
+func favoriteSpot(user *User, id string, add bool) (Spot, error) {
+	var spot Spot
+	if user == nil {
+		return spot, errLoginRequired
+	}
+	spotID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return spot, gorm.ErrRecordNotFound
+	}
+
+	err = retryTransaction(db, func(tx *gorm.DB) error {
+		if err := tx.Scopes(published).Select("id").First(&spot, spotID).Error; err != nil {
+			return err
+		}
+		fav := Favorite{UserID: user.ID, SpotID: uint(spotID)}
+		var err error
+		if add {
+			err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&fav).Error
+		} else {
+			err = tx.Where("user_id = ? AND spot_id = ?", user.ID, spotID).Delete(&Favorite{}).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE spots SET favorite_count =
+			(SELECT COUNT(*) FROM favorites WHERE favorites.spot_id = spots.id) WHERE id = ?`, spotID).Error; err != nil {
+			return err
+		}
+		return tx.Select("id", "favorite_count").First(&spot, spotID).Error
+	})
+	return spot, err
+}
+
+// favoriteSpotIDs 当前用户收藏的景点ID，模板里用来显示“已收藏”，未登录时为空
+func favoriteSpotIDs(c *gin.Context) map[uint]bool {
+	m := map[uint]bool{}
+	user := currentUser(c)
+	if user == nil {
+		return m
+	}
+	var ids []uint
+	dbFor(c).Model(&Favorite{}).Where("user_id = ?", user.ID).Pluck("spot_id", &ids)
+	for _, id := range ids {
+		m[id] = true
+	}
+	return m
+}
+
+// userFavorites 用户收藏的已发布景点，最近收藏的在前
+func userFavorites(userID uint) []Spot {
+	var spots []Spot
+	db.Scopes(published).Preload("Tags").
+		Joins("JOIN favorites ON favorites.spot_id = spots.id AND favorites.user_id = ?", userID).
+		Order("favorites.id desc").Find(&spots)
+	return spots
+}
+
+// favoriteForm 收藏 / 取消收藏：POST /favorite/:id、POST /favorite/:id/undo
+// 未登录时跳转到登录页，完成后回到 next 指定的页面
+func favoriteForm(add bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		spot, err := favoriteSpot(currentUser(c), c.Param("id"), add)
+		if wantsJSON(c) {
+			favoriteResponse(c, spot, err)
+			return
+		}
+		next := safeNext(c.PostForm("next"))
+		switch {
+		case errors.Is(err, errLoginRequired):
+			c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(next))
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.String(http.StatusNotFound, tr(c, "error.spot_id_not_found", c.Param("id")))
+		case err != nil:
+			c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		default:
+			c.Redirect(http.StatusFound, next)
+		}
+	}
+}
+
+// showFavorites 我的收藏：GET /favorites
+func showFavorites(c *gin.Context) {
+	user := currentUser(c)
+	if user == nil {
+		c.Redirect(http.StatusFound, "/login?next=/favorites")
+		return
+	}
+	render(c, http.StatusOK, "favorites.html", gin.H{
+		"title": tr(c, "nav.favorites"),
+		"spots": userFavorites(user.ID),
+	})
+}
+
+// apiListFavorites 当前用户的收藏：GET /api/v1/favorites
+func apiListFavorites(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"spots": userFavorites(currentUser(c).ID)})
+}
+
+// apiFavoriteSpot 收藏：POST /api/v1/spots/:id/favorite
+func apiFavoriteSpot(c *gin.Context) {
+	spot, err := favoriteSpot(currentUser(c), c.Param("id"), true)
+	favoriteResponse(c, spot, err)
+}
+
+// apiUnfavoriteSpot 取消收藏：POST /api/v1/spots/:id/favorite/undo
+func apiUnfavoriteSpot(c *gin.Context) {
+	spot, err := favoriteSpot(currentUser(c), c.Param("id"), false)
+	favoriteResponse(c, spot, err)
+}
+
+// favoriteResponse 把 favoriteSpot 的结果转成 JSON 响应
+func favoriteResponse(c *gin.Context, spot Spot, err error) {
+	switch {
+	case errors.Is(err, errLoginRequired):
+		apiError(c, http.StatusUnauthorized, tr(c, "error.login_required"))
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+	case err != nil:
+		apiError(c, http.StatusInternalServerError, tr(c, "error.action_failed"))
+	default:
+		c.JSON(http.StatusOK, gin.H{"id": spot.ID, "favorite_count": spot.FavoriteCount})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== Atom 订阅 ====================
+
+// GET /feed.xml 最新发布的景点的 Atom 订阅，可以用 RSS 阅读器订阅。
+// 每个景点一条，链接到详情页，摘要是去掉 Markdown 标记后的描述开头；标签作为分类。
+
+const (
+	feedSize       = 20  // 订阅里的景点数
+	feedSummaryLen = 200 // 摘要最多的字数
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Link       atomLink       `xml:"link"`
+	Summary    string         `xml:"summary,omitempty"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// showFeed Atom 订阅：GET /feed.xml
+func showFeed(c *gin.Context) {
+	var spots []Spot
+	dbFor(c).Scopes(published).Preload("Tags").Order("id DESC").Limit(feedSize).Find(&spots)
+
+	feed := atomFeed{
+		Title:   "旅游景点管理 - 最新景点",
+		ID:      absoluteURL(c, "/"),
+		Updated: time.Now().Format(time.RFC3339),
+		Author:  atomPerson{Name: "旅游景点管理"},
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: absoluteURL(c, "/feed.xml")},
+			{Rel: "alternate", Type: "text/html", Href: absoluteURL(c, "/")},
+		},
+	}
+	var updated time.Time
+	for _, s := range spots {
+		link := absoluteURL(c, "/spot/"+url.PathEscape(s.Slug))
+		// 条目的 id 用按ID的地址（也能打开详情页）：改名后 slug 会变，ID 不会
+		id := absoluteURL(c, "/spot/"+strconv.FormatUint(uint64(s.ID), 10))
+		entry := atomEntry{
+			Title:     s.Name,
+			ID:        id,
+			Updated:   s.UpdatedAt.Format(time.RFC3339),
+			Published: s.CreatedAt.Format(time.RFC3339),
+			Link:      atomLink{Rel: "alternate", Type: "text/html", Href: link},
+			Summary:   truncateRunes(markdownText(s.Description), feedSummaryLen),
+		}
+		for _, t := range s.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: t.Name})
+		}
+		feed.Entries = append(feed.Entries, entry)
+		if s.UpdatedAt.After(updated) {
+			updated = s.UpdatedAt
+		}
+	}
+	if !updated.IsZero() {
+		feed.Updated = updated.Format(time.RFC3339)
+	}
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.feed_failed"))
+		return
+	}
+	c.Data(http.StatusOK, "application/atom+xml; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+// truncateRunes 超过 n 个字时截断并加上省略号
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 组合筛选 ====================
+
+// 首页、/search、标签页和 /api/v1/spots 的筛选条件都由 filterSpots 加到同一个查询上，条件之间是“并且”：
+//
+//	province / city              地区，见 region.go
+//	tag                          标签名称，可以有多个（tag=古镇&tag=江南），要同时有这些标签
+//	min_price / max_price / free 价格，见 price.go
+//	min_rating                   最低平均评分（1~5），没有评分的景点不会出现
+//
+// 关键词由 /search 自己处理（全文索引或 LIKE），open_now 在查出来之后判断（见 hours.go）。
+// 页面上用 activeFilters 列出当前生效的条件，每个条件都可以单独去掉。
+
+// filterSpots 按查询参数加上所有筛选条件
+func filterSpots(c *gin.Context, q *gorm.DB) *gorm.DB {
+	q = filterByRegion(c, q)
+	q = filterByPrice(c, q)
+	for _, name := range tagParams(c) {
+		q = q.Where("id IN (?)", dbFor(c).Model(&SpotTag{}).Select("spot_id").
+			Where("tag_id IN (?)", dbFor(c).Model(&Tag{}).Select("id").Where("name = ?", name)))
+	}
+	if v, ok := ratingParam(c); ok {
+		q = q.Where("rating_count > 0 AND rating_avg >= ?", v)
+	}
+	return q
+}
+
+// tagParams 查询参数里的标签，去掉空的和重复的
+func tagParams(c *gin.Context) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, t := range c.QueryArray("tag") {
+		t = strings.TrimSpace(t)
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// ratingParam 查询参数 min_rating，不是 1~5 之间的数字时忽略
+func ratingParam(c *gin.Context) (float64, bool) {
+	v, err := strconv.ParseFloat(c.Query("min_rating"), 64)
+	if err != nil || v < 1 || v > 5 {
+		return 0, false
+	}
+	return v, true
+}
+
+// activeFilter 当前生效的一个筛选条件，Clear 是去掉这个条件后的地址
+type activeFilter struct {
+	Label string
+	Clear string
+}
+
+// activeFilters 当前请求生效的筛选条件（包括搜索关键词），按筛选表单里的顺序
+func activeFilters(c *gin.Context) []activeFilter {
+	var list []activeFilter
+	// without 去掉 name 参数（tag 只去掉值为 value 的一个）后的地址
+	without := func(name, value string) string {
+		q := c.Request.URL.Query()
+		if name == "tag" {
+			var kept []string
+			for _, t := range q["tag"] {
+				if strings.TrimSpace(t) != value {
+					kept = append(kept, t)
+				}
+			}
+			q["tag"] = kept
+		} else {
+			q.Del(name)
+		}
+		u := url.URL{Path: c.Request.URL.Path, RawQuery: q.Encode()}
+		return u.String()
+	}
+	add := func(name, value, label string) {
+		list = append(list, activeFilter{Label: label, Clear: without(name, value)})
+	}
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		add("q", q, tr(c, "filter.chip.q", q))
+	}
+	for _, t := range tagParams(c) {
+		add("tag", t, tr(c, "filter.chip.tag", t))
+	}
+	if v := c.Query("province"); v != "" {
+		add("province", v, tr(c, "filter.chip.province", v))
+	}
+	if v := c.Query("city"); v != "" {
+		add("city", v, tr(c, "filter.chip.city", v))
+	}
+	if v, ok := priceParam(c, "min_price"); ok {
+		add("min_price", "", tr(c, "filter.chip.min_price", formatPrice(v)))
+	}
+	if v, ok := priceParam(c, "max_price"); ok {
+		add("max_price", "", tr(c, "filter.chip.max_price", formatPrice(v)))
+	}
+	if c.Query("free") == "1" {
+		add("free", "", tr(c, "filter.free"))
+	}
+	if v, ok := ratingParam(c); ok {
+		add("min_rating", "", tr(c, "filter.chip.rating", strconv.FormatFloat(v, 'f', -1, 64)))
+	}
+	if c.Query("open_now") == "1" {
+		add("open_now", "", tr(c, "filter.open_now"))
+	}
+	return list
+}
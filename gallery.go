@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 景点图集 ====================
+
+// Spot.ImageURL 仍然是列表里显示的封面，图集是详情页里的多张图片
+
+// SpotImage 景点图集中的一张图片
+type SpotImage struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SpotID    uint      `gorm:"index" json:"-"`
+	URL       string    `json:"url"`
+	Caption   string    `json:"caption"`  // 图片说明
+	Position  int       `json:"position"` // 显示顺序，从小到大
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const maxCaptionLen = 200
+
+// spotImages 按显示顺序返回景点的图片
+func spotImages(spotID uint) []SpotImage {
+	var images []SpotImage
+	db.Where("spot_id = ?", spotID).Order("position, id").Find(&images)
+	return images
+}
+
+// gallerySpot 取出 URL 中 :id 对应的景点，不存在时返回 404
+func gallerySpot(c *gin.Context) (*Spot, bool) {
+	var spot Spot
+	if err := dbFor(c).First(&spot, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.spot_id_not_found", c.Param("id")))
+		return nil, false
+	}
+	return &spot, true
+}
+
+// backToSpot 操作完成后回到详情页
+func backToSpot(c *gin.Context, spot *Spot) {
+	c.Redirect(http.StatusFound, "/spot/"+url.PathEscape(spot.Slug))
+}
+
+// addSpotImage 添加图片：POST /admin/spot/:id/images，追加到最后
+func addSpotImage(c *gin.Context) {
+	spot, ok := gallerySpot(c)
+	if !ok {
+		return
+	}
+	imageURL := sanitizeURL(c.PostForm("url"))
+	caption := sanitizeText(c.PostForm("caption"))
+	if imageURL == "" || utf8.RuneCountInString(caption) > maxCaptionLen {
+		c.String(http.StatusBadRequest, tr(c, "error.gallery_invalid", maxCaptionLen))
+		return
+	}
+
+	before := spotImages(spot.ID)
+	img := SpotImage{SpotID: spot.ID, URL: imageURL, Caption: caption, Position: 1}
+	if n := len(before); n > 0 {
+		img.Position = before[n-1].Position + 1
+	}
+	if err := dbFor(c).Create(&img).Error; err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	recordAudit(c, auditUpdate, spot.ID, gin.H{"images": before}, gin.H{"images": spotImages(spot.ID)})
+	backToSpot(c, spot)
+}
+
+// deleteSpotImage 删除图片：POST /admin/spot/:id/images/:image/delete
+func deleteSpotImage(c *gin.Context) {
+	spot, ok := gallerySpot(c)
+	if !ok {
+		return
+	}
+	before := spotImages(spot.ID)
+	result := dbFor(c).Where("id = ? AND spot_id = ?", c.Param("image"), spot.ID).Delete(&SpotImage{})
+	if result.RowsAffected > 0 {
+		recordAudit(c, auditUpdate, spot.ID, gin.H{"images": before}, gin.H{"images": spotImages(spot.ID)})
+	}
+	backToSpot(c, spot)
+}
+
+// reorderSpotImages 调整顺序：POST /admin/spot/:id/images/reorder
+// 表单里每张图片一对 ids / positions，按 positions 从小到大重新编号；
+// 不属于这个景点的ID直接忽略
+func reorderSpotImages(c *gin.Context) {
+	spot, ok := gallerySpot(c)
+	if !ok {
+		return
+	}
+	ids := c.PostFormArray("ids")
+	positions := c.PostFormArray("positions")
+	if len(ids) != len(positions) {
+		c.String(http.StatusBadRequest, tr(c, "error.bad_params"))
+		return
+	}
+
+	type item struct {
+		id  string
+		pos int
+	}
+	items := make([]item, len(ids))
+	for i := range ids {
+		pos, err := strconv.Atoi(positions[i])
+		if err != nil {
+			c.String(http.StatusBadRequest, tr(c, "error.order_not_number"))
+			return
+		}
+		items[i] = item{ids[i], pos}
+	}
+	// 顺序相同的保持提交时的先后
+	sort.SliceStable(items, func(i, j int) bool { return items[i].pos < items[j].pos })
+
+	before := spotImages(spot.ID)
+	err := retryTransaction(dbFor(c), func(tx *gorm.DB) error {
+		for i, it := range items {
+			if err := tx.Model(&SpotImage{}).Where("id = ? AND spot_id = ?", it.id, spot.ID).
+				Update("position", i+1).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	recordAudit(c, auditUpdate, spot.ID, gin.H{"images": before}, gin.H{"images": spotImages(spot.ID)})
+	backToSpot(c, spot)
+}
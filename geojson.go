@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== GeoJSON ====================
+
+// 地图前端（Leaflet、高德等）可以直接加载 GeoJSON，不需要再写转换代码
+
+type geoJSONFeature struct {
+	Type       string          `json:"type"` // 固定为 Feature
+	Geometry   geoJSONGeometry `json:"geometry"`
+	Properties gin.H           `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string     `json:"type"`        // 固定为 Point
+	Coordinates [2]float64 `json:"coordinates"` // 注意顺序是 [经度, 纬度]（RFC 7946）
+}
+
+// apiSpotsGeoJSON 所有填写了坐标的景点：GET /api/v1/spots.geojson
+func apiSpotsGeoJSON(c *gin.Context) {
+	var spots []Spot
+	dbFor(c).Scopes(published).Where("latitude IS NOT NULL AND longitude IS NOT NULL").
+		Order("recommend_count desc, id asc").Find(&spots)
+
+	features := make([]geoJSONFeature, 0, len(spots))
+	for _, s := range spots {
+		features = append(features, geoJSONFeature{
+			Type:     "Feature",
+			Geometry: geoJSONGeometry{Type: "Point", Coordinates: [2]float64{*s.Longitude, *s.Latitude}},
+			Properties: gin.H{
+				"id":              s.ID,
+				"name":            s.Name,
+				"url":             "/spot/" + url.PathEscape(s.Slug),
+				"ticket":          s.Ticket,
+				"transport":       s.Transport,
+				"recommend_count": s.RecommendCount,
+				"image_url":       s.ImageURL,
+				"thumbnail_url":   cardThumb(s.ImageURL),
+			},
+		})
+	}
+
+	data, err := json.Marshal(gin.H{"type": "FeatureCollection", "features": features})
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.generate_failed"))
+		return
+	}
+	c.Data(http.StatusOK, "application/geo+json; charset=utf-8", data)
+}
@@ -0,0 +1,919 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== GraphQL ====================
+
+// /graphql 接口没有引入 GraphQL 的库，这里实现了够用的一部分：
+//
+//	查询文档  query / mutation 操作、变量（含默认值）、别名、参数、具名片段和内联片段、@include / @skip、__typename
+//	执行      按选择的字段调用各字段的解析函数，结果按查询里的顺序输出；某个字段出错时这个字段为 null，
+//	          错误放在 errors 里（带上字段路径），其他字段照常返回
+//
+// 不做静态校验和类型检查（参数类型不对时由解析函数报错），也不支持内省（__schema / __type）和订阅。
+// 类型和字段在 graphql_schema.go 里定义。
+
+// graphqlMaxDepth 查询最多嵌套的层数，防止构造很深的查询拖垮数据库
+const graphqlMaxDepth = 10
+
+// ---------- 类型定义 ----------
+
+// gqlType 对象类型
+type gqlType struct {
+	name   string
+	fields map[string]*gqlField
+}
+
+// gqlField 对象类型的一个字段
+type gqlField struct {
+	typ  *gqlType // 对象（或对象列表）的类型，标量为 nil
+	args []string // 可以传的参数
+	// resolve 取字段的值，src 是所在对象；为 nil 时取 src 转成 JSON 后同名的属性
+	resolve func(r *gqlRequest, src interface{}, args map[string]interface{}) (interface{}, error)
+}
+
+// newGQLType 创建类型，fieldsOf 的 JSON 属性都作为标量字段（Go 结构体，按 json 标签）
+func newGQLType(name string, fieldsOf interface{}) *gqlType {
+	t := &gqlType{name: name, fields: map[string]*gqlField{}}
+	if fieldsOf == nil {
+		return t
+	}
+	rt := reflect.TypeOf(fieldsOf)
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		t.fields[name] = &gqlField{}
+	}
+	return t
+}
+
+// ---------- 词法分析 ----------
+
+const (
+	tokEOF = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type gqlToken struct {
+	kind int
+	val  string
+	pos  int
+}
+
+type gqlLexer struct {
+	src string
+	pos int
+}
+
+func (l *gqlLexer) next() (gqlToken, error) {
+	// 空白、逗号和注释都忽略
+	for l.pos < len(l.src) {
+		ch := l.src[l.pos]
+		if ch == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+			continue
+		}
+		if ch != ' ' && ch != '\t' && ch != '\n' && ch != '\r' && ch != ',' {
+			break
+		}
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return gqlToken{kind: tokEOF, pos: start}, nil
+	}
+	ch := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return gqlToken{tokPunct, "...", start}, nil
+	case strings.IndexByte("!$():=@[]{}|&", ch) >= 0:
+		l.pos++
+		return gqlToken{tokPunct, string(ch), start}, nil
+	case ch == '_' || isASCIILetter(ch):
+		for l.pos < len(l.src) && (l.src[l.pos] == '_' || isASCIILetter(l.src[l.pos]) || isASCIIDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return gqlToken{tokName, l.src[start:l.pos], start}, nil
+	case ch == '-' || isASCIIDigit(ch):
+		return l.number()
+	case ch == '"':
+		return l.string()
+	}
+	return gqlToken{}, fmt.Errorf("第 %d 个字符 %q 无法识别", start, ch)
+}
+
+func (l *gqlLexer) number() (gqlToken, error) {
+	start := l.pos
+	kind := tokInt
+	if l.src[l.pos] == '-' {
+		l.pos++
+	}
+	digits := func() {
+		for l.pos < len(l.src) && isASCIIDigit(l.src[l.pos]) {
+			l.pos++
+		}
+	}
+	digits()
+	if l.pos < len(l.src) && l.src[l.pos] == '.' {
+		kind = tokFloat
+		l.pos++
+		digits()
+	}
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		kind = tokFloat
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		digits()
+	}
+	return gqlToken{kind, l.src[start:l.pos], start}, nil
+}
+
+func (l *gqlLexer) string() (gqlToken, error) {
+	start := l.pos
+	// 块字符串 """...""" 原样保留，只处理 \"""
+	if strings.HasPrefix(l.src[l.pos:], `"""`) {
+		l.pos += 3
+		end := strings.Index(l.src[l.pos:], `"""`)
+		for end > 0 && l.src[l.pos+end-1] == '\\' {
+			next := strings.Index(l.src[l.pos+end+3:], `"""`)
+			if next < 0 {
+				end = -1
+				break
+			}
+			end += 3 + next
+		}
+		if end < 0 {
+			return gqlToken{}, fmt.Errorf("第 %d 个字符开始的字符串没有结束", start)
+		}
+		s := strings.ReplaceAll(l.src[l.pos:l.pos+end], `\"""`, `"""`)
+		l.pos += end + 3
+		return gqlToken{tokString, strings.TrimSpace(s), start}, nil
+	}
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		ch := l.src[l.pos]
+		switch {
+		case ch == '"':
+			l.pos++
+			return gqlToken{tokString, b.String(), start}, nil
+		case ch == '\n':
+			return gqlToken{}, fmt.Errorf("第 %d 个字符开始的字符串没有结束", start)
+		case ch == '\\' && l.pos+1 < len(l.src):
+			esc := l.src[l.pos+1]
+			l.pos += 2
+			switch esc {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if l.pos+4 > len(l.src) {
+					return gqlToken{}, fmt.Errorf("第 %d 个字符的 \\u 转义不完整", l.pos)
+				}
+				r, err := strconv.ParseUint(l.src[l.pos:l.pos+4], 16, 32)
+				if err != nil {
+					return gqlToken{}, fmt.Errorf("第 %d 个字符的 \\u 转义不正确", l.pos)
+				}
+				b.WriteRune(rune(r))
+				l.pos += 4
+			default:
+				b.WriteByte(esc)
+			}
+		default:
+			r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+			b.WriteRune(r)
+			l.pos += size
+		}
+	}
+	return gqlToken{}, fmt.Errorf("第 %d 个字符开始的字符串没有结束", start)
+}
+
+func isASCIILetter(ch byte) bool { return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' }
+func isASCIIDigit(ch byte) bool  { return ch >= '0' && ch <= '9' }
+
+// ---------- 语法分析 ----------
+
+// gqlDocument 解析后的查询文档
+type gqlDocument struct {
+	operations []*gqlOperation
+	fragments  map[string]*gqlFragment
+}
+
+// gqlOperation 一个 query 或 mutation
+type gqlOperation struct {
+	kind string // query / mutation
+	name string
+	vars []gqlVarDef
+	set  []gqlSelection
+}
+
+type gqlVarDef struct {
+	name   string
+	def    interface{}
+	hasDef bool
+}
+
+type gqlFragment struct {
+	typeCond string
+	set      []gqlSelection
+}
+
+// gqlSelection 选择集里的一项：字段、...片段名 或者 ... on 类型 { }
+type gqlSelection struct {
+	alias, name string
+	args        map[string]interface{}
+	set         []gqlSelection
+
+	spread     string // 具名片段
+	inline     bool   // 内联片段
+	typeCond   string
+	directives map[string]map[string]interface{}
+}
+
+// 查询里的值：变量是 gqlVar，枚举是 gqlEnum，其他是 int64、float64、string、bool、nil、列表和对象
+type (
+	gqlVar  string
+	gqlEnum string
+)
+
+type gqlParser struct {
+	lex *gqlLexer
+	tok gqlToken
+}
+
+// parseGraphQL 解析查询文档
+func parseGraphQL(src string) (*gqlDocument, error) {
+	p := &gqlParser{lex: &gqlLexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &gqlDocument{fragments: map[string]*gqlFragment{}}
+	for p.tok.kind != tokEOF {
+		switch {
+		case p.peek("{"):
+			set, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &gqlOperation{kind: "query", set: set})
+		case p.tok.kind == tokName && p.tok.val == "fragment":
+			name, frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			doc.fragments[name] = frag
+		case p.tok.kind == tokName && (p.tok.val == "query" || p.tok.val == "mutation"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, errors.New("查询里没有操作")
+	}
+	return doc, nil
+}
+
+func (p *gqlParser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *gqlParser) peek(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.val == punct
+}
+
+func (p *gqlParser) unexpected() error {
+	if p.tok.kind == tokEOF {
+		return errors.New("查询意外结束")
+	}
+	return fmt.Errorf("第 %d 个字符处不应该是 %q", p.tok.pos, p.tok.val)
+}
+
+func (p *gqlParser) expect(punct string) error {
+	if !p.peek(punct) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *gqlParser) name() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.unexpected()
+	}
+	name := p.tok.val
+	return name, p.advance()
+}
+
+func (p *gqlParser) operation() (*gqlOperation, error) {
+	op := &gqlOperation{kind: p.tok.val}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokName {
+		op.name = p.tok.val
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if p.peek("(") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		for !p.peek(")") {
+			v, err := p.varDef()
+			if err != nil {
+				return nil, err
+			}
+			op.vars = append(op.vars, v)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	set, err := p.selectionSet()
+	op.set = set
+	return op, err
+}
+
+// varDef $name: Type = default，类型只解析不检查
+func (p *gqlParser) varDef() (gqlVarDef, error) {
+	var v gqlVarDef
+	if err := p.expect("$"); err != nil {
+		return v, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return v, err
+	}
+	v.name = name
+	if err := p.expect(":"); err != nil {
+		return v, err
+	}
+	if err := p.typeRef(); err != nil {
+		return v, err
+	}
+	if p.peek("=") {
+		if err := p.advance(); err != nil {
+			return v, err
+		}
+		if v.def, err = p.value(true); err != nil {
+			return v, err
+		}
+		v.hasDef = true
+	}
+	return v, nil
+}
+
+func (p *gqlParser) typeRef() error {
+	if p.peek("[") {
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.peek("!") {
+		return p.advance()
+	}
+	return nil
+}
+
+func (p *gqlParser) fragment() (string, *gqlFragment, error) {
+	if err := p.advance(); err != nil {
+		return "", nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return "", nil, err
+	}
+	if p.tok.kind != tokName || p.tok.val != "on" {
+		return "", nil, p.unexpected()
+	}
+	if err := p.advance(); err != nil {
+		return "", nil, err
+	}
+	frag := &gqlFragment{}
+	if frag.typeCond, err = p.name(); err != nil {
+		return "", nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return "", nil, err
+	}
+	frag.set, err = p.selectionSet()
+	return name, frag, err
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var set []gqlSelection
+	for !p.peek("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, sel)
+	}
+	if len(set) == 0 {
+		return nil, p.unexpected()
+	}
+	return set, p.advance()
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	var sel gqlSelection
+	var err error
+	if p.peek("...") {
+		if err := p.advance(); err != nil {
+			return sel, err
+		}
+		if p.tok.kind == tokName && p.tok.val != "on" {
+			sel.spread = p.tok.val
+			if err := p.advance(); err != nil {
+				return sel, err
+			}
+			sel.directives, err = p.directives()
+			return sel, err
+		}
+		sel.inline = true
+		if p.tok.kind == tokName && p.tok.val == "on" {
+			if err := p.advance(); err != nil {
+				return sel, err
+			}
+			if sel.typeCond, err = p.name(); err != nil {
+				return sel, err
+			}
+		}
+		if sel.directives, err = p.directives(); err != nil {
+			return sel, err
+		}
+		sel.set, err = p.selectionSet()
+		return sel, err
+	}
+
+	if sel.name, err = p.name(); err != nil {
+		return sel, err
+	}
+	if p.peek(":") {
+		if err := p.advance(); err != nil {
+			return sel, err
+		}
+		sel.alias = sel.name
+		if sel.name, err = p.name(); err != nil {
+			return sel, err
+		}
+	}
+	if p.peek("(") {
+		if sel.args, err = p.arguments(); err != nil {
+			return sel, err
+		}
+	}
+	if sel.directives, err = p.directives(); err != nil {
+		return sel, err
+	}
+	if p.peek("{") {
+		sel.set, err = p.selectionSet()
+	}
+	return sel, err
+}
+
+func (p *gqlParser) arguments() (map[string]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := map[string]interface{}{}
+	for !p.peek(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.advance()
+}
+
+func (p *gqlParser) directives() (map[string]map[string]interface{}, error) {
+	var dirs map[string]map[string]interface{}
+	for p.peek("@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args := map[string]interface{}{}
+		if p.peek("(") {
+			if args, err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		if dirs == nil {
+			dirs = map[string]map[string]interface{}{}
+		}
+		dirs[name] = args
+	}
+	return dirs, nil
+}
+
+// value 解析一个值，constant 为 true 时（变量的默认值）不能引用变量
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch {
+	case p.peek("$") && !constant:
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return gqlVar(name), err
+	case p.peek("["):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for !p.peek("]") {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.advance()
+	case p.peek("{"):
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		obj := map[string]interface{}{}
+		for !p.peek("}") {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if obj[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return obj, p.advance()
+	case tok.kind == tokInt:
+		n, err := strconv.ParseInt(tok.val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个字符处的整数 %s 不正确", tok.pos, tok.val)
+		}
+		return n, p.advance()
+	case tok.kind == tokFloat:
+		f, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 个字符处的数字 %s 不正确", tok.pos, tok.val)
+		}
+		return f, p.advance()
+	case tok.kind == tokString:
+		return tok.val, p.advance()
+	case tok.kind == tokName:
+		var v interface{}
+		switch tok.val {
+		case "true":
+			v = true
+		case "false":
+			v = false
+		case "null":
+			v = nil
+		default:
+			v = gqlEnum(tok.val)
+		}
+		return v, p.advance()
+	}
+	return nil, p.unexpected()
+}
+
+// ---------- 执行 ----------
+
+// gqlRequest 一次 GraphQL 请求的执行状态
+type gqlRequest struct {
+	c      *gin.Context
+	doc    *gqlDocument
+	vars   map[string]interface{}
+	errors []gqlError
+}
+
+// gqlError 响应里 errors 的一项
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// gqlResult 一个对象的查询结果，按字段在查询里的顺序输出
+type gqlResult struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *gqlResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		buf.Write(key)
+		buf.WriteByte(':')
+		v, err := json.Marshal(o.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// operation 按名称选出要执行的操作，文档里只有一个操作时可以不指定
+func (d *gqlDocument) operation(name string) (*gqlOperation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, errors.New("查询里有多个操作，请指定 operationName")
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("查询里没有名为 %s 的操作", name)
+}
+
+// executeGraphQL 执行一个操作，返回 data；字段的错误记在 r.errors 里
+func executeGraphQL(r *gqlRequest, op *gqlOperation, root *gqlType) *gqlResult {
+	// 没有传的变量用默认值
+	for _, v := range op.vars {
+		if _, ok := r.vars[v.name]; !ok && v.hasDef {
+			r.vars[v.name] = r.value(v.def)
+		}
+	}
+	return r.selectionSet(root, nil, op.set, nil, 1)
+}
+
+// value 把查询里的值换成 Go 的值：变量换成传入的值，枚举换成字符串
+func (r *gqlRequest) value(v interface{}) interface{} {
+	switch x := v.(type) {
+	case gqlVar:
+		// 变量的值来自请求里的 JSON，数字也要转换
+		return r.value(r.vars[string(x)])
+	case gqlEnum:
+		return string(x)
+	case []interface{}:
+		list := make([]interface{}, len(x))
+		for i, item := range x {
+			list[i] = r.value(item)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(x))
+		for k, item := range x {
+			obj[k] = r.value(item)
+		}
+		return obj
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n
+		}
+		f, _ := x.Float64()
+		return f
+	}
+	return v
+}
+
+// included 按 @skip / @include 判断是否要这一项
+func (r *gqlRequest) included(sel gqlSelection) bool {
+	if d, ok := sel.directives["skip"]; ok {
+		if b, _ := r.value(d["if"]).(bool); b {
+			return false
+		}
+	}
+	if d, ok := sel.directives["include"]; ok {
+		if b, _ := r.value(d["if"]).(bool); !b {
+			return false
+		}
+	}
+	return true
+}
+
+// collect 展开片段，把同一个结果名称的字段合并（子选择集拼在一起），保持第一次出现的顺序
+func (r *gqlRequest) collect(t *gqlType, set []gqlSelection, keys *[]string, fields map[string]*gqlSelection, visited map[string]bool) {
+	for _, sel := range set {
+		if !r.included(sel) {
+			continue
+		}
+		switch {
+		case sel.spread != "":
+			frag := r.doc.fragments[sel.spread]
+			if frag == nil || visited[sel.spread] || frag.typeCond != t.name {
+				continue
+			}
+			visited[sel.spread] = true
+			r.collect(t, frag.set, keys, fields, visited)
+		case sel.inline:
+			if sel.typeCond == "" || sel.typeCond == t.name {
+				r.collect(t, sel.set, keys, fields, visited)
+			}
+		default:
+			key := sel.alias
+			if key == "" {
+				key = sel.name
+			}
+			if prev, ok := fields[key]; ok {
+				prev.set = append(prev.set[:len(prev.set):len(prev.set)], sel.set...)
+				continue
+			}
+			s := sel
+			fields[key] = &s
+			*keys = append(*keys, key)
+		}
+	}
+}
+
+// selectionSet 在对象 src 上执行选择集
+func (r *gqlRequest) selectionSet(t *gqlType, src interface{}, set []gqlSelection, path []interface{}, depth int) *gqlResult {
+	var keys []string
+	fields := map[string]*gqlSelection{}
+	r.collect(t, set, &keys, fields, map[string]bool{})
+
+	result := &gqlResult{keys: keys, values: make(map[string]interface{}, len(keys))}
+	var props map[string]interface{} // src 转成的 JSON 对象，取默认字段时才转换
+	for _, key := range keys {
+		sel := fields[key]
+		fieldPath := append(path[:len(path):len(path)], key)
+		if sel.name == "__typename" {
+			result.values[key] = t.name
+			continue
+		}
+		field := t.fields[sel.name]
+		if field == nil {
+			r.fail(fieldPath, "类型 %s 没有字段 %s", t.name, sel.name)
+			continue
+		}
+		if depth > graphqlMaxDepth {
+			r.fail(fieldPath, "查询最多嵌套 %d 层", graphqlMaxDepth)
+			continue
+		}
+		args := make(map[string]interface{}, len(sel.args))
+		bad := ""
+		for name, v := range sel.args {
+			if !containsString(field.args, name) {
+				bad = name
+				break
+			}
+			args[name] = r.value(v)
+		}
+		if bad != "" {
+			r.fail(fieldPath, "字段 %s 没有参数 %s", sel.name, bad)
+			continue
+		}
+
+		var value interface{}
+		var err error
+		if field.resolve != nil {
+			value, err = field.resolve(r, src, args)
+		} else {
+			if props == nil {
+				props, err = jsonObject(src)
+			}
+			value = props[sel.name]
+		}
+		if err != nil {
+			r.fail(fieldPath, "%s", err.Error())
+			continue
+		}
+		result.values[key] = r.complete(field.typ, value, sel, fieldPath, depth)
+	}
+	return result
+}
+
+// complete 按字段类型处理取到的值：对象继续执行子选择集，列表逐项处理，标量原样返回
+func (r *gqlRequest) complete(t *gqlType, value interface{}, sel *gqlSelection, path []interface{}, depth int) interface{} {
+	if isNil(value) {
+		return nil
+	}
+	if t == nil {
+		if len(sel.set) > 0 {
+			r.fail(path, "字段 %s 不是对象，不能选择子字段", sel.name)
+			return nil
+		}
+		return value
+	}
+	if len(sel.set) == 0 {
+		r.fail(path, "字段 %s 是 %s，需要选择子字段", sel.name, t.name)
+		return nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = r.complete(t, rv.Index(i).Interface(), sel, append(path[:len(path):len(path)], i), depth)
+		}
+		return list
+	}
+	return r.selectionSet(t, value, sel.set, path, depth+1)
+}
+
+func (r *gqlRequest) fail(path []interface{}, format string, args ...interface{}) {
+	r.errors = append(r.errors, gqlError{Message: fmt.Sprintf(format, args...), Path: path})
+}
+
+// jsonObject 把对象转成 JSON 对象，数字保持原样（不转成 float64）
+func jsonObject(src interface{}) (map[string]interface{}, error) {
+	switch m := src.(type) {
+	case map[string]interface{}:
+		return m, nil
+	case gin.H:
+		return m, nil
+	}
+	data, err := json.Marshal(src)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m map[string]interface{}
+	err = dec.Decode(&m)
+	return m, err
+}
+
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
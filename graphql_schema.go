@@ -0,0 +1,495 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== GraphQL 接口 ====================
+
+// POST /graphql，请求体 {"query": "...", "operationName": "...", "variables": {...}}；
+// 只读的查询也可以用 GET /graphql?query=...&variables=...。前端一次请求就能取到需要的字段，不用拼好几个 REST 接口。
+// 字段名和 REST 接口的 JSON 一样用下划线（rating_avg、next_cursor）。认证和 /api/v1 一样：
+// X-API-Key 可选（按 Key 限流），修改数据的操作要带 Authorization: Bearer <令牌>，不认登录页面的 Cookie。
+//
+//	type Query {
+//	  spots(q, province, city, tag: [String], min_price, max_price, free, min_rating, open_now, sort, first, after): SpotPage
+//	  spot(id, slug): Spot
+//	  tags: [Tag]
+//	}
+//	type Mutation {
+//	  createSpot(input): Spot                 # 登录用户，input 的字段同 POST /api/v1/spots
+//	  updateSpot(id, input): Spot             # 管理员，input 同 PUT /api/v1/spots/:id
+//	  deleteSpot(id): Boolean                 # 管理员，移到回收站
+//	  addComment(spot_id, body, parent_id): Comment
+//	  rateSpot(id, stars): Spot
+//	}
+//	type SpotPage { nodes: [Spot]  next_cursor }
+//	type Spot { REST 接口里景点的所有字段  tags: [Tag]  images: [Image]  comments(page, first, after, collapsed): CommentPage  my_rating  price_text }
+//	type CommentPage { comments: [Comment]  total  count  page  next_page  next_cursor }
+//	type Comment { id  spot_id  parent_id  author  body  status  created_at  reply_count  replies: [Comment] }
+
+// graphqlQuery, graphqlMutation 查询和修改的根类型
+var graphqlQuery, graphqlMutation = graphqlSchema()
+
+func graphqlSchema() (query, mutation *gqlType) {
+	tagType := newGQLType("Tag", Tag{})
+	imageType := newGQLType("Image", SpotImage{})
+	cloudType := newGQLType("TagCount", tagCloudItem{})
+
+	commentType := newGQLType("Comment", Comment{})
+	commentType.fields["replies"].typ = commentType
+	commentPageType := newGQLType("CommentPage", commentPage{})
+	commentPageType.fields["comments"].typ = commentType
+
+	spotType := newGQLType("Spot", Spot{})
+	spotType.fields["tags"].typ = tagType
+	spotType.fields["images"] = &gqlField{typ: imageType, resolve: gqlSpotImages}
+	spotType.fields["comments"] = &gqlField{typ: commentPageType, args: []string{"page", "first", "after", "collapsed"}, resolve: gqlSpotComments}
+	spotType.fields["my_rating"] = &gqlField{resolve: func(r *gqlRequest, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return visitorRating(r.c, src.(Spot).ID), nil
+	}}
+	spotType.fields["price_text"] = &gqlField{resolve: func(r *gqlRequest, src interface{}, _ map[string]interface{}) (interface{}, error) {
+		return src.(Spot).PriceText(), nil
+	}}
+	spotPageType := newGQLType("SpotPage", nil)
+	spotPageType.fields["nodes"] = &gqlField{typ: spotType}
+	spotPageType.fields["next_cursor"] = &gqlField{}
+
+	query = newGQLType("Query", nil)
+	query.fields["spots"] = &gqlField{typ: spotPageType, resolve: gqlSpots, args: []string{
+		"q", "province", "city", "tag", "min_price", "max_price", "free", "min_rating", "open_now", "sort", "first", "after"}}
+	query.fields["spot"] = &gqlField{typ: spotType, args: []string{"id", "slug"}, resolve: gqlSpot}
+	query.fields["tags"] = &gqlField{typ: cloudType, resolve: func(*gqlRequest, interface{}, map[string]interface{}) (interface{}, error) {
+		return tagCloud(), nil
+	}}
+
+	mutation = newGQLType("Mutation", nil)
+	mutation.fields["createSpot"] = &gqlField{typ: spotType, args: []string{"input"}, resolve: gqlCreateSpot}
+	mutation.fields["updateSpot"] = &gqlField{typ: spotType, args: []string{"id", "input"}, resolve: gqlUpdateSpot}
+	mutation.fields["deleteSpot"] = &gqlField{args: []string{"id"}, resolve: gqlDeleteSpot}
+	mutation.fields["addComment"] = &gqlField{typ: commentType, args: []string{"spot_id", "body", "parent_id"}, resolve: gqlAddComment}
+	mutation.fields["rateSpot"] = &gqlField{typ: spotType, args: []string{"id", "stars"}, resolve: gqlRateSpot}
+	return query, mutation
+}
+
+// ---------- 参数 ----------
+
+// gqlString 字符串参数，没有传时为空；数字也转成字符串（ID、价格等）
+func gqlString(args map[string]interface{}, name string) (string, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("参数 %s 必须是字符串", name)
+}
+
+// gqlInt 整数参数，ok 为 false 表示没有传
+func gqlInt(args map[string]interface{}, name string) (n int, ok bool, err error) {
+	switch v := args[name].(type) {
+	case nil:
+		return 0, false, nil
+	case int64:
+		return int(v), true, nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v), true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("参数 %s 必须是整数", name)
+}
+
+// gqlBool 布尔参数，没有传时为 false
+func gqlBool(args map[string]interface{}, name string) (bool, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	}
+	return false, fmt.Errorf("参数 %s 必须是 true 或 false", name)
+}
+
+// gqlID 景点、评论等的ID，数字和字符串都可以
+func gqlID(args map[string]interface{}, name string) (string, error) {
+	s, err := gqlString(args, name)
+	if err == nil && s == "" {
+		err = fmt.Errorf("缺少参数 %s", name)
+	}
+	return s, err
+}
+
+// gqlUser 修改数据的操作要求带访问令牌
+func gqlUser(r *gqlRequest) (*User, error) {
+	user := currentUser(r.c)
+	if user == nil {
+		return nil, errors.New("缺少访问令牌")
+	}
+	return user, nil
+}
+
+func gqlAdmin(r *gqlRequest) error {
+	if _, err := gqlUser(r); err != nil {
+		return err
+	}
+	if !currentUser(r.c).IsAdmin() {
+		return errors.New("需要管理员权限")
+	}
+	return nil
+}
+
+// ---------- 查询 ----------
+
+// gqlSpots 景点列表，筛选条件和 GET /api/v1/spots 一样，总是按游标分页（first 默认 20，最多 100）
+func gqlSpots(r *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	values := url.Values{}
+	for _, name := range []string{"q", "province", "city", "min_price", "max_price", "min_rating", "sort"} {
+		v, err := gqlString(args, name)
+		if err != nil {
+			return nil, err
+		}
+		if v != "" {
+			values.Set(name, v)
+		}
+	}
+	switch tags := args["tag"].(type) {
+	case nil:
+	case string:
+		values.Add("tag", tags)
+	case []interface{}:
+		for _, t := range tags {
+			s, ok := t.(string)
+			if !ok {
+				return nil, errors.New("参数 tag 必须是字符串列表")
+			}
+			values.Add("tag", s)
+		}
+	default:
+		return nil, errors.New("参数 tag 必须是字符串列表")
+	}
+	for _, name := range []string{"free", "open_now"} {
+		b, err := gqlBool(args, name)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			values.Set(name, "1")
+		}
+	}
+	first, ok, err := gqlInt(args, "first")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		first = cursorLimit
+	}
+	if first < 1 || first > cursorMaxLimit {
+		return nil, fmt.Errorf("first 必须在 1 到 %d 之间", cursorMaxLimit)
+	}
+	after, err := gqlString(args, "after")
+	if err != nil {
+		return nil, err
+	}
+	spots, next, err := spotsPage(r.c, values, first, after)
+	if err != nil {
+		return nil, err
+	}
+	page := map[string]interface{}{"nodes": spots, "next_cursor": nil}
+	if next != "" {
+		page["next_cursor"] = next
+	}
+	return page, nil
+}
+
+// gqlSpot 按 id 或 slug 取一个景点，不存在时为 null
+func gqlSpot(r *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	key, err := gqlString(args, "slug")
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		if key, err = gqlID(args, "id"); err != nil {
+			return nil, errors.New("需要 id 或 slug 参数")
+		}
+	}
+	spot, err := findSpot(r.c, key)
+	if err != nil {
+		return nil, nil
+	}
+	s := *spot
+	localizeSpot(r.c, &s)
+	return s, nil
+}
+
+func gqlSpotImages(r *gqlRequest, src interface{}, _ map[string]interface{}) (interface{}, error) {
+	if spot := src.(Spot); len(spot.Images) > 0 {
+		return spot.Images, nil
+	}
+	return spotImages(src.(Spot).ID), nil
+}
+
+// gqlSpotComments 景点的评论，按讨论串分页：传 page 时按页码，传 first / after 时按游标
+func gqlSpotComments(r *gqlRequest, src interface{}, args map[string]interface{}) (interface{}, error) {
+	spotID := src.(Spot).ID
+	collapsed, err := gqlBool(args, "collapsed")
+	if err != nil {
+		return nil, err
+	}
+	first, hasFirst, err := gqlInt(args, "first")
+	if err != nil {
+		return nil, err
+	}
+	after, err := gqlString(args, "after")
+	if err != nil {
+		return nil, err
+	}
+	if !hasFirst && after == "" {
+		page, _, err := gqlInt(args, "page")
+		if err != nil {
+			return nil, err
+		}
+		return spotComments(spotID, page, collapsed), nil
+	}
+	if !hasFirst {
+		first = cursorLimit
+	}
+	if first < 1 || first > cursorMaxLimit {
+		return nil, fmt.Errorf("first 必须在 1 到 %d 之间", cursorMaxLimit)
+	}
+	return spotCommentsAfter(spotID, after, first, collapsed)
+}
+
+// ---------- 修改 ----------
+
+// gqlSpotInput 把 input 参数转成 spotInput 并校验，校验规则和 REST 接口一样
+func gqlSpotInput(args map[string]interface{}) (*spotInput, error) {
+	raw, ok := args["input"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("缺少参数 input")
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var in spotInput
+	if err := json.Unmarshal(data, &in); err != nil {
+		return nil, errors.New("input 格式错误")
+	}
+	if err := validateSpotInput(&in); err != nil {
+		return nil, err
+	}
+	return &in, nil
+}
+
+func gqlCreateSpot(r *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	if _, err := gqlUser(r); err != nil {
+		return nil, err
+	}
+	in, err := gqlSpotInput(args)
+	if err != nil {
+		return nil, err
+	}
+	spot, msg := createSpot(r.c, in)
+	if msg != "" {
+		return nil, errors.New(msg)
+	}
+	return spot, nil
+}
+
+func gqlUpdateSpot(r *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	if err := gqlAdmin(r); err != nil {
+		return nil, err
+	}
+	id, err := gqlID(args, "id")
+	if err != nil {
+		return nil, err
+	}
+	var spot Spot
+	if err := dbFor(r.c).Preload("Tags").First(&spot, id).Error; err != nil {
+		return nil, errors.New("景点不存在")
+	}
+	in, err := gqlSpotInput(args)
+	if err != nil {
+		return nil, err
+	}
+	if msg := updateSpot(r.c, &spot, in); msg != "" {
+		return nil, errors.New(msg)
+	}
+	return spot, nil
+}
+
+func gqlDeleteSpot(r *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	if err := gqlAdmin(r); err != nil {
+		return nil, err
+	}
+	id, err := gqlID(args, "id")
+	if err != nil {
+		return nil, err
+	}
+	var spot Spot
+	if err := dbFor(r.c).First(&spot, id).Error; err != nil {
+		return nil, errors.New("景点不存在")
+	}
+	deleteSpot(r.c, &spot)
+	return true, nil
+}
+
+// gqlAddComment 发表评论，和 POST /api/v1/spots/:id/comments 一样，昵称用用户名
+func gqlAddComment(r *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	if _, err := gqlUser(r); err != nil {
+		return nil, err
+	}
+	id, err := gqlID(args, "spot_id")
+	if err != nil {
+		return nil, err
+	}
+	body, err := gqlString(args, "body")
+	if err != nil {
+		return nil, err
+	}
+	parentID, _, err := gqlInt(args, "parent_id")
+	if err != nil || parentID < 0 {
+		return nil, errors.New("参数 parent_id 必须是评论ID")
+	}
+	var spot Spot
+	if err := dbFor(r.c).Scopes(published).First(&spot, id).Error; err != nil {
+		return nil, errors.New("景点不存在")
+	}
+	comment, msg := newComment(r.c, spot.ID, uint(parentID), "", body)
+	if msg != "" {
+		return nil, errors.New(msg)
+	}
+	if err := dbFor(r.c).Create(&comment).Error; err != nil {
+		return nil, errors.New("保存失败")
+	}
+	notifyComment(&comment, false)
+	return comment, nil
+}
+
+// gqlRateSpot 给景点评分（已经评过时修改），返回评分后的景点
+func gqlRateSpot(r *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+	if _, err := gqlUser(r); err != nil {
+		return nil, err
+	}
+	id, err := gqlID(args, "id")
+	if err != nil {
+		return nil, err
+	}
+	stars, _, err := gqlInt(args, "stars")
+	if err != nil {
+		return nil, err
+	}
+	_, err = rateSpot(id, visitorKeys(r.c), r.c.ClientIP(), stars)
+	switch {
+	case errors.Is(err, errInvalidStars):
+		return nil, errors.New("评分必须是 1 到 5 星")
+	case err != nil:
+		return nil, errors.New("景点不存在")
+	}
+	var spot Spot
+	if err := dbFor(r.c).Scopes(published).Preload("Tags").First(&spot, id).Error; err != nil {
+		return nil, errors.New("景点不存在")
+	}
+	localizeSpot(r.c, &spot)
+	return spot, nil
+}
+
+// ---------- 处理函数 ----------
+
+// graphqlAuth 不认页面登录的 Cookie（/graphql 不做 CSRF 校验），只认 Authorization: Bearer <令牌>；
+// 不带令牌时匿名访问，带了就必须有效
+func graphqlAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user", (*User)(nil))
+		auth := c.GetHeader("Authorization")
+		if auth == "" {
+			c.Next()
+			return
+		}
+		raw := strings.TrimPrefix(auth, "Bearer ")
+		user, err := parseToken(raw)
+		if raw == auth || err != nil {
+			graphqlError(c, http.StatusUnauthorized, "访问令牌无效或已过期")
+			return
+		}
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// graphqlError 请求本身有问题（格式错、查询语法错），不执行
+func graphqlError(c *gin.Context, code int, msg string) {
+	c.AbortWithStatusJSON(code, gin.H{"errors": []gqlError{{Message: msg}}, "request_id": c.GetString("requestID")})
+}
+
+// serveGraphQL GET / POST /graphql
+func serveGraphQL(c *gin.Context) {
+	var req struct {
+		Query         string          `json:"query"`
+		OperationName string          `json:"operationName"`
+		Variables     json.RawMessage `json:"variables"`
+	}
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		req.Variables = json.RawMessage(c.Query("variables"))
+	} else if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		graphqlError(c, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	vars := map[string]interface{}{}
+	if len(req.Variables) > 0 && string(req.Variables) != "null" {
+		dec := json.NewDecoder(strings.NewReader(string(req.Variables)))
+		dec.UseNumber()
+		if err := dec.Decode(&vars); err != nil {
+			graphqlError(c, http.StatusBadRequest, "variables 必须是 JSON 对象")
+			return
+		}
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		graphqlError(c, http.StatusBadRequest, "缺少 query")
+		return
+	}
+
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		graphqlError(c, http.StatusBadRequest, "查询语法错误："+err.Error())
+		return
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		graphqlError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	root := graphqlQuery
+	if op.kind == "mutation" {
+		// GET 请求可能被缓存、预取，不能修改数据
+		if c.Request.Method == http.MethodGet {
+			c.Header("Allow", http.MethodPost)
+			graphqlError(c, http.StatusMethodNotAllowed, "修改数据请用 POST")
+			return
+		}
+		root = graphqlMutation
+	}
+
+	r := &gqlRequest{c: c, doc: doc, vars: vars}
+	resp := gin.H{"data": executeGraphQL(r, op, root)}
+	if len(r.errors) > 0 {
+		resp["errors"] = r.errors
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ---------- 解析 ----------
+
+func TestParseGraphQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		check func(t *testing.T, doc *gqlDocument)
+	}{
+		{"简写查询", `{ spots { nodes { name } } }`, func(t *testing.T, doc *gqlDocument) {
+			op := doc.operations[0]
+			if op.kind != "query" || op.name != "" || len(op.set) != 1 || op.set[0].name != "spots" {
+				t.Fatalf("操作不对：%+v", op)
+			}
+			if nodes := op.set[0].set[0]; nodes.name != "nodes" || nodes.set[0].name != "name" {
+				t.Fatalf("子字段不对：%+v", nodes)
+			}
+		}},
+		{"变量和默认值", `query List($first: Int = 10, $tags: [String!]!) { spots(first: $first, tag: $tags) { next_cursor } }`, func(t *testing.T, doc *gqlDocument) {
+			op := doc.operations[0]
+			if op.name != "List" || len(op.vars) != 2 {
+				t.Fatalf("操作不对：%+v", op)
+			}
+			if v := op.vars[0]; v.name != "first" || !v.hasDef || v.def != int64(10) {
+				t.Errorf("$first = %+v", v)
+			}
+			if v := op.vars[1]; v.name != "tags" || v.hasDef {
+				t.Errorf("$tags = %+v", v)
+			}
+			want := map[string]interface{}{"first": gqlVar("first"), "tag": gqlVar("tags")}
+			if args := op.set[0].args; !reflect.DeepEqual(args, want) {
+				t.Errorf("参数 = %#v，应为 %#v", args, want)
+			}
+		}},
+		{"别名和指令", `{ a: spot(id: 1) @include(if: $show) @skip(if: false) { name } }`, func(t *testing.T, doc *gqlDocument) {
+			sel := doc.operations[0].set[0]
+			if sel.alias != "a" || sel.name != "spot" || sel.args["id"] != int64(1) {
+				t.Fatalf("字段不对：%+v", sel)
+			}
+			if sel.directives["include"]["if"] != gqlVar("show") || sel.directives["skip"]["if"] != false {
+				t.Errorf("指令 = %#v", sel.directives)
+			}
+		}},
+		{"片段", `query { ...F ... on Query { tags { name } } ... { spots { next_cursor } } } fragment F on Query { tags { count } }`, func(t *testing.T, doc *gqlDocument) {
+			set := doc.operations[0].set
+			if len(set) != 3 || set[0].spread != "F" || !set[1].inline || set[1].typeCond != "Query" || !set[2].inline || set[2].typeCond != "" {
+				t.Fatalf("选择集不对：%+v", set)
+			}
+			if f := doc.fragments["F"]; f == nil || f.typeCond != "Query" || f.set[0].name != "tags" {
+				t.Errorf("片段 F = %+v", f)
+			}
+		}},
+		{"各种值", `{ f(a: -1.5e3, b: "x\ty中\"", c: [1, "2", true, null, RED], d: {k: false}, e: """  block "q" \""" """) }`, func(t *testing.T, doc *gqlDocument) {
+			want := map[string]interface{}{
+				"a": -1500.0,
+				"b": "x\ty中\"",
+				"c": []interface{}{int64(1), "2", true, nil, gqlEnum("RED")},
+				"d": map[string]interface{}{"k": false},
+				"e": `block "q" """`,
+			}
+			if args := doc.operations[0].set[0].args; !reflect.DeepEqual(args, want) {
+				t.Errorf("参数 = %#v，应为 %#v", args, want)
+			}
+		}},
+		{"注释和逗号", "# 注释\n{ a,, b # 行尾注释\n c }", func(t *testing.T, doc *gqlDocument) {
+			if set := doc.operations[0].set; len(set) != 3 || set[2].name != "c" {
+				t.Errorf("选择集不对：%+v", set)
+			}
+		}},
+		{"多个操作", `query A { a } mutation B { deleteSpot(id: "1") }`, func(t *testing.T, doc *gqlDocument) {
+			if len(doc.operations) != 2 || doc.operations[1].kind != "mutation" || doc.operations[1].name != "B" {
+				t.Errorf("操作不对：%+v", doc.operations)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseGraphQL(tt.src)
+			if err != nil {
+				t.Fatalf("解析出错：%v", err)
+			}
+			tt.check(t, doc)
+		})
+	}
+}
+
+func TestParseGraphQLSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{``, "查询里没有操作"},
+		{`# 只有注释`, "查询里没有操作"},
+		{`{`, "查询意外结束"},
+		{`{ }`, `第 2 个字符处不应该是 "}"`},
+		{`{ a } }`, `第 6 个字符处不应该是 "}"`},
+		{`{ a(b: ) }`, `第 7 个字符处不应该是 ")"`},
+		{`{ a(b 1) }`, `第 6 个字符处不应该是 "1"`},
+		{`{ a ^ }`, "第 4 个字符 '^' 无法识别"},
+		{`{ a(b: "x) }`, "第 7 个字符开始的字符串没有结束"},
+		{"{ a(b: \"x\n\") }", "第 7 个字符开始的字符串没有结束"},
+		{`{ a(b: """x) }`, "第 7 个字符开始的字符串没有结束"},
+		{`{ a(b: "\u12") }`, `\u 转义不正确`},
+		{`{ a(b: 99999999999999999999) }`, "整数 99999999999999999999 不正确"},
+		{`query ($a: = 1) { a }`, `第 11 个字符处不应该是 "="`},
+		{`query ($a: Int = $b) { a }`, `第 17 个字符处不应该是 "$"`},
+		{`query ($a: [Int) { a }`, `第 15 个字符处不应该是 ")"`},
+		{`fragment F Query { a }`, `第 11 个字符处不应该是 "Query"`},
+		{`subscription { a }`, `第 0 个字符处不应该是 "subscription"`},
+		{`{ ... }`, `第 6 个字符处不应该是 "}"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := parseGraphQL(tt.src)
+			if err == nil {
+				t.Fatalf("应该出错")
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("错误 = %q，应包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGraphQLDocumentOperation(t *testing.T) {
+	doc, err := parseGraphQL(`query A { a } query B { b }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.operation(""); err == nil || !strings.Contains(err.Error(), "operationName") {
+		t.Errorf("多个操作时不指定名称应该出错，得到 %v", err)
+	}
+	if op, err := doc.operation("B"); err != nil || op.set[0].name != "b" {
+		t.Errorf("operation(B) = %+v, %v", op, err)
+	}
+	if _, err := doc.operation("C"); err == nil {
+		t.Errorf("没有的操作应该出错")
+	}
+}
+
+// ---------- 执行 ----------
+
+type testBook struct {
+	ID    int      `json:"id"`
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+var testBooks = []testBook{
+	{ID: 1, Title: "A", Tags: []string{"x"}},
+	{ID: 2, Title: "B", Tags: []string{}},
+}
+
+// testGraphQLSchema 执行测试用的类型，不查数据库
+func testGraphQLSchema() *gqlType {
+	bookType := newGQLType("Book", testBook{})
+	bookType.fields["related"] = &gqlField{typ: bookType, resolve: func(*gqlRequest, interface{}, map[string]interface{}) (interface{}, error) {
+		return testBooks[:1], nil
+	}}
+	bookType.fields["broken"] = &gqlField{resolve: func(*gqlRequest, interface{}, map[string]interface{}) (interface{}, error) {
+		return nil, errors.New("取不到")
+	}}
+
+	query := newGQLType("Query", nil)
+	query.fields["books"] = &gqlField{typ: bookType, resolve: func(*gqlRequest, interface{}, map[string]interface{}) (interface{}, error) {
+		return testBooks, nil
+	}}
+	query.fields["book"] = &gqlField{typ: bookType, args: []string{"id"}, resolve: func(_ *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+		id, _ := args["id"].(int64)
+		for i := range testBooks {
+			if int64(testBooks[i].ID) == id {
+				return &testBooks[i], nil
+			}
+		}
+		return (*testBook)(nil), nil
+	}}
+	query.fields["echo"] = &gqlField{args: []string{"value"}, resolve: func(_ *gqlRequest, _ interface{}, args map[string]interface{}) (interface{}, error) {
+		return args["value"], nil
+	}}
+	return query
+}
+
+// runGraphQL 解析并执行查询，返回 data 的 JSON 和“路径: 错误信息”列表
+func runGraphQL(t *testing.T, root *gqlType, src string, vars map[string]interface{}) (string, []string) {
+	t.Helper()
+	doc, err := parseGraphQL(src)
+	if err != nil {
+		t.Fatalf("解析出错：%v", err)
+	}
+	op, err := doc.operation("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars == nil {
+		vars = map[string]interface{}{}
+	}
+	r := &gqlRequest{doc: doc, vars: vars}
+	data, err := json.Marshal(executeGraphQL(r, op, root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var errs []string
+	for _, e := range r.errors {
+		path := make([]string, len(e.Path))
+		for i, p := range e.Path {
+			path[i] = fmt.Sprint(p)
+		}
+		errs = append(errs, strings.Join(path, ".")+": "+e.Message)
+	}
+	return string(data), errs
+}
+
+func TestExecuteGraphQL(t *testing.T) {
+	root := testGraphQLSchema()
+	tests := []struct {
+		name     string
+		query    string
+		vars     map[string]interface{}
+		wantData string
+		wantErrs []string
+	}{
+		{"列表和标量", `{ books { id title } }`, nil,
+			`{"books":[{"id":1,"title":"A"},{"id":2,"title":"B"}]}`, nil},
+		{"按查询里的顺序输出，别名和 __typename", `{ second: book(id: 2) { title } first: book(id: 1) { __typename title } }`, nil,
+			`{"second":{"title":"B"},"first":{"__typename":"Book","title":"A"}}`, nil},
+		{"变量的默认值", `query ($id: Int = 1) { book(id: $id) { title } }`, nil,
+			`{"book":{"title":"A"}}`, nil},
+		{"传入的变量（JSON 数字）", `query ($id: Int = 1) { book(id: $id) { title } }`, map[string]interface{}{"id": json.Number("2")},
+			`{"book":{"title":"B"}}`, nil},
+		{"片段展开并合并同名字段", `{ book(id: 1) { ...F ... on Book { tags } id ... on Query { books { id } } } } fragment F on Book { title id }`, nil,
+			`{"book":{"title":"A","id":1,"tags":["x"]}}`, nil},
+		{"同名字段的子选择集合并", `{ book(id: 1) { related { id } related { title } } }`, nil,
+			`{"book":{"related":[{"id":1,"title":"A"}]}}`, nil},
+		{"@include 和 @skip", `query ($show: Boolean!) { books @include(if: $show) { id } echo(value: "hi") @skip(if: true) __typename }`, map[string]interface{}{"show": false},
+			`{"__typename":"Query"}`, nil},
+		{"枚举、列表和对象参数", `{ echo(value: {a: [RED, 1.5, $v]}) }`, map[string]interface{}{"v": "var"},
+			`{"echo":{"a":["RED",1.5,"var"]}}`, nil},
+		{"对象为空时返回 null", `{ book(id: 9) { title } }`, nil,
+			`{"book":null}`, nil},
+
+		{"没有的字段", `{ nope books { id } }`, nil,
+			`{"nope":null,"books":[{"id":1},{"id":2}]}`, []string{"nope: 类型 Query 没有字段 nope"}},
+		{"子对象里没有的字段", `{ book(id: 1) { title isbn } }`, nil,
+			`{"book":{"title":"A","isbn":null}}`, []string{"book.isbn: 类型 Book 没有字段 isbn"}},
+		{"没有的参数", `{ books(first: 1) { id } }`, nil,
+			`{"books":null}`, []string{"books: 字段 books 没有参数 first"}},
+		{"解析函数出错时带上列表下标", `{ books { id broken } }`, nil,
+			`{"books":[{"id":1,"broken":null},{"id":2,"broken":null}]}`, []string{"books.0.broken: 取不到", "books.1.broken: 取不到"}},
+		{"标量不能选择子字段", `{ echo(value: 1) { x } }`, nil,
+			`{"echo":null}`, []string{"echo: 字段 echo 不是对象，不能选择子字段"}},
+		{"对象要选择子字段", `{ books }`, nil,
+			`{"books":null}`, []string{"books: 字段 books 是 Book，需要选择子字段"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, errs := runGraphQL(t, root, tt.query, tt.vars)
+			if data != tt.wantData {
+				t.Errorf("data = %s\n应为     %s", data, tt.wantData)
+			}
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Errorf("errors = %q\n应为       %q", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestExecuteGraphQLMaxDepth(t *testing.T) {
+	// nested 返回 { books { related { … { id } } } }，根选择集是第 1 层，id 在第 n+2 层
+	nested := func(n int) string {
+		return "{ books { " + strings.Repeat("related { ", n) + "id" + strings.Repeat(" }", n) + " } }"
+	}
+	_, errs := runGraphQL(t, testGraphQLSchema(), nested(graphqlMaxDepth-1), nil)
+	if len(errs) != 2 {
+		t.Fatalf("errors = %q，应该每本书一个", errs)
+	}
+	for _, e := range errs {
+		if !strings.HasSuffix(e, fmt.Sprintf(".id: 查询最多嵌套 %d 层", graphqlMaxDepth)) {
+			t.Errorf("error = %q", e)
+		}
+	}
+
+	if _, errs := runGraphQL(t, testGraphQLSchema(), nested(graphqlMaxDepth-2), nil); errs != nil {
+		t.Errorf("%d 层以内不应该出错：%q", graphqlMaxDepth, errs)
+	}
+}
+
+// 接口的根类型：没有的字段和参数在调用解析函数（查数据库）之前就报错
+func TestExecuteGraphQLSchemaUnknownFields(t *testing.T) {
+	tests := []struct {
+		root     *gqlType
+		query    string
+		wantData string
+		wantErrs []string
+	}{
+		{graphqlQuery, `{ nope __typename }`, `{"nope":null,"__typename":"Query"}`, []string{"nope: 类型 Query 没有字段 nope"}},
+		{graphqlQuery, `{ spots(bogus: 1) { next_cursor } }`, `{"spots":null}`, []string{"spots: 字段 spots 没有参数 bogus"}},
+		{graphqlQuery, `{ spot(id: 1, name: "x") { name } }`, `{"spot":null}`, []string{"spot: 字段 spot 没有参数 name"}},
+		{graphqlMutation, `mutation { dropAll }`, `{"dropAll":null}`, []string{"dropAll: 类型 Mutation 没有字段 dropAll"}},
+		{graphqlMutation, `mutation { deleteSpot(id: 1, force: true) }`, `{"deleteSpot":null}`, []string{"deleteSpot: 字段 deleteSpot 没有参数 force"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			data, errs := runGraphQL(t, tt.root, tt.query, nil)
+			if data != tt.wantData {
+				t.Errorf("data = %s，应为 %s", data, tt.wantData)
+			}
+			if !reflect.DeepEqual(errs, tt.wantErrs) {
+				t.Errorf("errors = %q，应为 %q", errs, tt.wantErrs)
+			}
+		})
+	}
+}
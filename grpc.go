@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protowire"
+	"gorm.io/gorm"
+)
+
+// ==================== gRPC ====================
+
+// 给内部服务用的 gRPC 接口，定义见 proto/spot.proto（touristspots.v1.SpotService），
+// 和 REST、GraphQL 调用同样的函数（spotsPage、createSpot、updateSpot、deleteSpot、recommendSpot），校验、审核、操作日志都一样。
+// 配置 server.grpc_addr（如 :9090）后另外监听这个端口，留空不启动。
+//
+// 没有引入 grpc-go，这里按 gRPC 的 HTTP/2 协议直接实现：只有一元调用（不支持流）；明文 HTTP/2（h2c），
+// 需要 TLS 时放在反向代理（Envoy、Nginx 的 grpc_pass）后面；请求可以用 gzip 压缩，响应不压缩。
+// 认证：metadata 里带 authorization: Bearer <JWT>（和 REST 接口同一个令牌），不带时匿名，只能 List / Get；
+// accept-language 决定返回哪种语言的翻译（见 translation.go）。
+
+// grpcService 服务的全名，请求路径是 /<服务全名>/<方法名>
+const grpcService = "touristspots.v1.SpotService"
+
+// grpcMaxMessage 请求消息的最大长度，和 grpc-go 的默认值一样
+const grpcMaxMessage = 4 << 20
+
+// gRPC 状态码
+const (
+	grpcOK                 = 0
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcAlreadyExists      = 6
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnauthenticated    = 16
+)
+
+// grpcError 带 gRPC 状态码的错误，处理函数返回其他错误时按 INTERNAL 处理
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+func grpcErrorf(code int, format string, args ...interface{}) error {
+	return &grpcError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// grpcMethods 方法名 → 处理函数，收到的是解码后的请求消息，返回编码好的响应消息
+var grpcMethods = map[string]func(c *gin.Context, req pbMessage) ([]byte, error){
+	"List":      grpcList,
+	"Get":       grpcGet,
+	"Create":    grpcCreate,
+	"Update":    grpcUpdate,
+	"Delete":    grpcDelete,
+	"Recommend": grpcRecommend,
+}
+
+// newGRPCServer 监听 server.grpc_addr 的服务
+func newGRPCServer() *http.Server {
+	r := gin.New()
+	r.UseH2C = true // gRPC 要求 HTTP/2，没有 TLS 时用 h2c
+	trustProxies(r)
+	r.Use(requestID(), requestLogger(), dbGate(), grpcAuth())
+	r.POST("/"+grpcService+"/:method", serveGRPC)
+	r.NoRoute(func(c *gin.Context) {
+		grpcStatus(c, grpcUnimplemented, "没有这个服务："+c.Request.URL.Path)
+	})
+	return &http.Server{Addr: cfg.Server.GRPCAddr, Handler: r.Handler()}
+}
+
+// grpcAuth 校验 metadata 里的 authorization，确定返回内容的语言
+func grpcAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("locale", negotiateLocale(c))
+		if auth := c.GetHeader("Authorization"); auth != "" {
+			raw := strings.TrimPrefix(auth, "Bearer ")
+			user, err := parseToken(raw)
+			if raw == auth || err != nil {
+				grpcStatus(c, grpcUnauthenticated, "访问令牌无效或已过期")
+				c.Abort()
+				return
+			}
+			c.Set("user", user)
+		}
+		c.Next()
+	}
+}
+
+// serveGRPC 一次一元调用：读出请求消息，调用对应的方法，写回响应消息和状态
+func serveGRPC(c *gin.Context) {
+	if ct := c.ContentType(); ct != "application/grpc" && ct != "application/grpc+proto" {
+		c.AbortWithStatus(http.StatusUnsupportedMediaType)
+		return
+	}
+	method := grpcMethods[c.Param("method")]
+	if method == nil {
+		grpcStatus(c, grpcUnimplemented, "没有这个方法："+c.Param("method"))
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			slog.ErrorContext(c.Request.Context(), "gRPC 调用出错", "method", c.Param("method"), "err", err)
+			grpcStatus(c, grpcInternal, "服务器内部错误")
+		}
+	}()
+
+	data, err := readGRPCMessage(c)
+	if err != nil {
+		grpcFail(c, err)
+		return
+	}
+	req, err := parsePB(data)
+	if err != nil {
+		grpcStatus(c, grpcInvalidArgument, "请求消息格式错误")
+		return
+	}
+	resp, err := method(c, req)
+	if err != nil {
+		grpcFail(c, err)
+		return
+	}
+
+	// 长度前缀的消息（1 字节压缩标志 + 4 字节长度），状态放在 trailer 里
+	frame := make([]byte, 5+len(resp))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(resp)))
+	copy(frame[5:], resp)
+	c.Header("Grpc-Accept-Encoding", "gzip")
+	c.Data(http.StatusOK, "application/grpc", frame)
+	c.Writer.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(grpcOK))
+}
+
+// readGRPCMessage 读出请求体里唯一的一条消息，压缩过的先解压
+func readGRPCMessage(c *gin.Context) ([]byte, error) {
+	var head [5]byte
+	if _, err := io.ReadFull(c.Request.Body, head[:]); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "请求消息不完整")
+	}
+	size := binary.BigEndian.Uint32(head[1:])
+	if size > grpcMaxMessage {
+		return nil, grpcErrorf(grpcResourceExhausted, "请求消息不能超过 %d 字节", grpcMaxMessage)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.Request.Body, data); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "请求消息不完整")
+	}
+	if n, _ := c.Request.Body.Read(head[:1]); n > 0 {
+		return nil, grpcErrorf(grpcUnimplemented, "只支持一元调用")
+	}
+	if head[0] == 0 {
+		return data, nil
+	}
+	if c.GetHeader("Grpc-Encoding") != "gzip" {
+		return nil, grpcErrorf(grpcUnimplemented, "不支持的压缩方式：%s", c.GetHeader("Grpc-Encoding"))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "请求消息解压失败")
+	}
+	data, err = io.ReadAll(io.LimitReader(zr, grpcMaxMessage+1))
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "请求消息解压失败")
+	}
+	if len(data) > grpcMaxMessage {
+		return nil, grpcErrorf(grpcResourceExhausted, "请求消息不能超过 %d 字节", grpcMaxMessage)
+	}
+	return data, nil
+}
+
+// grpcFail 按错误返回状态，不是 grpcError 的按 INTERNAL，记到访问日志里
+func grpcFail(c *gin.Context, err error) {
+	var ge *grpcError
+	if !errors.As(err, &ge) {
+		ge = &grpcError{code: grpcInternal, msg: "服务器内部错误"}
+	}
+	c.Error(err)
+	grpcStatus(c, ge.code, ge.msg)
+}
+
+// grpcStatus 只有状态没有消息的响应（Trailers-Only），状态直接放在响应头里
+func grpcStatus(c *gin.Context, code int, msg string) {
+	h := c.Writer.Header()
+	h.Set("Content-Type", "application/grpc")
+	h.Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		h.Set("Grpc-Message", grpcEncodeMessage(msg))
+	}
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+}
+
+// grpcEncodeMessage grpc-message 要求可打印 ASCII 以外的字节（包括中文）和 % 按百分号编码
+func grpcEncodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		ch := msg[i]
+		if ch < 0x20 || ch > 0x7e || ch == '%' {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		} else {
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// grpcUser 要求带访问令牌
+func grpcUser(c *gin.Context) error {
+	if currentUser(c) == nil {
+		return grpcErrorf(grpcUnauthenticated, "缺少访问令牌")
+	}
+	return nil
+}
+
+// grpcAdmin 要求管理员的访问令牌
+func grpcAdmin(c *gin.Context) error {
+	if err := grpcUser(c); err != nil {
+		return err
+	}
+	if !currentUser(c).IsAdmin() {
+		return grpcErrorf(grpcPermissionDenied, "需要管理员权限")
+	}
+	return nil
+}
+
+// ---------- 方法 ----------
+
+// grpcList List(ListSpotsRequest) returns (ListSpotsResponse)
+func grpcList(c *gin.Context, req pbMessage) ([]byte, error) {
+	values := url.Values{}
+	for n, name := range map[protowire.Number]string{1: "q", 2: "province", 3: "city", 10: "sort"} {
+		if v := req.str(n); v != "" {
+			values.Set(name, v)
+		}
+	}
+	for _, t := range req.strs(4) {
+		values.Add("tag", t)
+	}
+	for n, name := range map[protowire.Number]string{5: "min_price", 6: "max_price", 8: "min_rating"} {
+		if v, ok := req.double(n); ok {
+			values.Set(name, strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	if req.bool(7) {
+		values.Set("free", "1")
+	}
+	if req.bool(9) {
+		values.Set("open_now", "1")
+	}
+	size := int(int32(req.uint(11)))
+	if size == 0 {
+		size = cursorLimit
+	}
+	if size < 1 || size > cursorMaxLimit {
+		return nil, grpcErrorf(grpcInvalidArgument, "page_size 必须在 1 到 %d 之间", cursorMaxLimit)
+	}
+
+	spots, next, err := spotsPage(c, values, size, req.str(12))
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%s", err.Error())
+	}
+	var b pbBuilder
+	for _, s := range spots {
+		b.msg(1, pbSpot(s))
+	}
+	b.str(2, next)
+	return b, nil
+}
+
+// grpcGet Get(GetSpotRequest) returns (Spot)，普通用户只能取到已发布的景点
+func grpcGet(c *gin.Context, req pbMessage) ([]byte, error) {
+	key := req.str(2)
+	if key == "" && req.uint(1) != 0 {
+		key = strconv.FormatUint(req.uint(1), 10)
+	}
+	if key == "" {
+		return nil, grpcErrorf(grpcInvalidArgument, "需要 id 或 slug")
+	}
+	spot, err := findSpot(c, key)
+	if err != nil {
+		return nil, grpcErrorf(grpcNotFound, "景点不存在")
+	}
+	s := *spot
+	localizeSpot(c, &s)
+	return pbSpot(s), nil
+}
+
+// grpcCreate Create(CreateSpotRequest) returns (Spot)
+func grpcCreate(c *gin.Context, req pbMessage) ([]byte, error) {
+	if err := grpcUser(c); err != nil {
+		return nil, err
+	}
+	m, err := req.msg(1)
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "spot 格式错误")
+	}
+	in := pbSpotInput(m, true, true)
+	if err := validateSpotInput(&in); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%s", err.Error())
+	}
+	spot, msg := createSpot(c, &in)
+	if msg != "" {
+		return nil, grpcErrorf(grpcInternal, "%s", msg)
+	}
+	return pbSpot(spot), nil
+}
+
+// grpcUpdate Update(UpdateSpotRequest) returns (Spot)
+func grpcUpdate(c *gin.Context, req pbMessage) ([]byte, error) {
+	if err := grpcAdmin(c); err != nil {
+		return nil, err
+	}
+	var spot Spot
+	if err := dbFor(c).Preload("Tags").First(&spot, req.uint(1)).Error; err != nil {
+		return nil, grpcErrorf(grpcNotFound, "景点不存在")
+	}
+	m, err := req.msg(2)
+	if err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "spot 格式错误")
+	}
+	in := pbSpotInput(m, req.bool(3), req.bool(4))
+	if err := validateSpotInput(&in); err != nil {
+		return nil, grpcErrorf(grpcInvalidArgument, "%s", err.Error())
+	}
+	if msg := updateSpot(c, &spot, &in); msg != "" {
+		return nil, grpcErrorf(grpcInternal, "%s", msg)
+	}
+	return pbSpot(spot), nil
+}
+
+// grpcDelete Delete(DeleteSpotRequest) returns (DeleteSpotResponse)
+func grpcDelete(c *gin.Context, req pbMessage) ([]byte, error) {
+	if err := grpcAdmin(c); err != nil {
+		return nil, err
+	}
+	var spot Spot
+	if err := dbFor(c).First(&spot, req.uint(1)).Error; err != nil {
+		return nil, grpcErrorf(grpcNotFound, "景点不存在")
+	}
+	deleteSpot(c, &spot)
+	return []byte{}, nil
+}
+
+// grpcRecommend Recommend(RecommendSpotRequest) returns (RecommendSpotResponse)
+func grpcRecommend(c *gin.Context, req pbMessage) ([]byte, error) {
+	if err := grpcUser(c); err != nil {
+		return nil, err
+	}
+	id := strconv.FormatUint(req.uint(1), 10)
+	var count int
+	var err error
+	if req.bool(2) {
+		count, err = undoRecommend(id, visitorKeys(c))
+		recordRecommendAudit(c, auditUnrecommend, id, count, err)
+	} else {
+		count, err = recommendSpot(id, visitorKeys(c), c.ClientIP())
+		recordRecommendAudit(c, auditRecommend, id, count, err)
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, grpcErrorf(grpcNotFound, "景点不存在")
+	case errors.Is(err, errAlreadyRecommended):
+		return nil, grpcErrorf(grpcAlreadyExists, "您已经推荐过这个景点了")
+	case errors.Is(err, errNotRecommended):
+		return nil, grpcErrorf(grpcFailedPrecondition, "您还没有推荐过这个景点")
+	case err != nil:
+		return nil, err
+	}
+	var b pbBuilder
+	b.int(1, int64(count))
+	return b, nil
+}
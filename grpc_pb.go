@@ -0,0 +1,284 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ==================== gRPC 的 protobuf 编解码 ====================
+
+// 没有用 protoc 生成代码，消息按 proto/spot.proto 里的字段编号手工编解码。改了 .proto 要同步改这里。
+
+// pbField 消息里的一个字段值，varint / fixed 类型在 num 里，bytes 类型（字符串、嵌套消息、packed 列表）在 raw 里
+type pbField struct {
+	typ protowire.Type
+	num uint64
+	raw []byte
+}
+
+// pbMessage 解码后的消息，键是字段编号；同一个字段出现多次时都保留（repeated）
+type pbMessage map[protowire.Number][]pbField
+
+// parsePB 解码一条消息，不认识的字段也保留，用不到就忽略
+func parsePB(b []byte) (pbMessage, error) {
+	m := pbMessage{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := pbField{typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.num, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			f.num, n = protowire.ConsumeFixed64(b)
+		case protowire.Fixed32Type:
+			var v uint32
+			v, n = protowire.ConsumeFixed32(b)
+			f.num = uint64(v)
+		case protowire.BytesType:
+			f.raw, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+		m[num] = append(m[num], f)
+	}
+	return m, nil
+}
+
+// last 字段的最后一个值（proto3 里单个值的字段出现多次时以最后一次为准），wire 类型不对时当作没有
+func (m pbMessage) last(n protowire.Number, typ protowire.Type) (pbField, bool) {
+	fields := m[n]
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].typ == typ {
+			return fields[i], true
+		}
+	}
+	return pbField{}, false
+}
+
+func (m pbMessage) str(n protowire.Number) string {
+	f, _ := m.last(n, protowire.BytesType)
+	return string(f.raw)
+}
+
+func (m pbMessage) uint(n protowire.Number) uint64 {
+	f, _ := m.last(n, protowire.VarintType)
+	return f.num
+}
+
+func (m pbMessage) int(n protowire.Number) int64 {
+	return int64(m.uint(n))
+}
+
+func (m pbMessage) bool(n protowire.Number) bool {
+	return m.uint(n) != 0
+}
+
+// optBool optional bool，ok 为 false 表示没有传
+func (m pbMessage) optBool(n protowire.Number) (v, ok bool) {
+	f, ok := m.last(n, protowire.VarintType)
+	return f.num != 0, ok
+}
+
+// double double 字段，ok 为 false 表示没有传（optional 字段）
+func (m pbMessage) double(n protowire.Number) (float64, bool) {
+	f, ok := m.last(n, protowire.Fixed64Type)
+	return math.Float64frombits(f.num), ok
+}
+
+func (m pbMessage) strs(n protowire.Number) []string {
+	var list []string
+	for _, f := range m[n] {
+		if f.typ == protowire.BytesType {
+			list = append(list, string(f.raw))
+		}
+	}
+	return list
+}
+
+// int32s repeated int32，packed 和不 packed 的编码都接受
+func (m pbMessage) int32s(n protowire.Number) []int {
+	var list []int
+	for _, f := range m[n] {
+		switch f.typ {
+		case protowire.VarintType:
+			list = append(list, int(int32(f.num)))
+		case protowire.BytesType:
+			for b := f.raw; len(b) > 0; {
+				v, n := protowire.ConsumeVarint(b)
+				if n < 0 {
+					break
+				}
+				list = append(list, int(int32(v)))
+				b = b[n:]
+			}
+		}
+	}
+	return list
+}
+
+// msg 嵌套的消息，没有传时返回空消息
+func (m pbMessage) msg(n protowire.Number) (pbMessage, error) {
+	f, ok := m.last(n, protowire.BytesType)
+	if !ok {
+		return pbMessage{}, nil
+	}
+	return parsePB(f.raw)
+}
+
+// pbBuilder 编码消息；proto3 的默认值（0、空字符串、false）不写，optional 字段有值就写，
+// repeated 字段的每个元素都写
+type pbBuilder []byte
+
+func (b *pbBuilder) str(n protowire.Number, s string) {
+	if s != "" {
+		*b = protowire.AppendTag(*b, n, protowire.BytesType)
+		*b = protowire.AppendString(*b, s)
+	}
+}
+
+// repeatedStr repeated string 字段的一个元素，空字符串也是一个元素，不能省略
+func (b *pbBuilder) repeatedStr(n protowire.Number, s string) {
+	*b = protowire.AppendTag(*b, n, protowire.BytesType)
+	*b = protowire.AppendString(*b, s)
+}
+
+func (b *pbBuilder) uint(n protowire.Number, v uint64) {
+	if v != 0 {
+		*b = protowire.AppendTag(*b, n, protowire.VarintType)
+		*b = protowire.AppendVarint(*b, v)
+	}
+}
+
+func (b *pbBuilder) int(n protowire.Number, v int64) {
+	b.uint(n, uint64(v))
+}
+
+func (b *pbBuilder) bool(n protowire.Number, v bool) {
+	if v {
+		b.uint(n, 1)
+	}
+}
+
+func (b *pbBuilder) double(n protowire.Number, v float64) {
+	if v != 0 {
+		b.optDouble(n, &v)
+	}
+}
+
+func (b *pbBuilder) optDouble(n protowire.Number, v *float64) {
+	if v != nil {
+		*b = protowire.AppendTag(*b, n, protowire.Fixed64Type)
+		*b = protowire.AppendFixed64(*b, math.Float64bits(*v))
+	}
+}
+
+// int32s repeated int32，按 proto3 的默认方式 packed 编码
+func (b *pbBuilder) int32s(n protowire.Number, list []int) {
+	if len(list) == 0 {
+		return
+	}
+	var packed []byte
+	for _, v := range list {
+		packed = protowire.AppendVarint(packed, uint64(int64(v)))
+	}
+	*b = protowire.AppendTag(*b, n, protowire.BytesType)
+	*b = protowire.AppendBytes(*b, packed)
+}
+
+func (b *pbBuilder) msg(n protowire.Number, msg []byte) {
+	*b = protowire.AppendTag(*b, n, protowire.BytesType)
+	*b = protowire.AppendBytes(*b, msg)
+}
+
+// timestamp google.protobuf.Timestamp，零值不写
+func (b *pbBuilder) timestamp(n protowire.Number, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	var ts pbBuilder
+	ts.int(1, t.Unix())
+	ts.int(2, int64(t.Nanosecond()))
+	b.msg(n, ts)
+}
+
+// ---------- 消息 ----------
+
+// pbSpot 编码 Spot 消息
+func pbSpot(s Spot) []byte {
+	var b pbBuilder
+	b.uint(1, uint64(s.ID))
+	b.str(2, s.Slug)
+	b.str(3, s.Name)
+	b.str(4, s.Description)
+	b.str(5, s.Ticket)
+	b.str(6, s.Transport)
+	b.str(7, s.ImageURL)
+	b.optDouble(8, s.AdultPrice)
+	b.optDouble(9, s.ChildPrice)
+	b.bool(10, s.IsFree)
+	b.str(11, s.OpeningHours.Text())
+	b.int32s(12, s.BestMonths.List())
+	b.str(13, s.Province)
+	b.str(14, s.City)
+	for _, t := range s.Tags {
+		b.repeatedStr(15, t.Name)
+	}
+	b.optDouble(16, s.Latitude)
+	b.optDouble(17, s.Longitude)
+	b.str(18, s.Status)
+	b.int(19, int64(s.RecommendCount))
+	b.double(20, s.RatingAvg)
+	b.int(21, int64(s.RatingCount))
+	b.int(22, int64(s.FavoriteCount))
+	b.int(23, int64(s.CheckinCount))
+	b.int(24, s.ViewCount)
+	b.str(25, s.Locale)
+	b.timestamp(26, s.CreatedAt)
+	b.timestamp(27, s.UpdatedAt)
+	return b
+}
+
+// pbSpotInput 解码 SpotInput 消息。repeated 字段分不出没有传和传了空列表，
+// replaceTags / replaceMonths 为 false 时 Tags / BestMonths 为 nil（修改时不动），为 true 时按消息里的替换
+func pbSpotInput(m pbMessage, replaceTags, replaceMonths bool) spotInput {
+	in := spotInput{
+		Name:         m.str(1),
+		Description:  m.str(2),
+		Ticket:       m.str(3),
+		Transport:    m.str(4),
+		Province:     m.str(5),
+		City:         m.str(6),
+		ImageURL:     m.str(8),
+		OpeningHours: hoursText(m.str(12)),
+	}
+	if replaceTags {
+		in.Tags = tagList(m.strs(7))
+		if in.Tags == nil {
+			in.Tags = tagList{}
+		}
+	}
+	if replaceMonths {
+		in.BestMonths = m.int32s(13)
+		if in.BestMonths == nil {
+			in.BestMonths = []int{}
+		}
+	}
+	in.AdultPrice.Value, in.AdultPrice.Valid = m.double(9)
+	in.ChildPrice.Value, in.ChildPrice.Valid = m.double(10)
+	if v, ok := m.optBool(11); ok {
+		in.IsFree = &v
+	}
+	in.Latitude.Value, in.Latitude.Valid = m.double(14)
+	in.Longitude.Value, in.Longitude.Valid = m.double(15)
+	return in
+}
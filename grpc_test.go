@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ---------- 编解码 ----------
+
+func TestPBVarintRoundTrip(t *testing.T) {
+	tests := []struct {
+		v    uint64
+		size int // 编码后 varint 的字节数
+	}{
+		{1, 1},
+		{127, 1},
+		{128, 2},
+		{300, 2},
+		{16383, 2},
+		{16384, 3},
+		{math.MaxUint32, 5},
+		{math.MaxInt64, 9},
+		{math.MaxUint64, 10},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.FormatUint(tt.v, 10), func(t *testing.T) {
+			var b pbBuilder
+			b.uint(1, tt.v)
+			if len(b) != 1+tt.size {
+				t.Errorf("编码后 %d 字节，应为 1 字节标签 + %d 字节", len(b), tt.size)
+			}
+			m, err := parsePB(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.uint(1); got != tt.v {
+				t.Errorf("解码得到 %d", got)
+			}
+		})
+	}
+
+	// 0 是默认值，不写
+	var b pbBuilder
+	b.uint(1, 0)
+	b.int(2, 0)
+	b.bool(3, false)
+	b.str(4, "")
+	b.double(5, 0)
+	if len(b) != 0 {
+		t.Errorf("默认值不应该编码：% x", []byte(b))
+	}
+
+	// 负数按 int64 编码成 10 字节
+	b = nil
+	b.int(1, -1)
+	b.int(2, math.MinInt64)
+	m, err := parsePB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 2*(1+10) || m.int(1) != -1 || m.int(2) != math.MinInt64 {
+		t.Errorf("负数：% x 解码为 %d, %d", []byte(b), m.int(1), m.int(2))
+	}
+}
+
+func TestPBInt32s(t *testing.T) {
+	list := []int{1, 12, 0, -1, 300, math.MaxInt32, math.MinInt32}
+	var b pbBuilder
+	b.int32s(13, list)
+	m, err := parsePB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m[13]) != 1 || m[13][0].typ != protowire.BytesType {
+		t.Fatalf("应该 packed 编码成一个字段：%+v", m[13])
+	}
+	if got := m.int32s(13); !reflect.DeepEqual(got, list) {
+		t.Errorf("packed 解码得到 %v，应为 %v", got, list)
+	}
+
+	// 不 packed 的编码和 packed 的混在一起，按出现的顺序拼起来
+	var raw []byte
+	raw = protowire.AppendTag(raw, 13, protowire.VarintType)
+	raw = protowire.AppendVarint(raw, 7)
+	raw = append(raw, b...)
+	neg := int64(-5)
+	raw = protowire.AppendTag(raw, 13, protowire.VarintType)
+	raw = protowire.AppendVarint(raw, uint64(neg))
+	if m, err = parsePB(raw); err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]int{7}, list...), -5)
+	if got := m.int32s(13); !reflect.DeepEqual(got, want) {
+		t.Errorf("混合解码得到 %v，应为 %v", got, want)
+	}
+
+	// 空列表不写
+	b = nil
+	b.int32s(13, nil)
+	b.int32s(13, []int{})
+	if len(b) != 0 {
+		t.Errorf("空列表不应该编码：% x", []byte(b))
+	}
+}
+
+func TestPBFields(t *testing.T) {
+	zero, price := 0.0, 12.5
+	var b pbBuilder
+	b.str(1, "旧名称")
+	b.str(1, "西湖") // 单个值的字段以最后一次为准
+	b.str(2, "")   // 单个值的字段空字符串不写
+	b.repeatedStr(2, "标签1")
+	b.repeatedStr(2, "") // repeated 字段的空字符串也是一个元素
+	b.repeatedStr(2, "标签2")
+	b.optDouble(3, &zero) // optional 的 0 也要写
+	b.optDouble(4, &price)
+	b.optDouble(5, nil)
+	b.bool(6, true)
+	b.uint(7, 9)
+	b.timestamp(9, time.Unix(1700000000, 123))
+	b.timestamp(10, time.Time{})
+	// 字段 8 用错了 wire 类型（应为 varint），读的时候当作没有
+	b = protowire.AppendTag(b, 8, protowire.BytesType)
+	b = protowire.AppendString(b, "x")
+	// 不认识的 fixed32 字段保留
+	b = protowire.AppendTag(b, 99, protowire.Fixed32Type)
+	b = protowire.AppendFixed32(b, 42)
+
+	m, err := parsePB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := m.str(1); got != "西湖" {
+		t.Errorf("str(1) = %q", got)
+	}
+	if got := m.strs(2); !reflect.DeepEqual(got, []string{"标签1", "", "标签2"}) {
+		t.Errorf("strs(2) = %q", got)
+	}
+	if v, ok := m.double(3); !ok || v != 0 {
+		t.Errorf("double(3) = %v, %v，应为 0, true", v, ok)
+	}
+	if v, ok := m.double(4); !ok || v != price {
+		t.Errorf("double(4) = %v, %v", v, ok)
+	}
+	if _, ok := m.double(5); ok {
+		t.Errorf("double(5) 没有传，ok 应为 false")
+	}
+	if v, ok := m.optBool(6); !v || !ok {
+		t.Errorf("optBool(6) = %v, %v", v, ok)
+	}
+	if _, ok := m.optBool(11); ok {
+		t.Errorf("optBool(11) 没有传，ok 应为 false")
+	}
+	if m.uint(7) != 9 || m.uint(8) != 0 {
+		t.Errorf("uint(7) = %d, uint(8) = %d", m.uint(7), m.uint(8))
+	}
+	ts, err := m.msg(9)
+	if err != nil || ts.int(1) != 1700000000 || ts.int(2) != 123 {
+		t.Errorf("timestamp = %v, %v", ts, err)
+	}
+	if _, ok := m[10]; ok {
+		t.Errorf("零值的时间不应该编码")
+	}
+	if f := m[99]; len(f) != 1 || f[0].typ != protowire.Fixed32Type || f[0].num != 42 {
+		t.Errorf("不认识的字段 = %+v", f)
+	}
+	if empty, err := m.msg(12); err != nil || len(empty) != 0 {
+		t.Errorf("没有传的嵌套消息应为空消息：%v, %v", empty, err)
+	}
+}
+
+func TestParsePBTruncated(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"只有标签", []byte{0x08}},
+		{"varint 没有结束", []byte{0x08, 0x80}},
+		{"varint 超过 10 字节", []byte{0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"标签没有结束", []byte{0x80}},
+		{"字段编号为 0", []byte{0x00, 0x01}},
+		{"长度超过剩下的字节", []byte{0x0a, 0x05, 'a', 'b'}},
+		{"fixed64 不够 8 字节", []byte{0x19, 1, 2, 3}},
+		{"fixed32 不够 4 字节", []byte{0x1d, 1, 2}},
+		{"group 没有结束", []byte{0x0b, 0x08, 0x01}},
+		{"正常字段后面截断", append(pbSpot(Spot{ID: 1, Name: "西湖"}), 0x12, 0x03, 'a')},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := parsePB(tt.data); err == nil {
+				t.Errorf("应该出错，得到 %v", m)
+			}
+		})
+	}
+
+	// 嵌套消息里截断的，取嵌套消息时出错
+	var b pbBuilder
+	b.msg(1, []byte{0x08})
+	m, err := parsePB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.msg(1); err == nil {
+		t.Errorf("截断的嵌套消息应该出错")
+	}
+}
+
+func TestPBSpot(t *testing.T) {
+	adult, lat := 80.0, 30.25
+	created := time.Date(2026, 5, 1, 8, 0, 0, 500, time.UTC)
+	s := Spot{
+		ID: 7, Slug: "xihu", Name: "西湖", Description: "**湖**", Transport: "地铁",
+		AdultPrice: &adult, IsFree: false, BestMonths: newMonthSet([]int{4, 10}),
+		Province: "浙江", City: "杭州", Tags: []Tag{{Name: "湖泊"}, {Name: ""}, {Name: "5A"}},
+		Latitude: &lat, Status: SpotPublished, RecommendCount: 3, RatingAvg: 4.5, ViewCount: 1 << 40,
+		CreatedAt: created,
+	}
+	m, err := parsePB(pbSpot(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.uint(1) != 7 || m.str(2) != "xihu" || m.str(3) != "西湖" || m.str(4) != "**湖**" || m.str(6) != "地铁" {
+		t.Errorf("基本字段不对：%v", m)
+	}
+	if v, ok := m.double(8); !ok || v != adult {
+		t.Errorf("adult_price = %v, %v", v, ok)
+	}
+	if _, ok := m.double(9); ok {
+		t.Errorf("没有填的 child_price 不应该编码")
+	}
+	if m.bool(10) {
+		t.Errorf("is_free 应为 false")
+	}
+	if got := m.int32s(12); !reflect.DeepEqual(got, []int{4, 10}) {
+		t.Errorf("best_months = %v", got)
+	}
+	// 空的标签名也要编码，不然解码出来的标签会少一个
+	if got := m.strs(15); !reflect.DeepEqual(got, []string{"湖泊", "", "5A"}) {
+		t.Errorf("tags = %q", got)
+	}
+	if v, ok := m.double(16); !ok || v != lat {
+		t.Errorf("latitude = %v, %v", v, ok)
+	}
+	if _, ok := m.double(17); ok {
+		t.Errorf("没有填的 longitude 不应该编码")
+	}
+	if m.str(18) != SpotPublished || m.int(19) != 3 || m.int(24) != 1<<40 {
+		t.Errorf("status = %q, recommend_count = %d, view_count = %d", m.str(18), m.int(19), m.int(24))
+	}
+	if v, _ := m.double(20); v != 4.5 {
+		t.Errorf("rating_avg = %v", v)
+	}
+	ts, err := m.msg(26)
+	if err != nil || ts.int(1) != created.Unix() || ts.int(2) != 500 {
+		t.Errorf("created_at = %v, %v", ts, err)
+	}
+	if _, ok := m[27]; ok {
+		t.Errorf("零值的 updated_at 不应该编码")
+	}
+}
+
+func TestPBSpotInput(t *testing.T) {
+	child := 0.0
+	var b pbBuilder
+	b.str(1, "灵隐寺")
+	b.str(5, "浙江")
+	b.str(7, "寺庙")
+	b.str(7, "古迹")
+	b.optDouble(10, &child)
+	b.uint(11, 0) // 默认值不写，和没有传一样
+	b.int32s(13, []int{3, 4})
+	b.str(12, "每天 07:00-18:00")
+	m, err := parsePB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := pbSpotInput(m, true, true)
+	if in.Name != "灵隐寺" || in.Province != "浙江" || string(in.OpeningHours) != "每天 07:00-18:00" {
+		t.Errorf("基本字段不对：%+v", in)
+	}
+	if !reflect.DeepEqual(in.Tags, tagList{"寺庙", "古迹"}) || !reflect.DeepEqual(in.BestMonths, []int{3, 4}) {
+		t.Errorf("tags = %q, best_months = %v", in.Tags, in.BestMonths)
+	}
+	if in.AdultPrice.Valid || !in.ChildPrice.Valid || in.ChildPrice.Value != 0 {
+		t.Errorf("adult_price = %+v, child_price = %+v", in.AdultPrice, in.ChildPrice)
+	}
+	if in.IsFree != nil {
+		t.Errorf("is_free 没有传，应为 nil")
+	}
+
+	// 修改时不替换的 repeated 字段为 nil；要替换但消息里没有时是空列表（清空）
+	in = pbSpotInput(m, false, false)
+	if in.Tags != nil || in.BestMonths != nil {
+		t.Errorf("不替换时应为 nil：%q, %v", in.Tags, in.BestMonths)
+	}
+	in = pbSpotInput(pbMessage{}, true, true)
+	if in.Tags == nil || len(in.Tags) != 0 || in.BestMonths == nil || len(in.BestMonths) != 0 {
+		t.Errorf("替换时应为空列表：%#v, %#v", in.Tags, in.BestMonths)
+	}
+
+	var free pbBuilder
+	free = protowire.AppendTag(free, 11, protowire.VarintType)
+	free = protowire.AppendVarint(free, 0)
+	m, _ = parsePB(free)
+	if in := pbSpotInput(m, false, false); in.IsFree == nil || *in.IsFree {
+		t.Errorf("传了 is_free = false，应为 &false，得到 %v", in.IsFree)
+	}
+}
+
+// ---------- 端到端 ----------
+
+// newGRPCTestServer 用临时的 SQLite 数据库启动 gRPC 服务，返回地址和 h2c 客户端
+func newGRPCTestServer(t *testing.T) (string, *http.Client) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg = defaultConfig()
+	cfg.Database.Path = filepath.Join(t.TempDir(), "spots.db")
+	var err error
+	if db, err = openDatabase(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := migrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	if err := initSearch(); err != nil {
+		t.Fatal(err)
+	}
+	if err := initTimezone(); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadCatalogs(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(newGRPCServer().Handler)
+	t.Cleanup(srv.Close)
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	return srv.URL, client
+}
+
+// grpcCall 调用一个方法，返回 grpc-status、grpc-message（已解码）和响应消息
+func grpcCall(t *testing.T, client *http.Client, base, method string, msg []byte) (int, string, pbMessage) {
+	t.Helper()
+	frame := make([]byte, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(msg)))
+	copy(frame[5:], msg)
+	req, err := http.NewRequest(http.MethodPost, base+"/"+grpcService+"/"+method, bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("应该用 HTTP/2，得到 %s", resp.Proto)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 有消息时状态在 trailer 里，Trailers-Only 时在响应头里
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		t.Fatalf("grpc-status = %q", status)
+	}
+	if message, err = url.PathUnescape(message); err != nil {
+		t.Fatal(err)
+	}
+	var m pbMessage
+	if len(body) > 0 {
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			t.Fatalf("响应消息的长度前缀不对：% x", body)
+		}
+		if m, err = parsePB(body[5:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return code, message, m
+}
+
+func TestGRPCServer(t *testing.T) {
+	base, client := newGRPCTestServer(t)
+	price := 80.0
+	spot := Spot{Name: "西湖", Slug: "xihu", Province: "浙江", City: "杭州", AdultPrice: &price,
+		BestMonths: newMonthSet([]int{4, 10}), Status: SpotPublished}
+	if err := db.Create(&spot).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Spot{Name: "黄山", Slug: "huangshan", Province: "安徽", Status: SpotPublished}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("List", func(t *testing.T) {
+		var req pbBuilder
+		req.str(2, "浙江")
+		req.uint(11, 10)
+		code, msg, resp := grpcCall(t, client, base, "List", req)
+		if code != grpcOK {
+			t.Fatalf("status = %d %s", code, msg)
+		}
+		if n := len(resp[1]); n != 1 {
+			t.Fatalf("应该返回 1 个景点，得到 %d 个", n)
+		}
+		got, err := parsePB(resp[1][0].raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.uint(1) != uint64(spot.ID) || got.str(3) != "西湖" || !reflect.DeepEqual(got.int32s(12), []int{4, 10}) {
+			t.Errorf("景点不对：id=%d name=%q months=%v", got.uint(1), got.str(3), got.int32s(12))
+		}
+		if v, ok := got.double(8); !ok || v != price {
+			t.Errorf("adult_price = %v, %v", v, ok)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		var req pbBuilder
+		req.str(2, "huangshan")
+		code, msg, resp := grpcCall(t, client, base, "Get", req)
+		if code != grpcOK || resp.str(3) != "黄山" {
+			t.Errorf("status = %d %s, name = %q", code, msg, resp.str(3))
+		}
+	})
+
+	errorTests := []struct {
+		name, method string
+		req          []byte
+		code         int
+		msg          string
+	}{
+		{"景点不存在", "Get", func() []byte { var b pbBuilder; b.str(2, "nope"); return b }(), grpcNotFound, "景点不存在"},
+		{"缺少参数", "Get", nil, grpcInvalidArgument, "需要 id 或 slug"},
+		{"page_size 超出范围", "List", func() []byte { var b pbBuilder; b.uint(11, cursorMaxLimit+1); return b }(), grpcInvalidArgument,
+			"page_size 必须在 1 到 " + strconv.Itoa(cursorMaxLimit) + " 之间"},
+		{"截断的请求消息", "Get", []byte{0x0a, 0x05, 'a'}, grpcInvalidArgument, "请求消息格式错误"},
+		{"没有令牌不能新增", "Create", nil, grpcUnauthenticated, "缺少访问令牌"},
+		{"没有的方法", "Watch", nil, grpcUnimplemented, "没有这个方法：Watch"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, msg, resp := grpcCall(t, client, base, tt.method, tt.req)
+			if code != tt.code || msg != tt.msg {
+				t.Errorf("status = %d %q，应为 %d %q", code, msg, tt.code, tt.msg)
+			}
+			if resp != nil {
+				t.Errorf("出错时不应该有响应消息：%v", resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 修改历史 ====================
+
+// SpotRevision 景点的历史版本，每次修改前把旧内容存一份
+type SpotRevision struct {
+	ID          uint `gorm:"primaryKey"`
+	SpotID      uint `gorm:"index"`
+	Name        string
+	Description string
+	Ticket      string
+	Transport   string
+	ImageURL    string
+	EditorID    *uint // 做这次修改的用户，nil 表示未知
+	EditorName  string
+	CreatedAt   time.Time // 也就是被替换的时间
+}
+
+// spotContentFields 参与版本记录和回滚的字段
+var spotContentFields = []string{"Name", "Description", "Ticket", "Transport", "ImageURL"}
+
+// updateSpotWithRevision 先把修改前的内容存成一个历史版本，再更新
+// full 为 false 时和原来一样跳过空字段；为 true 时所有内容字段都覆盖（回滚用）
+func updateSpotWithRevision(spot *Spot, changes Spot, editor *User, full bool) error {
+	return retryTransaction(db, func(tx *gorm.DB) error {
+		rev := SpotRevision{
+			SpotID:      spot.ID,
+			Name:        spot.Name,
+			Description: spot.Description,
+			Ticket:      spot.Ticket,
+			Transport:   spot.Transport,
+			ImageURL:    spot.ImageURL,
+		}
+		if editor != nil {
+			rev.EditorID = &editor.ID
+			rev.EditorName = editor.Username
+		}
+		if err := tx.Create(&rev).Error; err != nil {
+			return err
+		}
+
+		q := tx.Model(spot)
+		if full {
+			q = q.Select(spotContentFields)
+		}
+		return q.Updates(changes).Error
+	})
+}
+
+// ---------- 页面 ----------
+
+// showHistory 景点的修改历史：GET /spot/:slug/history
+func showHistory(c *gin.Context) {
+	spot, err := findSpot(c, c.Param("slug"))
+	if err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.spot_slug_not_found", c.Param("slug")))
+		return
+	}
+	var revisions []SpotRevision
+	dbFor(c).Where("spot_id = ?", spot.ID).Order("id desc").Find(&revisions)
+	render(c, http.StatusOK, "history.html", gin.H{
+		"title":     tr(c, "history.title", spot.Name),
+		"spot":      spot,
+		"revisions": revisions,
+	})
+}
+
+// rollbackSpot 回滚到某个历史版本：POST /admin/spot/:id/rollback/:rev
+// 回滚本身也是一次修改，当前内容会先存成新的历史版本，所以回滚也可以撤销
+func rollbackSpot(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).First(&spot, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.spot_id_not_found", c.Param("id")))
+		return
+	}
+	var rev SpotRevision
+	if err := dbFor(c).Where("id = ? AND spot_id = ?", c.Param("rev"), spot.ID).First(&rev).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.revision_not_found"))
+		return
+	}
+
+	before := spot
+	err := updateSpotWithRevision(&spot, Spot{
+		Name:        rev.Name,
+		Description: rev.Description,
+		Ticket:      rev.Ticket,
+		Transport:   rev.Transport,
+		ImageURL:    rev.ImageURL,
+	}, currentUser(c), true)
+	if err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.rollback_failed"))
+		return
+	}
+	recordAudit(c, auditRollback, spot.ID, before, spot)
+	c.Redirect(http.StatusFound, "/spot/"+c.Param("id")+"/history")
+}
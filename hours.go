@@ -0,0 +1,430 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // 内置时区数据，容器里没有 /usr/share/zoneinfo 也能加载时区
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 开放时间 ====================
+
+// OpeningHours 开放时间：每周固定的时间段，加上节假日等特殊日期的安排
+// 以 JSON 保存在 spots.opening_hours 中，景点上为 nil 表示没有填写
+type OpeningHours struct {
+	Weekly     [7][]TimeRange   `json:"weekly"`               // 下标是 time.Weekday（0 为周日），空表示当天不开放
+	Exceptions []HoursException `json:"exceptions,omitempty"` // 特殊日期，优先于每周的安排，按日期排列
+}
+
+// TimeRange 一个开放时间段，closes 早于 opens 表示跨过午夜
+type TimeRange struct {
+	Opens  string `json:"opens"`  // 如 08:00
+	Closes string `json:"closes"` // 如 17:30，24:00 表示开到午夜
+}
+
+// HoursException 某一天的特殊安排
+type HoursException struct {
+	Date   string      `json:"date"`             // 2006-01-02
+	Ranges []TimeRange `json:"ranges,omitempty"` // 空表示全天闭馆
+}
+
+// timezone 判断“现在是否开放”用的时区，取配置 timezone
+var timezone *time.Location
+
+// initTimezone 加载配置的时区
+func initTimezone() error {
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		return err
+	}
+	timezone = loc
+	return nil
+}
+
+// ---------- 文本格式 ----------
+
+// 表单里的开放时间是几行文本，每行“日期 时间段”：
+//
+//	周一至周五 08:00-17:30
+//	周六、周日 09:00-12:00, 13:00-18:00
+//	2026-10-01至2026-10-07 休息
+//	2026-12-31 10:00-22:00
+//
+// 日期可以是 每天、周一～周日（也可以写星期一）、周一至周五 这样的范围，或者具体日期/日期范围；
+// 时间段可以有多个，写“休息”表示不开放，“全天”表示 00:00-24:00。没有写到的星期几不开放。
+
+var weekdayNames = []string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// weekdayOrder 显示时从周一排到周日
+var weekdayOrder = []time.Weekday{
+	time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday,
+}
+
+const maxExceptionDays = 366 // 一个日期范围最多展开的天数
+
+// hoursText 提交的开放时间文本
+// JSON 里可以传文本，也可以直接传接口返回的 opening_hours 对象
+type hoursText string
+
+// UnmarshalJSON 绑定 JSON 字段
+func (t *hoursText) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*t = hoursText(s)
+		return nil
+	}
+	var h OpeningHours
+	if err := json.Unmarshal(b, &h); err != nil {
+		return err
+	}
+	*t = hoursText(h.Text())
+	return nil
+}
+
+// parseOpeningHours 解析开放时间文本，空文本返回 nil
+func parseOpeningHours(text string) (*OpeningHours, error) {
+	h := &OpeningHours{}
+	empty := true
+	exceptions := map[string][]TimeRange{}
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		empty = false
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("第%d行缺少时间", i+1)
+		}
+		ranges, err := parseTimeRanges(strings.Join(fields[1:], " "))
+		if err != nil {
+			return nil, fmt.Errorf("第%d行%v", i+1, err)
+		}
+		if days, ok := parseWeekdays(fields[0]); ok {
+			for _, d := range days {
+				h.Weekly[d] = append(h.Weekly[d], ranges...)
+			}
+			continue
+		}
+		dates, err := parseDates(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("第%d行%v", i+1, err)
+		}
+		for _, d := range dates {
+			exceptions[d] = append(exceptions[d], ranges...)
+		}
+	}
+	if empty {
+		return nil, nil
+	}
+	for date, ranges := range exceptions {
+		h.Exceptions = append(h.Exceptions, HoursException{Date: date, Ranges: ranges})
+	}
+	sort.Slice(h.Exceptions, func(i, j int) bool { return h.Exceptions[i].Date < h.Exceptions[j].Date })
+	return h, nil
+}
+
+// parseWeekdays 解析 每天 / 周一 / 周一至周五 / 周六、周日
+func parseWeekdays(s string) ([]time.Weekday, bool) {
+	if s == "每天" || s == "每日" {
+		return weekdayOrder, true
+	}
+	var days []time.Weekday
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == '、' || r == ',' || r == '，' }) {
+		from, to, isRange := splitRange(part)
+		if !isRange {
+			d, ok := parseWeekday(part)
+			if !ok {
+				return nil, false
+			}
+			days = append(days, d)
+			continue
+		}
+		start, ok1 := parseWeekday(from)
+		end, ok2 := parseWeekday(to)
+		if !ok1 || !ok2 {
+			return nil, false
+		}
+		// 按周一到周日的顺序展开，周五至周一这种跨周末的也可以
+		for d := start; ; d = (d + 1) % 7 {
+			days = append(days, d)
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, len(days) > 0
+}
+
+func parseWeekday(s string) (time.Weekday, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "星期"), "周")
+	switch s {
+	case "一":
+		return time.Monday, true
+	case "二":
+		return time.Tuesday, true
+	case "三":
+		return time.Wednesday, true
+	case "四":
+		return time.Thursday, true
+	case "五":
+		return time.Friday, true
+	case "六":
+		return time.Saturday, true
+	case "日", "天":
+		return time.Sunday, true
+	}
+	return 0, false
+}
+
+// parseDates 解析 2026-10-01 或 2026-10-01至2026-10-07，返回其中每一天
+func parseDates(s string) ([]string, error) {
+	from, to, isRange := splitRange(s)
+	if !isRange {
+		from, to = s, s
+	}
+	start, err1 := time.Parse("2006-01-02", from)
+	end, err2 := time.Parse("2006-01-02", to)
+	if err1 != nil || err2 != nil {
+		return nil, fmt.Errorf("无法识别日期“%s”", s)
+	}
+	if end.Before(start) || end.Sub(start) > maxExceptionDays*24*time.Hour {
+		return nil, fmt.Errorf("日期范围“%s”不正确", s)
+	}
+	var dates []string
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d.Format("2006-01-02"))
+	}
+	return dates, nil
+}
+
+// splitRange 按 至 / ~ / ～ 拆分范围（日期里有 -，所以日期范围不用 -）
+// 星期范围也可以用 -，如 周一-周五
+func splitRange(s string) (from, to string, ok bool) {
+	for _, sep := range []string{"至", "~", "～"} {
+		if i := strings.Index(s, sep); i > 0 {
+			return s[:i], s[i+len(sep):], true
+		}
+	}
+	if strings.HasPrefix(s, "周") || strings.HasPrefix(s, "星期") {
+		if i := strings.Index(s, "-"); i > 0 {
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// parseTimeRanges 解析 08:00-17:30, 19:00-21:00 / 全天 / 休息
+func parseTimeRanges(s string) ([]TimeRange, error) {
+	switch strings.TrimSpace(s) {
+	case "休息", "闭馆", "关闭", "不开放":
+		return nil, nil
+	case "全天", "24小时":
+		return []TimeRange{{Opens: "00:00", Closes: "24:00"}}, nil
+	}
+	var ranges []TimeRange
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '，' || r == ' ' || r == '、' }) {
+		i := strings.IndexAny(part, "-~～")
+		if i < 0 {
+			return nil, fmt.Errorf("无法识别时间段“%s”", part)
+		}
+		opens, err1 := normalizeClock(part[:i])
+		closes, err2 := normalizeClock(strings.TrimLeft(part[i:], "-~～"))
+		if err1 != nil || err2 != nil || opens == closes {
+			return nil, fmt.Errorf("无法识别时间段“%s”", part)
+		}
+		ranges = append(ranges, TimeRange{Opens: opens, Closes: closes})
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("缺少时间")
+	}
+	return ranges, nil
+}
+
+// normalizeClock 8:00 → 08:00，允许 24:00
+func normalizeClock(s string) (string, error) {
+	m, err := clockMinutes(s)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%02d:%02d", m/60, m%60), nil
+}
+
+// clockMinutes 08:30 → 510
+func clockMinutes(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, errors.New("invalid time")
+	}
+	hh, err1 := strconv.Atoi(parts[0])
+	mm, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || hh < 0 || mm < 0 || mm > 59 || hh > 24 || (hh == 24 && mm != 0) {
+		return 0, errors.New("invalid time")
+	}
+	return hh*60 + mm, nil
+}
+
+// Text 转回表单里的文本，相邻且时间相同的星期几/日期合并成一行
+func (h *OpeningHours) Text() string {
+	if h == nil {
+		return ""
+	}
+	var lines []string
+	for i := 0; i < len(weekdayOrder); {
+		ranges := h.Weekly[weekdayOrder[i]]
+		j := i
+		for j+1 < len(weekdayOrder) && rangesText(h.Weekly[weekdayOrder[j+1]]) == rangesText(ranges) {
+			j++
+		}
+		if len(ranges) > 0 {
+			days := weekdayNames[weekdayOrder[i]]
+			switch {
+			case i == 0 && j == len(weekdayOrder)-1:
+				days = "每天"
+			case j > i:
+				days += "至" + weekdayNames[weekdayOrder[j]]
+			}
+			lines = append(lines, days+" "+rangesText(ranges))
+		}
+		i = j + 1
+	}
+	for i := 0; i < len(h.Exceptions); {
+		e := h.Exceptions[i]
+		j := i
+		for j+1 < len(h.Exceptions) && rangesText(h.Exceptions[j+1].Ranges) == rangesText(e.Ranges) &&
+			nextDate(h.Exceptions[j].Date) == h.Exceptions[j+1].Date {
+			j++
+		}
+		dates := e.Date
+		if j > i {
+			dates += "至" + h.Exceptions[j].Date
+		}
+		lines = append(lines, dates+" "+rangesText(e.Ranges))
+		i = j + 1
+	}
+	return strings.Join(lines, "\n")
+}
+
+func nextDate(date string) string {
+	d, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return ""
+	}
+	return d.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// rangesText 时间段显示成 08:00-12:00, 13:00-17:00，没有时间段显示“休息”
+func rangesText(ranges []TimeRange) string {
+	if len(ranges) == 0 {
+		return "休息"
+	}
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.Opens + "-" + r.Closes
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ---------- 显示 ----------
+
+// hoursRow 详情页上的一行
+type hoursRow struct {
+	Label string
+	Hours string
+	Today bool
+}
+
+// WeekRows 每周的安排，从周一到周日
+func (h *OpeningHours) WeekRows() []hoursRow {
+	today := time.Now().In(timezone).Weekday()
+	rows := make([]hoursRow, len(weekdayOrder))
+	for i, d := range weekdayOrder {
+		rows[i] = hoursRow{Label: weekdayNames[d], Hours: rangesText(h.Weekly[d]), Today: d == today}
+	}
+	return rows
+}
+
+// UpcomingExceptions 今天及以后的特殊安排
+func (h *OpeningHours) UpcomingExceptions() []hoursRow {
+	today := time.Now().In(timezone).Format("2006-01-02")
+	var rows []hoursRow
+	for _, e := range h.Exceptions {
+		if e.Date >= today {
+			rows = append(rows, hoursRow{Label: e.Date, Hours: rangesText(e.Ranges), Today: e.Date == today})
+		}
+	}
+	return rows
+}
+
+// ---------- 现在是否开放 ----------
+
+// dayRanges 某一天的开放时间段，特殊日期优先
+func (h *OpeningHours) dayRanges(day time.Time) []TimeRange {
+	date := day.Format("2006-01-02")
+	for _, e := range h.Exceptions {
+		if e.Date == date {
+			return e.Ranges
+		}
+	}
+	return h.Weekly[day.Weekday()]
+}
+
+// OpenAt t 时刻是否开放（按配置的时区计算），没有填写开放时间时返回 false
+func (h *OpeningHours) OpenAt(t time.Time) bool {
+	if h == nil {
+		return false
+	}
+	t = t.In(timezone)
+	now := t.Hour()*60 + t.Minute()
+	for _, r := range h.dayRanges(t) {
+		opens, _ := clockMinutes(r.Opens)
+		closes, _ := clockMinutes(r.Closes)
+		if closes > opens && now >= opens && now < closes {
+			return true
+		}
+		// 跨过午夜的时间段，今天这部分从开门到 24:00
+		if closes < opens && now >= opens {
+			return true
+		}
+	}
+	// 前一天跨过午夜的时间段，延续到今天关门
+	for _, r := range h.dayRanges(t.AddDate(0, 0, -1)) {
+		opens, _ := clockMinutes(r.Opens)
+		closes, _ := clockMinutes(r.Closes)
+		if closes < opens && now < closes {
+			return true
+		}
+	}
+	return false
+}
+
+// HoursText 开放时间的文本，填到编辑表单里
+func (s Spot) HoursText() string {
+	return s.OpeningHours.Text()
+}
+
+// OpenNow 现在是否开放，给模板用
+func (s Spot) OpenNow() bool {
+	return s.OpeningHours.OpenAt(time.Now())
+}
+
+// filterOpenNow 查询参数 open_now=1 时只保留现在开放的景点
+// 开放时间要在 Go 里按时区计算，所以在查询之后过滤
+func filterOpenNow(c *gin.Context, spots []Spot) []Spot {
+	if c.Query("open_now") != "1" {
+		return spots
+	}
+	now := time.Now()
+	open := spots[:0]
+	for _, s := range spots {
+		if s.OpeningHours.OpenAt(now) {
+			open = append(open, s)
+		}
+	}
+	return open
+}
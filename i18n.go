@@ -0,0 +1,180 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// ==================== 界面语言 ====================
+
+// 界面文字按语言放在 locales/<语言>.yaml（编进程序），每个文件是“键: 文字”，
+// 模板里用 {{t "nav.login"}} 取当前语言的文字，带参数的按 fmt 的格式写，如 {{t "card.checkins" .CheckinCount}}。
+// 当前语言依次看：?lang= 参数（同时记到 Cookie）、lang Cookie、Accept-Language 请求头，都没有或者不支持时用配置的 locale。
+// 某种语言缺少的键用默认语言的文字，默认语言也没有时显示键本身，方便发现漏掉的地方。
+// 主题（见 theme.go）里的 locales/<语言>.yaml 整个替换同名的内置文件，也可以加新的语言。
+
+//go:embed locales/*.yaml
+var localeFiles embed.FS
+
+// langCookie 记住用户选择的语言
+const langCookie = "lang"
+
+// catalogs 各语言的界面文字，键是语言代码（zh、en）
+var catalogs map[string]map[string]string
+
+// loadCatalogs 读取所有语言文件，启动时调用
+func loadCatalogs() error {
+	sub, _ := fs.Sub(localeFiles, "locales")
+	fsys := withTheme(sub, "locales")
+	names, err := fs.Glob(fsys, "*.yaml")
+	if err != nil {
+		return err
+	}
+	loaded := make(map[string]map[string]string, len(names))
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		messages := map[string]string{}
+		if err := yaml.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("%s 格式错误：%w", name, err)
+		}
+		loaded[strings.TrimSuffix(name, ".yaml")] = messages
+	}
+	if loaded[cfg.Locale] == nil {
+		return fmt.Errorf("没有 %s 的语言文件", cfg.Locale)
+	}
+	catalogs = loaded
+	return nil
+}
+
+// translate 取 locale 语言的文字，有参数时按 fmt 格式化
+func translate(locale, key string, args ...interface{}) string {
+	msg, ok := catalogs[locale][key]
+	if !ok {
+		if msg, ok = catalogs[cfg.Locale][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// translator 模板里的 t 函数，每种语言一份（见 loadTemplates）
+func translator(locale string) func(key string, args ...interface{}) string {
+	return func(key string, args ...interface{}) string {
+		return translate(locale, key, args...)
+	}
+}
+
+// translateDefault 用默认语言的 t 函数，页面模板在 loadTemplates 里按语言换掉，邮件模板等其他地方用这个
+func translateDefault(key string, args ...interface{}) string {
+	return translate(cfg.Locale, key, args...)
+}
+
+// localeOption 页面上切换语言的选项
+type localeOption struct {
+	Code string
+	Name string // 用这种语言自己写的名称，如“English”
+}
+
+// localeOptions 支持的语言，默认语言排在最前
+func localeOptions() []localeOption {
+	options := make([]localeOption, 0, len(catalogs))
+	for code := range catalogs {
+		options = append(options, localeOption{Code: code, Name: translate(code, "locale.name")})
+	}
+	sort.Slice(options, func(i, j int) bool {
+		if (options[i].Code == cfg.Locale) != (options[j].Code == cfg.Locale) {
+			return options[i].Code == cfg.Locale
+		}
+		return options[i].Code < options[j].Code
+	})
+	return options
+}
+
+// localeMiddleware 确定当前请求的语言，存到 c 里，之后用 currentLocale 取
+func localeMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 同一个地址按语言返回不同的内容
+		c.Writer.Header().Add("Vary", "Accept-Language")
+		if code := c.Query("lang"); catalogs[code] != nil {
+			c.SetCookie(langCookie, code, 365*24*3600, "/", "", secureCookie(c), true)
+			c.Set("locale", code)
+		} else {
+			c.Set("locale", negotiateLocale(c))
+		}
+		c.Next()
+	}
+}
+
+// negotiateLocale 按 Cookie 和 Accept-Language 选择语言
+func negotiateLocale(c *gin.Context) string {
+	if code, err := c.Cookie(langCookie); err == nil && catalogs[code] != nil {
+		return code
+	}
+	for _, tag := range acceptedLanguages(c.GetHeader("Accept-Language")) {
+		if catalogs[tag] != nil {
+			return tag
+		}
+		// zh-CN、en-US 这种带地区的按语言匹配
+		if i := strings.IndexByte(tag, '-'); i > 0 && catalogs[tag[:i]] != nil {
+			return tag[:i]
+		}
+	}
+	return cfg.Locale
+}
+
+// acceptedLanguages 解析 Accept-Language（如 "en-US,en;q=0.9,zh;q=0.8"），按权重从高到低返回小写的语言标签
+func acceptedLanguages(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
+
+// currentLocale 当前请求的语言，没有经过 localeMiddleware 时用默认语言
+func currentLocale(c *gin.Context) string {
+	if code := c.GetString("locale"); code != "" {
+		return code
+	}
+	return cfg.Locale
+}
+
+// tr 在处理函数里取当前语言的文字
+func tr(c *gin.Context, key string, args ...interface{}) string {
+	return translate(currentLocale(c), key, args...)
+}
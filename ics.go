@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 行程导出为日历 ====================
+
+// 填写了出发日期的行程可以下载 iCalendar（.ics）文件，导入 Google 日历、苹果日历、Outlook 等。
+// 每一站是一个全天事件，日期是出发日期加上第几天，地点是景点名称和地区（有经纬度时带上 GEO），
+// 描述是备注和景点详情页地址。格式见 RFC 5545。
+
+// icsText 转义文本字段里的特殊字符
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// icsWriter 按 RFC 5545 写内容行：CRLF 换行，超过 75 个字节的行折行（不拆开 UTF-8 字符）
+type icsWriter struct {
+	b strings.Builder
+}
+
+func (w *icsWriter) line(name, value string) {
+	s := name + ":" + value
+	limit := 75
+	for len(s) > limit {
+		n := limit
+		for n > 0 && s[n]&0xC0 == 0x80 { // 不在 UTF-8 字符中间断开
+			n--
+		}
+		w.b.WriteString(s[:n] + "\r\n ")
+		s = s[n:]
+		limit = 74 // 续行开头的空格也算在 75 个字节里
+	}
+	w.b.WriteString(s + "\r\n")
+}
+
+// itineraryICS 生成行程的日历文件，siteURL 把站内路径转成完整地址
+func itineraryICS(it *Itinerary, host string, siteURL func(string) string) string {
+	var w icsWriter
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", "-//tourist-spots//itinerary//ZH")
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.line("X-WR-CALNAME", icsText(it.Title))
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, stop := range it.Stops {
+		if stop.Spot == nil {
+			continue // 景点已下架
+		}
+		spot := stop.Spot
+		date := it.Date(stop.Day)
+		link := siteURL("/spot/" + url.PathEscape(spot.Slug))
+
+		location := spot.Name
+		if region := strings.TrimSpace(spot.Province + " " + spot.City); region != "" {
+			location += ", " + region
+		}
+		desc := link
+		if stop.Note != "" {
+			desc = stop.Note + "\n" + link
+		}
+
+		w.line("BEGIN", "VEVENT")
+		w.line("UID", fmt.Sprintf("itinerary-%d-stop-%d@%s", it.ID, stop.ID, host))
+		w.line("DTSTAMP", stamp)
+		w.line("DTSTART;VALUE=DATE", date.Format("20060102"))
+		w.line("DTEND;VALUE=DATE", date.AddDate(0, 0, 1).Format("20060102"))
+		w.line("SUMMARY", icsText(spot.Name))
+		w.line("LOCATION", icsText(location))
+		if spot.Latitude != nil && spot.Longitude != nil {
+			w.line("GEO", fmt.Sprintf("%f;%f", *spot.Latitude, *spot.Longitude))
+		}
+		w.line("DESCRIPTION", icsText(desc))
+		w.line("URL", link)
+		w.line("SEQUENCE", "0")
+		w.line("TRANSP", "TRANSPARENT")
+		w.line("END", "VEVENT")
+	}
+	w.line("END", "VCALENDAR")
+	return w.b.String()
+}
+
+// serveItineraryICS 下载行程的日历文件，没有出发日期时返回 400
+func serveItineraryICS(c *gin.Context, it *Itinerary) {
+	if it.StartDate == "" {
+		c.String(http.StatusBadRequest, tr(c, "error.itinerary_no_start"))
+		return
+	}
+	ics := itineraryICS(it, c.Request.Host, func(path string) string { return absoluteURL(c, path) })
+	filename := fmt.Sprintf("itinerary-%d.ics", it.ID)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`,
+		filename, url.PathEscape(it.Title+".ics")))
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(ics))
+}
+
+// exportItineraryICS 自己的行程：GET /itineraries/:id/calendar.ics
+func exportItineraryICS(c *gin.Context) {
+	if it, ok := pageItinerary(c); ok {
+		serveItineraryICS(c, it)
+	}
+}
+
+// exportSharedItineraryICS 分享的行程：GET /itineraries/share/:token/calendar.ics
+// 日历软件可以直接订阅这个地址，行程修改后会自动更新
+func exportSharedItineraryICS(c *gin.Context) {
+	it, err := sharedItinerary(c.Param("token"))
+	if err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.itinerary_not_found"))
+		return
+	}
+	serveItineraryICS(c, it)
+}
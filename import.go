@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// ==================== CSV 导入 ====================
+
+// 管理员在 /admin/import 上传 CSV 批量添加景点。第一行是表头，列名见 importColumns，顺序不限，
+// 只有 name 是必须的；/export 导出的文件也可以直接导入（id 和统计数据列会被忽略）。每一行按和添加表单相同的规则校验（spotInput 的 binding 标签），
+// 通过校验的行在一个事务里导入，有问题的行不导入，在结果里列出行号和原因。
+// 文件要用 UTF-8 编码（可以带 BOM，Excel 另存为“CSV UTF-8”即可）。
+
+const (
+	importMaxSize = 5 << 20 // 上传文件大小上限
+	importMaxRows = 5000    // 一次最多导入的行数
+
+	utf8BOM = "\ufeff" // Excel 保存的 UTF-8 CSV 开头带的 BOM
+)
+
+// importColumn CSV 的一列，Form 是 spotInput 里对应的 form 标签
+type importColumn struct {
+	Header string
+	Form   string
+	Field  string // spotInput 的字段名，用来对应校验错误
+	Note   string // 导入页面上的说明，是 locales/ 里的键
+}
+
+var importColumns = []importColumn{
+	{"name", "name", "Name", "import.col.name"},
+	{"description", "description", "Description", "import.col.description"},
+	{"ticket", "ticket", "Ticket", "import.col.ticket"},
+	{"transport", "transport", "Transport", "import.col.transport"},
+	{"province", "province", "Province", "import.col.province"},
+	{"city", "city", "City", "import.col.city"},
+	{"tags", "tags", "Tags", "import.col.tags"},
+	{"image_url", "imageurl", "ImageURL", "import.col.image_url"},
+	{"adult_price", "adult_price", "AdultPrice", "import.col.adult_price"},
+	{"child_price", "child_price", "ChildPrice", "import.col.child_price"},
+	{"is_free", "is_free", "IsFree", "import.col.is_free"},
+	{"opening_hours", "opening_hours", "OpeningHours", "import.col.opening_hours"},
+	{"best_months", "best_months", "BestMonths", "import.col.best_months"},
+	{"latitude", "latitude", "Latitude", "import.col.latitude"},
+	{"longitude", "longitude", "Longitude", "import.col.longitude"},
+}
+
+// importRowError 没有导入的一行
+type importRowError struct {
+	Row    int      `json:"row"` // 在文件中的行号，表头是第 1 行
+	Name   string   `json:"name"`
+	Errors []string `json:"errors"`
+}
+
+// importReport 导入结果
+type importReport struct {
+	Imported int              `json:"imported"`
+	Failed   []importRowError `json:"errors"`
+}
+
+// importRow 通过校验、等待导入的一行
+type importRow struct {
+	spot Spot
+	tags tagList
+}
+
+// parseImport 读取并校验 CSV，返回可以导入的行和有问题的行；文件本身有问题时返回 error
+func parseImport(r io.Reader) ([]importRow, []importRowError, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, errors.New("文件是空的")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("CSV 格式错误：%w", err)
+	}
+	columns := make([]*importColumn, len(header))
+	seen := map[string]bool{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, utf8BOM)))
+		if exportOnly(h) {
+			continue // 导出文件里的 id 和统计数据，见 export.go
+		}
+		for j := range importColumns {
+			if importColumns[j].Header == h {
+				columns[i] = &importColumns[j]
+			}
+		}
+		if columns[i] == nil {
+			return nil, nil, fmt.Errorf("不认识的列：%q", h)
+		}
+		if seen[h] {
+			return nil, nil, fmt.Errorf("列 %s 重复", h)
+		}
+		seen[h] = true
+	}
+	if !seen["name"] {
+		return nil, nil, errors.New("缺少 name 列")
+	}
+
+	var rows []importRow
+	var failed []importRowError
+	for n := 0; ; n++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("CSV 格式错误：%w", err)
+		}
+		if n >= importMaxRows {
+			return nil, nil, fmt.Errorf("一次最多导入 %d 行", importMaxRows)
+		}
+		line, _ := cr.FieldPos(0)
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		row, errs := parseImportRecord(columns, record)
+		if len(errs) > 0 {
+			failed = append(failed, importRowError{Row: line, Name: strings.TrimSpace(row.spot.Name), Errors: errs})
+			continue
+		}
+		rows = append(rows, row)
+	}
+	return rows, failed, nil
+}
+
+// parseImportRecord 把一行转成景点并校验，校验规则和添加表单相同
+func parseImportRecord(columns []*importColumn, record []string) (importRow, []string) {
+	form := map[string][]string{}
+	var errs []string
+	for i, v := range record {
+		if i >= len(columns) {
+			errs = append(errs, "列数比表头多")
+			break
+		}
+		col := columns[i]
+		if col == nil {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch col.Header {
+		case "best_months":
+			form[col.Form] = strings.FieldsFunc(v, isTagSeparator)
+		case "is_free":
+			switch strings.ToLower(v) {
+			case "1", "true", "yes", "是", "免费":
+				form[col.Form] = []string{"true"}
+			case "", "0", "false", "no", "否":
+				form[col.Form] = []string{"false"}
+			default:
+				errs = append(errs, "is_free：只能填 1 / 0、true / false 或 是 / 否")
+			}
+		default:
+			form[col.Form] = []string{v}
+		}
+	}
+	if len(errs) > 0 {
+		return importRow{spot: Spot{Name: sanitizeText(strings.Join(form["name"], ""))}}, errs
+	}
+
+	var in spotInput
+	err := binding.MapFormWithTag(&in, form, "form")
+	if err == nil {
+		err = binding.Validator.ValidateStruct(&in)
+	}
+	row := importRow{spot: in.spot(), tags: in.Tags}
+	if err == nil {
+		return row, nil
+	}
+	fieldErrs := fieldErrors(err)
+	if fieldErrs == nil {
+		return row, []string{"格式错误：" + err.Error()}
+	}
+	for _, col := range importColumns {
+		if msg, ok := fieldErrs[col.Field]; ok {
+			errs = append(errs, col.Header+"："+msg)
+		}
+	}
+	return row, errs
+}
+
+// importSpots 在一个事务里导入所有行，出错时一行也不导入
+func importSpots(rows []importRow) ([]Spot, error) {
+	spots := make([]Spot, len(rows))
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for i, row := range rows {
+			spot := row.spot
+			spot.Status = SpotPublished
+			if err := tx.Create(&spot).Error; err != nil {
+				return err
+			}
+			if err := saveSpotTags(tx, &spot, row.tags); err != nil {
+				return err
+			}
+			spots[i] = spot
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return spots, nil
+}
+
+// ---------- 页面 ----------
+
+// showImport CSV 导入页面：GET /admin/import
+func showImport(c *gin.Context) {
+	render(c, http.StatusOK, "import.html", gin.H{
+		"title":   tr(c, "nav.admin.import"),
+		"columns": importColumns,
+	})
+}
+
+// importTemplate 只有表头的 CSV 模板：GET /admin/import/template.csv
+func importTemplate(c *gin.Context) {
+	headers := make([]string, len(importColumns))
+	for i, col := range importColumns {
+		headers[i] = col.Header
+	}
+	c.Header("Content-Disposition", `attachment; filename="spots-template.csv"`)
+	c.String(http.StatusOK, utf8BOM+strings.Join(headers, ",")+"\n")
+}
+
+// importCSV 上传 CSV 导入景点：POST /admin/import，文件字段 file
+// 页面提交时显示结果；Accept: application/json 时返回 importReport
+func importCSV(c *gin.Context) {
+	fail := func(status int, msg string) {
+		if wantsJSON(c) {
+			apiError(c, status, msg)
+			return
+		}
+		render(c, status, "import.html", gin.H{"title": tr(c, "nav.admin.import"), "columns": importColumns, "error": msg})
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		fail(http.StatusBadRequest, "请选择要导入的 CSV 文件")
+		return
+	}
+	if fh.Size > importMaxSize {
+		fail(http.StatusBadRequest, fmt.Sprintf("文件不能超过 %d MB", importMaxSize>>20))
+		return
+	}
+	f, err := fh.Open()
+	if err != nil {
+		fail(http.StatusBadRequest, "读取文件失败")
+		return
+	}
+	defer f.Close()
+
+	rows, failed, err := parseImport(f)
+	if err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	spots, err := importSpots(rows)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "导入景点失败", "err", err)
+		fail(http.StatusInternalServerError, "导入失败，没有导入任何景点")
+		return
+	}
+	for _, spot := range spots {
+		recordAudit(c, auditCreate, spot.ID, nil, spot)
+	}
+
+	report := importReport{Imported: len(spots), Failed: failed}
+	if report.Failed == nil {
+		report.Failed = []importRowError{}
+	}
+	if wantsJSON(c) {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	render(c, http.StatusOK, "import.html", gin.H{"title": tr(c, "nav.admin.import"), "columns": importColumns, "report": report})
+}
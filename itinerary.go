@@ -0,0 +1,652 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 行程 ====================
+
+// 登录用户可以把景点排成多天的行程：每个行程有若干天，每天若干站，站的顺序可以调整。
+// 行程只有创建者能修改；每个行程有一个随机的分享令牌，/itineraries/share/<令牌> 是只读的分享页面，
+// 不需要登录。行程里的景点被删除或下架后，分享页面显示“景点已下架”。
+
+const (
+	maxItineraryDays  = 30  // 一个行程最多的天数
+	maxItineraryStops = 100 // 一个行程最多的站数
+	maxItineraryTitle = 100
+	maxStopNote       = 200
+)
+
+// Itinerary 行程
+type Itinerary struct {
+	ID         uint            `gorm:"primaryKey" json:"id"`
+	UserID     uint            `gorm:"index" json:"-"`
+	Title      string          `gorm:"size:100" json:"title"`
+	Days       int             `json:"days"`
+	StartDate  string          `gorm:"size:10" json:"start_date"`              // 出发日期，如 2026-10-01，可以不填；导出日历时需要
+	ShareToken string          `gorm:"size:32;uniqueIndex" json:"share_token"` // 分享链接里的令牌
+	Stops      []ItineraryStop `json:"stops,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+}
+
+// ItineraryStop 行程中的一站
+type ItineraryStop struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	ItineraryID uint   `gorm:"index" json:"-"`
+	SpotID      uint   `gorm:"index" json:"spot_id"`
+	Spot        *Spot  `json:"spot,omitempty"` // 景点被删除或下架时为空
+	Day         int    `json:"day"`            // 第几天，从 1 开始
+	Position    int    `json:"position"`       // 当天的顺序，从小到大
+	Note        string `json:"note"`           // 备注，如 “上午，预留 3 小时”
+}
+
+// itineraryDay 按天分组的站，页面显示用
+type itineraryDay struct {
+	Day   int
+	Date  time.Time // 没有填出发日期时为零值
+	Stops []ItineraryStop
+}
+
+var (
+	errItineraryTitle = errors.New("行程名称不能为空，且不能超过100个字符")
+	errItineraryDays  = errors.New("天数必须在 1 到 30 之间")
+	errStartDate      = errors.New("出发日期格式应为 2026-10-01")
+	errStopDay        = errors.New("天数超出了行程的范围")
+	errStopNote       = errors.New("备注不能超过200个字符")
+	errStopSpot       = errors.New("景点不存在")
+	errTooManyStops   = errors.New("一个行程最多100站")
+	errStopOrder      = errors.New("顺序参数错误")
+	errStopNotFound   = errors.New("行程里没有这一站")
+)
+
+// itineraryStatus 行程操作出错时的状态码：输入错误 400，找不到 404，其他 500
+func itineraryStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, errStopNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errItineraryTitle), errors.Is(err, errItineraryDays), errors.Is(err, errStartDate), errors.Is(err, errStopDay),
+		errors.Is(err, errStopNote), errors.Is(err, errStopSpot), errors.Is(err, errTooManyStops),
+		errors.Is(err, errStopOrder):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// itineraryMessage 出错时给用户看的提示
+func itineraryMessage(err error) string {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return "行程不存在"
+	case itineraryStatus(err) != http.StatusInternalServerError:
+		return err.Error()
+	}
+	return "保存失败"
+}
+
+// DayList 第 1 天到最后一天，模板里生成下拉框用
+func (it Itinerary) DayList() []int {
+	days := make([]int, it.Days)
+	for i := range days {
+		days[i] = i + 1
+	}
+	return days
+}
+
+// Date 第 day 天的日期，没有填出发日期时为零值
+func (it Itinerary) Date(day int) time.Time {
+	start, err := time.Parse("2006-01-02", it.StartDate)
+	if err != nil {
+		return time.Time{}
+	}
+	return start.AddDate(0, 0, day-1)
+}
+
+// ByDay 按天分组，没有安排的天也列出来
+func (it Itinerary) ByDay() []itineraryDay {
+	days := make([]itineraryDay, it.Days)
+	for i := range days {
+		days[i].Day = i + 1
+		days[i].Date = it.Date(i + 1)
+	}
+	for _, s := range it.Stops {
+		if s.Day >= 1 && s.Day <= it.Days {
+			days[s.Day-1].Stops = append(days[s.Day-1].Stops, s)
+		}
+	}
+	return days
+}
+
+// withStops 查行程时带上按天、按顺序排好的站和景点（只带已发布的景点）
+func withStops(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Stops", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("day, position, id")
+	}).Preload("Stops.Spot", published)
+}
+
+// userItineraries 用户的行程，最近修改的在前（不带站）
+func userItineraries(userID uint) []Itinerary {
+	var list []Itinerary
+	db.Where("user_id = ?", userID).Order("updated_at desc, id desc").Find(&list)
+	return list
+}
+
+// myItineraries 当前用户的行程，详情页的“加入行程”用，未登录时为空
+func myItineraries(c *gin.Context) []Itinerary {
+	if user := currentUser(c); user != nil {
+		return userItineraries(user.ID)
+	}
+	return nil
+}
+
+// ownItinerary 当前用户的行程，不是自己的行程当作不存在
+func ownItinerary(c *gin.Context, id string) (*Itinerary, error) {
+	var it Itinerary
+	if err := dbFor(c).Scopes(withStops).Where("user_id = ?", currentUser(c).ID).First(&it, id).Error; err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// sharedItinerary 按分享令牌查行程
+func sharedItinerary(token string) (*Itinerary, error) {
+	var it Itinerary
+	if err := db.Scopes(withStops).Where("share_token = ?", token).First(&it).Error; err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// itineraryInput 新建、修改行程时提交的字段
+type itineraryInput struct {
+	Title     string `json:"title" form:"title"`
+	Days      int    `json:"days" form:"days"`
+	StartDate string `json:"start_date" form:"start_date"` // 可以不填
+}
+
+// valid 检查并清洗行程名称、天数和出发日期
+func (in *itineraryInput) valid() error {
+	in.Title = sanitizeText(in.Title)
+	if in.Title == "" || utf8.RuneCountInString(in.Title) > maxItineraryTitle {
+		return errItineraryTitle
+	}
+	if in.Days < 1 || in.Days > maxItineraryDays {
+		return errItineraryDays
+	}
+	in.StartDate = strings.TrimSpace(in.StartDate)
+	if in.StartDate != "" {
+		if _, err := time.Parse("2006-01-02", in.StartDate); err != nil {
+			return errStartDate
+		}
+	}
+	return nil
+}
+
+// createItinerary 新建一个空行程
+func createItinerary(userID uint, in itineraryInput) (*Itinerary, error) {
+	if err := in.valid(); err != nil {
+		return nil, err
+	}
+	it := Itinerary{UserID: userID, Title: in.Title, Days: in.Days, StartDate: in.StartDate, ShareToken: randomToken(12)}
+	if err := db.Create(&it).Error; err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+// updateItinerary 修改名称、天数和出发日期，减少天数时超出范围的站移到最后一天
+func updateItinerary(it *Itinerary, in itineraryInput) error {
+	if err := in.valid(); err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 出发日期可以清空，所以要指定字段
+		if err := tx.Model(it).Select("Title", "Days", "StartDate").
+			Updates(Itinerary{Title: in.Title, Days: in.Days, StartDate: in.StartDate}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ItineraryStop{}).Where("itinerary_id = ? AND day > ?", it.ID, in.Days).
+			Updates(map[string]interface{}{"day": in.Days, "position": gorm.Expr("position + ?", maxItineraryStops)}).Error
+	})
+}
+
+// addStop 把景点加到第 day 天的最后
+func addStop(it *Itinerary, spotID uint, day int, note string) (*ItineraryStop, error) {
+	note = sanitizeText(note)
+	if day < 1 || day > it.Days {
+		return nil, errStopDay
+	}
+	if utf8.RuneCountInString(note) > maxStopNote {
+		return nil, errStopNote
+	}
+	if len(it.Stops) >= maxItineraryStops {
+		return nil, errTooManyStops
+	}
+	var spot Spot
+	if err := db.Scopes(published).Select("id").First(&spot, spotID).Error; err != nil {
+		return nil, errStopSpot
+	}
+
+	stop := ItineraryStop{ItineraryID: it.ID, SpotID: spot.ID, Day: day, Note: note}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var last int
+		tx.Model(&ItineraryStop{}).Where("itinerary_id = ? AND day = ?", it.ID, day).
+			Select("COALESCE(MAX(position), 0)").Scan(&last)
+		stop.Position = last + 1
+		if err := tx.Create(&stop).Error; err != nil {
+			return err
+		}
+		return touchItinerary(tx, it)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stop, nil
+}
+
+// removeStop 删除一站
+func removeStop(it *Itinerary, stopID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND itinerary_id = ?", stopID, it.ID).Delete(&ItineraryStop{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStopNotFound
+		}
+		return touchItinerary(tx, it)
+	})
+}
+
+// stopOrder 调整顺序时一站的新位置
+type stopOrder struct {
+	ID       uint `json:"id"`
+	Day      int  `json:"day"`
+	Position int  `json:"position"` // 当天内的顺序，相同时保持提交的先后
+}
+
+// reorderStops 按提交的天数和顺序重新排列，没有提交的站不变
+func reorderStops(it *Itinerary, orders []stopOrder) error {
+	own := make(map[uint]bool, len(it.Stops))
+	for _, s := range it.Stops {
+		own[s.ID] = true
+	}
+	for _, o := range orders {
+		if !own[o.ID] {
+			return errStopOrder
+		}
+		if o.Day < 1 || o.Day > it.Days {
+			return errStopDay
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool {
+		if orders[i].Day != orders[j].Day {
+			return orders[i].Day < orders[j].Day
+		}
+		return orders[i].Position < orders[j].Position
+	})
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		pos := map[int]int{} // 每天已经排到第几个
+		for _, o := range orders {
+			pos[o.Day]++
+			if err := tx.Model(&ItineraryStop{}).Where("id = ? AND itinerary_id = ?", o.ID, it.ID).
+				Updates(map[string]interface{}{"day": o.Day, "position": pos[o.Day]}).Error; err != nil {
+				return err
+			}
+		}
+		return touchItinerary(tx, it)
+	})
+}
+
+// touchItinerary 站有变化时更新行程的修改时间
+func touchItinerary(tx *gorm.DB, it *Itinerary) error {
+	return tx.Model(it).Update("updated_at", time.Now()).Error
+}
+
+// deleteItinerary 删除行程和它的站
+func deleteItinerary(it *Itinerary) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("itinerary_id = ?", it.ID).Delete(&ItineraryStop{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(it).Error
+	})
+}
+
+// ---------- 页面 ----------
+
+// itineraryPath 行程编辑页面的地址
+func itineraryPath(it *Itinerary) string {
+	return "/itineraries/" + strconv.FormatUint(uint64(it.ID), 10)
+}
+
+// loginFirst 未登录时跳转到登录页，返回 false
+func loginFirst(c *gin.Context, next string) bool {
+	if currentUser(c) != nil {
+		return true
+	}
+	c.Redirect(http.StatusFound, "/login?next="+url.QueryEscape(next))
+	return false
+}
+
+// pageItinerary 页面路由里取出 :id 对应的自己的行程，找不到时直接返回错误页面
+func pageItinerary(c *gin.Context) (*Itinerary, bool) {
+	if !loginFirst(c, c.Request.URL.Path) {
+		return nil, false
+	}
+	it, err := ownItinerary(c, c.Param("id"))
+	if err != nil {
+		c.String(itineraryStatus(err), itineraryMessage(err))
+		return nil, false
+	}
+	return it, true
+}
+
+// showItineraries 我的行程：GET /itineraries
+func showItineraries(c *gin.Context) {
+	if !loginFirst(c, "/itineraries") {
+		return
+	}
+	render(c, http.StatusOK, "itineraries.html", gin.H{
+		"title":       tr(c, "nav.itineraries"),
+		"itineraries": userItineraries(currentUser(c).ID),
+	})
+}
+
+// createItineraryForm 新建行程：POST /itineraries，表单字段 title、days、start_date
+func createItineraryForm(c *gin.Context) {
+	if !loginFirst(c, "/itineraries") {
+		return
+	}
+	var in itineraryInput
+	if err := c.ShouldBind(&in); err != nil {
+		c.String(http.StatusBadRequest, tr(c, "error.bad_form"))
+		return
+	}
+	it, err := createItinerary(currentUser(c).ID, in)
+	if err != nil {
+		c.String(itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	c.Redirect(http.StatusFound, itineraryPath(it))
+}
+
+// showItinerary 编辑行程：GET /itineraries/:id
+func showItinerary(c *gin.Context) {
+	it, ok := pageItinerary(c)
+	if !ok {
+		return
+	}
+	var spots []Spot
+	dbFor(c).Scopes(published).Select("id", "name").Order("name").Find(&spots)
+	render(c, http.StatusOK, "itinerary.html", gin.H{
+		"title":     it.Title,
+		"itinerary": it,
+		"editable":  true,
+		"spots":     spots,
+	})
+}
+
+// showSharedItinerary 分享的只读页面：GET /itineraries/share/:token
+func showSharedItinerary(c *gin.Context) {
+	it, err := sharedItinerary(c.Param("token"))
+	if err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.itinerary_not_found"))
+		return
+	}
+	render(c, http.StatusOK, "itinerary.html", gin.H{
+		"title":     it.Title,
+		"itinerary": it,
+	})
+}
+
+// updateItineraryForm 修改名称、天数和出发日期：POST /itineraries/:id
+func updateItineraryForm(c *gin.Context) {
+	it, ok := pageItinerary(c)
+	if !ok {
+		return
+	}
+	var in itineraryInput
+	if err := c.ShouldBind(&in); err != nil {
+		c.String(http.StatusBadRequest, tr(c, "error.bad_form"))
+		return
+	}
+	if err := updateItinerary(it, in); err != nil {
+		c.String(itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	c.Redirect(http.StatusFound, itineraryPath(it))
+}
+
+// deleteItineraryForm 删除行程：POST /itineraries/:id/delete
+func deleteItineraryForm(c *gin.Context) {
+	it, ok := pageItinerary(c)
+	if !ok {
+		return
+	}
+	if err := deleteItinerary(it); err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.delete_failed"))
+		return
+	}
+	c.Redirect(http.StatusFound, "/itineraries")
+}
+
+// addStopForm 加入一站：POST /itineraries/:id/stops，表单字段 spot_id、day、note
+// 详情页的“加入行程”也提交到这里，带 next 时完成后回到 next 指定的页面
+func addStopForm(c *gin.Context) {
+	it, ok := pageItinerary(c)
+	if !ok {
+		return
+	}
+	spotID, _ := strconv.ParseUint(c.PostForm("spot_id"), 10, 64)
+	day, _ := strconv.Atoi(c.PostForm("day"))
+	if _, err := addStop(it, uint(spotID), day, c.PostForm("note")); err != nil {
+		c.String(itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	if next := c.PostForm("next"); next != "" {
+		c.Redirect(http.StatusFound, safeNext(next))
+		return
+	}
+	c.Redirect(http.StatusFound, itineraryPath(it))
+}
+
+// removeStopForm 删除一站：POST /itineraries/:id/stops/:stop/delete
+func removeStopForm(c *gin.Context) {
+	it, ok := pageItinerary(c)
+	if !ok {
+		return
+	}
+	if err := removeStop(it, c.Param("stop")); err != nil {
+		c.String(itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	c.Redirect(http.StatusFound, itineraryPath(it))
+}
+
+// reorderStopsForm 调整顺序：POST /itineraries/:id/stops/reorder
+// 表单里每一站一组 ids、days、positions
+func reorderStopsForm(c *gin.Context) {
+	it, ok := pageItinerary(c)
+	if !ok {
+		return
+	}
+	ids, days, positions := c.PostFormArray("ids"), c.PostFormArray("days"), c.PostFormArray("positions")
+	if len(ids) != len(days) || len(ids) != len(positions) {
+		c.String(http.StatusBadRequest, tr(c, "error.bad_params"))
+		return
+	}
+	orders := make([]stopOrder, len(ids))
+	for i := range ids {
+		id, err1 := strconv.ParseUint(ids[i], 10, 64)
+		day, err2 := strconv.Atoi(days[i])
+		pos, err3 := strconv.Atoi(positions[i])
+		if err1 != nil || err2 != nil || err3 != nil {
+			c.String(http.StatusBadRequest, tr(c, "error.day_order_not_number"))
+			return
+		}
+		orders[i] = stopOrder{ID: uint(id), Day: day, Position: pos}
+	}
+	if err := reorderStops(it, orders); err != nil {
+		c.String(itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	c.Redirect(http.StatusFound, itineraryPath(it))
+}
+
+// ---------- 接口 ----------
+
+// apiItinerary 接口里取出 :id 对应的自己的行程，找不到时直接返回错误
+func apiItinerary(c *gin.Context) (*Itinerary, bool) {
+	it, err := ownItinerary(c, c.Param("id"))
+	if err != nil {
+		apiError(c, itineraryStatus(err), itineraryMessage(err))
+		return nil, false
+	}
+	return it, true
+}
+
+// apiItineraryResult 操作成功后返回最新的行程
+func apiItineraryResult(c *gin.Context, code int, id uint) {
+	var it Itinerary
+	if err := dbFor(c).Scopes(withStops).First(&it, id).Error; err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.action_failed"))
+		return
+	}
+	c.JSON(code, it)
+}
+
+// apiListItineraries GET /api/v1/itineraries
+func apiListItineraries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"itineraries": userItineraries(currentUser(c).ID)})
+}
+
+// apiCreateItinerary POST /api/v1/itineraries，请求体 {"title": "杭州三日游", "days": 3, "start_date": "2026-10-01"}
+func apiCreateItinerary(c *gin.Context) {
+	var in itineraryInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+		return
+	}
+	it, err := createItinerary(currentUser(c).ID, in)
+	if err != nil {
+		apiError(c, itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	apiItineraryResult(c, http.StatusCreated, it.ID)
+}
+
+// apiGetItinerary GET /api/v1/itineraries/:id
+func apiGetItinerary(c *gin.Context) {
+	if it, ok := apiItinerary(c); ok {
+		c.JSON(http.StatusOK, it)
+	}
+}
+
+// apiUpdateItinerary PUT /api/v1/itineraries/:id，请求体同新建
+func apiUpdateItinerary(c *gin.Context) {
+	it, ok := apiItinerary(c)
+	if !ok {
+		return
+	}
+	var in itineraryInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+		return
+	}
+	if err := updateItinerary(it, in); err != nil {
+		apiError(c, itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	apiItineraryResult(c, http.StatusOK, it.ID)
+}
+
+// apiDeleteItinerary DELETE /api/v1/itineraries/:id
+func apiDeleteItinerary(c *gin.Context) {
+	it, ok := apiItinerary(c)
+	if !ok {
+		return
+	}
+	if err := deleteItinerary(it); err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.delete_failed"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// apiAddStop POST /api/v1/itineraries/:id/stops，请求体 {"spot_id": 5, "day": 1, "note": "上午"}
+func apiAddStop(c *gin.Context) {
+	it, ok := apiItinerary(c)
+	if !ok {
+		return
+	}
+	var in struct {
+		SpotID uint   `json:"spot_id"`
+		Day    int    `json:"day"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+		return
+	}
+	if _, err := addStop(it, in.SpotID, in.Day, in.Note); err != nil {
+		apiError(c, itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	apiItineraryResult(c, http.StatusCreated, it.ID)
+}
+
+// apiRemoveStop DELETE /api/v1/itineraries/:id/stops/:stop
+func apiRemoveStop(c *gin.Context) {
+	it, ok := apiItinerary(c)
+	if !ok {
+		return
+	}
+	if err := removeStop(it, c.Param("stop")); err != nil {
+		apiError(c, itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	apiItineraryResult(c, http.StatusOK, it.ID)
+}
+
+// apiReorderStops PUT /api/v1/itineraries/:id/stops
+// 请求体 {"stops": [{"id": 3, "day": 1}, {"id": 1, "day": 1}, {"id": 2, "day": 2}]}，每天按数组里的先后排列
+func apiReorderStops(c *gin.Context) {
+	it, ok := apiItinerary(c)
+	if !ok {
+		return
+	}
+	var in struct {
+		Stops []stopOrder `json:"stops"`
+	}
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+		return
+	}
+	if err := reorderStops(it, in.Stops); err != nil {
+		apiError(c, itineraryStatus(err), itineraryMessage(err))
+		return
+	}
+	apiItineraryResult(c, http.StatusOK, it.ID)
+}
+
+// apiSharedItinerary 分享的行程：GET /api/v1/itineraries/share/:token
+func apiSharedItinerary(c *gin.Context) {
+	it, err := sharedItinerary(c.Param("token"))
+	if err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.itinerary_not_found"))
+		return
+	}
+	c.JSON(http.StatusOK, it)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// ==================== 日志 ====================
+
+// 所有日志都通过 log/slog 输出到标准错误，每条是一行：log.format 为 text 时是 key=value 形式，
+// 为 json 时是一个 JSON 对象，方便日志系统按字段检索。log.level 控制输出哪些级别（debug 会输出每条 SQL）。
+// 请求日志、Gin 自己的输出、GORM 的数据库错误和慢查询也都走这里，格式一致。
+// 处理请求时带着请求的 context 记的日志会自动加上 request_id，同一个请求的日志可以用它串起来。
+
+// logLevels 配置里的级别名
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// setupLogger 按配置创建 slog 的默认 Logger；第三方库用标准库 log 包打印的内容会变成 info 级别的日志，
+// Gin 的输出也转到它
+func setupLogger() {
+	opts := &slog.HandlerOptions{Level: logLevels[cfg.Log.Level]}
+	var handler slog.Handler
+	if cfg.Log.Format == "json" {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+
+	// Gin 的调试信息（注册的路由等）和 Recovery 打印的 panic 也按行写进日志
+	gin.DefaultWriter = logWriter{level: slog.LevelDebug}
+	gin.DefaultErrorWriter = logWriter{level: slog.LevelError}
+}
+
+// fatal 记一条错误日志后退出
+func fatal(msg string, args ...interface{}) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// logWriter 把写入的每一行作为一条日志，给只接受 io.Writer 的地方用
+type logWriter struct {
+	level slog.Level
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte("\n")) {
+		if msg := strings.TrimSpace(string(line)); msg != "" {
+			slog.Log(context.Background(), w.level, msg, "source", "gin")
+		}
+	}
+	return len(p), nil
+}
+
+// contextHandler 从 context 里取出请求 ID 和 trace ID（见 tracing.go）加到日志上
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestIDFrom(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if s := spanFrom(ctx); s != nil {
+		r.AddAttrs(slog.String("trace_id", s.traceIDString()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// ---------- 请求 ID ----------
+
+const requestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// requestID 给每个请求一个 ID：前面的代理或调用方已经在 X-Request-ID 里带了就沿用，否则生成一个。
+// ID 写回响应头 X-Request-ID，放进请求的 context（日志用）和 gin.Context 的 "requestID"（错误响应用）。
+// 要放在所有中间件的最前面，这样被拦下的请求也有 ID。
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = randomToken(16)
+		}
+		c.Set("requestID", id)
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+		c.Next()
+	}
+}
+
+// validRequestID 外面传进来的 ID 只接受不太长的字母、数字和 -_.:，免得往日志里写进奇怪的内容
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDFrom 取出 context 里的请求 ID，不是处理请求时返回空
+func requestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ---------- 访问日志 ----------
+
+// requestLogger 每个请求记一条日志：方法、路径、状态码、耗时、IP；5xx 记为错误，4xx 记为警告，
+// 加上 requestID 中间件后还带有 request_id
+func requestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.EscapedPath()
+		if q := redactQuery(c.Request.URL.RawQuery); q != "" {
+			path += "?" + q
+		}
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", c.ClientIP()),
+			slog.Int("size", c.Writer.Size()),
+		}
+		if errs := c.Errors.ByType(gin.ErrorTypePrivate).String(); errs != "" {
+			attrs = append(attrs, slog.String("err", errs))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "请求", attrs...)
+	}
+}
+
+// sensitiveParams 查询参数名（不分大小写）包含这些词时，日志里只留参数名，值换成 ***：
+// 邮件里确认、退订链接的 token，OAuth 回调的 code 和 state，API 密钥等
+var sensitiveParams = []string{"token", "code", "state", "key", "secret", "password", "sig"}
+
+// redactQuery 把查询字符串里敏感参数的值换成 ***，其余原样保留（搜索词等排查问题时有用）
+func redactQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	parts := strings.Split(raw, "&")
+	for i, p := range parts {
+		k, _, hasValue := strings.Cut(p, "=")
+		if !hasValue {
+			continue
+		}
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			name = k
+		}
+		name = strings.ToLower(name)
+		for _, s := range sensitiveParams {
+			if strings.Contains(name, s) {
+				parts[i] = k + "=***"
+				break
+			}
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// ---------- GORM ----------
+
+// gormLogger 让 GORM 的日志走 slog：出错的 SQL 记为错误（查不到记录不算），超过 log.slow_query 的记为警告，
+// debug 级别时记录每条 SQL
+type gormLogger struct{}
+
+func (l gormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	return l
+}
+
+func (gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	slog.InfoContext(ctx, fmt.Sprintf(msg, data...), "source", "gorm")
+}
+
+func (gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	slog.WarnContext(ctx, fmt.Sprintf(msg, data...), "source", "gorm")
+}
+
+func (gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	slog.ErrorContext(ctx, fmt.Sprintf(msg, data...), "source", "gorm")
+}
+
+func (gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		sql, rows := fc()
+		slog.ErrorContext(ctx, "数据库操作失败", "err", err, "sql", sql, "rows", rows, "elapsed", elapsed)
+	case cfg.Log.SlowQuery > 0 && elapsed > cfg.Log.SlowQuery:
+		sql, rows := fc()
+		slog.WarnContext(ctx, "慢查询", "sql", sql, "rows", rows, "elapsed", elapsed)
+	case slog.Default().Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		slog.DebugContext(ctx, "SQL", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// ==================== 邮件 ====================
+
+// 通过 SMTP 发邮件，mail.host 为空时不发。每封邮件有纯文本和 HTML 两个版本，
+// 内容来自模板目录下的 email/<name>.txt（text/template）和 email/<name>.html（html/template），
+// 改邮件内容不用改代码。模板里的文字和页面一样用 {{t "键"}} 从语言文件取，语言是收件人订阅时的界面语言。
+
+const mailTimeout = 30 * time.Second // 连接 SMTP 服务器和发送的超时时间
+
+var errMailDisabled = errors.New("没有配置 SMTP 服务器")
+
+// mailMessage 一封邮件
+type mailMessage struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string // 额外的邮件头，如 List-Unsubscribe
+}
+
+// mailEnabled 是否配置了 SMTP 服务器
+func mailEnabled() bool {
+	return cfg.Mail.Host != ""
+}
+
+// mailURL 邮件里的完整链接
+func mailURL(path string) string {
+	return strings.TrimRight(cfg.Mail.BaseURL, "/") + path
+}
+
+// mailLocale 收件人的语言，没有记录或者已经不支持时用默认语言
+func mailLocale(locale string) string {
+	if catalogs[locale] == nil {
+		return cfg.Locale
+	}
+	return locale
+}
+
+// renderMail 用 email/<name>.txt 和 email/<name>.html 两个模板生成 locale 语言的邮件正文
+func renderMail(name, locale string, data interface{}) (text, html string, err error) {
+	t := translator(locale)
+	tt, err := texttemplate.New(name+".txt").Funcs(texttemplate.FuncMap{"t": t}).ParseFS(templateFS(), "email/"+name+".txt")
+	if err != nil {
+		return "", "", err
+	}
+	var buf bytes.Buffer
+	if err := tt.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+	text = buf.String()
+
+	ht, err := htmltemplate.New(name+".html").Funcs(templateFuncs).Funcs(htmltemplate.FuncMap{"t": t, "timeAgo": timeAgoIn(locale)}).ParseFS(templateFS(), "email/"+name+".html")
+	if err != nil {
+		return "", "", err
+	}
+	buf.Reset()
+	if err := ht.Execute(&buf, data); err != nil {
+		return "", "", err
+	}
+	return text, buf.String(), nil
+}
+
+// buildMail 生成 MIME 格式的邮件（multipart/alternative，正文 base64 编码）
+func buildMail(from *mail.Address, m mailMessage) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString([]byte(part.content))
+		for len(encoded) > 76 {
+			fmt.Fprintf(w, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(w, "%s\r\n", encoded)
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from.String())
+	fmt.Fprintf(&msg, "To: %s\r\n", m.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", m.Subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: <%s@%s>\r\n", randomToken(16), domain)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	for k, v := range m.Headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", k, v)
+	}
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// sendMail 发送一封邮件
+func sendMail(m mailMessage) error {
+	if !mailEnabled() {
+		return errMailDisabled
+	}
+	from, err := mail.ParseAddress(cfg.Mail.From)
+	if err != nil {
+		return err
+	}
+	data, err := buildMail(from, m)
+	if err != nil {
+		return err
+	}
+
+	host := cfg.Mail.Host
+	addr := net.JoinHostPort(host, strconv.Itoa(cfg.Mail.Port))
+	dialer := &net.Dialer{Timeout: mailTimeout}
+	var conn net.Conn
+	if cfg.Mail.TLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok && !cfg.Mail.TLS {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if cfg.Mail.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Mail.Username, cfg.Mail.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(m.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
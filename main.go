@@ -1,11 +1,16 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -13,82 +18,271 @@ import (
 
 // Spot 模型（对应数据库中的景点表）
 // gorm 标签 `primaryKey` 表示 ID 为主键，自增
+// json 标签用于 /api/v1 接口的输出
 type Spot struct {
-	ID             uint   `gorm:"primaryKey"` // 景点ID，主键
-	Name           string // 景点名称
-	Description    string // 景点描述
-	Ticket         string // 门票信息
-	Transport      string // 交通信息
-	RecommendCount int    // 推荐次数
-	ImageURL       string // 图片URL
+	ID             uint   `gorm:"primaryKey" json:"id"`             // 景点ID，主键
+	Slug           string `gorm:"uniqueIndex;size:191" json:"slug"` // 详情页地址 /spot/<slug>，由名称生成
+	Name           string `gorm:"index" json:"name"`                // 景点名称，搜索联想按前缀查询
+	Description    string `json:"description"`                      // 景点描述
+	Ticket         string `json:"ticket"`                           // 门票信息
+	Transport      string `json:"transport"`                        // 交通信息
+	RecommendCount int    `json:"recommend_count"`                  // 推荐次数
+	ImageURL       string `json:"image_url"`                        // 图片URL（封面）
+
+	PinyinName        string `json:"-"` // 名称的全拼和首字母，如 "xihu xh"，拼音搜索用，见 pinyin.go
+	PinyinDescription string `json:"-"` // 描述的全拼
+
+	AdultPrice *float64 `json:"adult_price"` // 成人票价（元），nil 表示未填写，Ticket 作为票价说明
+	ChildPrice *float64 `json:"child_price"` // 儿童票价（元）
+	IsFree     bool     `json:"is_free"`     // 免费景点
+
+	OpeningHours *OpeningHours `gorm:"type:text;serializer:json" json:"opening_hours"` // 开放时间，nil 表示未填写
+	BestMonths   monthSet      `json:"best_months"`                                    // 最佳游览月份
+
+	Status     string `gorm:"size:20;index;default:published" json:"status"` // 发布状态，见 submission.go
+	ReviewNote string `json:"review_note,omitempty"`                         // 审核说明（驳回原因等）
+
+	RatingAvg   float64 `gorm:"index" json:"rating_avg"` // 平均评分（1~5），没有评分时为 0
+	RatingCount int     `json:"rating_count"`            // 评分人数
+	RatingScore float64 `gorm:"index" json:"-"`          // 评分的 Wilson 置信下限，“好评优先”排序用，见 ranking.go
+
+	FavoriteCount int `json:"favorite_count"` // 收藏人数
+	CheckinCount  int `json:"checkin_count"`  // 打卡人数（N 人来过）
+
+	ViewCount int64 `gorm:"index" json:"view_count"` // 详情页浏览次数，见 views.go
+
+	ShortCode   *string `gorm:"uniqueIndex;size:16" json:"short_code"` // 短链接 /s/<code>，nil 表示还没生成，见 shortlink.go
+	ShortClicks int64   `json:"short_clicks"`                          // 通过短链接打开的次数
+
+	Province string `gorm:"index:idx_spot_region" json:"province"` // 省份，如 浙江
+	City     string `gorm:"index:idx_spot_region" json:"city"`     // 城市，如 杭州
+
+	Latitude  *float64 `json:"latitude"`  // 纬度，nil 表示未填写
+	Longitude *float64 `json:"longitude"` // 经度
+
+	Images []SpotImage `gorm:"foreignKey:SpotID" json:"images,omitempty"` // 图集，需要时 Preload
+	Tags   []Tag       `gorm:"many2many:spot_tags" json:"tags"`           // 标签，需要时 Preload
+
+	Locale string `gorm:"-" json:"locale,omitempty"` // 名称和描述换成了这种语言的翻译（见 translation.go），原文时为空
+
+	CreatedAt time.Time      `json:"created_at"`     // 添加时间
+	UpdatedAt time.Time      `json:"updated_at"`     // 最后修改时间
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"` // 软删除：删除时只记录时间，查询时自动过滤
 }
 
+// db 全局数据库连接，在 main 中初始化
+var db *gorm.DB
+
 func main() {
+	// ==================== 0. 加载配置 ====================
+	// 默认值 < config.yaml < 环境变量 < 命令行参数
+	cfg = loadConfig()
+	// 按配置输出结构化日志（见 logging.go）
+	setupLogger()
+	// 链路追踪（见 tracing.go），没配置时不启用
+	startTracing()
+
 	// ==================== 1. 连接数据库 ====================
-	// 打开/创建 SQLite 数据库文件（spots.db）
-	db, err := gorm.Open(sqlite.Open("spots.db"), &gorm.Config{})
+	// 默认打开/创建 SQLite 数据库文件（spots.db），也可以配置为 MySQL / PostgreSQL
+	var err error
+	db, err = openDatabase()
 	if err != nil {
-		log.Fatal("无法连接数据库:", err)
-	}
-
-	// 根据模型自动迁移数据库结构（不存在表就建表，添加缺失列）
-	db.AutoMigrate(&Spot{})
-
-	// 如果表为空，插入两条示例数据（初始化用）
-	var count int64
-	db.Model(&Spot{}).Count(&count)
-	if count == 0 {
-		db.Create(&Spot{
-			Name:           "西湖",
-			Description:    "杭州著名景点",
-			Ticket:         "免费",
-			Transport:      "公交可达",
-			RecommendCount: 0,
-		})
-		db.Create(&Spot{
-			Name:           "黄山",
-			Description:    "中国名山",
-			Ticket:         "门票230元",
-			Transport:      "高铁+大巴",
-			RecommendCount: 0,
-		})
+		fatal("无法连接数据库", "err", err)
+	}
+
+	// 子命令：./tourist-spots migrate [up | down [n] | status]，执行完直接退出
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		runMigrateCommand(args[1:])
+		return
+	}
+	// 子命令：./tourist-spots load <备份文件>，把 /admin/dump 导出的数据导入到空数据库
+	if args := flag.Args(); len(args) > 0 && args[0] == "load" {
+		runLoadCommand(args[1:])
+		return
+	}
+
+	// 启动时执行未执行的数据库迁移（见 migrations.go），可以在配置中关闭
+	if cfg.Database.MigrateOnStart {
+		if err := migrateUp(); err != nil {
+			fatal("数据库迁移失败", "err", err)
+		}
+	}
+
+	// 搜索后端（数据库全文索引 / Elasticsearch）
+	if err := initSearch(); err != nil {
+		fatal("搜索配置错误", "err", err)
+	}
+	// 保证至少有一个管理员账号
+	ensureAdmin()
+	// 初始化 JWT 签名密钥
+	initJWTSecret()
+	// 读取第三方登录配置
+	initOAuth()
+	// 注册自定义表单校验规则
+	initValidation()
+	// 判断开放时间用的时区
+	if err := initTimezone(); err != nil {
+		fatal("时区配置错误", "err", err)
+	}
+	// 界面文字的各语言版本
+	if err := loadCatalogs(); err != nil {
+		fatal("界面语言配置错误", "err", err)
+	}
+	// 图片存储（本地目录 / S3 / OSS）
+	if err := initStorage(); err != nil {
+		fatal("图片存储配置错误", "err", err)
+	}
+	// 添加景点的验证码
+	if err := initCaptcha(); err != nil {
+		fatal("验证码配置错误", "err", err)
+	}
+	// 查询缓存（见 cache.go），没配置时不缓存
+	if err := initCache(); err != nil {
+		fatal("缓存配置错误", "err", err)
 	}
+	// 出错时上报到 Sentry（见 recovery.go），没配置时不上报
+	if err := initErrorReporter(); err != nil {
+		fatal("错误上报配置错误", "err", err)
+	}
+
+	// 如果表为空，从示例数据文件导入景点（初始化用，见 seed.go）
+	if err := seedSpots(); err != nil {
+		fatal("导入示例数据失败", "err", err)
+	}
+
+	// 读入管理员设置的首页默认排序
+	loadRankingSetting()
+	// 后台定时任务，运行情况在 /admin/jobs 查看（见 scheduler.go）
+	startScheduler(
+		trashPurgeJob(), // 清理回收站
+		similarityJob(), // 计算景点相似度
+		backupJob(),     // 备份数据库（SQLite）
+		sitemapJob(),    // 生成站点地图
+		digestJob(),     // 发送邮件周报
+	)
+	// 后台定期写入浏览次数
+	startViewFlusher()
+	// 后台投递 webhook
+	startWebhookJob()
 
 	// ==================== 2. Gin 主程序（端口 8080） ====================
 	// 创建 Gin 引擎，加载模板
-	r1 := gin.Default()
-	r1.LoadHTMLGlob("templates/*.html")
+	r1 := gin.New()
+	// 上传的文件不超过这个大小时放在内存里，更大的（上传数据库文件恢复）写到临时文件
+	r1.MaxMultipartMemory = int64(cfg.Upload.MaxSizeMB)<<20 + bodyOverhead
+	// 客户端 IP 只认可信代理转发的 X-Forwarded-For（见 middleware.go）
+	trustProxies(r1)
+	// 请求 ID（见 logging.go）
+	r1.Use(requestID())
+	// 链路追踪（见 tracing.go），放在请求日志之前，请求日志才能带上 trace_id
+	if tracer != nil {
+		r1.Use(tracingMiddleware())
+	}
+	// 请求日志（slog）
+	r1.Use(requestLogger())
+	// 压缩响应（见 compress.go），放在 panic 恢复外面，出错页面也压缩
+	if cfg.Compression.Enabled {
+		r1.Use(compressResponses())
+	}
+	// 当前请求的界面语言（见 i18n.go），放在出错页面之前，出错页面也按语言显示
+	r1.Use(localeMiddleware())
+	// panic 恢复，显示出错页面（见 recovery.go）
+	r1.Use(recovery("error.html"))
+	// 处理函数返回的纯文本错误信息换成出错页面，找不到的页面同样显示出错页面
+	r1.Use(errorPages("error.html"))
+	r1.NoRoute(notFound)
+	// GET 响应按内容加 ETag，内容没变时返回 304（见 etag.go）
+	r1.Use(conditionalGet())
+	r1.SetFuncMap(templateFuncs) // 模板辅助函数，必须在加载模板之前设置
+	loadTemplates(r1)            // 编进程序里的模板，开发模式下读磁盘（见 assets.go）
+	// 安全响应头（CSP、X-Frame-Options 等）
+	r1.Use(securityHeaders())
+	// 请求数和耗时（Prometheus 指标，见 metrics.go）；/metrics 注册在限流等中间件之前，抓取不受影响
+	if cfg.Metrics.Enabled {
+		r1.Use(metricsMiddleware())
+		r1.GET("/metrics", showMetrics)
+	}
+	// 存活和就绪检查（见 health.go），同样注册在限流等中间件之前
+	r1.GET("/healthz", healthz)
+	r1.GET("/readyz", readyz)
+	// 静态站点（以前单独监听 8081 端口），不用查库，同样注册在限流等中间件之前；
+	// 配置了 server.static_host 时，这个域名的请求也都到这里（见 staticSiteHost）
+	site := r1.Group(staticSitePrefix)
+	site.StaticFileFS("/", "another.html", staticFS())
+	// 主题的样式、图片等（配置了 server.theme_dir 时）
+	themeAssets(r1)
+	// 所有写请求按IP限流（放在查库的中间件之前，被限流的请求不再查库）
+	r1.Use(rateLimitWrites())
+	// 从备份恢复数据库时暂停处理请求（见 restore.go）
+	r1.Use(dbGate())
+	// 所有请求先解析登录状态
+	r1.Use(loadUser())
+	// 请求体大小上限，必须在 CSRF 校验解析表单之前
+	r1.Use(limitBody())
+	// 页面表单的 CSRF 校验
+	r1.Use(csrfProtect())
+
+	// ---------- 登录 / 注册 / 退出 ----------
+	r1.GET("/login", showLogin)
+	r1.POST("/login", doLogin)
+	r1.GET("/register", showRegister)
+	r1.POST("/register", doRegister)
+	r1.POST("/logout", doLogout)
+
+	// ---------- 第三方登录与账号绑定 ----------
+	r1.GET("/auth/:provider", oauthStart)
+	r1.GET("/auth/:provider/callback", oauthCallback)
+	r1.GET("/account", showAccount)
+
+	// 管理员路由组：修改、删除类操作只允许管理员
+	admin := r1.Group("/admin", adminRequired())
 
 	// ---------- 首页：列出所有景点 ----------
 	r1.GET("/", func(c *gin.Context) {
-		var spots []Spot
-		// 按推荐次数降序、ID升序排序
-		db.Order("recommend_count desc, id asc").Find(&spots)
-		c.HTML(http.StatusOK, "index.html", gin.H{
-			"spots": spots, // 模板可用 {{range .spots}} ... {{end}}
+		// 默认按推荐次数降序、ID升序排序，可以按地区、标签、价格、评分组合筛选（见 filter.go），
+		// ?sort=price_asc/price_desc 按价格排序，?open_now=1 只看现在开放的
+		// 查询结果可以缓存（见 cache.go）
+		spots := cachedSpots(c, "index", func() []Spot {
+			var spots []Spot
+			filterSpots(c, dbFor(c).Scopes(published).Preload("Tags").Order(spotOrder(c))).Find(&spots)
+			return spots
+		})
+		spots = filterOpenNow(c, spots)
+		localizeSpots(c, spots) // 名称和描述换成当前语言的翻译（见 translation.go）
+		render(c, http.StatusOK, "index.html", gin.H{
+			"spots":       spots, // 模板可用 {{range .spots}} ... {{end}}
+			"recommended": recommendedSpotIDs(c),
+			"favorited":   favoriteSpotIDs(c),
+			"filters":     activeFilters(c),
+			"exportCSV":   exportURL(c, "csv"),
+			"exportXLSX":  exportURL(c, "xlsx"),
 		})
 	})
 
 	// ---------- 添加新景点 ----------
 	r1.POST("/add", func(c *gin.Context) {
-		// 取表单字段
-		name := c.PostForm("name")
-		description := c.PostForm("description")
-		ticket := c.PostForm("ticket")
-		transport := c.PostForm("transport")
-		imageURL := c.PostForm("imageurl")
-
-		// 插入数据库
-		db.Create(&Spot{
-			Name:           name,
-			Description:    description,
-			Ticket:         ticket,
-			Transport:      transport,
-			ImageURL:       imageURL,
-			RecommendCount: 0, // 新增景点推荐数初始为0
-		})
+		// 绑定并校验表单字段，不合法时带着错误信息重新显示表单
+		var in spotInput
+		if !bindSpotForm(c, &in, "add", nil) {
+			return
+		}
+
+		// 插入数据库（新增景点推荐数初始为0），未登录访客添加的需要审核后才显示
+		spot := in.spot()
+		spot.Status = newSpotStatus(c)
+		if err := dbFor(c).Create(&spot).Error; err == nil {
+			if err := setSpotTags(&spot, in.Tags); err != nil {
+				slog.ErrorContext(c.Request.Context(), "保存标签失败", "err", err)
+			}
+			recordAudit(c, auditCreate, spot.ID, nil, spot)
+			notifySubmission(c, &spot)
+		}
 
 		// 插入后重定向回首页
+		if spot.Status == SpotPending {
+			c.Redirect(http.StatusFound, "/?submitted=pending")
+			return
+		}
 		c.Redirect(http.StatusFound, "/")
 	})
 
@@ -96,53 +290,197 @@ func main() {
 	r1.POST("/recommend/:id", func(c *gin.Context) {
 		id := c.Param("id") // URL路径参数，如 /recommend/3
 
-		var spot Spot
-		// 根据主键查询（注意：这里是字符串ID，GORM可自动转换）
-		if err := db.First(&spot, id).Error; err == nil {
-			// 找到则推荐次数+1，再保存回数据库
-			spot.RecommendCount++
-			db.Save(&spot)
+		// 原子地+1，并拿到新的推荐次数；同一访客窗口期内重复推荐会被忽略
+		count, err := recommendSpot(id, visitorKeys(c), c.ClientIP())
+		recordRecommendAudit(c, auditRecommend, id, count, err)
+		// 前端用 fetch 调用时直接返回新次数
+		if wantsJSON(c) {
+			recommendResponse(c, count, err)
+			return
 		}
-		// 不论是否成功，都重定向回首页
-		c.Redirect(http.StatusFound, "/")
+		// 表单提交：不论是否成功，都重定向回来源页面（详情页会带 next，默认首页）
+		c.Redirect(http.StatusFound, safeNext(c.PostForm("next")))
 	})
 
-	// ---------- 删除景点 ----------
-	r1.POST("/delete/:id", func(c *gin.Context) {
-		id := c.Param("id")
-		// 根据ID删除记录
-		db.Delete(&Spot{}, id)
+	// ---------- 撤销推荐（推荐次数 -1，只能撤销自己的推荐） ----------
+	r1.POST("/recommend/:id/undo", func(c *gin.Context) {
+		count, err := undoRecommend(c.Param("id"), visitorKeys(c))
+		recordRecommendAudit(c, auditUnrecommend, c.Param("id"), count, err)
+		if wantsJSON(c) {
+			recommendResponse(c, count, err)
+			return
+		}
+		c.Redirect(http.StatusFound, safeNext(c.PostForm("next")))
+	})
+
+	// ---------- 评分（1~5 星，每个访客一个评分） ----------
+	r1.POST("/rate/:id", rateSpotForm)
+
+	// ---------- 收藏（登录用户） ----------
+	r1.POST("/favorite/:id", favoriteForm(true))
+	r1.POST("/favorite/:id/undo", favoriteForm(false))
+	r1.GET("/favorites", showFavorites)
+
+	// ---------- 打卡（登录用户） ----------
+	r1.POST("/checkin/:id", checkinForm)
+	r1.POST("/checkin/:id/undo", undoCheckinForm)
+	r1.GET("/visited", showVisited)
+
+	// ---------- 行程（登录用户，分享页面不需要登录） ----------
+	r1.GET("/itineraries", showItineraries)
+	r1.POST("/itineraries", createItineraryForm)
+	r1.GET("/itineraries/share/:token", showSharedItinerary)
+	r1.GET("/itineraries/share/:token/calendar.ics", exportSharedItineraryICS)
+	r1.GET("/itineraries/:id", showItinerary)
+	r1.GET("/itineraries/:id/calendar.ics", exportItineraryICS)
+	r1.POST("/itineraries/:id", updateItineraryForm)
+	r1.POST("/itineraries/:id/delete", deleteItineraryForm)
+	r1.POST("/itineraries/:id/stops", addStopForm)
+	r1.POST("/itineraries/:id/stops/reorder", reorderStopsForm)
+	r1.POST("/itineraries/:id/stops/:stop/delete", removeStopForm)
+
+	// ---------- 站内通知（登录用户） ----------
+	r1.GET("/notifications", showNotifications)
+	r1.GET("/notifications/:id", openNotification)
+	r1.POST("/notifications/read", readNotificationsForm)
+
+	// ---------- 删除景点（管理员） ----------
+	admin.POST("/delete/:id", func(c *gin.Context) {
+		var spot Spot
+		if err := dbFor(c).First(&spot, c.Param("id")).Error; err == nil {
+			// 根据ID删除记录（Spot 带 DeletedAt，这里是软删除）
+			dbFor(c).Delete(&spot)
+			updateSpotTagCounts(spot.ID)
+			recordAudit(c, auditDelete, spot.ID, spot, nil)
+		}
 		c.Redirect(http.StatusFound, "/")
 	})
 
-	// ---------- 更新景点信息 ----------
-	r1.POST("/update/:id", func(c *gin.Context) {
-		id := c.Param("id")
+	// ---------- 上传的图片 ----------
+	r1.GET("/media/:file", serveMedia)
+	r1.GET("/media/thumb/:size/:file", serveThumbnail)
+	r1.POST("/media/exif", readPhotoLocation)
+
+	// ---------- Markdown 预览（添加/编辑表单） ----------
+	r1.POST("/markdown/preview", previewMarkdown)
+
+	// ---------- 按地区浏览 ----------
+	r1.GET("/regions", showRegions)
+
+	// ---------- 按标签浏览 ----------
+	r1.GET("/tag/:name", showTag)
+	r1.GET("/tags", showTagCloud)
+
+	// ---------- 附近的景点 ----------
+	r1.GET("/nearby", showNearby)
+
+	// ---------- 热门趋势 ----------
+	r1.GET("/trending", showTrending)
+
+	// ---------- 导出 ----------
+	r1.GET("/export", exportSpots)
+
+	// ---------- Atom 订阅 / 站点地图 ----------
+	r1.GET("/feed.xml", showFeed)
+	r1.GET("/sitemap.xml", showSitemap)
+
+	// ---------- 邮件周报 ----------
+	r1.GET("/digest", showSubscribe)
+	r1.POST("/digest/subscribe", subscribeDigest)
+	r1.GET("/digest/confirm", confirmDigest)
+	r1.GET("/digest/unsubscribe", showUnsubscribe)
+	r1.POST("/digest/unsubscribe", unsubscribeDigest)
+
+	// ---------- 景点对比 ----------
+	r1.GET("/compare", showCompare)
+
+	// ---------- 景点详情页 ----------
+	r1.GET("/spot/:slug", showSpot)
+
+	// ---------- 修改历史（查看公开，回滚需要管理员） ----------
+	r1.GET("/spot/:slug/history", showHistory)
 
-		// 取表单字段
-		name := c.PostForm("name")
-		description := c.PostForm("description")
-		ticket := c.PostForm("ticket")
-		transport := c.PostForm("transport")
-		imageURL := c.PostForm("imageurl")
+	// ---------- 二维码、短链接 ----------
+	r1.GET("/spot/:slug/qr.png", showSpotQR)
+	r1.GET("/s/:code", followShortLink)
+
+	// ---------- 投稿审核（管理员） ----------
+	admin.GET("/submissions", showSubmissions)
+	admin.POST("/submissions/:id/publish", publishSubmission)
+	admin.POST("/submissions/:id/reject", rejectSubmission)
+
+	// 评论
+	r1.POST("/spot/:slug/comments", addComment)
+	admin.POST("/comments/:id/delete", deleteComment)
+	admin.GET("/comments", showModeration)
+	admin.POST("/comments/:id/approve", approveComment)
+	admin.POST("/comments/:id/reject", rejectComment)
+
+	// 举报
+	r1.POST("/report", submitReport)
+	admin.GET("/reports", showReports)
+	admin.POST("/reports/:id/resolve", resolveReport)
+	admin.POST("/reports/:id/dismiss", dismissReport)
+	admin.POST("/spot/:id/rollback/:rev", rollbackSpot)
+
+	// ---------- 图集（管理员） ----------
+	admin.POST("/spot/:id/images", addSpotImage)
+	admin.POST("/spot/:id/images/reorder", reorderSpotImages)
+	admin.POST("/spot/:id/images/:image/delete", deleteSpotImage)
+	// 景点名称和描述的翻译（见 translation.go）
+	admin.POST("/spot/:id/translations", saveSpotTranslation)
+	admin.POST("/spot/:id/translations/:locale/delete", deleteSpotTranslation)
+
+	// ---------- 回收站（管理员） ----------
+	admin.GET("/trash", showTrash)
+	admin.POST("/restore/:id", restoreSpot)
+	admin.POST("/purge/:id", purgeSpot)
+
+	// ---------- 操作日志（管理员） ----------
+	admin.GET("/audit", showAudit)
+	admin.GET("/audit/export", exportAudit)
+
+	// ---------- 标签管理（管理员） ----------
+	admin.GET("/tags", showTags)
+	admin.POST("/tags/:id/rename", renameTag)
+	admin.POST("/tags/:id/delete", removeTag)
+
+	// ---------- 更新景点信息（管理员） ----------
+	admin.POST("/update/:id", func(c *gin.Context) {
+		id := c.Param("id")
 
 		// 找到对应的景点
 		var spot Spot
-		if err := db.First(&spot, id).Error; err != nil {
+		if err := dbFor(c).Preload("Tags").First(&spot, id).Error; err != nil {
 			// 没找到直接返回404
-			c.String(http.StatusNotFound, "未找到ID为 %s 的景点", id)
+			c.String(http.StatusNotFound, tr(c, "error.spot_id_not_found", id))
+			return
+		}
+
+		// 绑定并校验表单字段
+		var in spotInput
+		if !bindSpotForm(c, &in, "edit", gin.H{"editID": spot.ID}) {
 			return
 		}
 
-		// 更新字段
+		// 更新字段，修改前的内容存为历史版本
 		// 注意：Updates(Spot{}) 用struct会跳过零值（空字符串不会更新）
-		db.Model(&spot).Updates(Spot{
-			Name:        name,
-			Description: description,
-			Ticket:      ticket,
-			Transport:   transport,
-			ImageURL:    imageURL,
-		})
+		before := spot
+		if err := updateSpotWithRevision(&spot, in.spot(), currentUser(c), false); err != nil {
+			c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+			return
+		}
+		// 价格、开放时间和标签一样，表单里总会带上，清空就是去掉
+		if err := saveClearableFields(&spot, &in); err != nil {
+			c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+			return
+		}
+		// 表单里总会带上标签，清空就是去掉所有标签
+		if err := setSpotTags(&spot, in.Tags); err != nil {
+			c.String(http.StatusInternalServerError, tr(c, "error.tags_save_failed"))
+			return
+		}
+		recordAudit(c, auditUpdate, spot.ID, before, spot)
 
 		c.Redirect(http.StatusFound, "/")
 	})
@@ -151,48 +489,222 @@ func main() {
 	r1.GET("/search", func(c *gin.Context) {
 		query := c.Query("q") // 获取搜索关键词（GET参数q=）
 
-		var spots []Spot
-		if query == "" {
-			// 没关键词：返回全部
-			db.Order("recommend_count desc, id asc").Find(&spots)
-		} else {
-			// 按名称或描述模糊搜索
-			db.Where("name LIKE ? OR description LIKE ?", "%"+query+"%", "%"+query+"%").
-				Order("recommend_count desc, id asc").Find(&spots)
-		}
+		// 搜索结果和首页一样可以缓存
+		spots := cachedSpots(c, "search", func() []Spot {
+			var spots []Spot
+			// 和首页一样可以组合筛选、排序
+			q := filterSpots(c, dbFor(c).Scopes(published).Preload("Tags").Order(spotOrder(c)))
+			q, ranked := searchKeyword(q, query)
+			q.Find(&spots)
+			// 全文搜索没有指定排序时按相关度
+			if ranked != nil && c.Query("sort") == "" {
+				sortByRank(spots, ranked)
+			}
+			return spots
+		})
 
-		c.HTML(http.StatusOK, "index.html", gin.H{
-			"spots": spots,
+		spots = filterOpenNow(c, spots)
+		localizeSpots(c, spots)
+		render(c, http.StatusOK, "index.html", gin.H{
+			"spots":       spots,
+			"recommended": recommendedSpotIDs(c),
+			"favorited":   favoriteSpotIDs(c),
+			"filters":     activeFilters(c),
 		})
 	})
 
-	// ---------- 批量删除景点 ----------
-	r1.POST("/batchdelete", func(c *gin.Context) {
+	// ---------- 批量删除景点（管理员） ----------
+	admin.POST("/batchdelete", func(c *gin.Context) {
 		// 获取多个ID（表单checkbox name=ids）
 		ids := c.PostFormArray("ids")
 		if len(ids) > 0 {
-			// WHERE id IN (...)
-			db.Where("id IN ?", ids).Delete(&Spot{})
+			// 先查出来留作日志快照，再 WHERE id IN (...) 一次删除
+			var spots []Spot
+			dbFor(c).Where("id IN ?", ids).Find(&spots)
+			dbFor(c).Where("id IN ?", ids).Delete(&Spot{})
+			deleted := make([]uint, len(spots))
+			for i, spot := range spots {
+				deleted[i] = spot.ID
+				recordAudit(c, auditDelete, spot.ID, spot, nil)
+			}
+			updateSpotTagCounts(deleted...)
+			syncSearch(deleted...)
 		}
 		c.Redirect(http.StatusFound, "/")
 	})
 
-	// ---------- 启动主服务（8080端口） ----------
-	// 因为后面还要再启动一个服务，所以这里放在goroutine里
+	// ---------- CSV 导入（管理员） ----------
+	admin.GET("/import", showImport)
+	admin.GET("/import/template.csv", importTemplate)
+	admin.POST("/import", importCSV)
+
+	// ---------- JSON 备份（管理员） ----------
+	admin.GET("/dump", downloadDump)
+
+	// ---------- 数据库快照与恢复（管理员） ----------
+	admin.GET("/backups", showBackups)
+	admin.POST("/backups", backupNow)
+	admin.GET("/backups/:name", downloadBackup)
+	admin.POST("/backups/restore", restoreBackup)
+
+	// ---------- 定时任务（管理员） ----------
+	admin.GET("/jobs", showJobs)
+	admin.POST("/jobs/:name/run", runJobNow)
+
+	// ---------- 首页默认排序（管理员） ----------
+	admin.GET("/ranking", showRankingSetting)
+	admin.POST("/ranking", updateRankingSetting)
+
+	// ---------- Webhook（管理员） ----------
+	admin.GET("/webhooks", showWebhooks)
+	admin.POST("/webhooks", createWebhook)
+	admin.GET("/webhooks/:id", showWebhookDeliveries)
+	admin.POST("/webhooks/:id/toggle", toggleWebhook)
+	admin.POST("/webhooks/:id/delete", deleteWebhook)
+	admin.POST("/webhooks/:id/ping", pingWebhook)
+	admin.POST("/webhooks/:id/deliveries/:delivery/retry", redeliverWebhook)
+
+	// ---------- API Key 管理（管理员） ----------
+	admin.GET("/apikeys", showAPIKeys)
+	admin.POST("/apikeys", createAPIKey)
+	admin.POST("/apikeys/:id/revoke", revokeAPIKey)
+
+	// ---------- 性能分析（管理员，见 pprof.go） ----------
+	registerPprof(r1)
+
+	// ==================== JSON API（/api/v1） ====================
+	api := r1.Group("/api/v1")
+	// 跨域访问（见 cors.go）；预检请求（OPTIONS）由中间件直接回答，这里只是让它能匹配到路由
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		api.Use(corsMiddleware())
+		api.OPTIONS("/*path", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	}
+	// 用户名密码换取 JWT
+	api.POST("/token", issueToken)
+	// 只读接口公开访问，携带 X-API-Key 时按 Key 校验和限流
+	read := api.Group("", apiKeyAuth())
+	read.GET("/spots", apiListSpots)
+	read.GET("/spots.geojson", apiSpotsGeoJSON)
+	read.GET("/spots/nearby", apiNearbySpots)
+	read.GET("/spots/compare", apiCompareSpots)
+	read.GET("/spots/trending", apiTrendingSpots)
+	read.GET("/spots/:id", apiGetSpot)
+	read.GET("/tags", apiTags)
+	read.GET("/suggest", apiSuggest)
+	read.GET("/spots/:id/comments", apiListComments)
+	read.GET("/spots/:id/translations", apiListTranslations)
+	read.GET("/spots/:id/related", apiRelatedSpots)
+	read.GET("/spots/:id/recommended", apiRecommendedSpots)
+	read.GET("/comments/:id/replies", apiCommentReplies)
+	read.GET("/itineraries/share/:token", apiSharedItinerary)
+	// 修改类接口必须带 JWT，修改/删除还需要管理员
+	authed := api.Group("", jwtRequired())
+	authed.POST("/spots", apiCreateSpot)
+	authed.POST("/spots/:id/recommend", apiRecommendSpot)
+	authed.POST("/spots/:id/recommend/undo", apiUndoRecommend)
+	authed.POST("/spots/:id/comments", apiCreateComment)
+	authed.POST("/spots/:id/rating", apiRateSpot)
+	authed.POST("/spots/:id/favorite", apiFavoriteSpot)
+	authed.POST("/spots/:id/favorite/undo", apiUnfavoriteSpot)
+	authed.GET("/favorites", apiListFavorites)
+	authed.POST("/spots/:id/shortlink", apiMintShortLink)
+	authed.POST("/spots/:id/checkin", apiCheckinSpot)
+	authed.POST("/spots/:id/checkin/undo", apiUndoCheckin)
+	authed.GET("/checkins", apiListCheckins)
+	authed.GET("/notifications", apiListNotifications)
+	authed.POST("/notifications/read", apiReadNotifications)
+	authed.GET("/itineraries", apiListItineraries)
+	authed.POST("/itineraries", apiCreateItinerary)
+	authed.GET("/itineraries/:id", apiGetItinerary)
+	authed.PUT("/itineraries/:id", apiUpdateItinerary)
+	authed.DELETE("/itineraries/:id", apiDeleteItinerary)
+	authed.POST("/itineraries/:id/stops", apiAddStop)
+	authed.PUT("/itineraries/:id/stops", apiReorderStops)
+	authed.DELETE("/itineraries/:id/stops/:stop", apiRemoveStop)
+	authed.PUT("/spots/:id", apiAdminRequired(), apiUpdateSpot)
+	authed.DELETE("/spots/:id", apiAdminRequired(), apiDeleteSpot)
+	authed.PUT("/spots/:id/translations/:locale", apiAdminRequired(), apiPutTranslation)
+	authed.DELETE("/spots/:id/translations/:locale", apiAdminRequired(), apiDeleteTranslation)
+	authed.POST("/sitemap/refresh", apiAdminRequired(), apiRefreshSitemap)
+
+	// ==================== GraphQL（见 graphql_schema.go） ====================
+	// X-API-Key 可选，认证只认 Bearer 令牌
+	gql := r1.Group("/graphql", apiKeyAuth(), graphqlAuth())
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		gql.Use(corsMiddleware())
+		gql.OPTIONS("", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	}
+	gql.GET("", serveGraphQL)
+	gql.POST("", serveGraphQL)
+
+	// ---------- 启动服务（默认8080端口） ----------
+	// 用 http.Server 而不是 r1.Run，才能在退出时调用 Shutdown 等待请求处理完
+	srv := &http.Server{Addr: cfg.Server.Addr, Handler: staticSiteHost(r1)}
+	// HTTPS（见 tls.go），启用时另外监听 HTTP，重定向到 HTTPS
+	redirectSrv, err := setupTLS(srv)
+	if err != nil {
+		fatal("HTTPS 配置错误", "err", err)
+	}
+	// 放在goroutine里，主goroutine等待退出信号
 	go func() {
-		if err := r1.Run(":8080"); err != nil {
-			log.Fatal("主程序启动失败:", err)
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS("", "") // 证书已经在 TLSConfig 里
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fatal("服务启动失败", "err", err)
 		}
 	}()
+	if redirectSrv != nil {
+		go func() {
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("HTTP 重定向服务启动失败", "err", err)
+			}
+		}()
+	}
+	// gRPC（见 grpc.go），配置了 server.grpc_addr 时另外监听
+	var grpcSrv *http.Server
+	if cfg.Server.GRPCAddr != "" {
+		grpcSrv = newGRPCServer()
+		go func() {
+			if err := grpcSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("gRPC 服务启动失败", "err", err)
+			}
+		}()
+	}
 
-	// ==================== 3. 第二个Gin实例（静态HTML，端口8081） ====================
-	r2 := gin.Default()
-	// 如果只有一个静态HTML，可以直接用StaticFile映射根路径
-	r2.StaticFile("/", "./static/another.html")
+	// ==================== 3. 优雅退出 ====================
+	// 等待 Ctrl+C（SIGINT）或 kill（SIGTERM）
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	slog.Info("收到退出信号，正在关闭服务...")
 
-	// 启动第二个服务（阻塞）
-	if err := r2.Run(":8081"); err != nil {
-		log.Fatal("静态HTML服务启动失败:", err)
+	// 不再接受新请求，最多等 10 秒让进行中的请求处理完
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("服务关闭超时", "err", err)
+	}
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(ctx)
 	}
+	if grpcSrv != nil {
+		grpcSrv.Shutdown(ctx)
+	}
+
+	// 停下定时任务、浏览次数和 webhook 等后台 goroutine，等正在做的做完（见 scheduler.go）
+	stopBackground(ctx)
+	// 写入还没保存的浏览次数
+	spotViews.flush()
+	// 上报还没上报的链路追踪数据
+	stopTracing(ctx)
 
+	// 最后关闭数据库连接
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	slog.Info("服务已退出")
 }
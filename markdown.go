@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// ==================== Markdown 描述 ====================
+
+// 景点描述按 Markdown 保存（入库前仍然经过 sanitizeText，库里没有 HTML），
+// 显示时在服务端渲染成 HTML，再用 bluemonday 的 UGC 规则过滤一遍
+
+// md 支持 GFM（表格、删除线、自动链接），不允许原始 HTML
+var md = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+// markdownPolicy 渲染结果的白名单：常见排版标签，链接强制 nofollow 并在新窗口打开
+var markdownPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// renderMarkdown 把 Markdown 渲染成安全的 HTML，给模板用
+func renderMarkdown(s string) template.HTML {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(s), &buf); err != nil {
+		return template.HTML(template.HTMLEscapeString(s))
+	}
+	return template.HTML(markdownPolicy.SanitizeBytes(buf.Bytes()))
+}
+
+// markdownText 去掉 Markdown 标记后的纯文本，列表卡片上的摘要用
+func markdownText(s string) string {
+	text := textPolicy.Sanitize(string(renderMarkdown(s)))
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
+
+// previewMarkdown 添加/编辑表单里的预览：POST /markdown/preview，返回渲染后的 HTML 片段
+func previewMarkdown(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(renderMarkdown(sanitizeText(c.PostForm("text")))))
+}
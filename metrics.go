@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 监控指标（Prometheus） ====================
+
+// GET /metrics 按 Prometheus 文本格式（0.0.4）输出监控指标，可以直接配到 Prometheus 里抓取、在 Grafana 里画图：
+//
+//	http_requests_total                   请求数，按方法、路由（如 /spot/:slug）、状态码
+//	http_request_duration_seconds         请求耗时的直方图，按方法、路由
+//	db_query_duration_seconds             数据库操作耗时的直方图，按操作（query / create / update / delete / row / raw）
+//	tourist_spot_events_total             景点的新增、修改、删除、推荐等操作次数（和操作日志的类型一样）
+//	tourist_cache_requests_total          查询缓存的命中、未命中、出错次数（见 cache.go）
+//	tourist_spots / tourist_recommendations  抓取时从数据库统计的景点数（按状态）和推荐记录数
+//	go_* / process_start_time_seconds     Go 运行时：goroutine 数、内存、GC
+//
+// 指标不多，没有引入 Prometheus 的客户端库，计数器和直方图都是这里实现的。
+// 默认关闭；启用时必须配置 metrics.token，抓取要带 Authorization: Bearer <token>。
+
+// latencyBuckets 耗时直方图的分桶（秒），和 Prometheus 客户端的默认值一样
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var (
+	httpRequests  = newCounterVec("http_requests_total", "HTTP 请求数", "method", "route", "status")
+	httpDuration  = newHistogramVec("http_request_duration_seconds", "HTTP 请求耗时（秒）", latencyBuckets, "method", "route")
+	dbDuration    = newHistogramVec("db_query_duration_seconds", "数据库操作耗时（秒）", latencyBuckets, "operation")
+	spotEvents    = newCounterVec("tourist_spot_events_total", "景点操作次数，action 同操作日志", "action")
+	cacheRequests = newCounterVec("tourist_cache_requests_total", "查询缓存的读取次数，result 为 hit / miss / error", "result")
+	processStart  = time.Now()
+)
+
+// ---------- 计数器和直方图 ----------
+
+// metricSeries 一组标签值对应的数据
+type metricSeries struct {
+	labels []string
+	value  float64  // 计数器的值
+	counts []uint64 // 直方图每个桶的计数（不累加）
+	sum    float64  // 直方图所有观测值的和
+	count  uint64   // 直方图观测次数
+}
+
+// metricVec 带标签的一个指标，同一组标签值是一条时间序列
+type metricVec struct {
+	name    string
+	help    string
+	kind    string    // counter / histogram
+	labels  []string  // 标签名
+	buckets []float64 // 直方图的分桶上限
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, series: map[string]*metricSeries{}}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, series: map[string]*metricSeries{}}
+}
+
+// get 取出标签值对应的序列，没有时创建，调用时要持有锁
+func (m *metricVec) get(values []string) *metricSeries {
+	key := strings.Join(values, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labels: values}
+		if m.kind == "histogram" {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// inc 计数器加一
+func (m *metricVec) inc(values ...string) {
+	m.mu.Lock()
+	m.get(values).value++
+	m.mu.Unlock()
+}
+
+// observe 直方图记录一个值
+func (m *metricVec) observe(v float64, values ...string) {
+	m.mu.Lock()
+	s := m.get(values)
+	if i := sort.SearchFloat64s(m.buckets, v); i < len(m.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+	m.mu.Unlock()
+}
+
+// write 按文本格式输出，序列按标签值排序，每次抓取的顺序一样
+func (m *metricVec) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := m.series[k]
+		labels := formatLabels(m.labels, s.labels)
+		if m.kind == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, wrapLabels(labels), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, le := range m.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, wrapLabels(joinLabels(labels, `le="`+formatFloat(le)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, wrapLabels(joinLabels(labels, `le="+Inf"`)), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, wrapLabels(labels), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, wrapLabels(labels), s.count)
+	}
+}
+
+// formatLabels 拼成 name="value",... 的形式
+func formatLabels(names, values []string) string {
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(parts, ",")
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return extra
+	}
+	return labels + "," + extra
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// escapeLabel 转义标签值里的反斜杠、双引号和换行
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeGauge 输出一个没有标签（或只有一组标签）的即时值
+func writeGauge(w io.Writer, name, help string, samples map[string]float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	keys := make([]string, 0, len(samples))
+	for k := range samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", name, wrapLabels(k), formatFloat(samples[k]))
+	}
+}
+
+// ---------- 采集 ----------
+
+// metricsMiddleware 记录每个请求的路由、状态码和耗时；路由用注册时的模板（/spot/:slug），没匹配到的记为 unmatched
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.inc(c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+		httpDuration.observe(time.Since(start).Seconds(), c.Request.Method, route)
+	}
+}
+
+// dbMetrics GORM 插件：记录每次数据库操作的耗时
+type dbMetrics struct{}
+
+func (dbMetrics) Name() string { return "metrics" }
+
+func (dbMetrics) Initialize(db *gorm.DB) error {
+	const startKey = "metrics:start"
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(startKey, time.Now())
+	}
+	after := func(op string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if v, ok := tx.InstanceGet(startKey); ok {
+				dbDuration.observe(time.Since(v.(time.Time)).Seconds(), op)
+			}
+		}
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("metrics:before_create", before),
+		cb.Create().After("gorm:create").Register("metrics:after_create", after("create")),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", before),
+		cb.Query().After("gorm:query").Register("metrics:after_query", after("query")),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", before),
+		cb.Update().After("gorm:update").Register("metrics:after_update", after("update")),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", before),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete")),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", before),
+		cb.Row().After("gorm:row").Register("metrics:after_row", after("row")),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", before),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStoreMetrics 从数据库统计景点数和推荐数
+func writeStoreMetrics(w io.Writer) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	db.Model(&Spot{}).Select("status, COUNT(*) AS count").Group("status").Scan(&rows)
+	spots := map[string]float64{}
+	for _, r := range rows {
+		spots[`status="`+escapeLabel(r.Status)+`"`] = float64(r.Count)
+	}
+	writeGauge(w, "tourist_spots", "未删除的景点数，按审核状态", spots)
+
+	var recommendations int64
+	db.Model(&Recommendation{}).Count(&recommendations)
+	writeGauge(w, "tourist_recommendations", "推荐记录数", map[string]float64{"": float64(recommendations)})
+}
+
+// writeRuntimeMetrics Go 运行时指标，名字和 Prometheus 客户端库的一样，现成的 Grafana 面板可以直接用
+func writeRuntimeMetrics(w io.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	gauges := []struct {
+		name, help string
+		value      float64
+	}{
+		{"go_goroutines", "goroutine 数", float64(runtime.NumGoroutine())},
+		{"go_memstats_alloc_bytes", "堆上已分配且仍在使用的字节数", float64(ms.Alloc)},
+		{"go_memstats_heap_inuse_bytes", "正在使用的堆内存（字节）", float64(ms.HeapInuse)},
+		{"go_memstats_heap_objects", "堆上的对象数", float64(ms.HeapObjects)},
+		{"go_memstats_sys_bytes", "从操作系统获得的内存（字节）", float64(ms.Sys)},
+		{"go_memstats_last_gc_time_seconds", "上次 GC 的时间（Unix 秒）", float64(ms.LastGC) / 1e9},
+		{"process_start_time_seconds", "进程启动时间（Unix 秒）", float64(processStart.UnixNano()) / 1e9},
+	}
+	for _, g := range gauges {
+		writeGauge(w, g.name, g.help, map[string]float64{"": g.value})
+	}
+	counters := []struct {
+		name, help string
+		value      float64
+	}{
+		{"go_memstats_alloc_bytes_total", "累计分配的字节数", float64(ms.TotalAlloc)},
+		{"go_memstats_mallocs_total", "累计分配的对象数", float64(ms.Mallocs)},
+		{"go_gc_cycles_total", "已完成的 GC 次数", float64(ms.NumGC)},
+		{"go_gc_pause_seconds_total", "GC 暂停的累计时间（秒）", float64(ms.PauseTotalNs) / 1e9},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", c.name, c.help, c.name, c.name, formatFloat(c.value))
+	}
+	writeGauge(w, "go_info", "Go 版本", map[string]float64{`version="` + runtime.Version() + `"`: 1})
+}
+
+// ---------- 页面 ----------
+
+// showMetrics 监控指标：GET /metrics，要带 metrics.token（启用时必须配置，见 config.go）
+func showMetrics(c *gin.Context) {
+	got := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(got), []byte(cfg.Metrics.Token)) != 1 {
+		c.String(http.StatusUnauthorized, tr(c, "error.metrics_token"))
+		return
+	}
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w := bufio.NewWriter(c.Writer)
+	for _, m := range []*metricVec{httpRequests, httpDuration, dbDuration, spotEvents, cacheRequests} {
+		m.write(w)
+	}
+	writeStoreMetrics(w)
+	writeRuntimeMetrics(w)
+	w.Flush()
+}
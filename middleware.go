@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 通用中间件 ====================
+
+// ---------- 写操作限流（按IP的令牌桶） ----------
+
+// tokenBucket 单个IP的令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// ipLimiter 按IP限流，桶按需创建，长时间不用的桶定期清理
+type ipLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	rate    float64 // 每秒补充的令牌
+	burst   float64 // 桶容量
+}
+
+func newIPLimiter(rate, burst float64) *ipLimiter {
+	l := &ipLimiter{buckets: map[string]*tokenBucket{}, rate: rate, burst: burst}
+	go l.cleanup()
+	return l
+}
+
+// allow 取一个令牌；取不到时返回需要等待的时间
+func (l *ipLimiter) allow(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	// 按经过的时间补充令牌，不超过桶容量
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// cleanup 每分钟清理一次已经装满（长时间没请求）的桶
+func (l *ipLimiter) cleanup() {
+	for range time.Tick(time.Minute) {
+		l.mu.Lock()
+		full := time.Duration(l.burst / l.rate * float64(time.Second))
+		for ip, b := range l.buckets {
+			if time.Since(b.last) > full {
+				delete(l.buckets, ip)
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// trustProxies 只信 server.trusted_proxies 里的代理发来的 X-Forwarded-For / X-Real-IP，
+// 没配置时都不信，c.ClientIP() 就是连接的对端地址。限流、推荐防刷、日志里的 IP 都靠它
+func trustProxies(r *gin.Engine) {
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		fatal("代理参数错误", "err", err)
+	}
+}
+
+// rateLimitWrites 对写请求（POST/PUT/PATCH/DELETE）按IP限流，超出返回429和 Retry-After
+func rateLimitWrites() gin.HandlerFunc {
+	limiter := newIPLimiter(cfg.RateLimit.RPS, cfg.RateLimit.Burst)
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if ok, wait := limiter.allow(c.ClientIP()); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			if wantsJSON(c) {
+				apiError(c, http.StatusTooManyRequests, tr(c, "error.rate_limited"))
+				return
+			}
+			c.String(http.StatusTooManyRequests, tr(c, "error.rate_limited"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ---------- 请求体大小上限 ----------
+
+// bodyOverhead 上传文件以外的表单字段、multipart 分隔符等占用的大小
+const bodyOverhead = 1 << 20
+
+// bodyLimit 请求体大小上限：CSV 导入和上传数据库文件恢复有各自的上限，
+// 其他请求（包括上传图片、/media/exif 读取照片位置）按单张图片的上限
+func bodyLimit(path string) int64 {
+	switch path {
+	case "/admin/import":
+		return importMaxSize + bodyOverhead
+	case restorePath:
+		return int64(cfg.Backup.MaxUploadMB)<<20 + bodyOverhead
+	default:
+		return int64(cfg.Upload.MaxSizeMB)<<20 + bodyOverhead
+	}
+}
+
+// limitBody 限制请求体大小，超出时返回413
+// 必须放在 csrfProtect 之前：csrfProtect 读取表单字段时会解析整个请求体，
+// 不限制的话多大的上传都会先读进内存或临时文件，处理函数里再检查大小已经晚了
+func limitBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+		limit := bodyLimit(c.Request.URL.Path)
+		if c.Request.ContentLength > limit {
+			bodyTooLarge(c, limit)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+
+		// 表单在这里先解析，超出上限时才能返回413；
+		// 交给 PostForm 解析的话错误会被忽略，只会得到一个空的 CSRF 令牌
+		var err error
+		switch c.ContentType() {
+		case "multipart/form-data":
+			_, err = c.MultipartForm()
+		case "application/x-www-form-urlencoded":
+			err = c.Request.ParseForm()
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			bodyTooLarge(c, limit)
+			return
+		}
+		c.Next()
+	}
+}
+
+// bodyTooLarge 返回413，API 和页面里的 fetch 调用返回 JSON，页面显示出错页面
+func bodyTooLarge(c *gin.Context, limit int64) {
+	msg := tr(c, "error.too_large", (limit-bodyOverhead)>>20)
+	if isAPIPath(c) || wantsJSON(c) {
+		apiError(c, http.StatusRequestEntityTooLarge, msg)
+		return
+	}
+	c.String(http.StatusRequestEntityTooLarge, msg)
+	c.Abort()
+}
+
+// ---------- CSRF 防护（双重提交 Cookie） ----------
+
+const (
+	csrfCookie = "csrf_token" // 存放令牌的 Cookie
+	csrfField  = "_csrf"      // 表单中的隐藏字段
+	csrfHeader = "X-CSRF-Token"
+)
+
+// csrfProtect 页面表单的 CSRF 校验
+// 每个访客一个随机令牌，放在 Cookie 里，同时通过 render 注入模板（.csrfToken）；
+// 写请求必须在表单字段或请求头里带上同样的令牌。
+// /api/ 下的接口和 /graphql 用 JWT 认证，不依赖 Cookie，不做校验
+func csrfProtect() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isAPIPath(c) {
+			c.Next()
+			return
+		}
+
+		token, err := c.Cookie(csrfCookie)
+		if err != nil || token == "" {
+			token = randomToken(16)
+			c.SetSameSite(http.SameSiteLaxMode)
+			c.SetCookie(csrfCookie, token, 0, "/", "", secureCookie(c), true)
+		}
+		c.Set("csrfToken", token)
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		sent := c.GetHeader(csrfHeader)
+		if sent == "" {
+			sent = c.PostForm(csrfField)
+		}
+		if err != nil || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+			c.String(http.StatusForbidden, tr(c, "error.csrf"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ---------- 安全响应头 ----------
+
+// securityHeaderConfig 安全响应头的取值，留空表示不发送该响应头
+type securityHeaderConfig struct {
+	ContentSecurityPolicy string `yaml:"content_security_policy"` // Content-Security-Policy
+	FrameOptions          string `yaml:"frame_options"`           // X-Frame-Options
+	ContentTypeOptions    string `yaml:"content_type_options"`    // X-Content-Type-Options
+	ReferrerPolicy        string `yaml:"referrer_policy"`         // Referrer-Policy
+}
+
+// staticSitePrefix 静态站点的路由组
+const staticSitePrefix = "/static-site"
+
+// staticSiteHost 配置了 server.static_host 时，用这个域名访问的请求都交给静态站点：
+// 路径前面加上 staticSitePrefix，http://<static_host>/ 和 http://<主站>/static-site/ 是同一个页面，
+// 主站的其他页面用这个域名访问不到
+func staticSiteHost(next http.Handler) http.Handler {
+	host := cfg.Server.StaticHost
+	if host == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			name = h
+		}
+		if strings.EqualFold(name, host) {
+			r.URL.Path = staticSitePrefix + r.URL.Path
+			if r.URL.RawPath != "" {
+				r.URL.RawPath = staticSitePrefix + r.URL.RawPath
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// securityHeaders 给每个响应加上安全响应头
+func securityHeaders() gin.HandlerFunc {
+	h := cfg.SecurityHeaders
+	headers := [][2]string{
+		{"Content-Security-Policy", h.ContentSecurityPolicy},
+		{"X-Frame-Options", h.FrameOptions},
+		{"X-Content-Type-Options", h.ContentTypeOptions},
+		{"Referrer-Policy", h.ReferrerPolicy},
+	}
+	return func(c *gin.Context) {
+		for _, h := range headers {
+			if h[1] != "" {
+				c.Header(h[0], h[1])
+			}
+		}
+		c.Next()
+	}
+}
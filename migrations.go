@@ -0,0 +1,1136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ==================== 数据库迁移 ====================
+
+// 表结构的每一次变化都写成一条带编号的迁移（Up 升级 / Down 回滚），
+// 已执行的版本记录在 schema_migrations 表里。
+// 迁移函数里用的是当时的结构体快照，不要直接引用会继续变化的模型（如 Spot），
+// 否则以后模型加了字段，旧迁移的行为也会跟着变。
+
+// SchemaMigration 已执行的迁移
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// migration 一条迁移
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// migrations 全部迁移，按版本号递增排列，只能在末尾追加
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create_initial_tables",
+		// 引入迁移之前的库已经由 AutoMigrate 建好了这些表，
+		// 所以第一条迁移也用 AutoMigrate：新库建表，旧库只补缺失的列
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				ID             uint `gorm:"primaryKey"`
+				Name           string
+				Description    string
+				Ticket         string
+				Transport      string
+				RecommendCount int
+				ImageURL       string
+			}
+			type User struct {
+				ID           uint   `gorm:"primaryKey"`
+				Username     string `gorm:"uniqueIndex"`
+				PasswordHash string
+				Role         string
+				CreatedAt    time.Time
+			}
+			type Session struct {
+				Token     string `gorm:"primaryKey"`
+				UserID    uint   `gorm:"index"`
+				ExpiresAt time.Time
+			}
+			type APIKey struct {
+				ID         uint `gorm:"primaryKey"`
+				Name       string
+				Prefix     string
+				KeyHash    string `gorm:"uniqueIndex"`
+				RateLimit  int
+				Revoked    bool
+				LastUsedAt *time.Time
+				CreatedAt  time.Time
+			}
+			type UserIdentity struct {
+				ID         uint   `gorm:"primaryKey"`
+				UserID     uint   `gorm:"index"`
+				Provider   string `gorm:"uniqueIndex:idx_provider_external"`
+				ExternalID string `gorm:"uniqueIndex:idx_provider_external"`
+				Name       string
+				CreatedAt  time.Time
+			}
+			type Recommendation struct {
+				ID        uint   `gorm:"primaryKey"`
+				SpotID    uint   `gorm:"index:idx_rec_spot_visitor"`
+				VisitorID string `gorm:"index:idx_rec_spot_visitor"`
+				IP        string
+				CreatedAt time.Time
+			}
+			return tx.AutoMigrate(&Spot{}, &User{}, &Session{}, &APIKey{}, &UserIdentity{}, &Recommendation{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("recommendations", "user_identities", "api_keys", "sessions", "users", "spots")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_spot_timestamps_and_soft_delete",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				CreatedAt time.Time
+				UpdatedAt time.Time
+				DeletedAt gorm.DeletedAt `gorm:"index"`
+			}
+			m := tx.Migrator()
+			// 很早的库里 spots 已经有 created_at 列，存在就跳过
+			for _, field := range []string{"CreatedAt", "UpdatedAt", "DeletedAt"} {
+				if !m.HasColumn(&Spot{}, field) {
+					if err := m.AddColumn(&Spot{}, field); err != nil {
+						return err
+					}
+				}
+			}
+			if !m.HasIndex(&Spot{}, "DeletedAt") {
+				if err := m.CreateIndex(&Spot{}, "DeletedAt"); err != nil {
+					return err
+				}
+			}
+			// 已有数据没有时间，统一补成迁移时的时间
+			if err := tx.Exec("UPDATE spots SET created_at = CURRENT_TIMESTAMP WHERE created_at IS NULL").Error; err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE spots SET updated_at = created_at WHERE updated_at IS NULL").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				CreatedAt time.Time
+				UpdatedAt time.Time
+				DeletedAt gorm.DeletedAt `gorm:"index"`
+			}
+			if err := tx.Migrator().DropIndex(&Spot{}, "DeletedAt"); err != nil {
+				return err
+			}
+			// 不用 Migrator().DropColumn：它在 SQLite 上会重建整张表，遇到早期手工建的表会出错，
+			// 三种数据库都支持 ALTER TABLE ... DROP COLUMN（SQLite 3.35+）
+			for _, col := range []string{"deleted_at", "updated_at", "created_at"} {
+				if err := tx.Exec("ALTER TABLE spots DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_spot_revisions",
+		Up: func(tx *gorm.DB) error {
+			type SpotRevision struct {
+				ID          uint `gorm:"primaryKey"`
+				SpotID      uint `gorm:"index"`
+				Name        string
+				Description string
+				Ticket      string
+				Transport   string
+				ImageURL    string
+				EditorID    *uint
+				EditorName  string
+				CreatedAt   time.Time
+			}
+			return tx.Migrator().CreateTable(&SpotRevision{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("spot_revisions")
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create_audit_entries",
+		Up: func(tx *gorm.DB) error {
+			type AuditEntry struct {
+				ID        uint `gorm:"primaryKey"`
+				ActorID   *uint
+				Actor     string `gorm:"index"`
+				Action    string `gorm:"index"`
+				SpotID    uint   `gorm:"index"`
+				Before    string
+				After     string
+				IP        string
+				CreatedAt time.Time `gorm:"index"`
+			}
+			return tx.Migrator().CreateTable(&AuditEntry{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("audit_entries")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_spot_slug",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				ID   uint
+				Name string
+				Slug string `gorm:"uniqueIndex;size:191"`
+			}
+			m := tx.Migrator()
+			if err := m.AddColumn(&Spot{}, "Slug"); err != nil {
+				return err
+			}
+			// 给已有的景点（包括回收站里的）补上 slug，再建唯一索引
+			var spots []Spot
+			if err := tx.Table("spots").Select("id", "name").Order("id").Find(&spots).Error; err != nil {
+				return err
+			}
+			used := map[string]bool{}
+			for _, s := range spots {
+				base := slugify(s.Name)
+				slug := base
+				for i := 2; used[slug]; i++ {
+					slug = fmt.Sprintf("%s-%d", base, i)
+				}
+				used[slug] = true
+				if err := tx.Table("spots").Where("id = ?", s.ID).Update("slug", slug).Error; err != nil {
+					return err
+				}
+			}
+			return m.CreateIndex(&Spot{}, "Slug")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				Slug string `gorm:"uniqueIndex;size:191"`
+			}
+			if err := tx.Migrator().DropIndex(&Spot{}, "Slug"); err != nil {
+				return err
+			}
+			return tx.Exec("ALTER TABLE spots DROP COLUMN slug").Error
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_spot_images",
+		Up: func(tx *gorm.DB) error {
+			type SpotImage struct {
+				ID        uint `gorm:"primaryKey"`
+				SpotID    uint `gorm:"index"`
+				URL       string
+				Caption   string
+				Position  int
+				CreatedAt time.Time
+			}
+			return tx.Migrator().CreateTable(&SpotImage{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("spot_images")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add_spot_coordinates",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				Latitude  *float64
+				Longitude *float64
+			}
+			for _, field := range []string{"Latitude", "Longitude"} {
+				if err := tx.Migrator().AddColumn(&Spot{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, col := range []string{"longitude", "latitude"} {
+				if err := tx.Exec("ALTER TABLE spots DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 8,
+		Name:    "add_spot_province_city",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				Province string `gorm:"index:idx_spot_region"`
+				City     string `gorm:"index:idx_spot_region"`
+			}
+			m := tx.Migrator()
+			for _, field := range []string{"Province", "City"} {
+				if err := m.AddColumn(&Spot{}, field); err != nil {
+					return err
+				}
+			}
+			// 已有的景点没有地区，补成空字符串，和新数据保持一致（按地区分组时不会出现 NULL）
+			if err := tx.Exec("UPDATE spots SET province = '', city = ''").Error; err != nil {
+				return err
+			}
+			return m.CreateIndex(&Spot{}, "idx_spot_region")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				Province string `gorm:"index:idx_spot_region"`
+				City     string `gorm:"index:idx_spot_region"`
+			}
+			if err := tx.Migrator().DropIndex(&Spot{}, "idx_spot_region"); err != nil {
+				return err
+			}
+			for _, col := range []string{"city", "province"} {
+				if err := tx.Exec("ALTER TABLE spots DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 9,
+		Name:    "create_tags",
+		Up: func(tx *gorm.DB) error {
+			type Tag struct {
+				ID        uint   `gorm:"primaryKey"`
+				Name      string `gorm:"uniqueIndex;size:50"`
+				CreatedAt time.Time
+			}
+			type SpotTag struct {
+				SpotID uint `gorm:"primaryKey;autoIncrement:false"`
+				TagID  uint `gorm:"primaryKey;autoIncrement:false;index"`
+			}
+			return tx.Migrator().CreateTable(&Tag{}, &SpotTag{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("spot_tags", "tags")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "add_tag_spot_count",
+		Up: func(tx *gorm.DB) error {
+			type Tag struct {
+				SpotCount int `gorm:"index"`
+			}
+			m := tx.Migrator()
+			if err := m.AddColumn(&Tag{}, "SpotCount"); err != nil {
+				return err
+			}
+			err := tx.Exec(`UPDATE tags SET spot_count = (
+				SELECT COUNT(*) FROM spot_tags JOIN spots ON spots.id = spot_tags.spot_id
+				WHERE spot_tags.tag_id = tags.id AND spots.deleted_at IS NULL
+			)`).Error
+			if err != nil {
+				return err
+			}
+			return m.CreateIndex(&Tag{}, "SpotCount")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Tag struct {
+				SpotCount int `gorm:"index"`
+			}
+			if err := tx.Migrator().DropIndex(&Tag{}, "SpotCount"); err != nil {
+				return err
+			}
+			return tx.Exec("ALTER TABLE tags DROP COLUMN spot_count").Error
+		},
+	},
+	{
+		Version: 11,
+		Name:    "add_spot_prices",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				ID         uint
+				Ticket     string
+				AdultPrice *float64
+				ChildPrice *float64
+				IsFree     bool
+			}
+			m := tx.Migrator()
+			for _, field := range []string{"AdultPrice", "ChildPrice", "IsFree"} {
+				if err := m.AddColumn(&Spot{}, field); err != nil {
+					return err
+				}
+			}
+			// 从原来的票价文本中尽量解析出价格（包括回收站里的景点），解析不出的留空
+			var spots []Spot
+			if err := tx.Table("spots").Select("id", "ticket").Order("id").Find(&spots).Error; err != nil {
+				return err
+			}
+			for _, s := range spots {
+				p := parseTicketPrice(s.Ticket)
+				err := tx.Table("spots").Where("id = ?", s.ID).Updates(map[string]interface{}{
+					"adult_price": p.Adult,
+					"child_price": p.Child,
+					"is_free":     p.IsFree,
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, col := range []string{"is_free", "child_price", "adult_price"} {
+				if err := tx.Exec("ALTER TABLE spots DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 12,
+		Name:    "add_spot_opening_hours",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				OpeningHours string `gorm:"type:text"`
+			}
+			return tx.Migrator().AddColumn(&Spot{}, "OpeningHours")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE spots DROP COLUMN opening_hours").Error
+		},
+	},
+	{
+		Version: 13,
+		Name:    "add_spot_best_months",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				BestMonths int `gorm:"not null;default:0"`
+			}
+			return tx.Migrator().AddColumn(&Spot{}, "BestMonths")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE spots DROP COLUMN best_months").Error
+		},
+	},
+	{
+		Version: 14,
+		Name:    "create_comments",
+		Up: func(tx *gorm.DB) error {
+			type Comment struct {
+				ID        uint `gorm:"primaryKey"`
+				SpotID    uint `gorm:"index"`
+				UserID    *uint
+				Author    string `gorm:"size:50"`
+				Body      string `gorm:"type:text"`
+				IP        string `gorm:"size:45"`
+				CreatedAt time.Time
+			}
+			return tx.Migrator().CreateTable(&Comment{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("comments")
+		},
+	},
+	{
+		Version: 15,
+		Name:    "create_ratings",
+		Up: func(tx *gorm.DB) error {
+			type Rating struct {
+				ID        uint   `gorm:"primaryKey"`
+				SpotID    uint   `gorm:"index:idx_rating_spot_visitor"`
+				VisitorID string `gorm:"index:idx_rating_spot_visitor"`
+				Stars     int
+				IP        string
+				CreatedAt time.Time
+				UpdatedAt time.Time
+			}
+			type Spot struct {
+				RatingAvg   float64 `gorm:"not null;default:0;index"`
+				RatingCount int     `gorm:"not null;default:0"`
+			}
+			m := tx.Migrator()
+			if err := m.CreateTable(&Rating{}); err != nil {
+				return err
+			}
+			for _, field := range []string{"RatingAvg", "RatingCount"} {
+				if err := m.AddColumn(&Spot{}, field); err != nil {
+					return err
+				}
+			}
+			return m.CreateIndex(&Spot{}, "RatingAvg")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				RatingAvg float64 `gorm:"index"`
+			}
+			m := tx.Migrator()
+			if err := m.DropIndex(&Spot{}, "RatingAvg"); err != nil {
+				return err
+			}
+			for _, col := range []string{"rating_count", "rating_avg"} {
+				if err := tx.Exec("ALTER TABLE spots DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return m.DropTable("ratings")
+		},
+	},
+	{
+		Version: 16,
+		Name:    "add_comment_threads",
+		Up: func(tx *gorm.DB) error {
+			type Comment struct {
+				ParentID *uint `gorm:"index"`
+				RootID   *uint `gorm:"index"`
+			}
+			m := tx.Migrator()
+			for _, field := range []string{"ParentID", "RootID"} {
+				if err := m.AddColumn(&Comment{}, field); err != nil {
+					return err
+				}
+				if err := m.CreateIndex(&Comment{}, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			type Comment struct {
+				ParentID *uint `gorm:"index"`
+				RootID   *uint `gorm:"index"`
+			}
+			m := tx.Migrator()
+			for _, field := range []string{"RootID", "ParentID"} {
+				if err := m.DropIndex(&Comment{}, field); err != nil {
+					return err
+				}
+			}
+			for _, col := range []string{"root_id", "parent_id"} {
+				if err := tx.Exec("ALTER TABLE comments DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 17,
+		Name:    "add_comment_status",
+		Up: func(tx *gorm.DB) error {
+			type Comment struct {
+				Status string `gorm:"size:20;index"`
+			}
+			m := tx.Migrator()
+			if err := m.AddColumn(&Comment{}, "Status"); err != nil {
+				return err
+			}
+			// 已有的评论都已经显示出来了，算作通过
+			if err := tx.Exec("UPDATE comments SET status = ?", CommentApproved).Error; err != nil {
+				return err
+			}
+			return m.CreateIndex(&Comment{}, "Status")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Comment struct {
+				Status string `gorm:"size:20;index"`
+			}
+			if err := tx.Migrator().DropIndex(&Comment{}, "Status"); err != nil {
+				return err
+			}
+			return tx.Exec("ALTER TABLE comments DROP COLUMN status").Error
+		},
+	},
+	{
+		Version: 18,
+		Name:    "create_reports",
+		Up: func(tx *gorm.DB) error {
+			type Report struct {
+				ID         uint   `gorm:"primaryKey"`
+				TargetType string `gorm:"size:20;index:idx_report_target"`
+				TargetID   uint   `gorm:"index:idx_report_target"`
+				Reason     string `gorm:"size:20"`
+				Detail     string `gorm:"type:text"`
+				VisitorID  string
+				IP         string `gorm:"size:45"`
+				Status     string `gorm:"size:20;index"`
+				HandledBy  string
+				HandledAt  *time.Time
+				CreatedAt  time.Time
+			}
+			return tx.Migrator().CreateTable(&Report{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("reports")
+		},
+	},
+	{
+		Version: 19,
+		Name:    "add_spot_status",
+		Up: func(tx *gorm.DB) error {
+			// 已有的景点都已经公开显示，默认值就是已发布
+			type Spot struct {
+				Status     string `gorm:"size:20;index;default:published"`
+				ReviewNote string
+			}
+			m := tx.Migrator()
+			for _, field := range []string{"Status", "ReviewNote"} {
+				if err := m.AddColumn(&Spot{}, field); err != nil {
+					return err
+				}
+			}
+			if err := tx.Exec("UPDATE spots SET status = ? WHERE status IS NULL OR status = ''", SpotPublished).Error; err != nil {
+				return err
+			}
+			return m.CreateIndex(&Spot{}, "Status")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				Status string `gorm:"size:20;index"`
+			}
+			if err := tx.Migrator().DropIndex(&Spot{}, "Status"); err != nil {
+				return err
+			}
+			for _, col := range []string{"review_note", "status"} {
+				if err := tx.Exec("ALTER TABLE spots DROP COLUMN " + col).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 20,
+		Name:    "create_favorites",
+		Up: func(tx *gorm.DB) error {
+			type Favorite struct {
+				ID        uint `gorm:"primaryKey"`
+				UserID    uint `gorm:"uniqueIndex:idx_favorite_user_spot"`
+				SpotID    uint `gorm:"uniqueIndex:idx_favorite_user_spot;index"`
+				CreatedAt time.Time
+			}
+			type Spot struct {
+				FavoriteCount int `gorm:"not null;default:0"`
+			}
+			if err := tx.Migrator().CreateTable(&Favorite{}); err != nil {
+				return err
+			}
+			return tx.Migrator().AddColumn(&Spot{}, "FavoriteCount")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Exec("ALTER TABLE spots DROP COLUMN favorite_count").Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable("favorites")
+		},
+	},
+	{
+		Version: 21,
+		Name:    "create_itineraries",
+		Up: func(tx *gorm.DB) error {
+			type Itinerary struct {
+				ID         uint   `gorm:"primaryKey"`
+				UserID     uint   `gorm:"index"`
+				Title      string `gorm:"size:100"`
+				Days       int
+				ShareToken string `gorm:"size:32;uniqueIndex"`
+				CreatedAt  time.Time
+				UpdatedAt  time.Time
+			}
+			type ItineraryStop struct {
+				ID          uint `gorm:"primaryKey"`
+				ItineraryID uint `gorm:"index"`
+				SpotID      uint `gorm:"index"`
+				Day         int
+				Position    int
+				Note        string
+			}
+			return tx.Migrator().CreateTable(&Itinerary{}, &ItineraryStop{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("itinerary_stops", "itineraries")
+		},
+	},
+	{
+		Version: 22,
+		Name:    "add_itinerary_start_date",
+		Up: func(tx *gorm.DB) error {
+			type Itinerary struct {
+				StartDate string `gorm:"size:10"`
+			}
+			return tx.Migrator().AddColumn(&Itinerary{}, "StartDate")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE itineraries DROP COLUMN start_date").Error
+		},
+	},
+	{
+		Version: 23,
+		Name:    "create_check_ins",
+		Up: func(tx *gorm.DB) error {
+			type CheckIn struct {
+				ID        uint   `gorm:"primaryKey"`
+				UserID    uint   `gorm:"uniqueIndex:idx_checkin_user_spot"`
+				SpotID    uint   `gorm:"uniqueIndex:idx_checkin_user_spot;index"`
+				VisitedOn string `gorm:"size:10"`
+				Note      string `gorm:"type:text"`
+				CreatedAt time.Time
+				UpdatedAt time.Time
+			}
+			type Spot struct {
+				CheckinCount int `gorm:"not null;default:0"`
+			}
+			if err := tx.Migrator().CreateTable(&CheckIn{}); err != nil {
+				return err
+			}
+			return tx.Migrator().AddColumn(&Spot{}, "CheckinCount")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Exec("ALTER TABLE spots DROP COLUMN checkin_count").Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable("check_ins")
+		},
+	},
+	{
+		Version: 24,
+		Name:    "add_spot_view_count",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				ViewCount int64 `gorm:"not null;default:0;index"`
+			}
+			if err := tx.Migrator().AddColumn(&Spot{}, "ViewCount"); err != nil {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&Spot{}, "ViewCount")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				ViewCount int64 `gorm:"index"`
+			}
+			if err := tx.Migrator().DropIndex(&Spot{}, "ViewCount"); err != nil {
+				return err
+			}
+			return tx.Exec("ALTER TABLE spots DROP COLUMN view_count").Error
+		},
+	},
+	{
+		Version: 25,
+		Name:    "index_recommendation_created_at",
+		Up: func(tx *gorm.DB) error {
+			// 热门趋势按时间范围查推荐记录
+			type Recommendation struct {
+				CreatedAt time.Time `gorm:"index"`
+			}
+			return tx.Migrator().CreateIndex(&Recommendation{}, "CreatedAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Recommendation struct {
+				CreatedAt time.Time `gorm:"index"`
+			}
+			return tx.Migrator().DropIndex(&Recommendation{}, "CreatedAt")
+		},
+	},
+	{
+		Version: 26,
+		Name:    "add_spot_rating_score",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				ID          uint
+				RatingAvg   float64
+				RatingCount int
+				RatingScore float64 `gorm:"not null;default:0;index"`
+			}
+			m := tx.Migrator()
+			if err := m.AddColumn(&Spot{}, "RatingScore"); err != nil {
+				return err
+			}
+			if err := m.CreateIndex(&Spot{}, "RatingScore"); err != nil {
+				return err
+			}
+			// 已有评分的景点算出 Wilson 分数
+			var spots []Spot
+			if err := tx.Where("rating_count > 0").Find(&spots).Error; err != nil {
+				return err
+			}
+			for _, s := range spots {
+				if err := tx.Model(&Spot{}).Where("id = ?", s.ID).
+					Update("rating_score", wilsonScore(s.RatingAvg, s.RatingCount)).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				RatingScore float64 `gorm:"index"`
+			}
+			if err := tx.Migrator().DropIndex(&Spot{}, "RatingScore"); err != nil {
+				return err
+			}
+			return tx.Exec("ALTER TABLE spots DROP COLUMN rating_score").Error
+		},
+	},
+	{
+		Version: 27,
+		Name:    "create_settings",
+		Up: func(tx *gorm.DB) error {
+			type Setting struct {
+				Name      string `gorm:"primaryKey;size:50"`
+				Value     string
+				UpdatedAt time.Time
+			}
+			return tx.Migrator().CreateTable(&Setting{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("settings")
+		},
+	},
+	{
+		Version: 28,
+		Name:    "create_spot_similarities",
+		Up: func(tx *gorm.DB) error {
+			type SpotSimilarity struct {
+				SpotID  uint `gorm:"primaryKey;autoIncrement:false"`
+				OtherID uint `gorm:"primaryKey;autoIncrement:false"`
+				Score   float64
+			}
+			return tx.Migrator().CreateTable(&SpotSimilarity{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("spot_similarities")
+		},
+	},
+	{
+		Version: 29,
+		Name:    "index_spot_name",
+		Up: func(tx *gorm.DB) error {
+			// 搜索联想按名称前缀做范围查询
+			type Spot struct {
+				Name string `gorm:"index"`
+			}
+			return tx.Migrator().CreateIndex(&Spot{}, "Name")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				Name string `gorm:"index"`
+			}
+			return tx.Migrator().DropIndex(&Spot{}, "Name")
+		},
+	},
+	{
+		Version: 30,
+		Name:    "add_spot_pinyin",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				ID                uint
+				Name              string
+				Description       string
+				PinyinName        string
+				PinyinDescription string
+			}
+			m := tx.Migrator()
+			for _, field := range []string{"PinyinName", "PinyinDescription"} {
+				if err := m.AddColumn(&Spot{}, field); err != nil {
+					return err
+				}
+			}
+			// 已有景点（包括回收站里的）生成拼音
+			var spots []Spot
+			if err := tx.Select("id", "name", "description").Find(&spots).Error; err != nil {
+				return err
+			}
+			for _, s := range spots {
+				name, description := spotPinyin(s.Name, s.Description)
+				if err := tx.Model(&Spot{}).Where("id = ?", s.ID).Updates(map[string]interface{}{
+					"pinyin_name":        name,
+					"pinyin_description": description,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, column := range []string{"pinyin_name", "pinyin_description"} {
+				if err := tx.Exec("ALTER TABLE spots DROP COLUMN " + column).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 31,
+		Name:    "add_spot_short_code",
+		Up: func(tx *gorm.DB) error {
+			type Spot struct {
+				ShortCode   *string `gorm:"uniqueIndex;size:16"`
+				ShortClicks int64   `gorm:"not null;default:0"`
+			}
+			m := tx.Migrator()
+			for _, field := range []string{"ShortCode", "ShortClicks"} {
+				if err := m.AddColumn(&Spot{}, field); err != nil {
+					return err
+				}
+			}
+			return m.CreateIndex(&Spot{}, "ShortCode")
+		},
+		Down: func(tx *gorm.DB) error {
+			type Spot struct {
+				ShortCode *string `gorm:"uniqueIndex;size:16"`
+			}
+			if err := tx.Migrator().DropIndex(&Spot{}, "ShortCode"); err != nil {
+				return err
+			}
+			for _, column := range []string{"short_code", "short_clicks"} {
+				if err := tx.Exec("ALTER TABLE spots DROP COLUMN " + column).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 32,
+		Name:    "create_webhooks",
+		Up: func(tx *gorm.DB) error {
+			type Webhook struct {
+				ID        uint `gorm:"primaryKey"`
+				URL       string
+				Events    string
+				Secret    string
+				Active    bool
+				CreatedAt time.Time
+			}
+			type WebhookDelivery struct {
+				ID            uint   `gorm:"primaryKey"`
+				WebhookID     uint   `gorm:"index"`
+				Event         string `gorm:"size:50"`
+				Payload       string
+				Status        string `gorm:"size:20;index"`
+				Attempts      int
+				ResponseCode  int
+				Error         string
+				NextAttemptAt time.Time `gorm:"index"`
+				CreatedAt     time.Time
+				UpdatedAt     time.Time
+			}
+			return tx.Migrator().CreateTable(&Webhook{}, &WebhookDelivery{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("webhook_deliveries", "webhooks")
+		},
+	},
+	{
+		Version: 33,
+		Name:    "create_digest_subscribers",
+		Up: func(tx *gorm.DB) error {
+			type DigestSubscriber struct {
+				ID            uint   `gorm:"primaryKey"`
+				Email         string `gorm:"uniqueIndex;size:191"`
+				Token         string `gorm:"uniqueIndex;size:64"`
+				Confirmed     bool   `gorm:"index"`
+				ConfirmSentAt time.Time
+				LastSentAt    *time.Time
+				CreatedAt     time.Time
+			}
+			return tx.Migrator().CreateTable(&DigestSubscriber{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("digest_subscribers")
+		},
+	},
+	{
+		Version: 34,
+		Name:    "create_notifications",
+		Up: func(tx *gorm.DB) error {
+			type Notification struct {
+				ID        uint       `gorm:"primaryKey"`
+				UserID    uint       `gorm:"index:idx_notification_user"`
+				Kind      string     `gorm:"size:30"`
+				Message   string     `gorm:"size:500"`
+				Link      string     `gorm:"size:500"`
+				ReadAt    *time.Time `gorm:"index:idx_notification_user"`
+				CreatedAt time.Time
+			}
+			return tx.Migrator().CreateTable(&Notification{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("notifications")
+		},
+	},
+	{
+		Version: 35,
+		Name:    "create_spot_translations",
+		Up: func(tx *gorm.DB) error {
+			type SpotTranslation struct {
+				ID          uint   `gorm:"primaryKey"`
+				SpotID      uint   `gorm:"uniqueIndex:idx_spot_translation"`
+				Locale      string `gorm:"uniqueIndex:idx_spot_translation;size:10"`
+				Name        string
+				Description string
+				UpdatedAt   time.Time
+			}
+			return tx.Migrator().CreateTable(&SpotTranslation{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable("spot_translations")
+		},
+	},
+	{
+		Version: 36,
+		Name:    "add_digest_subscriber_locale",
+		Up: func(tx *gorm.DB) error {
+			type DigestSubscriber struct {
+				Locale string `gorm:"size:10"`
+			}
+			if err := tx.Migrator().AddColumn(&DigestSubscriber{}, "Locale"); err != nil {
+				return err
+			}
+			// 已有的订阅者不知道用的什么语言，留空，发邮件时用默认语言
+			return tx.Exec("UPDATE digest_subscribers SET locale = ''").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE digest_subscribers DROP COLUMN locale").Error
+		},
+	},
+}
+
+// appliedVersions 查询已执行的迁移版本
+func appliedVersions() (map[int]bool, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]bool, len(rows))
+	for _, r := range rows {
+		applied[r.Version] = true
+	}
+	return applied, nil
+}
+
+// pendingMigrations 还没执行的迁移数量
+func pendingMigrations() (int, error) {
+	applied, err := appliedVersions()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// migrateUp 按顺序执行所有未执行的迁移，每条迁移在一个事务里完成
+func migrateUp() error {
+	applied, err := appliedVersions()
+	if err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		// 大表上的迁移可能要跑很久，不受 query_timeout 限制
+		err := db.WithContext(withoutQueryTimeout(context.Background())).Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("迁移 %d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		slog.Info("已执行迁移", "version", m.Version, "name", m.Name)
+	}
+	return nil
+}
+
+// migrateDown 回滚最近执行的 steps 条迁移
+func migrateDown(steps int) error {
+	applied, err := appliedVersions()
+	if err != nil {
+		return err
+	}
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if !applied[m.Version] {
+			continue
+		}
+		err := db.WithContext(withoutQueryTimeout(context.Background())).Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return fmt.Errorf("回滚 %d_%s 失败: %w", m.Version, m.Name, err)
+		}
+		slog.Info("已回滚迁移", "version", m.Version, "name", m.Name)
+		steps--
+	}
+	return nil
+}
+
+// runMigrateCommand 处理 migrate 子命令：
+//
+//	migrate up        执行所有未执行的迁移
+//	migrate down [n]  回滚最近 n 条迁移（默认1条）
+//	migrate status    查看每条迁移的状态
+func runMigrateCommand(args []string) {
+	sub := "up"
+	if len(args) > 0 {
+		sub = args[0]
+	}
+
+	switch sub {
+	case "up":
+		if err := migrateUp(); err != nil {
+			fatal("数据库迁移失败", "err", err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fatal("回滚条数必须是正整数")
+			}
+			steps = n
+		}
+		if err := migrateDown(steps); err != nil {
+			fatal("回滚迁移失败", "err", err)
+		}
+	case "status":
+		applied, err := appliedVersions()
+		if err != nil {
+			fatal("查询迁移状态失败", "err", err)
+		}
+		for _, m := range migrations {
+			state := "未执行"
+			if applied[m.Version] {
+				state = "已执行"
+			}
+			fmt.Printf("%4d  %-40s %s\n", m.Version, m.Name, state)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "用法: migrate [up | down [n] | status]")
+		os.Exit(2)
+	}
+}
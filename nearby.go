@@ -0,0 +1,121 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 附近的景点 ====================
+
+const (
+	earthRadiusKm     = 6371.0
+	defaultNearbyKm   = 10.0
+	maxNearbyRadiusKm = 500.0
+)
+
+// nearbySpot 附近的景点，带上距离
+type nearbySpot struct {
+	Spot
+	DistanceKm float64 `json:"distance_km"`
+}
+
+// haversineKm 两点间的球面距离（公里）
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// findNearby 查找 radiusKm 公里内有坐标的景点，按距离从近到远排序
+// 先在 SQL 里用经纬度范围粗筛（能用上普通比较），再在 Go 里按球面距离精确过滤
+func findNearby(lat, lng, radiusKm float64) ([]nearbySpot, error) {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	q := db.Scopes(published).Where("latitude BETWEEN ? AND ?", lat-dLat, lat+dLat).Where("longitude IS NOT NULL")
+	// 靠近两极或跨越 180° 经线时经度范围不好算，只按纬度粗筛
+	if cos := math.Cos(lat * math.Pi / 180); cos > 0.01 {
+		dLng := dLat / cos
+		if lng-dLng >= -180 && lng+dLng <= 180 {
+			q = q.Where("longitude BETWEEN ? AND ?", lng-dLng, lng+dLng)
+		}
+	}
+
+	var spots []Spot
+	if err := q.Find(&spots).Error; err != nil {
+		return nil, err
+	}
+	result := make([]nearbySpot, 0, len(spots))
+	for _, s := range spots {
+		d := haversineKm(lat, lng, *s.Latitude, *s.Longitude)
+		if d <= radiusKm {
+			result = append(result, nearbySpot{Spot: s, DistanceKm: math.Round(d*100) / 100})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].DistanceKm < result[j].DistanceKm })
+	return result, nil
+}
+
+// nearbyParams 解析 lat / lng / radius（公里），坐标缺失或不合法时 ok 为 false
+func nearbyParams(c *gin.Context) (lat, lng, radius float64, ok bool) {
+	lat, err1 := strconv.ParseFloat(c.Query("lat"), 64)
+	lng, err2 := strconv.ParseFloat(c.Query("lng"), 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return 0, 0, 0, false
+	}
+	radius, err := strconv.ParseFloat(c.Query("radius"), 64)
+	if err != nil || radius <= 0 {
+		radius = defaultNearbyKm
+	}
+	if radius > maxNearbyRadiusKm {
+		radius = maxNearbyRadiusKm
+	}
+	return lat, lng, radius, true
+}
+
+// showNearby 附近的景点：GET /nearby?lat=&lng=&radius=
+// fetch 调用时和 API 一样返回 JSON；浏览器打开时显示页面，没有坐标时页面会请求浏览器定位
+func showNearby(c *gin.Context) {
+	if wantsJSON(c) {
+		apiNearbySpots(c)
+		return
+	}
+	lat, lng, radius, ok := nearbyParams(c)
+	if !ok {
+		render(c, http.StatusOK, "nearby.html", gin.H{"title": tr(c, "spot.nearby"), "radius": defaultNearbyKm})
+		return
+	}
+	spots, err := findNearby(lat, lng, radius)
+	if err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.query_failed"))
+		return
+	}
+	render(c, http.StatusOK, "nearby.html", gin.H{
+		"title":   tr(c, "spot.nearby"),
+		"located": true,
+		"lat":     lat,
+		"lng":     lng,
+		"radius":  radius,
+		"spots":   spots,
+	})
+}
+
+// apiNearbySpots API 版：GET /api/v1/spots/nearby?lat=&lng=&radius=
+func apiNearbySpots(c *gin.Context) {
+	lat, lng, radius, ok := nearbyParams(c)
+	if !ok {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_coordinates"))
+		return
+	}
+	spots, err := findNearby(lat, lng, radius)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.query_failed"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"spots": spots, "radius_km": radius})
+}
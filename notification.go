@@ -0,0 +1,238 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 站内通知 ====================
+
+// 登录用户在站内收到的提醒：投稿的景点通过或被驳回、评论通过或被驳回、评论有了新回复。
+// 通知保存在表里，每个页面顶部的铃铛显示未读数和最近几条，点开一条就标为已读并跳到对应页面；
+// /notifications 列出全部通知，API 可以查询未读数和标记已读。
+// 访客没有账号，收不到通知；自己回复自己、管理员自己添加的景点都不通知。
+
+const (
+	notificationPageSize = 50 // /notifications 和 API 一次返回的通知数
+	notificationRecent   = 5  // 铃铛下拉里显示的通知数
+)
+
+// 通知类型
+const (
+	notifySpotPublished   = "spot_published"
+	notifySpotRejected    = "spot_rejected"
+	notifyCommentApproved = "comment_approved"
+	notifyCommentRejected = "comment_rejected"
+	notifyCommentReply    = "comment_reply"
+)
+
+// Notification 一条站内通知
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index:idx_notification_user" json:"-"`
+	Kind      string     `gorm:"size:30" json:"kind"`
+	Message   string     `gorm:"size:500" json:"message"`
+	Link      string     `gorm:"size:500" json:"link"`                                 // 站内路径，点开通知时跳转
+	ReadAt    *time.Time `gorm:"index:idx_notification_user" json:"read_at,omitempty"` // nil 表示未读
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// notificationSummary 铃铛下拉用到的数据
+type notificationSummary struct {
+	Unread int64
+	Recent []Notification
+}
+
+// notify 给用户发一条通知，失败只会少一条提醒，不影响调用方
+func notify(userID uint, kind, message, link string) {
+	db.Create(&Notification{
+		UserID:  userID,
+		Kind:    kind,
+		Message: truncateRunes(message, 200),
+		Link:    link,
+	})
+}
+
+// spotLink 景点详情页的站内路径
+func spotLink(spot *Spot) string {
+	return "/spot/" + url.PathEscape(spot.Slug)
+}
+
+// spotCreator 添加景点的登录用户（从操作日志里查），访客添加的返回 0
+func spotCreator(spotID uint) uint {
+	var e AuditEntry
+	db.Where("spot_id = ? AND action = ? AND actor_id IS NOT NULL", spotID, auditCreate).Order("id").Limit(1).Find(&e)
+	if e.ActorID == nil {
+		return 0
+	}
+	return *e.ActorID
+}
+
+// notifyReview 投稿审核后通知投稿人
+func notifyReview(c *gin.Context, spot *Spot) {
+	creator := spotCreator(spot.ID)
+	if user := currentUser(c); creator == 0 || user != nil && user.ID == creator {
+		return
+	}
+	if spot.Status == SpotPublished {
+		notify(creator, notifySpotPublished, "你投稿的景点「"+spot.Name+"」已通过审核并发布", spotLink(spot))
+		return
+	}
+	msg := "你投稿的景点「" + spot.Name + "」未通过审核"
+	if spot.ReviewNote != "" {
+		msg += "：" + spot.ReviewNote
+	}
+	notify(creator, notifySpotRejected, msg, "")
+}
+
+// notifyComment 评论审核后通知作者；评论显示出来时，通知被回复的评论的作者
+// moderated 为 true 表示是管理员审核的结果，为 false 表示发表时直接通过
+func notifyComment(comment *Comment, moderated bool) {
+	var spot Spot
+	if err := db.Unscoped().First(&spot, comment.SpotID).Error; err != nil {
+		return
+	}
+	link := spotLink(&spot) + "#comment-" + strconv.FormatUint(uint64(comment.ID), 10)
+	if moderated && comment.UserID != nil {
+		if comment.Status == CommentApproved {
+			notify(*comment.UserID, notifyCommentApproved, "你在「"+spot.Name+"」的评论已通过审核", link)
+		} else if comment.Status == CommentRejected {
+			notify(*comment.UserID, notifyCommentRejected, "你在「"+spot.Name+"」的评论未通过审核", spotLink(&spot))
+		}
+	}
+	if comment.Status != CommentApproved || comment.ParentID == nil {
+		return
+	}
+	var parent Comment
+	if err := db.First(&parent, *comment.ParentID).Error; err != nil || parent.UserID == nil {
+		return
+	}
+	if comment.UserID != nil && *comment.UserID == *parent.UserID {
+		return
+	}
+	author := comment.Author
+	if author == "" {
+		author = "游客"
+	}
+	notify(*parent.UserID, notifyCommentReply, author+" 回复了你在「"+spot.Name+"」的评论："+comment.Body, link)
+}
+
+// unreadNotifications 用户的未读通知数
+func unreadNotifications(userID uint) int64 {
+	var n int64
+	db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&n)
+	return n
+}
+
+// userNotifications 用户最近的通知，新的在前；unread 为 true 时只取未读的
+func userNotifications(userID uint, unread bool, limit int) []Notification {
+	q := db.Where("user_id = ?", userID)
+	if unread {
+		q = q.Where("read_at IS NULL")
+	}
+	items := []Notification{}
+	q.Order("id DESC").Limit(limit).Find(&items)
+	return items
+}
+
+// summarizeNotifications 铃铛下拉的数据，未登录返回 nil
+func summarizeNotifications(user *User) *notificationSummary {
+	if user == nil {
+		return nil
+	}
+	return &notificationSummary{
+		Unread: unreadNotifications(user.ID),
+		Recent: userNotifications(user.ID, false, notificationRecent),
+	}
+}
+
+// markNotificationsRead 把用户的通知标为已读，ids 为空时全部标为已读
+func markNotificationsRead(userID uint, ids []uint) error {
+	q := db.Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if len(ids) > 0 {
+		q = q.Where("id IN ?", ids)
+	}
+	return q.Update("read_at", time.Now()).Error
+}
+
+// ---------- 页面 ----------
+
+// showNotifications 我的通知：GET /notifications
+func showNotifications(c *gin.Context) {
+	if !loginFirst(c, "/notifications") {
+		return
+	}
+	render(c, http.StatusOK, "notifications.html", gin.H{
+		"title": tr(c, "notifications.title"),
+		"items": userNotifications(currentUser(c).ID, false, notificationPageSize),
+	})
+}
+
+// openNotification 打开一条通知：GET /notifications/:id，标为已读后跳到通知对应的页面
+func openNotification(c *gin.Context) {
+	if !loginFirst(c, "/notifications") {
+		return
+	}
+	var n Notification
+	if err := dbFor(c).Where("user_id = ?", currentUser(c).ID).First(&n, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.notification_not_found"))
+		return
+	}
+	markNotificationsRead(n.UserID, []uint{n.ID})
+	link := n.Link
+	if link == "" {
+		link = "/notifications"
+	}
+	c.Redirect(http.StatusFound, safeNext(link))
+}
+
+// readNotificationsForm 标为已读：POST /notifications/read，带 id 时只标这一条，否则全部
+func readNotificationsForm(c *gin.Context) {
+	if !loginFirst(c, "/notifications") {
+		return
+	}
+	var ids []uint
+	if id, err := strconv.ParseUint(c.PostForm("id"), 10, 64); err == nil {
+		ids = append(ids, uint(id))
+	}
+	if err := markNotificationsRead(currentUser(c).ID, ids); err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	c.Redirect(http.StatusFound, safeNext(c.PostForm("next")))
+}
+
+// ---------- API ----------
+
+// apiListNotifications 当前用户的通知：GET /api/v1/notifications?unread=1
+func apiListNotifications(c *gin.Context) {
+	userID := currentUser(c).ID
+	unread := c.Query("unread") == "1" || c.Query("unread") == "true"
+	c.JSON(http.StatusOK, gin.H{
+		"unread":        unreadNotifications(userID),
+		"notifications": userNotifications(userID, unread, notificationPageSize),
+	})
+}
+
+// apiReadNotifications 标为已读：POST /api/v1/notifications/read，请求体 {"ids": [1, 2]}，不传 ids 时全部标为已读
+func apiReadNotifications(c *gin.Context) {
+	var in struct {
+		IDs []uint `json:"ids"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&in); err != nil {
+			apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+			return
+		}
+	}
+	userID := currentUser(c).ID
+	if err := markNotificationsRead(userID, in.IDs); err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": unreadNotifications(userID)})
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 投稿通知（钉钉 / Slack） ====================
+
+// 非管理员添加景点时，往配置的钉钉群机器人或 Slack Incoming Webhook 发一条消息，
+// 带上景点摘要和审核链接，管理员不用一直盯着 /admin/submissions。
+// 访客的投稿进入审核队列，消息里是“待审核”和审核页面的链接；登录用户添加的直接发布，消息里是详情页链接。
+// 两个都没配置时什么也不做；发送在后台进行，失败只打印日志，不影响添加景点。
+
+const notifySummaryLen = 100 // 消息里描述的最多字数
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// submissionNotice 一条投稿通知的内容
+type submissionNotice struct {
+	Spot      Spot
+	Submitter string // 用户名，访客为 “访客（IP）”
+	SpotURL   string // 详情页（按ID，待审核的景点管理员登录后能看到）
+	ReviewURL string // 投稿审核页面
+}
+
+// notifySubmission 非管理员添加景点后调用
+func notifySubmission(c *gin.Context, spot *Spot) {
+	if cfg.Notify.DingTalk.Webhook == "" && cfg.Notify.Slack.Webhook == "" {
+		return
+	}
+	user := currentUser(c)
+	if user.IsAdmin() {
+		return
+	}
+	n := submissionNotice{
+		Spot:      *spot,
+		SpotURL:   absoluteURL(c, "/spot/"+strconv.FormatUint(uint64(spot.ID), 10)),
+		ReviewURL: absoluteURL(c, "/admin/submissions"),
+	}
+	if user != nil {
+		n.Submitter = user.Username
+	} else {
+		n.Submitter = "访客（" + c.ClientIP() + "）"
+	}
+	ctx := c.Request.Context() // 只用来在日志里带上请求 ID，goroutine 里不能再用 c
+	go func() {
+		if cfg.Notify.DingTalk.Webhook != "" {
+			if err := sendDingTalk(n); err != nil {
+				slog.ErrorContext(ctx, "发送钉钉通知失败", "err", err)
+			}
+		}
+		if cfg.Notify.Slack.Webhook != "" {
+			if err := sendSlack(n); err != nil {
+				slog.ErrorContext(ctx, "发送 Slack 通知失败", "err", err)
+			}
+		}
+	}()
+}
+
+// title 消息标题
+func (n submissionNotice) title() string {
+	if n.Spot.Status == SpotPending {
+		return "新投稿待审核：" + n.Spot.Name
+	}
+	return "新景点：" + n.Spot.Name
+}
+
+// fields 景点摘要的各行（标签：值）
+func (n submissionNotice) fields() [][2]string {
+	var rows [][2]string
+	if region := strings.TrimSpace(n.Spot.Province + " " + n.Spot.City); region != "" {
+		rows = append(rows, [2]string{"地区", region})
+	}
+	if len(n.Spot.Tags) > 0 {
+		names := make([]string, len(n.Spot.Tags))
+		for i, t := range n.Spot.Tags {
+			names[i] = t.Name
+		}
+		rows = append(rows, [2]string{"标签", strings.Join(names, "、")})
+	}
+	rows = append(rows, [2]string{"提交人", n.Submitter})
+	if d := truncateRunes(markdownText(n.Spot.Description), notifySummaryLen); d != "" {
+		rows = append(rows, [2]string{"描述", d})
+	}
+	return rows
+}
+
+// sendDingTalk 发到钉钉群机器人（markdown 消息），配置了加签密钥时带上签名
+func sendDingTalk(n submissionNotice) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, "### %s\n\n", n.title())
+	for _, f := range n.fields() {
+		fmt.Fprintf(&text, "- **%s**：%s\n", f[0], f[1])
+	}
+	fmt.Fprintf(&text, "\n[查看景点](%s)", n.SpotURL)
+	if n.Spot.Status == SpotPending {
+		fmt.Fprintf(&text, " | [去审核](%s)", n.ReviewURL)
+	}
+	body := map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": n.title(), "text": text.String()},
+	}
+
+	endpoint := cfg.Notify.DingTalk.Webhook
+	if secret := cfg.Notify.DingTalk.Secret; secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(timestamp + "\n" + secret))
+		sign := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+		endpoint += "&timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+	}
+	var resp struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := postNotify(endpoint, body, &resp); err != nil {
+		return err
+	}
+	if resp.ErrCode != 0 {
+		return fmt.Errorf("钉钉返回错误 %d: %s", resp.ErrCode, resp.ErrMsg)
+	}
+	return nil
+}
+
+// sendSlack 发到 Slack Incoming Webhook（mrkdwn 文本）
+func sendSlack(n submissionNotice) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, "*%s*\n", slackEscape(n.title()))
+	for _, f := range n.fields() {
+		fmt.Fprintf(&text, "• *%s*：%s\n", f[0], slackEscape(f[1]))
+	}
+	fmt.Fprintf(&text, "<%s|查看景点>", n.SpotURL)
+	if n.Spot.Status == SpotPending {
+		fmt.Fprintf(&text, " | <%s|去审核>", n.ReviewURL)
+	}
+	return postNotify(cfg.Notify.Slack.Webhook, map[string]string{"text": text.String()}, nil)
+}
+
+// slackEscape 转义 Slack mrkdwn 的控制字符
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// postNotify POST JSON，out 不为 nil 时解析响应
+func postNotify(endpoint string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("返回 %s", resp.Status)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 第三方登录（GitHub / 微信） ====================
+
+// UserIdentity 第三方账号与本站用户的绑定关系
+// 同一个用户可以绑定多个平台，同一平台账号只能绑定一个用户
+type UserIdentity struct {
+	ID         uint   `gorm:"primaryKey"`
+	UserID     uint   `gorm:"index"`
+	Provider   string `gorm:"uniqueIndex:idx_provider_external"` // github / wechat
+	ExternalID string `gorm:"uniqueIndex:idx_provider_external"` // 平台上的用户ID
+	Name       string // 平台上的昵称
+	CreatedAt  time.Time
+}
+
+// oauthProfile 从第三方平台取回的用户信息
+type oauthProfile struct {
+	ID   string
+	Name string
+}
+
+// oauthProvider 一个第三方登录平台
+type oauthProvider struct {
+	Name         string // 标识，用在 URL 中
+	Title        string // 页面上显示的名称
+	ClientID     string
+	ClientSecret string
+	// authURL 生成跳转到平台授权页的地址
+	authURL func(p *oauthProvider, redirectURI, state string) string
+	// fetchProfile 用授权码换取令牌并读取用户信息
+	fetchProfile func(ctx context.Context, p *oauthProvider, redirectURI, code string) (*oauthProfile, error)
+}
+
+// oauthProviders 已配置的平台（没有配置 ID/Secret 的平台不会出现在这里）
+var oauthProviders = map[string]*oauthProvider{}
+
+// oauthBaseURL 回调地址前缀，例如 https://spots.example.com
+var oauthBaseURL string
+
+var oauthClient = &http.Client{Timeout: 10 * time.Second}
+
+// initOAuth 根据配置启用各平台，没有配置 ID/Secret 的平台不启用
+func initOAuth() {
+	oauthBaseURL = strings.TrimRight(cfg.OAuth.BaseURL, "/")
+
+	if gh := cfg.OAuth.GitHub; gh.ClientID != "" && gh.ClientSecret != "" {
+		oauthProviders["github"] = &oauthProvider{
+			Name: "github", Title: "GitHub",
+			ClientID: gh.ClientID, ClientSecret: gh.ClientSecret,
+			authURL: githubAuthURL, fetchProfile: githubProfile,
+		}
+	}
+	if wx := cfg.OAuth.WeChat; wx.AppID != "" && wx.AppSecret != "" {
+		oauthProviders["wechat"] = &oauthProvider{
+			Name: "wechat", Title: "微信",
+			ClientID: wx.AppID, ClientSecret: wx.AppSecret,
+			authURL: wechatAuthURL, fetchProfile: wechatProfile,
+		}
+	}
+	for name := range oauthProviders {
+		slog.Info("已启用第三方登录", "provider", name)
+	}
+}
+
+// providerList 按固定顺序返回已启用的平台，给模板用
+func providerList() []*oauthProvider {
+	var list []*oauthProvider
+	for _, name := range []string{"wechat", "github"} {
+		if p, ok := oauthProviders[name]; ok {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// getJSON 发送请求并把 JSON 响应解析到 out
+func getJSON(req *http.Request, out interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := oauthClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s 返回状态码 %d", req.URL.Host, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ---------- GitHub ----------
+
+func githubAuthURL(p *oauthProvider, redirectURI, state string) string {
+	q := url.Values{
+		"client_id":    {p.ClientID},
+		"redirect_uri": {redirectURI},
+		"scope":        {"read:user"},
+		"state":        {state},
+	}
+	return "https://github.com/login/oauth/authorize?" + q.Encode()
+}
+
+func githubProfile(ctx context.Context, p *oauthProvider, redirectURI, code string) (*oauthProfile, error) {
+	form := url.Values{
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://github.com/login/oauth/access_token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := getJSON(req, &tok); err != nil {
+		return nil, err
+	}
+	if tok.AccessToken == "" {
+		return nil, errors.New("github: " + tok.Error)
+	}
+
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, "https://api.github.com/user", nil)
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	var u struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := getJSON(req, &u); err != nil {
+		return nil, err
+	}
+	return &oauthProfile{ID: fmt.Sprint(u.ID), Name: u.Login}, nil
+}
+
+// ---------- 微信（网站应用扫码登录） ----------
+
+func wechatAuthURL(p *oauthProvider, redirectURI, state string) string {
+	q := url.Values{
+		"appid":         {p.ClientID},
+		"redirect_uri":  {redirectURI},
+		"response_type": {"code"},
+		"scope":         {"snsapi_login"},
+		"state":         {state},
+	}
+	return "https://open.weixin.qq.com/connect/qrconnect?" + q.Encode() + "#wechat_redirect"
+}
+
+func wechatProfile(ctx context.Context, p *oauthProvider, redirectURI, code string) (*oauthProfile, error) {
+	q := url.Values{
+		"appid":      {p.ClientID},
+		"secret":     {p.ClientSecret},
+		"code":       {code},
+		"grant_type": {"authorization_code"},
+	}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://api.weixin.qq.com/sns/oauth2/access_token?"+q.Encode(), nil)
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		OpenID      string `json:"openid"`
+		UnionID     string `json:"unionid"`
+		ErrCode     int    `json:"errcode"`
+		ErrMsg      string `json:"errmsg"`
+	}
+	if err := getJSON(req, &tok); err != nil {
+		return nil, err
+	}
+	if tok.ErrCode != 0 {
+		return nil, fmt.Errorf("wechat: %d %s", tok.ErrCode, tok.ErrMsg)
+	}
+
+	q = url.Values{"access_token": {tok.AccessToken}, "openid": {tok.OpenID}}
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet,
+		"https://api.weixin.qq.com/sns/userinfo?"+q.Encode(), nil)
+	var u struct {
+		Nickname string `json:"nickname"`
+	}
+	if err := getJSON(req, &u); err != nil {
+		return nil, err
+	}
+
+	// 有 unionid 时优先使用，同一开放平台下的多个应用可以识别为同一人
+	id := tok.UnionID
+	if id == "" {
+		id = tok.OpenID
+	}
+	return &oauthProfile{ID: id, Name: u.Nickname}, nil
+}
+
+// ---------- 登录流程 ----------
+
+const oauthStateCookie = "oauth_state"
+
+func redirectURI(p *oauthProvider) string {
+	return oauthBaseURL + "/auth/" + p.Name + "/callback"
+}
+
+// oauthStart 跳转到第三方授权页：GET /auth/:provider
+func oauthStart(c *gin.Context) {
+	p, ok := oauthProviders[c.Param("provider")]
+	if !ok {
+		c.String(http.StatusNotFound, tr(c, "error.oauth_unsupported"))
+		return
+	}
+	// state 防止 CSRF，放在短时 Cookie 中，回调时比对
+	state := randomToken(16)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookie, state, 600, "/auth/", "", secureCookie(c), true)
+	c.Redirect(http.StatusFound, p.authURL(p, redirectURI(p), state))
+}
+
+// oauthCallback 第三方回调：GET /auth/:provider/callback
+// 已绑定 → 直接登录；已登录但未绑定 → 绑定到当前账号；都不是 → 自动注册新用户
+func oauthCallback(c *gin.Context) {
+	p, ok := oauthProviders[c.Param("provider")]
+	if !ok {
+		c.String(http.StatusNotFound, tr(c, "error.oauth_unsupported"))
+		return
+	}
+	state, err := c.Cookie(oauthStateCookie)
+	c.SetCookie(oauthStateCookie, "", -1, "/auth/", "", secureCookie(c), true)
+	if err != nil || state == "" || state != c.Query("state") {
+		c.String(http.StatusBadRequest, tr(c, "error.oauth_state"))
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		// 用户在授权页点了取消
+		c.Redirect(http.StatusFound, "/login")
+		return
+	}
+
+	profile, err := p.fetchProfile(c.Request.Context(), p, redirectURI(p), code)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "第三方登录失败", "provider", p.Name, "err", err)
+		c.String(http.StatusBadGateway, tr(c, "error.oauth_failed", p.Title))
+		return
+	}
+
+	current := currentUser(c)
+	var ident UserIdentity
+	found := dbFor(c).Where("provider = ? AND external_id = ?", p.Name, profile.ID).First(&ident).Error == nil
+
+	switch {
+	case found && current != nil && ident.UserID != current.ID:
+		c.String(http.StatusConflict, tr(c, "error.oauth_taken", p.Title))
+		return
+
+	case found:
+		var user User
+		if err := dbFor(c).First(&user, ident.UserID).Error; err != nil {
+			c.String(http.StatusNotFound, tr(c, "error.oauth_user_missing"))
+			return
+		}
+		startSession(c, &user)
+
+	case current != nil:
+		// 账号绑定
+		dbFor(c).Create(&UserIdentity{UserID: current.ID, Provider: p.Name, ExternalID: profile.ID, Name: profile.Name})
+
+	default:
+		// 首次登录，自动创建用户（没有密码，只能通过第三方登录）
+		user := User{Username: uniqueUsername(profile.Name, p.Name), Role: RoleUser}
+		if err := dbFor(c).Create(&user).Error; err != nil {
+			c.String(http.StatusInternalServerError, tr(c, "error.user_create_failed"))
+			return
+		}
+		dbFor(c).Create(&UserIdentity{UserID: user.ID, Provider: p.Name, ExternalID: profile.ID, Name: profile.Name})
+		startSession(c, &user)
+	}
+
+	c.Redirect(http.StatusFound, "/account")
+}
+
+// uniqueUsername 根据第三方昵称生成一个未被占用的用户名
+func uniqueUsername(name, provider string) string {
+	base := sanitizeText(name)
+	if base == "" {
+		base = provider + "_user"
+	}
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		db.Model(&User{}).Where("username = ?", candidate).Count(&count)
+		if count == 0 {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s_%d", base, i)
+	}
+}
+
+// ---------- 账号页（查看和绑定第三方账号） ----------
+
+func showAccount(c *gin.Context) {
+	user := currentUser(c)
+	if user == nil {
+		c.Redirect(http.StatusFound, "/login?next=/account")
+		return
+	}
+	var idents []UserIdentity
+	dbFor(c).Where("user_id = ?", user.ID).Find(&idents)
+	linked := map[string]bool{}
+	for _, id := range idents {
+		linked[id.Provider] = true
+	}
+	render(c, http.StatusOK, "account.html", gin.H{
+		"title":      tr(c, "nav.account"),
+		"identities": idents,
+		"linked":     linked,
+		"providers":  providerList(),
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 分享卡片 ====================
+
+// 详情页的 Open Graph 和 Twitter Card 标签：链接分享到微信、Slack、Telegram 等时显示标题、摘要和图片，
+// 而不是光秃秃的网址。内容在处理函数里算好，以 meta 传给模板（见 layout.html 的 header）。
+
+const metaDescriptionLen = 120 // 摘要最多的字数
+
+// pageMeta 页面的分享信息，地址都是带域名的完整地址
+type pageMeta struct {
+	Title       string
+	Description string
+	URL         string
+	Image       string // 没有图片时为空，卡片用不带大图的样式
+	Type        string // og:type，景点是 article
+}
+
+// TwitterCard 有图片时用大图卡片
+func (m pageMeta) TwitterCard() string {
+	if m.Image != "" {
+		return "summary_large_image"
+	}
+	return "summary"
+}
+
+// spotMeta 景点详情页的分享信息：图片用封面，没有封面时用图集的第一张
+func spotMeta(c *gin.Context, spot *Spot, images []SpotImage) pageMeta {
+	m := pageMeta{
+		Title:       spot.Name,
+		Description: truncateRunes(markdownText(spot.Description), metaDescriptionLen),
+		URL:         absoluteURL(c, "/spot/"+url.PathEscape(spot.Slug)),
+		Type:        "article",
+	}
+	image := spot.ImageURL
+	if image == "" && len(images) > 0 {
+		image = images[0].URL
+	}
+	switch {
+	case strings.HasPrefix(image, "/"):
+		// 上传的图片是站内地址
+		m.Image = absoluteURL(c, image)
+	case strings.HasPrefix(image, "http://"), strings.HasPrefix(image, "https://"):
+		m.Image = image
+	}
+	return m
+}
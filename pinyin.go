@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// ==================== 拼音搜索 ====================
+
+// 景点保存时把名称转成拼音存在 pinyin_name（全拼和首字母，如 "xihu xh"），
+// 描述转成全拼存在 pinyin_description。搜索词全是英文字母时（如 xihu、xi hu、xh）
+// 同时在这两列里查，这样不用输入中文也能找到景点。
+//
+// 汉字到拼音的对照表在 pinyin_table.go，不带声调，ü 写作 v。多音字只取一个读音
+// （GB2312 一级字库里排的那个），比如“重庆”会转成 zhongqing，以后要支持多音字得换成按词转换。
+
+// pinyinOf 每个汉字的拼音，由 pinyinSyllables 生成
+var pinyinOf = func() map[rune]string {
+	m := make(map[rune]string, 20000)
+	for syllable, chars := range pinyinSyllables {
+		for _, r := range chars {
+			m[r] = syllable
+		}
+	}
+	return m
+}()
+
+// toPinyin 把文本转成全拼和首字母：汉字换成拼音，英文字母和数字转成小写保留，其他字符去掉。
+// 空白和标点把文本分成几段，各段之间用空格隔开
+func toPinyin(s string) (full, initials string) {
+	var f, i strings.Builder
+	sep := false
+	for _, r := range s {
+		var part string
+		if py, ok := pinyinOf[r]; ok {
+			part = py
+		} else if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			part = string(unicode.ToLower(r))
+		} else {
+			sep = f.Len() > 0
+			continue
+		}
+		if sep {
+			f.WriteByte(' ')
+			i.WriteByte(' ')
+			sep = false
+		}
+		f.WriteString(part)
+		i.WriteByte(part[0])
+	}
+	return f.String(), i.String()
+}
+
+// spotPinyin 景点名称和描述的拼音，存到 pinyin_name 和 pinyin_description
+func spotPinyin(name, description string) (pinyinName, pinyinDescription string) {
+	full, initials := toPinyin(name)
+	if full != "" {
+		pinyinName = full + " " + initials
+	}
+	pinyinDescription, _ = toPinyin(description)
+	return pinyinName, pinyinDescription
+}
+
+// pinyinQuery 搜索词是否可以当作拼音查询，是的话返回去掉空格、转成小写的拼音
+func pinyinQuery(q string) (string, bool) {
+	var b strings.Builder
+	for _, r := range q {
+		switch {
+		case r >= 'a' && r <= 'z':
+			b.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			b.WriteRune(unicode.ToLower(r))
+		case r == ' ':
+		default:
+			return "", false
+		}
+	}
+	// 单个字母几乎能匹配所有景点
+	if b.Len() < 2 {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// updateSpotPinyin 根据数据库里的名称和描述重新生成景点的拼音
+func updateSpotPinyin(tx *gorm.DB, spotID uint) error {
+	var spot Spot
+	if err := tx.Unscoped().Select("id", "name", "description").First(&spot, spotID).Error; err != nil {
+		return err
+	}
+	name, description := spotPinyin(spot.Name, spot.Description)
+	return tx.Unscoped().Model(&Spot{}).Where("id = ?", spotID).
+		UpdateColumns(map[string]interface{}{"pinyin_name": name, "pinyin_description": description}).Error
+}
+
+// AfterSave 新建或修改景点后更新拼音，并通知搜索后端（见 search.go）。
+// 修改可能只带了部分字段，所以从数据库里重新读名称和描述
+func (s *Spot) AfterSave(tx *gorm.DB) error {
+	if s.ID == 0 {
+		return nil
+	}
+	if err := updateSpotPinyin(tx.Session(&gorm.Session{NewDB: true}), s.ID); err != nil {
+		return err
+	}
+	syncSearch(s.ID)
+	return nil
+}
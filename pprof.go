@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 性能分析（pprof） ====================
+
+// 列表接口变慢等问题在线上才出现时，管理员可以直接从运行中的服务抓 CPU、内存、goroutine 等 profile：
+//
+//	/debug/pprof/                    所有 profile 的列表
+//	/debug/pprof/profile?seconds=30  CPU profile，采样 30 秒后返回
+//	/debug/pprof/heap                内存分配（加 gc=1 先做一次 GC）
+//	/debug/pprof/goroutine?debug=2   所有 goroutine 的调用栈
+//	/debug/pprof/trace?seconds=5     执行追踪，用 go tool trace 查看
+//
+// 只有管理员能访问（和 /admin 一样用登录会话），下载后用 go tool pprof 分析。
+// 导入 net/http/pprof 会在 http.DefaultServeMux 上注册同样的地址，但两个服务都不用 DefaultServeMux，不会被公开访问。
+
+// registerPprof 在 /debug/pprof 下注册 pprof 的处理函数
+func registerPprof(r *gin.Engine) {
+	g := r.Group("/debug/pprof", adminRequired())
+	g.GET("/", gin.WrapF(pprof.Index))
+	g.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	g.GET("/profile", gin.WrapF(pprof.Profile))
+	g.GET("/symbol", gin.WrapF(pprof.Symbol))
+	g.GET("/trace", gin.WrapF(pprof.Trace))
+	for _, name := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+		g.GET("/"+name, gin.WrapH(pprof.Handler(name)))
+	}
+}
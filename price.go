@@ -0,0 +1,178 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==================== 票价 ====================
+
+// 票价分成结构化的成人价、儿童价和“免费”标记，原来的 Ticket 文本保留作票价说明
+// （如“旺季230元，淡季150元，1.2米以下儿童免费”）。
+
+const maxPrice = 100000 // 价格上限（元）
+
+var (
+	// pricePattern 带单位的价格：¥60、￥60、60元、60.5 元
+	pricePattern = regexp.MustCompile(`[¥￥]\s*(\d+(?:\.\d+)?)|(\d+(?:\.\d+)?)\s*元`)
+	// barePricePattern 整段只有一个数字，如 399
+	barePricePattern = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+	// childPattern 说明这一段是儿童/优惠票价
+	childPattern = regexp.MustCompile(`儿童|小孩|学生|半价|半票|优惠|老人|child`)
+)
+
+// parsedPrice 从票价说明中解析出的价格
+type parsedPrice struct {
+	Adult  *float64
+	Child  *float64
+	IsFree bool
+}
+
+// parseTicketPrice 尽量从票价说明中解析出价格，解析不出的部分留空
+// 按标点分成几段：提到儿童、学生等的段落是儿童价，其余第一个价格是成人价；
+// 没有成人价但提到“免费”时算作免费景点
+func parseTicketPrice(text string) parsedPrice {
+	var p parsedPrice
+	free := false
+	segments := strings.FieldsFunc(text, func(r rune) bool {
+		return strings.ContainsRune(",，;；/、|()（）\n", r)
+	})
+	for _, seg := range segments {
+		seg = strings.TrimSpace(seg)
+		price, ok := findPrice(seg)
+		if childPattern.MatchString(seg) {
+			if p.Child == nil {
+				switch {
+				case ok:
+					p.Child = &price
+				case strings.Contains(seg, "免费"):
+					zero := 0.0
+					p.Child = &zero
+				case p.Adult != nil && (strings.Contains(seg, "半价") || strings.Contains(seg, "半票")):
+					half := *p.Adult / 2
+					p.Child = &half
+				}
+			}
+			continue
+		}
+		if ok && p.Adult == nil {
+			p.Adult = &price
+		}
+		if strings.Contains(seg, "免费") {
+			free = true
+		}
+	}
+	if p.Adult == nil && free {
+		p.IsFree = true
+	}
+	return p
+}
+
+// findPrice 取一段文字中的第一个价格
+func findPrice(seg string) (float64, bool) {
+	raw := ""
+	if m := pricePattern.FindStringSubmatch(seg); m != nil {
+		raw = m[1] + m[2]
+	} else if barePricePattern.MatchString(seg) {
+		raw = seg
+	}
+	if raw == "" {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v > maxPrice {
+		return 0, false
+	}
+	return v, true
+}
+
+// formatPrice 60 → ¥60，60.5 → ¥60.50
+func formatPrice(v float64) string {
+	if v == float64(int64(v)) {
+		return "¥" + strconv.FormatInt(int64(v), 10)
+	}
+	return "¥" + strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// PriceText 显示用的价格，如“成人 ¥80 / 儿童 ¥40”，没有结构化价格时返回空字符串
+func (s Spot) PriceText() string {
+	if s.IsFree {
+		return "免费"
+	}
+	var parts []string
+	if s.AdultPrice != nil {
+		parts = append(parts, "成人 "+formatPrice(*s.AdultPrice))
+	}
+	if s.ChildPrice != nil {
+		if *s.ChildPrice == 0 {
+			parts = append(parts, "儿童免费")
+		} else {
+			parts = append(parts, "儿童 "+formatPrice(*s.ChildPrice))
+		}
+	}
+	return strings.Join(parts, " / ")
+}
+
+// ---------- 按价格筛选和排序 ----------
+
+// priceExpr 筛选和排序用的价格：免费景点算 0，否则是成人票价（没有填写时为 NULL）
+const priceExpr = "(CASE WHEN is_free THEN 0 ELSE adult_price END)"
+
+// filterByPrice 按查询参数 min_price / max_price 筛选价格，free=1 时只看免费景点
+// 不是数字的参数忽略；指定了价格范围时，没有填写价格的景点不会出现
+func filterByPrice(c *gin.Context, q *gorm.DB) *gorm.DB {
+	if v, ok := priceParam(c, "min_price"); ok {
+		q = q.Where(priceExpr+" >= ?", v)
+	}
+	if v, ok := priceParam(c, "max_price"); ok {
+		q = q.Where(priceExpr+" <= ?", v)
+	}
+	if c.Query("free") == "1" {
+		q = q.Where(priceExpr + " = 0")
+	}
+	return q
+}
+
+func priceParam(c *gin.Context, name string) (float64, bool) {
+	v, err := strconv.ParseFloat(c.Query(name), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// spotOrder 列表的排序：sort=price_asc / price_desc 按价格（没有价格的排在最后），
+// 其他取值见 ranking.go 里的排序策略和别名；没有指定或不认识时使用首页默认排序
+func spotOrder(c *gin.Context) clause.OrderBy {
+	sort := sortParam(c)
+	switch sort {
+	case "price_asc":
+		return clause.OrderBy{Expression: clause.Expr{SQL: priceExpr + " IS NULL, " + priceExpr + " ASC, id ASC"}}
+	case "price_desc":
+		return clause.OrderBy{Expression: clause.Expr{SQL: priceExpr + " IS NULL, " + priceExpr + " DESC, id ASC"}}
+	}
+	return clause.OrderBy{Expression: rankingFor(sort).Order()}
+}
+
+// sortParam 查询参数 sort，别名换成排序策略的名称
+func sortParam(c *gin.Context) string {
+	sort := c.Query("sort")
+	if name, ok := sortAliases[sort]; ok {
+		return name
+	}
+	return sort
+}
+
+// rankingFor 名称对应的排序策略，不认识时使用首页默认排序
+func rankingFor(name string) rankingStrategy {
+	if r, ok := rankings[name]; ok {
+		return r
+	}
+	return rankings[defaultSort()]
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 二维码 ====================
+
+// GET /spot/:slug/qr.png 详情页地址的二维码，打印在景区的指示牌、宣传单上，扫码直接打开详情页。
+// 二维码里是按ID的地址（/spot/<ID>，会跳转到详情页），比带中文 slug 的地址短得多，景点改名后也不会失效。
+//
+// 没有引入第三方库，下面按 QR Code 标准（ISO/IEC 18004）实现了编码：字节模式、纠错等级 M、版本 1~20
+// （最多 666 字节，网址足够用了），自动选择最小的版本和扣分最少的掩码。
+
+const (
+	qrDefaultSize = 256  // 默认图片边长（像素）
+	qrMaxSize     = 1024 // size 参数的上限
+	qrQuietZone   = 4    // 四周空白的模块数（标准要求至少 4）
+)
+
+// qrVersions 纠错等级 M 下每个版本的分块：每块纠错码字数，第一组块数和每块数据码字数，第二组块数和每块数据码字数
+var qrVersions = [...]struct{ ecLen, blocks1, data1, blocks2, data2 int }{
+	1: {10, 1, 16, 0, 0}, 2: {16, 1, 28, 0, 0}, 3: {26, 1, 44, 0, 0}, 4: {18, 2, 32, 0, 0},
+	5: {24, 2, 43, 0, 0}, 6: {16, 4, 27, 0, 0}, 7: {18, 4, 31, 0, 0}, 8: {22, 2, 38, 2, 39},
+	9: {22, 3, 36, 2, 37}, 10: {26, 4, 43, 1, 44}, 11: {30, 1, 50, 4, 51}, 12: {22, 6, 36, 2, 37},
+	13: {22, 8, 37, 1, 38}, 14: {24, 4, 40, 5, 41}, 15: {24, 5, 41, 5, 42}, 16: {28, 7, 45, 3, 46},
+	17: {28, 10, 46, 1, 47}, 18: {26, 9, 43, 4, 44}, 19: {26, 3, 44, 11, 45}, 20: {26, 3, 41, 13, 42},
+}
+
+// qrAlignment 每个版本的校正图形中心坐标
+var qrAlignment = [...][]int{
+	2: {6, 18}, 3: {6, 22}, 4: {6, 26}, 5: {6, 30}, 6: {6, 34},
+	7: {6, 22, 38}, 8: {6, 24, 42}, 9: {6, 26, 46}, 10: {6, 28, 50}, 11: {6, 30, 54},
+	12: {6, 32, 58}, 13: {6, 34, 62}, 14: {6, 26, 46, 66}, 15: {6, 26, 48, 70},
+	16: {6, 26, 50, 74}, 17: {6, 30, 54, 78}, 18: {6, 30, 56, 82}, 19: {6, 30, 58, 86},
+	20: {6, 34, 62, 90},
+}
+
+var errQRTooLong = errors.New("内容太长，无法生成二维码")
+
+// qrCode 生成好的二维码，modules[y][x] 为 true 表示深色
+type qrCode struct {
+	size     int
+	modules  [][]bool
+	function [][]bool // 定位、校正、格式信息等固定图形，不放数据也不加掩码
+}
+
+// encodeQR 把 data 编码成二维码
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 0
+	for v := 1; v < len(qrVersions); v++ {
+		countBits := 8
+		if v >= 10 {
+			countBits = 16
+		}
+		info := qrVersions[v]
+		capacity := info.blocks1*info.data1 + info.blocks2*info.data2
+		if 4+countBits+len(data)*8 <= capacity*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, errQRTooLong
+	}
+
+	q := &qrCode{size: version*4 + 17}
+	q.modules = make([][]bool, q.size)
+	q.function = make([][]bool, q.size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, q.size)
+		q.function[i] = make([]bool, q.size)
+	}
+	q.drawFunctionPatterns(version)
+	q.drawCodewords(qrCodewords(version, data))
+
+	// 选扣分最少的掩码
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if p := q.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		q.applyMask(mask) // 再异或一次就还原了
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+	return q, nil
+}
+
+// qrCodewords 数据加上模式、长度和填充，分块计算纠错码后交错排列
+func qrCodewords(version int, data []byte) []byte {
+	info := qrVersions[version]
+	capacity := info.blocks1*info.data1 + info.blocks2*info.data2
+
+	var bits []bool
+	appendBits := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 == 1)
+		}
+	}
+	appendBits(0x4, 4) // 字节模式
+	if version >= 10 {
+		appendBits(len(data), 16)
+	} else {
+		appendBits(len(data), 8)
+	}
+	for _, b := range data {
+		appendBits(int(b), 8)
+	}
+	// 结束符最多 4 个 0，然后补齐到整字节，再用 0xEC 0x11 交替填满
+	for i := 0; i < 4 && len(bits) < capacity*8; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+	codewords := make([]byte, 0, capacity)
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 1 << (7 - j)
+			}
+		}
+		codewords = append(codewords, b)
+	}
+	for pad := byte(0xEC); len(codewords) < capacity; pad ^= 0xEC ^ 0x11 {
+		codewords = append(codewords, pad)
+	}
+
+	// 分块，每块算纠错码
+	divisor := rsDivisor(info.ecLen)
+	var blocks, ecBlocks [][]byte
+	for i, n := 0, 0; i < info.blocks1+info.blocks2; i++ {
+		size := info.data1
+		if i >= info.blocks1 {
+			size = info.data2
+		}
+		block := codewords[n : n+size]
+		n += size
+		blocks = append(blocks, block)
+		ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+	}
+
+	// 按列交错：先是每块的第 1 个数据码字，再是第 2 个……最后是纠错码字
+	result := make([]byte, 0, capacity+info.ecLen*len(blocks))
+	for i := 0; i < info.data2 || i < info.data1; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecLen; i++ {
+		for _, ec := range ecBlocks {
+			result = append(result, ec[i])
+		}
+	}
+	return result
+}
+
+// ---------- Reed-Solomon ----------
+
+// gfMultiply GF(2^8) 上的乘法，本原多项式 x^8+x^4+x^3+x^2+1
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor 生成多项式 (x-α^0)(x-α^1)...(x-α^(degree-1)) 的系数，不含最高次项
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// rsRemainder 数据多项式除以生成多项式的余数，就是纠错码
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// ---------- 图形 ----------
+
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// drawFunctionPatterns 画定位图形、时序图形、校正图形和版本信息，给格式信息留出位置
+func (q *qrCode) drawFunctionPatterns(version int) {
+	for i := 0; i < q.size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	// 三个角上的定位图形（连同一圈白边）
+	for _, c := range [][2]int{{3, 3}, {q.size - 4, 3}, {3, q.size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x < 0 || x >= q.size || y < 0 || y >= q.size {
+					continue
+				}
+				d := maxInt(absInt(dx), absInt(dy))
+				q.set(x, y, d != 2 && d != 4)
+			}
+		}
+	}
+	// 校正图形，和定位图形重叠的三个位置不画
+	pos := qrAlignment[version]
+	for i, cx := range pos {
+		for j, cy := range pos {
+			last := len(pos) - 1
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(cx+dx, cy+dy, maxInt(absInt(dx), absInt(dy)) != 1)
+				}
+			}
+		}
+	}
+	q.drawFormatBits(0) // 先占位，选好掩码后再写真正的值
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := bits>>i&1 == 1
+			a, b := q.size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+}
+
+// drawFormatBits 写入格式信息（纠错等级 M 和掩码编号），左上角一份，右上和左下拼成另一份
+func (q *qrCode) drawFormatBits(mask int) {
+	data := 0<<3 | mask // 纠错等级 M 的编号是 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true) // 固定的深色模块
+}
+
+// drawCodewords 从右下角开始，两列一组上下蛇形放置数据，跳过固定图形
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // 跳过竖的时序图形
+		}
+		for vert := 0; vert < q.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert // 向上
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask 数据部分按掩码取反
+func (q *qrCode) applyMask(mask int) {
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty 按标准的四条规则给当前图形扣分，分数越低越容易识别
+func (q *qrCode) penalty() int {
+	n := q.size
+	at := func(x, y int, horizontal bool) bool {
+		if horizontal {
+			return q.modules[y][x]
+		}
+		return q.modules[x][y]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	result := 0
+	for _, horizontal := range []bool{true, false} {
+		for y := 0; y < n; y++ {
+			// 规则 1：同色连续 5 个以上
+			run := 1
+			for x := 1; x <= n; x++ {
+				if x < n && at(x, y, horizontal) == at(x-1, y, horizontal) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += run - 2
+				}
+				run = 1
+			}
+			// 规则 3：类似定位图形的 1:1:3:1:1，一侧有 4 个浅色
+			for x := 0; x+7 <= n; x++ {
+				match := true
+				for k, dark := range finder {
+					if at(x+k, y, horizontal) != dark {
+						match = false
+						break
+					}
+				}
+				if !match {
+					continue
+				}
+				lightBefore, lightAfter := x >= 4, x+11 <= n
+				for k := 1; k <= 4; k++ {
+					if lightBefore && at(x-k, y, horizontal) {
+						lightBefore = false
+					}
+					if lightAfter && at(x+6+k, y, horizontal) {
+						lightAfter = false
+					}
+				}
+				if lightBefore || lightAfter {
+					result += 40
+				}
+			}
+		}
+	}
+	// 规则 2：2×2 同色块
+	dark := 0
+	for y := 0; y < n; y++ {
+		for x := 0; x < n; x++ {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < n && y+1 < n {
+				c := q.modules[y][x]
+				if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+					result += 3
+				}
+			}
+		}
+	}
+	// 规则 4：深色比例偏离 50%，每 5% 扣 10 分
+	total := n * n
+	k := (absInt(dark*20-total*10) + total - 1) / total
+	result += maxInt(k-1, 0) * 10
+	return result
+}
+
+// image 画成图片，每个模块 scale 像素，四周留白
+func (q *qrCode) image(scale int) image.Image {
+	side := (q.size + qrQuietZone*2) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < q.size; y++ {
+		for x := 0; x < q.size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+qrQuietZone)*scale+dx, (y+qrQuietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return img
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// ---------- 页面 ----------
+
+// showSpotQR 景点二维码：GET /spot/:slug/qr.png?size=256，slug 也可以是景点ID
+// size 是图片的大致边长（像素），实际边长是模块数的整数倍
+func showSpotQR(c *gin.Context) {
+	spot, err := findSpot(c, c.Param("slug"))
+	if err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.spot_slug_not_found", c.Param("slug")))
+		return
+	}
+	size := qrDefaultSize
+	if v := c.Query("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > qrMaxSize {
+			c.String(http.StatusBadRequest, tr(c, "error.qr_size", qrMaxSize))
+			return
+		}
+		size = n
+	}
+
+	code, err := encodeQR([]byte(absoluteURL(c, "/spot/"+strconv.FormatUint(uint64(spot.ID), 10))))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	scale := size / (code.size + qrQuietZone*2)
+	if scale < 1 {
+		scale = 1
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code.image(scale)); err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.qr_failed"))
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/png", buf.Bytes())
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==================== 排序策略 ====================
+
+// 列表的排序（sort 参数）由一组排序策略实现，每种策略给出 ORDER BY 表达式。
+// 没有 sort 参数时使用首页默认排序：管理员在 /admin/ranking 设置过就用设置的，
+// 否则用配置的 ranking.default_sort。设置存在 settings 表里，启动时读入内存。
+// 按价格排序是筛选条件的一部分，不算排序策略，见 price.go。
+
+// rankingStrategy 一种排序方式
+type rankingStrategy interface {
+	Label() string      // 排序下拉框里显示的名称，是 locales/ 里的键
+	Order() clause.Expr // ORDER BY 后面的表达式
+}
+
+// keysetRanking 按几个列排序的策略，可以用游标分页（见 cursor.go）
+type keysetRanking interface {
+	rankingStrategy
+	Keys() []sortKey
+}
+
+// sqlRanking 按固定的几列排序
+type sqlRanking struct {
+	label string
+	keys  []sortKey
+}
+
+func (r sqlRanking) Label() string      { return r.label }
+func (r sqlRanking) Order() clause.Expr { return clause.Expr{SQL: keysSQL(r.keys)} }
+func (r sqlRanking) Keys() []sortKey    { return r.keys }
+
+// seasonRanking 当季景点加权，见 season.go
+type seasonRanking struct{}
+
+func (seasonRanking) Label() string      { return "sort.season" }
+func (seasonRanking) Order() clause.Expr { return clause.Expr{SQL: seasonOrder()} }
+
+// recentRanking 按最近的推荐排序：最近一个 trending.half_life 内的推荐记 8 分，
+// 再往前每过一个 half_life 分数减半，4 个 half_life 之前的推荐不计分；分数相同时按推荐总数。
+// 和 /trending 的衰减方式一样，只是分成几档，这样可以在数据库里直接排序和分页。
+type recentRanking struct{}
+
+func (recentRanking) Label() string { return "sort.recent" }
+
+func (recentRanking) Order() clause.Expr {
+	now := time.Now()
+	step := cfg.Trending.HalfLife
+	return clause.Expr{
+		SQL: `(SELECT COALESCE(SUM(CASE WHEN r.created_at > ? THEN 8 WHEN r.created_at > ? THEN 4 WHEN r.created_at > ? THEN 2 ELSE 1 END), 0)
+			FROM recommendations r WHERE r.spot_id = spots.id AND r.created_at > ?) DESC, recommend_count DESC, id ASC`,
+		Vars: []interface{}{now.Add(-step), now.Add(-2 * step), now.Add(-3 * step), now.Add(-4 * step)},
+	}
+}
+
+// rankings 所有排序策略，rankingNames 是它们在下拉框里的顺序
+var (
+	rankings = map[string]rankingStrategy{
+		"recommend": sqlRanking{"sort.recommend", []sortKey{{"recommend_count", true}, {"id", false}}},
+		"wilson":    sqlRanking{"sort.wilson", []sortKey{{"rating_score", true}, {"recommend_count", true}, {"id", false}}},
+		"recent":    recentRanking{},
+		"season":    seasonRanking{},
+		"rating":    sqlRanking{"sort.rating", []sortKey{{"rating_avg", true}, {"rating_count", true}, {"id", false}}},
+		"views":     sqlRanking{"sort.views", []sortKey{{"view_count", true}, {"id", false}}},
+		"newest":    sqlRanking{"sort.newest", []sortKey{{"id", true}}}, // ID 自增，和添加时间的顺序一致
+		"alpha":     sqlRanking{"sort.alpha", []sortKey{{"name", false}, {"id", false}}},
+	}
+	rankingNames = []string{"recommend", "wilson", "recent", "season", "rating", "views", "newest", "alpha"}
+
+	// sortAliases sort 参数的别名，和其他接口的命名保持一致
+	sortAliases = map[string]string{
+		"recommend_desc": "recommend",
+		"rating_desc":    "rating",
+		"name":           "alpha",
+	}
+)
+
+// keysetRankingNames 可以用游标分页的排序策略
+func keysetRankingNames() []string {
+	var names []string
+	for _, name := range rankingNames {
+		if _, ok := rankings[name].(keysetRanking); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// rankingOption 排序下拉框的一项
+type rankingOption struct {
+	Name  string
+	Label string
+}
+
+// rankingOptions 所有排序策略，模板里用 {{range rankingOptions}} 生成下拉框
+func rankingOptions() []rankingOption {
+	opts := make([]rankingOption, len(rankingNames))
+	for i, name := range rankingNames {
+		opts[i] = rankingOption{Name: name, Label: rankings[name].Label()}
+	}
+	return opts
+}
+
+// wilsonScore 评分的 Wilson 置信下限（95%）：把 1~5 星换算成 0~1 的好评率，
+// 评分人数少时分数会往下压，避免一两个五星就排到最前面。没有评分时为 0。
+func wilsonScore(avg float64, count int) float64 {
+	if count <= 0 {
+		return 0
+	}
+	const z = 1.96
+	n := float64(count)
+	p := (avg - 1) / 4
+	score := (p + z*z/(2*n) - z*math.Sqrt(p*(1-p)/n+z*z/(4*n*n))) / (1 + z*z/n)
+	return math.Max(0, math.Round(score*10000)/10000)
+}
+
+// Setting 管理员在页面上修改的设置，覆盖配置文件里的对应项
+type Setting struct {
+	Name      string `gorm:"primaryKey;size:50"`
+	Value     string
+	UpdatedAt time.Time
+}
+
+const rankingSettingKey = "ranking.default_sort"
+
+// homeSort 管理员设置的首页默认排序，为空时用配置的 ranking.default_sort
+var homeSort struct {
+	mu    sync.RWMutex
+	value string
+}
+
+// loadRankingSetting 启动时读入管理员设置的默认排序，设置里的策略已经不存在时忽略
+func loadRankingSetting() {
+	var s Setting
+	if err := db.Where("name = ?", rankingSettingKey).Limit(1).Find(&s).Error; err != nil {
+		slog.Error("读取排序设置失败", "err", err)
+		return
+	}
+	if _, ok := rankings[s.Value]; ok {
+		homeSort.mu.Lock()
+		homeSort.value = s.Value
+		homeSort.mu.Unlock()
+	}
+}
+
+// defaultSort 没有 sort 参数时使用的排序
+func defaultSort() string {
+	homeSort.mu.RLock()
+	defer homeSort.mu.RUnlock()
+	if homeSort.value != "" {
+		return homeSort.value
+	}
+	return cfg.Ranking.DefaultSort
+}
+
+// saveSetting 保存一项设置，已有时覆盖
+func saveSetting(name, value string) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(&Setting{Name: name, Value: value}).Error
+}
+
+// saveRankingSetting 保存管理员设置的默认排序，name 为空时删除设置，恢复使用配置文件
+func saveRankingSetting(name string) error {
+	var err error
+	if name == "" {
+		err = db.Where("name = ?", rankingSettingKey).Delete(&Setting{}).Error
+	} else {
+		err = saveSetting(rankingSettingKey, name)
+	}
+	if err != nil {
+		return err
+	}
+	homeSort.mu.Lock()
+	homeSort.value = name
+	homeSort.mu.Unlock()
+	return nil
+}
+
+// showRankingSetting 首页默认排序的设置页面：GET /admin/ranking
+func showRankingSetting(c *gin.Context) {
+	homeSort.mu.RLock()
+	current := homeSort.value
+	homeSort.mu.RUnlock()
+	render(c, http.StatusOK, "ranking.html", gin.H{
+		"title":      tr(c, "nav.admin.ranking"),
+		"options":    rankingOptions(),
+		"current":    current,
+		"configured": cfg.Ranking.DefaultSort,
+	})
+}
+
+// updateRankingSetting 修改首页默认排序：POST /admin/ranking，表单字段 sort，为空时恢复使用配置文件
+func updateRankingSetting(c *gin.Context) {
+	name := strings.TrimSpace(c.PostForm("sort"))
+	if _, ok := rankings[name]; name != "" && !ok {
+		c.String(http.StatusBadRequest, tr(c, "error.sort_unsupported", name))
+		return
+	}
+	if err := saveRankingSetting(name); err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin/ranking")
+}
+
+// updateRatingScore 按平均分和人数重新计算景点的 Wilson 分数
+func updateRatingScore(tx *gorm.DB, spotID uint) error {
+	var spot Spot
+	if err := tx.Select("id", "rating_avg", "rating_count").First(&spot, spotID).Error; err != nil {
+		return err
+	}
+	return tx.Model(&Spot{}).Where("id = ?", spotID).
+		UpdateColumn("rating_score", wilsonScore(spot.RatingAvg, spot.RatingCount)).Error
+}
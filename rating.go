@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 评分 ====================
+
+// 访客可以给景点打 1~5 星，每个访客对每个景点只保留一个评分，再次评分时覆盖。
+// 平均分和评分人数存在 spots.rating_avg / rating_count 里，评分变化时重新统计这个景点，
+// 列表按评分排序时不需要 JOIN。访客的识别方式和推荐一样，见 visitorKeys。
+
+// Rating 评分记录
+type Rating struct {
+	ID        uint   `gorm:"primaryKey"`
+	SpotID    uint   `gorm:"index:idx_rating_spot_visitor"`
+	VisitorID string `gorm:"index:idx_rating_spot_visitor"`
+	Stars     int    // 1~5
+	IP        string // 评分时的IP，仅用于排查刷分
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// errInvalidStars 评分不在 1~5 之间
+var errInvalidStars = errors.New("invalid stars")
+
+// rateSpot 记录当前访客的评分（已经评过分时修改），返回更新后的景点（含平均分和人数）
+func rateSpot(id string, visitors []string, ip string, stars int) (Spot, error) {
+	var spot Spot
+	spotID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return spot, gorm.ErrRecordNotFound
+	}
+	if stars < 1 || stars > 5 {
+		return spot, errInvalidStars
+	}
+
+	err = retryTransaction(db, func(tx *gorm.DB) error {
+		if err := tx.Scopes(published).Select("id").First(&spot, spotID).Error; err != nil {
+			return err
+		}
+		var rating Rating
+		err := tx.Where("spot_id = ? AND visitor_id IN ?", spotID, visitors).Order("id").First(&rating).Error
+		switch {
+		case err == nil:
+			err = tx.Model(&rating).Updates(Rating{Stars: stars, IP: ip}).Error
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			err = tx.Create(&Rating{SpotID: uint(spotID), VisitorID: visitors[0], Stars: stars, IP: ip}).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := updateRatingStats(tx, uint(spotID)); err != nil {
+			return err
+		}
+		return tx.Select("id", "rating_avg", "rating_count").First(&spot, spotID).Error
+	})
+	return spot, err
+}
+
+// updateRatingStats 重新统计景点的平均分和评分人数，以及“好评优先”排序用的 Wilson 分数
+func updateRatingStats(tx *gorm.DB, spotID uint) error {
+	if err := tx.Exec(`UPDATE spots SET
+		rating_count = (SELECT COUNT(*) FROM ratings WHERE ratings.spot_id = spots.id),
+		rating_avg = COALESCE((SELECT AVG(stars) FROM ratings WHERE ratings.spot_id = spots.id), 0)
+		WHERE id = ?`, spotID).Error; err != nil {
+		return err
+	}
+	return updateRatingScore(tx, spotID)
+}
+
+// visitorRating 当前访客给景点打的分，没有评过分时为 0
+func visitorRating(c *gin.Context, spotID uint) int {
+	var rating Rating
+	if err := dbFor(c).Where("spot_id = ? AND visitor_id IN ?", spotID, visitorKeys(c)).Order("id").First(&rating).Error; err != nil {
+		return 0
+	}
+	return rating.Stars
+}
+
+// RatingText 显示用的平均分，如 4.3
+func (s Spot) RatingText() string {
+	return strconv.FormatFloat(s.RatingAvg, 'f', 1, 64)
+}
+
+// rateSpotForm 评分：POST /rate/:id，表单字段 stars，完成后回到 next 指定的页面
+func rateSpotForm(c *gin.Context) {
+	stars, _ := strconv.Atoi(c.PostForm("stars"))
+	spot, err := rateSpot(c.Param("id"), visitorKeys(c), c.ClientIP(), stars)
+	if wantsJSON(c) {
+		ratingResponse(c, spot, err)
+		return
+	}
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.String(http.StatusNotFound, tr(c, "error.spot_id_not_found", c.Param("id")))
+	case errors.Is(err, errInvalidStars):
+		c.String(http.StatusBadRequest, tr(c, "error.rating_range"))
+	case err != nil:
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+	default:
+		c.Redirect(http.StatusFound, safeNext(c.PostForm("next")))
+	}
+}
+
+// apiRateSpot 评分：POST /api/v1/spots/:id/rating，请求体 {"stars": 4}
+func apiRateSpot(c *gin.Context) {
+	var in struct {
+		Stars int `json:"stars"`
+	}
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+		return
+	}
+	spot, err := rateSpot(c.Param("id"), visitorKeys(c), c.ClientIP(), in.Stars)
+	ratingResponse(c, spot, err)
+}
+
+// ratingResponse 把 rateSpot 的结果转成 JSON 响应
+func ratingResponse(c *gin.Context, spot Spot, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+	case errors.Is(err, errInvalidStars):
+		apiError(c, http.StatusBadRequest, tr(c, "error.rating_range"))
+	case err != nil:
+		apiError(c, http.StatusInternalServerError, tr(c, "error.action_failed"))
+	default:
+		c.JSON(http.StatusOK, gin.H{"id": spot.ID, "rating_avg": spot.RatingAvg, "rating_count": spot.RatingCount})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 推荐 ====================
+
+// Recommendation 推荐记录，一次推荐一行，用来识别同一访客的重复推荐
+type Recommendation struct {
+	ID        uint      `gorm:"primaryKey"`
+	SpotID    uint      `gorm:"index:idx_rec_spot_visitor"`
+	VisitorID string    `gorm:"index:idx_rec_spot_visitor"` // 访客标识，见 visitorKeys
+	IP        string    // 推荐时的IP，仅用于排查刷票
+	CreatedAt time.Time `gorm:"index"` // 热门趋势按时间衰减计分
+}
+
+// errAlreadyRecommended 窗口期内重复推荐
+var errAlreadyRecommended = errors.New("already recommended")
+
+// errNotRecommended 撤销推荐时找不到该访客的推荐记录
+var errNotRecommended = errors.New("not recommended")
+
+const visitorCookie = "visitor_id"
+
+// ensureVisitorCookie 给匿名访客下发访客 Cookie（渲染页面时调用）
+func ensureVisitorCookie(c *gin.Context) {
+	if v, err := c.Cookie(visitorCookie); err == nil && v != "" {
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(visitorCookie, randomToken(16), 365*24*3600, "/", "", secureCookie(c), true)
+}
+
+// visitorKeys 识别当前访客，第一个用于记录，全部用于查重
+// 登录用户用用户ID；匿名访客用 Cookie；不带 Cookie 的请求（脚本等）退回到 IP。
+// 带 Cookie 的访客同时也查 IP 记录，防止先不带 Cookie 投一次再带 Cookie 投一次。
+// IP 是 c.ClientIP()，只认 server.trusted_proxies 转发的 X-Forwarded-For，客户端改这个头换不了身份
+func visitorKeys(c *gin.Context) []string {
+	if user := currentUser(c); user != nil {
+		return []string{"u:" + strconv.FormatUint(uint64(user.ID), 10)}
+	}
+	ipKey := "ip:" + c.ClientIP()
+	if v, err := c.Cookie(visitorCookie); err == nil && v != "" {
+		return []string{"c:" + v, ipKey}
+	}
+	return []string{ipKey}
+}
+
+// recommendSpot 记录一次推荐并把推荐次数+1，返回新的推荐次数
+// 同一访客在 cfg.Recommend.Window 内重复推荐返回 errAlreadyRecommended（次数不变）
+// 计数用 UPDATE ... SET recommend_count = recommend_count + 1 在数据库里直接加，
+// 不再先查再存，并发点击也不会丢票
+func recommendSpot(id string, visitors []string, ip string) (int, error) {
+	spotID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	var spot Spot
+	err = retryTransaction(db, func(tx *gorm.DB) error {
+		if err := tx.Scopes(published).Select("id", "recommend_count").First(&spot, spotID).Error; err != nil {
+			return err
+		}
+
+		var recent int64
+		q := tx.Model(&Recommendation{}).Where("spot_id = ? AND created_at > ?", spotID, time.Now().Add(-cfg.Recommend.Window))
+		if strings.HasPrefix(visitors[0], "u:") {
+			q = q.Where("visitor_id IN ?", visitors)
+		} else {
+			// 匿名访客每次换一个新 Cookie 也是新的标识，所以同一 IP 的匿名推荐也算重复
+			q = q.Where("visitor_id IN ? OR (ip = ? AND visitor_id NOT LIKE ?)", visitors, ip, "u:%")
+		}
+		q.Count(&recent)
+		if recent > 0 {
+			return errAlreadyRecommended
+		}
+
+		if err := tx.Create(&Recommendation{SpotID: uint(spotID), VisitorID: visitors[0], IP: ip}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Spot{}).Where("id = ?", spotID).
+			UpdateColumn("recommend_count", gorm.Expr("recommend_count + ?", 1)).Error; err != nil {
+			return err
+		}
+		return tx.Select("id", "recommend_count").First(&spot, spotID).Error
+	})
+	return spot.RecommendCount, err
+}
+
+// undoRecommend 撤销该访客对景点最近的一次推荐，推荐次数-1（不会小于0），返回新的推荐次数
+func undoRecommend(id string, visitors []string) (int, error) {
+	spotID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, gorm.ErrRecordNotFound
+	}
+
+	var spot Spot
+	err = retryTransaction(db, func(tx *gorm.DB) error {
+		if err := tx.Select("id", "recommend_count").First(&spot, spotID).Error; err != nil {
+			return err
+		}
+
+		var rec Recommendation
+		if err := tx.Where("spot_id = ? AND visitor_id IN ?", spotID, visitors).
+			Order("created_at desc").First(&rec).Error; err != nil {
+			return errNotRecommended
+		}
+		if err := tx.Delete(&rec).Error; err != nil {
+			return err
+		}
+		// WHERE recommend_count > 0 保证不会减成负数
+		if err := tx.Model(&Spot{}).Where("id = ? AND recommend_count > 0", spotID).
+			UpdateColumn("recommend_count", gorm.Expr("recommend_count - ?", 1)).Error; err != nil {
+			return err
+		}
+		return tx.Select("id", "recommend_count").First(&spot, spotID).Error
+	})
+	return spot.RecommendCount, err
+}
+
+// recommendedSpotIDs 当前访客推荐过的景点，首页用来切换“推荐/取消推荐”按钮
+func recommendedSpotIDs(c *gin.Context) map[uint]bool {
+	var ids []uint
+	dbFor(c).Model(&Recommendation{}).Where("visitor_id IN ?", visitorKeys(c)).Distinct().Pluck("spot_id", &ids)
+	m := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		m[id] = true
+	}
+	return m
+}
+
+// recommendResponse 把 recommendSpot / undoRecommend 的结果转成 JSON 响应
+func recommendResponse(c *gin.Context, count int, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+	case errors.Is(err, errAlreadyRecommended):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":           "您已经推荐过这个景点了",
+			"recommend_count": count,
+		})
+	case errors.Is(err, errNotRecommended):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":           "您还没有推荐过这个景点",
+			"recommend_count": count,
+		})
+	case err != nil:
+		apiError(c, http.StatusInternalServerError, tr(c, "error.action_failed"))
+	default:
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id"), "recommend_count": count})
+	}
+}
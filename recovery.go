@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 出错处理 ====================
+
+// 出错时用户看到的都是同一个出错页面（templates/error.html），API 和 fetch 请求都是 {"error": "...", "request_id": "..."}：
+//
+//	找不到路由      r1.NoRoute(notFound)
+//	处理函数出错    处理函数照常用 c.String 返回一句错误信息，errorPages 把它换成出错页面
+//	panic           recovery 捕获后显示出错页面
+
+// recovery 代替 Gin 自带的 Recovery：处理请求时 panic 不会让整个进程退出，
+// 而是记一条带调用栈的错误日志，给用户显示友好的出错页面（API 返回 JSON），上面有请求 ID 方便反馈问题。
+// 配置了 error_report.dsn 时，panic 和返回 5xx 的请求还会上报到 Sentry（或兼容 Sentry 协议的 GlitchTip 等），
+// 上报在后台进行，不影响响应。
+
+const (
+	reportQueueSize = 100 // 等待上报的错误太多（上报服务不可用）时丢弃新的
+	maxStackFrames  = 64
+)
+
+// errorReporter 当前使用的错误上报，没配置时为 nil，由 initErrorReporter 设置
+var errorReporter *sentryReporter
+
+// recovery 捕获 panic，errorPage 是出错页面的模板名，为空时（没有加载模板的引擎）返回纯文本
+func recovery(errorPage string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			// 客户端已经断开，写不出响应，也不是程序的问题
+			if err, ok := r.(error); ok && (errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)) {
+				slog.WarnContext(c.Request.Context(), "客户端已断开连接", "path", c.Request.URL.Path, "err", err)
+				c.Abort()
+				return
+			}
+
+			frames := panicFrames()
+			slog.ErrorContext(c.Request.Context(), "处理请求时 panic",
+				"method", c.Request.Method, "path", c.Request.URL.Path, "err", r, "stack", formatFrames(frames))
+			errorReporter.report(c, fmt.Sprintf("%T", r), fmt.Sprint(r), frames)
+
+			if c.Writer.Written() {
+				// 已经开始输出，没法再换成出错页面了
+				c.Abort()
+				return
+			}
+			renderError(c, http.StatusInternalServerError, errorPage, tr(c, "error.internal"))
+		}()
+
+		c.Next()
+
+		// 没有 panic 但返回了 5xx（数据库出错等），也上报，没有调用栈
+		if status := c.Writer.Status(); status >= 500 && errorReporter != nil {
+			msg := fmt.Sprintf("%s %s 返回 %d", c.Request.Method, c.FullPath(), status)
+			if errs := strings.TrimSpace(c.Errors.ByType(gin.ErrorTypePrivate).String()); errs != "" {
+				msg += "：" + errs
+			}
+			errorReporter.report(c, "", msg, nil)
+		}
+	}
+}
+
+// errorTitles 出错页面标题的文字键（见 i18n.go），其他的用 error.title
+var errorTitles = map[int]string{
+	http.StatusBadRequest:      "error.bad_request",
+	http.StatusForbidden:       "error.forbidden",
+	http.StatusNotFound:        "error.not_found",
+	http.StatusTooManyRequests: "error.too_many_requests",
+}
+
+// notFound 没有匹配的路由
+func notFound(c *gin.Context) {
+	renderError(c, http.StatusNotFound, "error.html", tr(c, "error.not_found"))
+}
+
+// errorPages 处理函数返回 4xx / 5xx 纯文本（c.String）时，把这句话放进出错页面里显示；
+// API 和 fetch 请求换成 JSON。已经是 JSON、HTML、重定向等的响应不动
+func errorPages(errorPage string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := &errorPageWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		c.Writer = w.ResponseWriter
+		if !w.captured {
+			return
+		}
+		msg := strings.TrimSpace(w.buf.String())
+		if msg == "" {
+			msg = http.StatusText(w.Status())
+		}
+		// 换成模板的内容类型
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Length")
+		renderError(c, w.Status(), errorPage, msg)
+	}
+}
+
+// errorPageWriter 开始输出时看状态码和内容类型，是纯文本的错误信息就截下来，不发出去
+type errorPageWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	decided  bool
+	captured bool
+}
+
+func (w *errorPageWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.captured = w.Status() >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain")
+}
+
+func (w *errorPageWriter) WriteHeaderNow() {
+	w.decide()
+	if !w.captured {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *errorPageWriter) Write(p []byte) (int, error) {
+	w.decide()
+	if w.captured {
+		return w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *errorPageWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *errorPageWriter) Written() bool {
+	return w.captured || w.ResponseWriter.Written()
+}
+
+// renderError 出错页面：API 和 fetch 请求返回 JSON，页面请求渲染 errorPage 模板
+func renderError(c *gin.Context, status int, errorPage, msg string) {
+	if errorPage == "" {
+		c.String(status, tr(c, "error.with_request_id", msg, c.GetString("requestID")))
+		c.Abort()
+		return
+	}
+	if isAPIPath(c) || wantsJSON(c) {
+		apiError(c, status, msg)
+		return
+	}
+	// 不用 render：出错的原因可能就是数据库，不再查当前用户和通知
+	key, ok := errorTitles[status]
+	if !ok {
+		key = "error.title"
+	}
+	c.HTML(status, errorPage, gin.H{
+		"title":     tr(c, key),
+		"status":    status,
+		"message":   msg,
+		"requestID": c.GetString("requestID"),
+		"lang":      currentLocale(c),
+	})
+	c.Abort()
+}
+
+// panicFrames panic 发生处的调用栈，去掉 recover 和 runtime 自己的部分，最里层在前
+func panicFrames() []runtime.Frame {
+	pcs := make([]uintptr, maxStackFrames)
+	n := runtime.Callers(1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []runtime.Frame
+	inPanic := false
+	for {
+		f, more := frames.Next()
+		switch {
+		case f.Function == "runtime.gopanic":
+			inPanic = true
+		case inPanic && (len(out) > 0 || !strings.HasPrefix(f.Function, "runtime.")):
+			out = append(out, f)
+		}
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// formatFrames 调用栈写进日志的格式，和 Go 打印 panic 时的一样
+func formatFrames(frames []runtime.Frame) string {
+	var b strings.Builder
+	for _, f := range frames {
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+	}
+	return b.String()
+}
+
+// ---------- Sentry ----------
+
+// sentryReporter 按 Sentry 的 envelope 协议上报错误
+type sentryReporter struct {
+	dsn      string
+	endpoint string // <scheme>://<host>/api/<project>/envelope/
+	auth     string // X-Sentry-Auth 请求头
+	events   chan sentryEvent
+	client   *http.Client
+}
+
+// initErrorReporter 按配置创建错误上报，DSN 格式不对时返回错误
+func initErrorReporter() error {
+	dsn := cfg.ErrorReport.DSN
+	if dsn == "" {
+		return nil
+	}
+	// DSN 格式：<scheme>://<public_key>@<host>[/<path>]/<project_id>
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.User == nil || u.User.Username() == "" {
+		return fmt.Errorf("error_report.dsn 格式应为 https://<key>@<host>/<project>")
+	}
+	i := strings.LastIndex(u.Path, "/")
+	project := u.Path[i+1:]
+	if project == "" {
+		return fmt.Errorf("error_report.dsn 里缺少项目 ID")
+	}
+	r := &sentryReporter{
+		dsn:      dsn,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, u.Path[:i], project),
+		auth:     "Sentry sentry_version=7, sentry_client=tourist-spots/1.0, sentry_key=" + u.User.Username(),
+		events:   make(chan sentryEvent, reportQueueSize),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if secret, ok := u.User.Password(); ok {
+		r.auth += ", sentry_secret=" + secret
+	}
+	errorReporter = r
+	go r.run()
+	slog.Info("已启用错误上报", "endpoint", r.endpoint, "environment", cfg.ErrorReport.Environment)
+	return nil
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	Filename string `json:"filename"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Transaction string            `json:"transaction,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+	Request     gin.H             `json:"request"`
+	User        gin.H             `json:"user,omitempty"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// report 把一个错误放进上报队列；typ 为空时作为消息上报，否则作为带调用栈的异常上报
+func (r *sentryReporter) report(c *gin.Context, typ, value string, frames []runtime.Frame) {
+	if r == nil {
+		return
+	}
+	ev := sentryEvent{
+		EventID:     randomToken(16),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       "error",
+		Platform:    "go",
+		Environment: cfg.ErrorReport.Environment,
+		Transaction: c.Request.Method + " " + c.FullPath(),
+		Request: gin.H{
+			"url":          absoluteURL(c, c.Request.URL.Path),
+			"method":       c.Request.Method,
+			"query_string": redactQuery(c.Request.URL.RawQuery), // 和请求日志一样去掉令牌等参数的值
+			// 不带 Cookie 和 Authorization，免得把登录凭据发出去
+			"headers": gin.H{"User-Agent": c.Request.UserAgent(), "Referer": c.Request.Referer()},
+		},
+		Tags: map[string]string{"request_id": c.GetString("requestID")},
+	}
+	ev.ServerName, _ = os.Hostname()
+	if s := spanFrom(c.Request.Context()); s != nil {
+		ev.Tags["trace_id"] = s.traceIDString()
+	}
+	ev.User = gin.H{"ip_address": c.ClientIP()}
+	if u := currentUser(c); u != nil {
+		ev.User["id"] = u.ID
+		ev.User["username"] = u.Username
+	}
+	if typ == "" {
+		ev.Message = value
+	} else {
+		ex := sentryException{Type: typ, Value: value, Stacktrace: &sentryStacktrace{}}
+		// Sentry 要求最外层在前
+		for i := len(frames) - 1; i >= 0; i-- {
+			f := frames[i]
+			module, function := splitFunction(f.Function)
+			ex.Stacktrace.Frames = append(ex.Stacktrace.Frames, sentryFrame{
+				Function: function,
+				Module:   module,
+				Filename: f.File[strings.LastIndex(f.File, "/")+1:],
+				AbsPath:  f.File,
+				Lineno:   f.Line,
+				InApp:    module == "main",
+			})
+		}
+		ev.Exception = &sentryExceptions{Values: []sentryException{ex}}
+	}
+
+	select {
+	case r.events <- ev:
+	default:
+		slog.Warn("错误上报队列已满，丢弃", "event_id", ev.EventID)
+	}
+}
+
+// splitFunction 把 main.(*viewCounter).flush 这样的函数名分成包名和函数名
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+1+dot+1:]
+}
+
+func (r *sentryReporter) run() {
+	for ev := range r.events {
+		if err := r.send(ev); err != nil {
+			slog.Warn("上报错误失败", "event_id", ev.EventID, "err", err)
+		}
+	}
+}
+
+// send 发送一个 envelope：头部、条目头、事件各占一行
+func (r *sentryReporter) send(ev sentryEvent) error {
+	event, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	header, _ := json.Marshal(gin.H{"event_id": ev.EventID, "dsn": r.dsn, "sent_at": time.Now().UTC().Format(time.RFC3339Nano)})
+	item, _ := json.Marshal(gin.H{"type": "event", "length": len(event)})
+	var body bytes.Buffer
+	body.Write(header)
+	body.WriteByte('\n')
+	body.Write(item)
+	body.WriteByte('\n')
+	body.Write(event)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("上报服务返回 %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ==================== Redis ====================
+
+// 缓存只用到 GET / SET / INCR 几个命令，没有引入 Redis 的客户端库，这里按 RESP 协议直接收发。
+// 连接放在一个小连接池里复用，出错的连接直接关掉不再放回去。
+
+const (
+	redisPoolSize     = 10
+	redisDialTimeout  = 3 * time.Second
+	redisReadTimeout  = 2 * time.Second // 缓存查询慢了还不如直接查数据库
+	redisWriteTimeout = 2 * time.Second
+)
+
+// errRedisNil GET 的键不存在
+var errRedisNil = errors.New("redis: nil")
+
+// redisError Redis 返回的错误（-ERR ...）
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// redisClient Redis 客户端
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func newRedisClient(addr, password string, db int) *redisClient {
+	return &redisClient{addr: addr, password: password, db: db, pool: make(chan *redisConn, redisPoolSize)}
+}
+
+// dial 新建连接，需要时先认证、选择数据库
+func (r *redisClient) dial() (*redisConn, error) {
+	nc, err := net.DialTimeout("tcp", r.addr, redisDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if r.password != "" {
+		if _, err := conn.do("AUTH", r.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// do 执行一个命令，返回值是 string、int64、nil（空回复）或 []interface{}
+func (r *redisClient) do(args ...string) (interface{}, error) {
+	var conn *redisConn
+	select {
+	case conn = <-r.pool:
+	default:
+		c, err := r.dial()
+		if err != nil {
+			return nil, err
+		}
+		conn = c
+	}
+	reply, err := conn.do(args...)
+	var re redisError
+	if err != nil && !errors.As(err, &re) {
+		// 网络错误或者读到一半超时，连接里可能还剩着没读完的回复，不能再用
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case r.pool <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+// Ping 检查能不能连上
+func (r *redisClient) Ping() error {
+	_, err := r.do("PING")
+	return err
+}
+
+// Get 取字符串值，键不存在时返回 errRedisNil
+func (r *redisClient) Get(key string) ([]byte, error) {
+	reply, err := r.do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, errRedisNil
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("redis: GET 返回了 %T", reply)
+	}
+	return []byte(s), nil
+}
+
+// Set 设置字符串值和过期时间
+func (r *redisClient) Set(key string, value []byte, ttl time.Duration) error {
+	_, err := r.do("SET", key, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Incr 加一，返回加之后的值
+func (r *redisClient) Incr(key string) (int64, error) {
+	reply, err := r.do("INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: INCR 返回了 %T", reply)
+	}
+	return n, nil
+}
+
+// ---------- RESP 协议 ----------
+
+// do 发送命令（数组形式）并读取回复
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.SetWriteDeadline(time.Now().Add(redisWriteTimeout))
+	w := bufio.NewWriter(c.Conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	c.SetReadDeadline(time.Now().Add(redisReadTimeout))
+	return c.readReply()
+}
+
+// readReply 读一个回复
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: 回复格式错误")
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: 不认识的回复类型 %q", line[0])
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 省份/城市 ====================
+
+// filterByRegion 按查询参数 province / city 筛选景点，参数为空时不筛选
+func filterByRegion(c *gin.Context, q *gorm.DB) *gorm.DB {
+	if province := c.Query("province"); province != "" {
+		q = q.Where("province = ?", province)
+	}
+	if city := c.Query("city"); city != "" {
+		q = q.Where("city = ?", city)
+	}
+	return q
+}
+
+// regionGroup 一个省份及其下各城市的景点数量
+type regionGroup struct {
+	Province string
+	Count    int
+	Cities   []regionCity
+}
+
+type regionCity struct {
+	City  string
+	Count int
+}
+
+// showRegions 按地区浏览：GET /regions
+// 没有填写省份的景点归到“未分类”
+func showRegions(c *gin.Context) {
+	var rows []struct {
+		Province string
+		City     string
+		Count    int
+	}
+	dbFor(c).Model(&Spot{}).Scopes(published).Select("province, city, COUNT(*) AS count").
+		Group("province, city").Order("province, city").Scan(&rows)
+
+	var groups []regionGroup
+	for _, r := range rows {
+		if len(groups) == 0 || groups[len(groups)-1].Province != r.Province {
+			groups = append(groups, regionGroup{Province: r.Province})
+		}
+		g := &groups[len(groups)-1]
+		g.Count += r.Count
+		if r.City != "" {
+			g.Cities = append(g.Cities, regionCity{City: r.City, Count: r.Count})
+		}
+	}
+	render(c, http.StatusOK, "regions.html", gin.H{
+		"title":  tr(c, "nav.regions"),
+		"groups": groups,
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 猜你喜欢 ====================
+
+// 详情页底部推荐几个相似的景点。相似度由 spotSimilarity 计算：共同标签、同城（或同省）、
+// 价格接近各加一些分。候选景点只从有共同标签或同一省份的景点里找，分数相同时推荐次数多的在前。
+// 以后要换算法（比如按共同收藏的用户）只需要改 relatedSpots。
+
+const (
+	relatedLimit      = 4   // 最多推荐的景点数
+	relatedCandidates = 200 // 最多比较的候选景点数，按推荐次数取前面的
+)
+
+// spotSimilarity 两个景点的相似度，0 表示没有关系
+func spotSimilarity(a, b *Spot) float64 {
+	score := 0.0
+	tags := make(map[uint]bool, len(a.Tags))
+	for _, t := range a.Tags {
+		tags[t.ID] = true
+	}
+	for _, t := range b.Tags {
+		if tags[t.ID] {
+			score += 3
+		}
+	}
+	switch {
+	case a.City != "" && a.Province == b.Province && a.City == b.City:
+		score += 2
+	case a.Province != "" && a.Province == b.Province:
+		score++
+	}
+	// 价格接近时加 0~1 分，只在已经有关系时才算，避免只因价格相同就推荐
+	if score > 0 {
+		if pa, ok := a.comparablePrice(); ok {
+			if pb, ok := b.comparablePrice(); ok {
+				if hi := math.Max(pa, pb); hi == 0 {
+					score++
+				} else {
+					score += 1 - math.Abs(pa-pb)/hi
+				}
+			}
+		}
+	}
+	return score
+}
+
+// comparablePrice 比较用的价格：免费算 0，否则是成人票价，没有填写时 ok 为 false
+func (s *Spot) comparablePrice() (float64, bool) {
+	if s.IsFree {
+		return 0, true
+	}
+	if s.AdultPrice != nil {
+		return *s.AdultPrice, true
+	}
+	return 0, false
+}
+
+// relatedSpots 和 spot 最相似的已发布景点，最多 relatedLimit 个
+func relatedSpots(spot *Spot) []Spot {
+	tagIDs := make([]uint, len(spot.Tags))
+	for i, t := range spot.Tags {
+		tagIDs[i] = t.ID
+	}
+	q := db.Scopes(published).Preload("Tags").Where("id <> ?", spot.ID)
+	switch {
+	case len(tagIDs) > 0 && spot.Province != "":
+		q = q.Where("province = ? OR id IN (SELECT spot_id FROM spot_tags WHERE tag_id IN ?)", spot.Province, tagIDs)
+	case len(tagIDs) > 0:
+		q = q.Where("id IN (SELECT spot_id FROM spot_tags WHERE tag_id IN ?)", tagIDs)
+	case spot.Province != "":
+		q = q.Where("province = ?", spot.Province)
+	default:
+		return nil
+	}
+	var candidates []Spot
+	q.Order("recommend_count DESC, id ASC").Limit(relatedCandidates).Find(&candidates)
+
+	type scored struct {
+		spot  Spot
+		score float64
+	}
+	list := make([]scored, 0, len(candidates))
+	for i := range candidates {
+		if s := spotSimilarity(spot, &candidates[i]); s > 0 {
+			list = append(list, scored{candidates[i], s})
+		}
+	}
+	// 候选已经按推荐次数排好，稳定排序后分数相同的保持这个顺序
+	sort.SliceStable(list, func(i, j int) bool { return list[i].score > list[j].score })
+	if len(list) > relatedLimit {
+		list = list[:relatedLimit]
+	}
+	spots := make([]Spot, len(list))
+	for i, s := range list {
+		spots[i] = s.spot
+	}
+	return spots
+}
+
+// apiRelatedSpots 相似的景点：GET /api/v1/spots/:id/related
+func apiRelatedSpots(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).Scopes(published).Preload("Tags").First(&spot, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	spots := relatedSpots(&spot)
+	if spots == nil {
+		spots = []Spot{}
+	}
+	c.JSON(http.StatusOK, gin.H{"spots": spots})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// ==================== 举报 ====================
+
+// 访客可以举报信息有误或不当的景点和评论，管理员在 /admin/reports 处理：
+// 处理完（如修改景点、驳回评论）后标记为“已处理”，不需要处理的标记为“已忽略”。
+
+// 举报的对象
+const (
+	ReportSpot    = "spot"
+	ReportComment = "comment"
+)
+
+// 举报的状态
+const (
+	ReportOpen      = "open"      // 待处理
+	ReportResolved  = "resolved"  // 已处理
+	ReportDismissed = "dismissed" // 已忽略
+)
+
+const maxReportDetail = 500 // 补充说明最多的字符数
+
+// reportReasons 举报原因，顺序即表单里的顺序；Label 是 locales/ 里的键
+var reportReasons = []struct{ Reason, Label string }{
+	{"wrong_info", "report.reason.wrong_info"},
+	{"inappropriate", "report.reason.inappropriate"},
+	{"spam", "report.reason.spam"},
+	{"other", "report.reason.other"},
+}
+
+// reportStatusLabels 管理页面显示的状态名称（locales/ 里的键）
+var reportStatusLabels = []struct{ Status, Label string }{
+	{ReportOpen, "report.status.open"},
+	{ReportResolved, "report.status.resolved"},
+	{ReportDismissed, "report.status.dismissed"},
+}
+
+// Report 举报
+type Report struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	TargetType string     `gorm:"size:20;index:idx_report_target" json:"target_type"` // spot / comment
+	TargetID   uint       `gorm:"index:idx_report_target" json:"target_id"`
+	Reason     string     `gorm:"size:20" json:"reason"`
+	Detail     string     `gorm:"type:text" json:"detail"`
+	VisitorID  string     `json:"-"` // 举报人，见 visitorKeys，用来避免重复举报
+	IP         string     `gorm:"size:45" json:"-"`
+	Status     string     `gorm:"size:20;index" json:"status"`
+	HandledBy  string     `json:"-"` // 处理的管理员
+	HandledAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ReasonLabel 举报原因的名称在 locales/ 里的键，模板里用 {{t .ReasonLabel}}
+func (r Report) ReasonLabel() string {
+	for _, v := range reportReasons {
+		if v.Reason == r.Reason {
+			return v.Label
+		}
+	}
+	return r.Reason
+}
+
+func validReportReason(reason string) bool {
+	for _, v := range reportReasons {
+		if v.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// reportInput 提交举报的字段，表单和 JSON 都可以
+type reportInput struct {
+	TargetType string `form:"target_type" json:"target_type"`
+	TargetID   uint   `form:"target_id" json:"target_id"`
+	Reason     string `form:"reason" json:"reason"`
+	Detail     string `form:"detail" json:"detail"`
+}
+
+var errReportTarget = errors.New("report target not found")
+
+// reportTargetSpot 举报对象所在的景点（举报评论时是评论所在的景点），对象不存在时返回错误
+func reportTargetSpot(targetType string, targetID uint) (*Spot, error) {
+	var spotID uint
+	switch targetType {
+	case ReportSpot:
+		spotID = targetID
+	case ReportComment:
+		var comment Comment
+		if err := db.Where("status = ?", CommentApproved).First(&comment, targetID).Error; err != nil {
+			return nil, errReportTarget
+		}
+		spotID = comment.SpotID
+	default:
+		return nil, errReportTarget
+	}
+	var spot Spot
+	if err := db.Scopes(published).First(&spot, spotID).Error; err != nil {
+		return nil, errReportTarget
+	}
+	return &spot, nil
+}
+
+// submitReport 举报景点或评论：POST /report
+// fetch 调用或提交 JSON 时返回 JSON，表单提交后回到景点详情页
+func submitReport(c *gin.Context) {
+	var in reportInput
+	if err := c.ShouldBind(&in); err != nil {
+		reportFailed(c, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	spot, err := reportTargetSpot(in.TargetType, in.TargetID)
+	if err != nil {
+		reportFailed(c, http.StatusNotFound, "举报的内容不存在")
+		return
+	}
+	report := Report{
+		TargetType: in.TargetType,
+		TargetID:   in.TargetID,
+		Reason:     in.Reason,
+		Detail:     sanitizeText(in.Detail),
+		VisitorID:  visitorKeys(c)[0],
+		IP:         c.ClientIP(),
+		Status:     ReportOpen,
+	}
+	if !validReportReason(in.Reason) {
+		reportFailed(c, http.StatusBadRequest, "请选择举报原因")
+		return
+	}
+	if utf8.RuneCountInString(report.Detail) > maxReportDetail {
+		reportFailed(c, http.StatusBadRequest, "补充说明不能超过500个字符")
+		return
+	}
+
+	// 同一访客对同一内容的举报还没处理时，不重复记录
+	var open int64
+	dbFor(c).Model(&Report{}).Where("target_type = ? AND target_id = ? AND visitor_id IN ? AND status = ?",
+		report.TargetType, report.TargetID, visitorKeys(c), ReportOpen).Count(&open)
+	if open == 0 {
+		if err := dbFor(c).Create(&report).Error; err != nil {
+			reportFailed(c, http.StatusInternalServerError, "保存失败")
+			return
+		}
+	}
+	if reportWantsJSON(c) {
+		c.JSON(http.StatusCreated, gin.H{"status": ReportOpen})
+		return
+	}
+	c.Redirect(http.StatusFound, "/spot/"+url.PathEscape(spot.Slug)+"?reported=1")
+}
+
+func reportWantsJSON(c *gin.Context) bool {
+	return wantsJSON(c) || c.ContentType() == binding.MIMEJSON
+}
+
+func reportFailed(c *gin.Context, code int, msg string) {
+	if reportWantsJSON(c) {
+		apiError(c, code, msg)
+		return
+	}
+	c.String(code, msg)
+}
+
+// ---------- 管理 ----------
+
+// reportItem 管理页面的一条举报，带上被举报的内容
+type reportItem struct {
+	Report
+	SpotName string // 被举报的景点，或被举报评论所在的景点
+	SpotSlug string
+	Excerpt  string // 被举报评论的内容
+}
+
+// showReports 举报管理：GET /admin/reports?status=open
+func showReports(c *gin.Context) {
+	status := c.DefaultQuery("status", ReportOpen)
+	var reports []Report
+	dbFor(c).Where("status = ?", status).Order("id desc").Limit(200).Find(&reports)
+
+	items := make([]reportItem, len(reports))
+	for i, r := range reports {
+		items[i] = reportItem{Report: r}
+		spotID := r.TargetID
+		if r.TargetType == ReportComment {
+			var comment Comment
+			if err := dbFor(c).First(&comment, r.TargetID).Error; err != nil {
+				items[i].Excerpt = "（评论已删除）"
+				continue
+			}
+			spotID = comment.SpotID
+			items[i].Excerpt = comment.Body
+		}
+		var spot Spot
+		if err := dbFor(c).Unscoped().Select("id", "name", "slug").First(&spot, spotID).Error; err == nil {
+			items[i].SpotName, items[i].SpotSlug = spot.Name, spot.Slug
+		}
+	}
+	var open int64
+	dbFor(c).Model(&Report{}).Where("status = ?", ReportOpen).Count(&open)
+	render(c, http.StatusOK, "reports.html", gin.H{
+		"title":    tr(c, "reports.title"),
+		"items":    items,
+		"statuses": reportStatusLabels,
+		"status":   status,
+		"open":     open,
+	})
+}
+
+// resolveReport 标记为已处理：POST /admin/reports/:id/resolve
+func resolveReport(c *gin.Context) {
+	handleReport(c, ReportResolved)
+}
+
+// dismissReport 忽略：POST /admin/reports/:id/dismiss
+func dismissReport(c *gin.Context) {
+	handleReport(c, ReportDismissed)
+}
+
+func handleReport(c *gin.Context, status string) {
+	now := time.Now()
+	result := dbFor(c).Model(&Report{}).Where("id = ?", c.Param("id")).Updates(Report{
+		Status:    status,
+		HandledBy: currentUser(c).Username,
+		HandledAt: &now,
+	})
+	if result.Error != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.String(http.StatusNotFound, tr(c, "error.report_not_found"))
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin/reports")
+}
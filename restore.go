@@ -0,0 +1,222 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 从备份恢复 ====================
+
+// 管理员在 /admin/backups 上传一个 SQLite 数据库文件，或者选一个已有的快照，替换当前数据库，不用重启服务：
+//
+//  1. 把文件复制到数据库所在目录的临时文件，检查它是完整的 SQLite 数据库（integrity_check），
+//     有 spots 表，迁移版本不比当前程序新
+//  2. 先给当前数据库做一个快照（见 backup.go），恢复错了还可以再恢复回去
+//  3. 等正在处理的请求结束、暂停新请求，关闭数据库连接，把临时文件改名成数据库文件（同一目录下改名是原子的），
+//     重新打开连接，执行迁移（旧版本的备份会升级到当前版本），重新读取设置
+//
+// 恢复后登录会话以备份里的为准，管理员一般需要重新登录。
+
+// dbSwapMu 恢复数据库时加写锁；每个请求处理期间（见 dbGate）和后台任务用数据库期间（见 holdDB）加读锁，
+// 保证恢复时没有人在用数据库，换连接之后也都拿到新的 db
+var dbSwapMu sync.RWMutex
+
+// holdDB 后台任务（定时任务、写入浏览次数、投递 webhook、同步搜索索引）用数据库期间加读锁，和请求的 dbGate 一样：
+// 恢复数据库要等它做完，它也不会用到已经关闭的旧连接。不能嵌套调用，恢复在等写锁时第二次读锁会一直等下去
+func holdDB(f func()) {
+	dbSwapMu.RLock()
+	defer dbSwapMu.RUnlock()
+	f()
+}
+
+// restorePath 恢复数据库的地址，这个请求自己不加读锁
+const restorePath = "/admin/backups/restore"
+
+// dbGate 请求处理期间加读锁，恢复数据库时新请求会等恢复完成再处理
+func dbGate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == restorePath {
+			c.Next()
+			return
+		}
+		dbSwapMu.RLock()
+		defer dbSwapMu.RUnlock()
+		c.Next()
+	}
+}
+
+// sqliteFile 当前 SQLite 数据库文件的路径；用 dsn 配置了 URI 参数或者内存数据库时不支持恢复
+func sqliteFile() (string, error) {
+	if db.Dialector.Name() != "sqlite" {
+		return "", errors.New("只有 SQLite 数据库支持从快照恢复")
+	}
+	path := cfg.Database.DSN
+	if path == "" {
+		path = cfg.Database.Path
+	}
+	if strings.HasPrefix(path, "file:") || strings.Contains(path, "?") || strings.Contains(path, ":memory:") {
+		return "", errors.New("使用 dsn 配置的 SQLite 不支持在线恢复，请停止服务后替换数据库文件")
+	}
+	return path, nil
+}
+
+// validateBackup 检查文件是不是可以恢复的数据库
+func validateBackup(path string) error {
+	check, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer check.Close()
+
+	var result string
+	if err := check.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return errors.New("不是有效的 SQLite 数据库文件")
+	}
+	if result != "ok" {
+		return fmt.Errorf("数据库文件已损坏：%s", result)
+	}
+	var spots int64
+	if err := check.QueryRow("SELECT COUNT(*) FROM spots").Scan(&spots); err != nil {
+		return errors.New("不是景点数据库（没有 spots 表）")
+	}
+	var version sql.NullInt64
+	if err := check.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return errors.New("不是景点数据库（没有迁移记录）")
+	}
+	if int(version.Int64) > schemaVersion() {
+		return fmt.Errorf("备份的数据库版本是 %d，比当前程序（%d）新，请先升级程序", version.Int64, schemaVersion())
+	}
+	return nil
+}
+
+// restoreDatabase 用 src 替换当前数据库，src 必须和数据库文件在同一目录，成功后 src 不再存在
+func restoreDatabase(src string) (safety string, err error) {
+	path, err := sqliteFile()
+	if err != nil {
+		return "", err
+	}
+	dbSwapMu.Lock()
+	defer dbSwapMu.Unlock()
+
+	safety, err = createBackup()
+	if err != nil {
+		return "", fmt.Errorf("恢复前备份当前数据库失败：%w", err)
+	}
+	// 原来的景点也要从外部搜索索引里更新（被删掉或者内容变了）
+	var oldIDs []uint
+	db.Unscoped().Model(&Spot{}).Pluck("id", &oldIDs)
+
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	// 连接全部关闭后 WAL 已经合并进数据库文件，留下的 -wal / -shm 是旧数据库的，不能给新文件用
+	os.Remove(path + "-wal")
+	os.Remove(path + "-shm")
+	renameErr := os.Rename(src, path)
+
+	// 不管改名是否成功都要重新打开连接，失败时打开的还是原来的数据库
+	newDB, err := openDatabase()
+	if err != nil {
+		fatal("恢复数据库后无法打开数据库", "err", err)
+	}
+	db = newDB
+	// 换了整个数据库，缓存里的全是恢复前的数据（见 cache.go）
+	queryCache.invalidate()
+	if renameErr != nil {
+		return safety, renameErr
+	}
+	if err := migrateUp(); err != nil {
+		return safety, err
+	}
+
+	loadRankingSetting()
+	ensureAdmin()
+	if _, ok := searcher.(sqlSearch); ok {
+		ftsEnabled = false
+		initFTS()
+	}
+	var newIDs []uint
+	db.Unscoped().Model(&Spot{}).Pluck("id", &newIDs)
+	syncSearch(append(oldIDs, newIDs...)...)
+	return safety, nil
+}
+
+// stageBackup 把上传的文件或者选中的快照复制到数据库所在目录的临时文件
+func stageBackup(c *gin.Context, dir string) (string, error) {
+	var from io.ReadCloser
+	if name := c.PostForm("name"); name != "" {
+		if !backupNamePattern.MatchString(name) {
+			return "", errors.New("快照不存在")
+		}
+		f, err := os.Open(filepath.Join(cfg.Backup.Dir, name))
+		if err != nil {
+			return "", errors.New("快照不存在")
+		}
+		from = f
+	} else {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			return "", errors.New("请选择要恢复的数据库文件或快照")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return "", errors.New("读取上传的文件失败")
+		}
+		from = f
+	}
+	defer from.Close()
+
+	tmp, err := os.CreateTemp(dir, ".restore-*.db")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(tmp, from)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// ---------- 页面 ----------
+
+// restoreBackup 从上传的文件（字段 file）或已有的快照（字段 name）恢复：POST /admin/backups/restore
+func restoreBackup(c *gin.Context) {
+	path, err := sqliteFile()
+	if err != nil {
+		renderBackups(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	tmp, err := stageBackup(c, filepath.Dir(path))
+	if err != nil {
+		renderBackups(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateBackup(tmp); err != nil {
+		os.Remove(tmp)
+		renderBackups(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	safety, err := restoreDatabase(tmp)
+	if err != nil {
+		os.Remove(tmp)
+		slog.ErrorContext(c.Request.Context(), "恢复数据库失败", "err", err)
+		renderBackups(c, http.StatusInternalServerError, "恢复失败："+err.Error())
+		return
+	}
+	slog.InfoContext(c.Request.Context(), "已从备份恢复数据库", "safety_backup", safety)
+	c.Redirect(http.StatusFound, "/admin/backups?restored="+safety)
+}
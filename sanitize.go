@@ -0,0 +1,47 @@
+package main
+
+import (
+	"html"
+	"net/url"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// ==================== 用户内容清洗 ====================
+
+// 用户提交的内容在写入数据库前统一清洗，库里存的永远是安全的纯文本，
+// 不依赖模板的自动转义，以后 JSON API 或其他前端直接使用也不会有 XSS
+
+// textPolicy 纯文本字段：去掉所有 HTML 标签
+var textPolicy = bluemonday.StrictPolicy()
+
+// sanitizeText 去掉 HTML 标签，返回纯文本
+// bluemonday 会把 & < > ' " 转义成实体，这里再还原成普通字符（模板输出时会重新转义），
+// 还原后如果又出现了标签（原文是 &lt;b&gt; 这种写法）就再清洗一遍，直到结果不再变化
+func sanitizeText(s string) string {
+	for i := 0; i < 5; i++ {
+		clean := html.UnescapeString(textPolicy.Sanitize(s))
+		if clean == s {
+			break
+		}
+		s = clean
+	}
+	return strings.TrimSpace(s)
+}
+
+// sanitizeURL 只允许 http/https 地址和本站上传的图片（/media/...），其他协议（javascript: 等）一律丢弃
+func sanitizeURL(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return ""
+	}
+	if strings.HasPrefix(s, "/media/") && mediaName.MatchString(strings.TrimPrefix(s, "/media/")) {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
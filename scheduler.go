@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 定时任务 ====================
+
+// 清理回收站、计算相似度、备份、生成站点地图、邮件周报等周期性的工作都注册成定时任务，
+// 启动时由 startScheduler 统一调度：每个任务一个 goroutine，按自己的间隔运行。
+// 同一个任务同时只会运行一次（管理员手动运行时定时的那次正在跑，就跳过），
+// 出错或 panic 只记日志和状态，不影响其他任务和下一次运行。
+// 运行情况（上次开始时间、用时、结果、下次运行时间、次数）保存在内存里，管理员在 /admin/jobs 查看。
+// 投递 webhook 和写入浏览次数是随时有新数据就处理的队列，不在这里。
+//
+// 这些后台 goroutine 都用 goBackground 启动，退出时 stopBackground 通知它们停下并等正在做的做完，
+// 之后才关闭数据库，不会有任务用到已经关闭的连接。
+
+// ---------- 后台 goroutine ----------
+
+var (
+	// bgCtx 退出时取消，后台 goroutine 看到后不再开始新的工作
+	bgCtx, stopBG = context.WithCancel(context.Background())
+	bgWG          sync.WaitGroup
+)
+
+// goBackground 启动一个后台 goroutine，f 在 ctx 取消后应尽快返回
+func goBackground(f func(ctx context.Context)) {
+	bgWG.Add(1)
+	go func() {
+		defer bgWG.Done()
+		f(bgCtx)
+	}()
+}
+
+// stopBackground 通知后台 goroutine 停下并等它们结束，ctx 到期时不再等
+func stopBackground(ctx context.Context) {
+	stopBG()
+	done := make(chan struct{})
+	go func() {
+		bgWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("等待后台任务结束超时")
+	}
+}
+
+// sleepCtx 等待 d，ctx 取消时提前返回 false
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// scheduledJob 一个定时任务
+type scheduledJob struct {
+	Name     string        // 唯一的名字，用在网址和日志里
+	Title    string        // 管理页面上显示的说明，是 locales/ 里的键
+	Interval time.Duration // 两次运行的间隔
+	Delay    bool          // 为 true 时启动后先等一个间隔再运行，否则启动时马上运行一次
+	Disabled string        // 不为空时不运行，值是原因（如配置里关掉了）的语言键
+
+	// Run 执行一次，返回结果说明（写进日志和管理页面，没什么可说的时候返回空）
+	Run func() (string, error)
+
+	mu    sync.Mutex
+	state jobState
+}
+
+// jobState 任务的运行情况
+type jobState struct {
+	Running    bool
+	LastStart  time.Time
+	LastEnd    time.Time
+	LastResult string
+	LastError  string
+	NextRun    time.Time
+	Runs       int // 运行次数
+	Failures   int // 失败次数
+	Skipped    int // 因为上一次还没结束而跳过的次数
+}
+
+// jobStatus 管理页面上的一行
+type jobStatus struct {
+	*scheduledJob
+	jobState
+}
+
+// Duration 上次运行的用时，还没运行完时为 0
+func (s jobStatus) Duration() time.Duration {
+	if s.LastEnd.Before(s.LastStart) {
+		return 0
+	}
+	d := s.LastEnd.Sub(s.LastStart)
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
+
+var scheduledJobs []*scheduledJob
+
+// startScheduler 注册并启动定时任务
+func startScheduler(jobs ...*scheduledJob) {
+	scheduledJobs = jobs
+	for _, j := range jobs {
+		if j.Disabled != "" {
+			slog.Info("定时任务未启用", "job", j.Name, "reason", translateDefault(j.Disabled))
+			continue
+		}
+		goBackground(j.loop)
+	}
+}
+
+// findJob 按名字查找定时任务
+func findJob(name string) *scheduledJob {
+	for _, j := range scheduledJobs {
+		if j.Name == name {
+			return j
+		}
+	}
+	return nil
+}
+
+// loop 按间隔反复运行，直到退出
+func (j *scheduledJob) loop(ctx context.Context) {
+	if j.Delay {
+		j.setNextRun(time.Now().Add(j.Interval))
+		if !sleepCtx(ctx, j.Interval) {
+			return
+		}
+	}
+	for {
+		j.execute()
+		j.setNextRun(time.Now().Add(j.Interval))
+		if !sleepCtx(ctx, j.Interval) {
+			return
+		}
+	}
+}
+
+func (j *scheduledJob) setNextRun(t time.Time) {
+	j.mu.Lock()
+	j.state.NextRun = t
+	j.mu.Unlock()
+}
+
+// status 当前的运行情况
+func (j *scheduledJob) status() jobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return jobStatus{j, j.state}
+}
+
+// execute 运行一次，上一次还没结束时跳过并返回 false
+func (j *scheduledJob) execute() bool {
+	j.mu.Lock()
+	if j.state.Running {
+		j.state.Skipped++
+		j.mu.Unlock()
+		slog.Warn("定时任务上一次还没结束，跳过这一次", "job", j.Name)
+		return false
+	}
+	j.state.Running = true
+	j.state.LastStart = time.Now()
+	j.mu.Unlock()
+
+	var result string
+	var err error
+	holdDB(func() { result, err = j.safeRun() })
+
+	j.mu.Lock()
+	j.state.Running = false
+	j.state.LastEnd = time.Now()
+	j.state.Runs++
+	j.state.LastResult = result
+	j.state.LastError = ""
+	if err != nil {
+		j.state.Failures++
+		j.state.LastError = err.Error()
+	}
+	took := j.state.LastEnd.Sub(j.state.LastStart).Round(time.Millisecond)
+	j.mu.Unlock()
+
+	switch {
+	case err != nil:
+		slog.Error("定时任务失败", "job", j.Name, "elapsed", took, "err", err)
+	case result != "":
+		slog.Info("定时任务完成", "job", j.Name, "elapsed", took, "result", result)
+	}
+	return true
+}
+
+// safeRun 运行任务，panic 当作失败
+func (j *scheduledJob) safeRun() (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.Run()
+}
+
+// ---------- 管理页面 ----------
+
+// renderJobs 定时任务列表，message 是操作结果
+func renderJobs(c *gin.Context, status int, message string) {
+	rows := make([]jobStatus, len(scheduledJobs))
+	for i, j := range scheduledJobs {
+		rows[i] = j.status()
+	}
+	render(c, status, "jobs.html", gin.H{
+		"title":   tr(c, "nav.admin.jobs"),
+		"jobs":    rows,
+		"message": message,
+	})
+}
+
+// showJobs 定时任务：GET /admin/jobs
+func showJobs(c *gin.Context) {
+	renderJobs(c, http.StatusOK, "")
+}
+
+// runJobNow 立即运行：POST /admin/jobs/:name/run，在后台运行，不等它结束
+func runJobNow(c *gin.Context) {
+	j := findJob(c.Param("name"))
+	if j == nil {
+		c.String(http.StatusNotFound, tr(c, "error.job_not_found"))
+		return
+	}
+	if j.Disabled != "" {
+		renderJobs(c, http.StatusConflict, tr(c, "jobs.disabled_message", tr(c, j.Title), tr(c, j.Disabled)))
+		return
+	}
+	if j.status().Running {
+		renderJobs(c, http.StatusConflict, tr(c, "jobs.running_message", tr(c, j.Title)))
+		return
+	}
+	goBackground(func(context.Context) { j.execute() })
+	c.Redirect(http.StatusFound, "/admin/jobs")
+}
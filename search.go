@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// ==================== 全文搜索 ====================
+
+// /search 的关键词搜索由 search.provider 指定的搜索后端完成：
+//
+//	sql            默认，使用数据库：SQLite 下用 FTS5 全文索引，其他情况用 LIKE
+//	elasticsearch  外部的 Elasticsearch，数据量大时使用，见 search_elastic.go
+//
+// 搜索后端只返回按相关度排好的景点ID，价格筛选、排序和发布状态仍在数据库里处理；
+// 后端不可用时 /search 退回到 LIKE 搜索。景点新建、修改、删除后调用 syncSearch 更新外部索引。
+
+// searchProvider 搜索后端
+type searchProvider interface {
+	// Search 匹配 query 的景点ID，按相关度从高到低；ok 为 false 时由调用方用 LIKE 搜索
+	Search(query string) (ids []uint, ok bool)
+	// Sync 景点新建、修改或删除后更新索引
+	Sync(ids ...uint)
+}
+
+// searcher 当前使用的搜索后端，由 initSearch 设置
+var searcher searchProvider
+
+// initSearch 根据配置创建搜索后端
+func initSearch() error {
+	switch cfg.Search.Provider {
+	case "", "sql":
+		initFTS()
+		searcher = sqlSearch{}
+	case "elasticsearch":
+		s, err := newElasticSearch()
+		if err != nil {
+			return err
+		}
+		searcher = s
+	default:
+		return fmt.Errorf("不支持的搜索后端 %q（可选 sql / elasticsearch）", cfg.Search.Provider)
+	}
+	slog.Info("搜索后端", "provider", cfg.Search.Provider)
+	return nil
+}
+
+// syncSearch 通知搜索后端这些景点有变化，还没有初始化搜索后端时（比如执行迁移）什么也不做
+func syncSearch(ids ...uint) {
+	if searcher != nil && len(ids) > 0 {
+		searcher.Sync(ids...)
+	}
+}
+
+// AfterDelete 删除景点后从外部索引中去掉；按条件批量删除时没有ID，由调用方调用 syncSearch
+func (s *Spot) AfterDelete(tx *gorm.DB) error {
+	if s.ID != 0 {
+		syncSearch(s.ID)
+	}
+	return nil
+}
+
+// searchKeyword 给查询加上关键词条件：搜索后端可用时按它返回的ID查，ranked 是按相关度排好的ID；
+// 否则按名称或描述模糊搜索，搜索词是拼音时也查拼音列（见 pinyin.go），ranked 为 nil。没有关键词时不加条件
+func searchKeyword(q *gorm.DB, query string) (result *gorm.DB, ranked []uint) {
+	if query == "" {
+		return q, nil
+	}
+	if ids, ok := searcher.Search(query); ok {
+		return q.Where("id IN ?", ids), ids
+	}
+	like := "%" + query + "%"
+	if py, ok := pinyinQuery(query); ok {
+		return q.Where("name LIKE ? OR description LIKE ? OR pinyin_name LIKE ? OR pinyin_description LIKE ?",
+			like, like, "%"+py+"%", "%"+py+"%"), nil
+	}
+	return q.Where("name LIKE ? OR description LIKE ?", like, like), nil
+}
+
+// ---------- 数据库（FTS5 / LIKE） ----------
+
+// sqlSearch 用数据库搜索，索引由触发器维护，不需要同步
+type sqlSearch struct{}
+
+func (sqlSearch) Search(query string) ([]uint, bool) { return ftsSearch(query) }
+func (sqlSearch) Sync(ids ...uint)                   {}
+
+// SQLite 下 /search 用 FTS5 全文索引（spots_fts 虚拟表，索引名称和描述）按相关度排序，
+// 名称里匹配的权重是描述的 10 倍。spots_fts 是 spots 的外部内容表，由触发器和 spots 保持同步，
+// 软删除和未发布的景点在查景点时照常过滤。
+//
+// FTS5 需要编译时加上 -tags sqlite_fts5，所以索引不放在迁移里，而是启动时由 initSearch 检查：
+// 没有就创建并从 spots 重建索引；当前程序不支持 FTS5 或者使用 MySQL / PostgreSQL 时退回到 LIKE 搜索。
+// 分词用 trigram，中文不需要分词，但每个关键词至少要 3 个字，更短的关键词也用 LIKE 搜索。
+// 全是英文字母的搜索词可能是拼音，也用 LIKE 搜索，同时查拼音列。
+
+const ftsMaxResults = 1000 // 全文搜索最多返回的景点数
+
+// ftsEnabled 是否可以用 FTS5 搜索，由 initFTS 设置
+var ftsEnabled bool
+
+// ftsSchema 创建全文索引和同步触发器，最后从 spots 重建索引
+var ftsSchema = []string{
+	`CREATE VIRTUAL TABLE spots_fts USING fts5(name, description, content='spots', content_rowid='id', tokenize='trigram')`,
+	`CREATE TRIGGER spots_fts_insert AFTER INSERT ON spots BEGIN
+		INSERT INTO spots_fts(rowid, name, description) VALUES (new.id, new.name, new.description);
+	END`,
+	`CREATE TRIGGER spots_fts_delete AFTER DELETE ON spots BEGIN
+		INSERT INTO spots_fts(spots_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+	END`,
+	`CREATE TRIGGER spots_fts_update AFTER UPDATE OF name, description ON spots BEGIN
+		INSERT INTO spots_fts(spots_fts, rowid, name, description) VALUES ('delete', old.id, old.name, old.description);
+		INSERT INTO spots_fts(rowid, name, description) VALUES (new.id, new.name, new.description);
+	END`,
+	`INSERT INTO spots_fts(spots_fts) VALUES ('rebuild')`,
+}
+
+// initFTS 启动时准备全文索引，不能用时记一条日志，搜索退回到 LIKE
+func initFTS() {
+	if db.Dialector.Name() != "sqlite" {
+		return
+	}
+	var n int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'spots_fts'").Scan(&n)
+	if n == 0 {
+		// 没有 fts5 模块时建表失败是预料中的，只记下面这一条日志，不记数据库错误
+		quiet := db.Session(&gorm.Session{Logger: gormlogger.Discard})
+		err := quiet.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range ftsSchema {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Warn("未启用全文搜索，使用 LIKE 搜索（编译时加 -tags sqlite_fts5 可以启用）", "err", err)
+			return
+		}
+		slog.Info("已创建全文搜索索引")
+	}
+	ftsEnabled = true
+}
+
+// ftsMatch 把搜索词转成 FTS5 的查询：每个关键词作为一个短语，全部都要匹配。
+// 不能用 FTS5、有少于 3 个字的关键词或者搜索词是拼音（要查拼音列，见 pinyin.go）时 ok 为 false
+func ftsMatch(query string) (match string, ok bool) {
+	if !ftsEnabled {
+		return "", false
+	}
+	if _, ok := pinyinQuery(query); ok {
+		return "", false
+	}
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return "", false
+	}
+	for i, t := range terms {
+		if utf8.RuneCountInString(t) < 3 {
+			return "", false
+		}
+		terms[i] = `"` + strings.ReplaceAll(t, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " "), true
+}
+
+// ftsSearch 用全文索引查出匹配的景点ID，按相关度从高到低；不能用全文索引时 ok 为 false
+func ftsSearch(query string) (ids []uint, ok bool) {
+	match, ok := ftsMatch(query)
+	if !ok {
+		return nil, false
+	}
+	err := db.Raw("SELECT rowid FROM spots_fts WHERE spots_fts MATCH ? ORDER BY bm25(spots_fts, 10.0, 1.0) LIMIT ?",
+		match, ftsMaxResults).Scan(&ids).Error
+	if err != nil {
+		slog.Error("全文搜索失败", "err", err)
+		return nil, false
+	}
+	return ids, true
+}
+
+// sortByRank 按 ids 的顺序（相关度）排列景点
+func sortByRank(spots []Spot, ids []uint) {
+	rank := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		rank[id] = i
+	}
+	sort.SliceStable(spots, func(i, j int) bool { return rank[spots[i].ID] < rank[spots[j].ID] })
+}
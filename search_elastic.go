@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==================== Elasticsearch 搜索 ====================
+
+// 直接调用 Elasticsearch 的 REST 接口，不引入客户端库：只用到建索引、_search 和 _bulk。
+// 索引里每个已发布的景点一个文档（_id 是景点ID），包括名称、描述和它们的拼音（见 pinyin.go）。
+//
+// syncSearch 只把景点ID记下来，由后台协程稍后从数据库读出最新内容写入索引：
+// 已发布的更新文档，删除、待审核、驳回的从索引中去掉。写入失败时过一会儿重试，
+// 这期间搜索结果可能和数据库不一致。索引不存在时启动时创建并导入全部已发布景点，
+// 所以要完整重建索引，删掉索引后重启即可。
+
+const (
+	elasticSyncDelay  = time.Second      // 收到变化后等一会儿再写入，合并连续的修改，也让事务先提交
+	elasticRetryDelay = 10 * time.Second // 写入失败后的重试间隔
+	elasticBatchSize  = 500              // 每个 _bulk 请求最多包含的景点数
+)
+
+// elasticMapping 新建索引时的字段定义
+const elasticMapping = `{
+	"mappings": {
+		"properties": {
+			"name":               {"type": "text"},
+			"description":        {"type": "text"},
+			"pinyin_name":        {"type": "text"},
+			"pinyin_description": {"type": "text"}
+		}
+	}
+}`
+
+type elasticSearch struct {
+	base  *url.URL // 如 http://127.0.0.1:9200，可以带用户名和密码
+	index string
+
+	mu      sync.Mutex
+	pending map[uint]bool // 等待写入索引的景点ID
+	wake    chan struct{}
+}
+
+// elasticClient 访问 Elasticsearch 用的 HTTP 客户端
+var elasticClient = &http.Client{Timeout: 10 * time.Second}
+
+func newElasticSearch() (*elasticSearch, error) {
+	c := cfg.Search.Elasticsearch
+	base, err := url.Parse(strings.TrimRight(c.URL, "/"))
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("elasticsearch url 格式错误: %q", c.URL)
+	}
+	if c.Index == "" {
+		return nil, fmt.Errorf("使用 elasticsearch 搜索需要配置 index")
+	}
+	s := &elasticSearch{
+		base:    base,
+		index:   c.Index,
+		pending: map[uint]bool{},
+		wake:    make(chan struct{}, 1),
+	}
+	created, err := s.ensureIndex()
+	if err != nil {
+		return nil, err
+	}
+	goBackground(s.syncLoop)
+	if created {
+		// 新建的索引导入全部已发布景点
+		var ids []uint
+		db.Model(&Spot{}).Scopes(published).Pluck("id", &ids)
+		slog.Info("已创建 Elasticsearch 索引", "index", s.index, "spots", len(ids))
+		s.Sync(ids...)
+	}
+	return s, nil
+}
+
+// do 发送请求，body 不为 nil 时编码成 JSON（ndjson 为 true 时原样发送）
+func (s *elasticSearch) do(method, path string, body []byte, ndjson bool) (*http.Response, error) {
+	u := *s.base
+	u.Path = s.base.Path + path
+	ctx, cancel := context.WithTimeout(context.Background(), elasticClient.Timeout)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if ndjson {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := elasticClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose 关闭响应时释放请求的 context
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// ensureIndex 索引不存在时创建，created 表示是这次新建的
+func (s *elasticSearch) ensureIndex() (created bool, err error) {
+	resp, err := s.do(http.MethodHead, "/"+s.index, nil, false)
+	if err != nil {
+		return false, fmt.Errorf("连接 Elasticsearch 失败: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return false, nil
+	case http.StatusNotFound:
+	default:
+		return false, fmt.Errorf("查询 Elasticsearch 索引失败: %s", resp.Status)
+	}
+
+	resp, err = s.do(http.MethodPut, "/"+s.index, []byte(elasticMapping), false)
+	if err != nil {
+		return false, fmt.Errorf("创建 Elasticsearch 索引失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("创建 Elasticsearch 索引失败: %s %s", resp.Status, msg)
+	}
+	return true, nil
+}
+
+// Search 名称里匹配的权重是描述的 10 倍；搜索词是拼音时也按拼音匹配（名称的全拼或首字母前缀）
+func (s *elasticSearch) Search(query string) ([]uint, bool) {
+	should := []interface{}{
+		map[string]interface{}{"multi_match": map[string]interface{}{
+			"query":    query,
+			"fields":   []string{"name^10", "description"},
+			"operator": "and",
+		}},
+	}
+	if py, ok := pinyinQuery(query); ok {
+		should = append(should,
+			map[string]interface{}{"prefix": map[string]interface{}{"pinyin_name": map[string]interface{}{"value": py, "boost": 10}}},
+			map[string]interface{}{"match": map[string]interface{}{"pinyin_description": py}},
+		)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"size":    ftsMaxResults,
+		"_source": false,
+		"query":   map[string]interface{}{"bool": map[string]interface{}{"should": should}},
+	})
+
+	resp, err := s.do(http.MethodPost, "/"+s.index+"/_search", body, false)
+	if err != nil {
+		slog.Error("Elasticsearch 搜索失败", "err", err)
+		return nil, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		slog.Error("Elasticsearch 搜索失败", "status", resp.Status)
+		return nil, false
+	}
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				ID string `json:"_id"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		slog.Error("Elasticsearch 搜索结果解析失败", "err", err)
+		return nil, false
+	}
+	ids := make([]uint, 0, len(result.Hits.Hits))
+	for _, h := range result.Hits.Hits {
+		if id, err := strconv.ParseUint(h.ID, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, true
+}
+
+// Sync 记下有变化的景点，由 syncLoop 写入索引
+func (s *elasticSearch) Sync(ids ...uint) {
+	s.mu.Lock()
+	for _, id := range ids {
+		s.pending[id] = true
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// syncLoop 后台把有变化的景点分批写入索引，失败的留到下次重试
+func (s *elasticSearch) syncLoop(ctx context.Context) {
+	for {
+		select {
+		case <-s.wake:
+		case <-ctx.Done():
+			return
+		}
+		sleepCtx(ctx, elasticSyncDelay) // 退出时不再等，马上把攒下的写进去
+		s.mu.Lock()
+		ids := make([]uint, 0, len(s.pending))
+		for id := range s.pending {
+			ids = append(ids, id)
+		}
+		s.pending = map[uint]bool{}
+		s.mu.Unlock()
+
+		for start := 0; start < len(ids); start += elasticBatchSize {
+			end := start + elasticBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			var err error
+			holdDB(func() { err = s.bulk(ids[start:end]) })
+			if err != nil {
+				slog.Error("更新 Elasticsearch 索引失败，稍后重试", "err", err)
+				sleepCtx(ctx, elasticRetryDelay)
+				s.Sync(ids[start:]...)
+				break
+			}
+		}
+	}
+}
+
+// bulk 从数据库读出这些景点，已发布的写入索引，其余的从索引中删除
+func (s *elasticSearch) bulk(ids []uint) error {
+	var spots []Spot
+	if err := db.Scopes(published).Select("id", "name", "description", "pinyin_name", "pinyin_description").
+		Where("id IN ?", ids).Find(&spots).Error; err != nil {
+		return err
+	}
+	found := make(map[uint]bool, len(spots))
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, spot := range spots {
+		found[spot.ID] = true
+		enc.Encode(map[string]interface{}{"index": map[string]string{"_id": strconv.FormatUint(uint64(spot.ID), 10)}})
+		enc.Encode(map[string]string{
+			"name":               spot.Name,
+			"description":        spot.Description,
+			"pinyin_name":        spot.PinyinName,
+			"pinyin_description": spot.PinyinDescription,
+		})
+	}
+	for _, id := range ids {
+		if !found[id] {
+			enc.Encode(map[string]interface{}{"delete": map[string]string{"_id": strconv.FormatUint(uint64(id), 10)}})
+		}
+	}
+
+	resp, err := s.do(http.MethodPost, "/"+s.index+"/_bulk", buf.Bytes(), true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s", resp.Status, msg)
+	}
+	// 删除不在索引里的文档也会在 items 里报 404，不算失败；其他错误只记日志，不重试
+	var result struct {
+		Items []map[string]struct {
+			Status int `json:"status"`
+			Error  struct {
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	for _, item := range result.Items {
+		for action, r := range item {
+			if r.Status >= 300 && !(action == "delete" && r.Status == http.StatusNotFound) {
+				slog.Error("Elasticsearch 写入失败", "action", action, "status", r.Status, "reason", r.Error.Reason)
+			}
+		}
+	}
+	return nil
+}
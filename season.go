@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== 最佳游览季节 ====================
+
+// monthSet 最佳游览月份，第 1~12 位分别表示 1~12 月，数据库里存成整数，
+// 查询当季景点时用 best_months & (1 << 当前月份) 判断
+type monthSet int
+
+// newMonthSet 从月份列表生成，超出 1~12 的忽略
+func newMonthSet(months []int) monthSet {
+	var s monthSet
+	for _, m := range months {
+		if m >= 1 && m <= 12 {
+			s |= 1 << m
+		}
+	}
+	return s
+}
+
+// Has 是否包含某个月
+func (s monthSet) Has(m time.Month) bool {
+	return s&(1<<m) != 0
+}
+
+// List 包含的月份，从小到大
+func (s monthSet) List() []int {
+	months := []int{}
+	for m := 1; m <= 12; m++ {
+		if s.Has(time.Month(m)) {
+			months = append(months, m)
+		}
+	}
+	return months
+}
+
+// String 显示成 4-5月、10月 这样，连续的月份合并
+func (s monthSet) String() string {
+	months := s.List()
+	var parts []string
+	for i := 0; i < len(months); {
+		j := i
+		for j+1 < len(months) && months[j+1] == months[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d月", months[i], months[j]))
+		} else {
+			parts = append(parts, strconv.Itoa(months[i])+"月")
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, "、")
+}
+
+// MarshalJSON 接口里输出月份数组，如 [4,5,10]
+func (s monthSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.List())
+}
+
+// UnmarshalJSON 接受月份数组
+func (s *monthSet) UnmarshalJSON(b []byte) error {
+	var months []int
+	if err := json.Unmarshal(b, &months); err != nil {
+		return err
+	}
+	*s = newMonthSet(months)
+	return nil
+}
+
+// InSeason 现在（按配置的时区）是不是这个景点的最佳季节
+func (s Spot) InSeason() bool {
+	return s.BestMonths.Has(time.Now().In(timezone).Month())
+}
+
+// allMonths 1~12，模板里生成月份复选框用
+func allMonths() []int {
+	return []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+}
+
+// HasMonth 表单里是否勾选了某个月，重新显示表单时用
+func (in spotInput) HasMonth(m int) bool {
+	for _, v := range in.BestMonths {
+		if v == m {
+			return true
+		}
+	}
+	return false
+}
+
+// validMonths 校验规则 months：每个月份都在 1~12 之间
+func validMonths(months []int) bool {
+	for _, m := range months {
+		if m < 1 || m > 12 {
+			return false
+		}
+	}
+	return true
+}
+
+// seasonOrder 当季加权排序：推荐次数乘以 ranking.season_boost，当季的景点排得更靠前
+// 推荐次数加 1，没有推荐过的当季景点也能排在没有推荐过的非当季景点前面
+func seasonOrder() string {
+	bit := 1 << time.Now().In(timezone).Month()
+	return fmt.Sprintf("(recommend_count + 1) * (CASE WHEN best_months & %d <> 0 THEN %g ELSE 1 END) DESC, id ASC",
+		bit, cfg.Ranking.SeasonBoost)
+}
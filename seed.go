@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin/binding"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// ==================== 示例数据 ====================
+
+// 第一次运行（景点表是空的）时从 database.seed_file 导入示例景点，文件不存在就跳过。
+// 文件可以是 YAML（.yaml / .yml）或 JSON，字段和 POST /api/v1/spots 的请求体相同，另外可以带图集：
+//
+//	spots:
+//	  - name: 西湖
+//	    description: 杭州著名景点
+//	    tags: [湖泊, 世界遗产]
+//	    is_free: true
+//	    images:
+//	      - url: https://example.com/xihu.jpg
+//	        caption: 断桥
+//
+// 每个景点按添加表单的规则校验，有一个不合格就整个文件都不导入。
+
+// seedSpot 示例数据里的一个景点
+type seedSpot struct {
+	spotInput
+	Images []seedImage `json:"images"`
+}
+
+type seedImage struct {
+	URL     string `json:"url"`
+	Caption string `json:"caption"`
+}
+
+// loadSeedFile 读取并校验示例数据文件，文件不存在时返回 os.ErrNotExist
+func loadSeedFile(path string) ([]seedSpot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// YAML 先转成 JSON，这样两种格式用同一套 json 标签和类型转换
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var file struct {
+		Spots []seedSpot `json:"spots"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	for i := range file.Spots {
+		s := &file.Spots[i]
+		if err := binding.Validator.ValidateStruct(&s.spotInput); err != nil {
+			var msgs []string
+			for _, msg := range fieldErrors(err) {
+				msgs = append(msgs, msg)
+			}
+			sort.Strings(msgs)
+			if msgs == nil {
+				msgs = []string{err.Error()}
+			}
+			return nil, fmt.Errorf("第 %d 个景点（%s）：%s", i+1, s.Name, strings.Join(msgs, "；"))
+		}
+		for _, img := range s.Images {
+			if sanitizeURL(img.URL) == "" || utf8.RuneCountInString(img.Caption) > maxCaptionLen {
+				return nil, fmt.Errorf("第 %d 个景点（%s）：图片地址必须是 http(s) 地址，说明不能超过 %d 个字", i+1, s.Name, maxCaptionLen)
+			}
+		}
+	}
+	return file.Spots, nil
+}
+
+// seedSpots 景点表是空的时候导入示例数据，文件不存在时什么也不做
+func seedSpots() error {
+	var count int64
+	if err := db.Unscoped().Model(&Spot{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 || cfg.Database.SeedFile == "" {
+		return nil
+	}
+	spots, err := loadSeedFile(cfg.Database.SeedFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", cfg.Database.SeedFile, err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, s := range spots {
+			spot := s.spot()
+			spot.Status = SpotPublished
+			if err := tx.Create(&spot).Error; err != nil {
+				return err
+			}
+			if err := saveSpotTags(tx, &spot, s.Tags); err != nil {
+				return err
+			}
+			for i, img := range s.Images {
+				image := SpotImage{SpotID: spot.ID, URL: sanitizeURL(img.URL), Caption: sanitizeText(img.Caption), Position: i + 1}
+				if err := tx.Create(&image).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("已导入示例景点", "file", cfg.Database.SeedFile, "spots", len(spots))
+	return nil
+}
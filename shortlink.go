@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 短链接 ====================
+
+// 每个景点可以生成一个短链接 /s/<code>，分享到短信、海报上比详情页地址短得多。
+// 短码是 6 位随机字母数字（去掉了 0/O、1/l/I 这些容易看错的字符），生成后不再改变，景点改名也不影响。
+// 打开短链接时跳转到详情页，并把 short_clicks 加一（爬虫和链接预览的请求不计数）。
+
+const (
+	shortCodeLen      = 6
+	shortCodeAlphabet = "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+	shortCodeAttempts = 5 // 短码重复时重试的次数
+)
+
+// newShortCode 随机生成一个短码
+func newShortCode() string {
+	b := make([]byte, shortCodeLen)
+	for i := range b {
+		b[i] = shortCodeAlphabet[randIntn(len(shortCodeAlphabet))]
+	}
+	return string(b)
+}
+
+// mintShortCode 给景点生成短码，已经有了就直接返回；created 表示这次新生成的
+func mintShortCode(spotID uint) (spot Spot, created bool, err error) {
+	if err := db.Scopes(published).First(&spot, spotID).Error; err != nil {
+		return spot, false, err
+	}
+	if spot.ShortCode != nil {
+		return spot, false, nil
+	}
+	for i := 0; i < shortCodeAttempts; i++ {
+		code := newShortCode()
+		var n int64
+		if err := db.Unscoped().Model(&Spot{}).Where("short_code = ?", code).Count(&n).Error; err != nil {
+			return spot, false, err
+		}
+		if n > 0 {
+			continue
+		}
+		// 只在还没有短码时写入，两个请求同时生成时以先写入的为准
+		res := db.Model(&Spot{}).Where("id = ? AND short_code IS NULL", spot.ID).Update("short_code", code)
+		if res.Error != nil {
+			return spot, false, res.Error
+		}
+		if err := db.First(&spot, spot.ID).Error; err != nil {
+			return spot, false, err
+		}
+		return spot, res.RowsAffected > 0, nil
+	}
+	return spot, false, errors.New("生成短码失败，请重试")
+}
+
+// shortURL 短链接的完整地址
+func shortURL(c *gin.Context, spot *Spot) string {
+	if spot.ShortCode == nil {
+		return ""
+	}
+	return absoluteURL(c, "/s/"+*spot.ShortCode)
+}
+
+// ---------- 页面 ----------
+
+// followShortLink 短链接跳转：GET /s/:code
+// 用 302 而不是 301，浏览器不会缓存跳转，每次打开都能计数
+func followShortLink(c *gin.Context) {
+	var spot Spot
+	err := dbFor(c).Scopes(published).Select("id", "slug").Where("short_code = ?", c.Param("code")).First(&spot).Error
+	if err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.shortlink_not_found"))
+		return
+	}
+	if !isBot(c) {
+		dbFor(c).Exec("UPDATE spots SET short_clicks = short_clicks + 1 WHERE id = ?", spot.ID)
+	}
+	c.Redirect(http.StatusFound, "/spot/"+url.PathEscape(spot.Slug))
+}
+
+// ---------- API ----------
+
+// apiMintShortLink 生成景点的短链接：POST /api/v1/spots/:id/shortlink（需要登录）
+// 已经有短链接时返回原来的（200），新生成时返回 201；响应里带点击次数
+func apiMintShortLink(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	spot, created, err := mintShortCode(uint(id))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	case err != nil:
+		apiError(c, http.StatusInternalServerError, tr(c, "error.shortlink_failed"))
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, gin.H{
+		"id":     spot.ID,
+		"code":   *spot.ShortCode,
+		"url":    shortURL(c, &spot),
+		"clicks": spot.ShortClicks,
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 协同过滤推荐 ====================
+
+// 把收藏和推荐当作“喜欢”，后台每隔 similar.interval 计算一次景点之间的相似度（item-item 余弦相似度）：
+// 两个景点被同一批人喜欢得越多，相似度越高。每个景点只保存最相似的 similarTopK 个，存在 spot_similarities 表里。
+// GET /api/v1/spots/:id/recommended 以这个景点为主，再加上当前访客自己喜欢过的景点，
+// 把它们的相似景点按相似度加起来排序，去掉访客已经喜欢过的。还没有相似度数据时退回到 related.go 的相似景点。
+
+const (
+	similarTopK         = 20  // 每个景点保存的最相似景点数
+	similarMaxUserItems = 200 // 喜欢的景点超过这个数的访客（多半是脚本）不参与计算
+	recommendedLimit    = 6   // 推荐接口最多返回的景点数
+)
+
+// SpotSimilarity 两个景点的相似度，OtherID 是和 SpotID 相似的景点
+type SpotSimilarity struct {
+	SpotID  uint    `gorm:"primaryKey;autoIncrement:false"`
+	OtherID uint    `gorm:"primaryKey;autoIncrement:false"`
+	Score   float64 // 余弦相似度，0~1
+}
+
+// computeSimilarities 根据收藏和推荐记录计算景点之间的相似度，每个景点保留前 similarTopK 个
+func computeSimilarities() ([]SpotSimilarity, error) {
+	// 每个访客喜欢的景点，登录用户的收藏和推荐都记在 "u:<用户ID>" 下（和 visitorKeys 一致）
+	likes := map[string]map[uint]bool{}
+	like := func(who string, spotID uint) {
+		if likes[who] == nil {
+			likes[who] = map[uint]bool{}
+		}
+		likes[who][spotID] = true
+	}
+	var favorites []Favorite
+	if err := db.Select("user_id", "spot_id").Find(&favorites).Error; err != nil {
+		return nil, err
+	}
+	for _, f := range favorites {
+		like("u:"+strconv.FormatUint(uint64(f.UserID), 10), f.SpotID)
+	}
+	var recs []Recommendation
+	if err := db.Select("visitor_id", "spot_id").Find(&recs).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range recs {
+		like(r.VisitorID, r.SpotID)
+	}
+
+	// 每个景点被多少人喜欢，每两个景点被多少人同时喜欢
+	counts := map[uint]int{}
+	pairs := map[[2]uint]int{}
+	for _, spots := range likes {
+		if len(spots) > similarMaxUserItems {
+			continue
+		}
+		ids := make([]uint, 0, len(spots))
+		for id := range spots {
+			ids = append(ids, id)
+			counts[id]++
+		}
+		for i, a := range ids {
+			for _, b := range ids[i+1:] {
+				if a < b {
+					pairs[[2]uint{a, b}]++
+				} else {
+					pairs[[2]uint{b, a}]++
+				}
+			}
+		}
+	}
+
+	bySpot := map[uint][]SpotSimilarity{}
+	for p, n := range pairs {
+		score := float64(n) / math.Sqrt(float64(counts[p[0]]*counts[p[1]]))
+		score = math.Round(score*10000) / 10000
+		bySpot[p[0]] = append(bySpot[p[0]], SpotSimilarity{SpotID: p[0], OtherID: p[1], Score: score})
+		bySpot[p[1]] = append(bySpot[p[1]], SpotSimilarity{SpotID: p[1], OtherID: p[0], Score: score})
+	}
+	var all []SpotSimilarity
+	for _, list := range bySpot {
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Score != list[j].Score {
+				return list[i].Score > list[j].Score
+			}
+			return list[i].OtherID < list[j].OtherID
+		})
+		if len(list) > similarTopK {
+			list = list[:similarTopK]
+		}
+		all = append(all, list...)
+	}
+	return all, nil
+}
+
+// refreshSimilarities 重新计算并替换 spot_similarities 表里的数据
+func refreshSimilarities() error {
+	sims, err := computeSimilarities()
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("1 = 1").Delete(&SpotSimilarity{}).Error; err != nil {
+			return err
+		}
+		if len(sims) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(sims, 500).Error
+	})
+}
+
+// similarityJob 定时任务：启动时计算一次景点相似度，之后每隔 similar.interval 重新计算
+func similarityJob() *scheduledJob {
+	return &scheduledJob{
+		Name:     "similarity",
+		Title:    "job.similar",
+		Interval: cfg.Similar.Interval,
+		Run: func() (string, error) {
+			return "", refreshSimilarities()
+		},
+	}
+}
+
+// recommendedSpots 看过 spot 的当前访客可能喜欢的已发布景点，没有相似度数据时返回 nil
+func recommendedSpots(c *gin.Context, spot *Spot) []Spot {
+	// 当前景点的权重是访客自己喜欢过的景点的两倍
+	weights := map[uint]float64{spot.ID: 2}
+	liked := recommendedSpotIDs(c)
+	for id := range favoriteSpotIDs(c) {
+		liked[id] = true
+	}
+	for id := range liked {
+		if id != spot.ID {
+			weights[id] = 1
+		}
+	}
+	seeds := make([]uint, 0, len(weights))
+	for id := range weights {
+		seeds = append(seeds, id)
+	}
+	var sims []SpotSimilarity
+	dbFor(c).Where("spot_id IN ?", seeds).Find(&sims)
+
+	scores := map[uint]float64{}
+	for _, s := range sims {
+		if s.OtherID == spot.ID || liked[s.OtherID] {
+			continue
+		}
+		scores[s.OtherID] += weights[s.SpotID] * s.Score
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	var spots []Spot
+	dbFor(c).Scopes(published).Preload("Tags").Where("id IN ?", ids).Find(&spots)
+	if len(spots) == 0 {
+		return nil
+	}
+	sort.Slice(spots, func(i, j int) bool {
+		if scores[spots[i].ID] != scores[spots[j].ID] {
+			return scores[spots[i].ID] > scores[spots[j].ID]
+		}
+		return spots[i].ID < spots[j].ID
+	})
+	if len(spots) > recommendedLimit {
+		spots = spots[:recommendedLimit]
+	}
+	return spots
+}
+
+// apiRecommendedSpots 为当前访客推荐的景点：GET /api/v1/spots/:id/recommended
+// source 为 collaborative 表示来自协同过滤，related 表示数据不够、退回到按标签/地区/价格的相似景点
+func apiRecommendedSpots(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).Scopes(published).Preload("Tags").First(&spot, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	source := "collaborative"
+	spots := recommendedSpots(c, &spot)
+	if spots == nil {
+		source = "related"
+		spots = relatedSpots(&spot)
+	}
+	if spots == nil {
+		spots = []Spot{}
+	}
+	c.JSON(http.StatusOK, gin.H{"spots": spots, "source": source})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 站点地图 ====================
+
+// GET /sitemap.xml 给搜索引擎的站点地图：首页、所有已发布景点的详情页和标签页，
+// 最后修改时间取景点的 UpdatedAt（首页取所有景点中最新的，标签页取这个标签下最新的）。
+//
+// 地址列表在后台每隔 sitemap.interval 重新生成一次，请求时只拼上当前域名；
+// 管理员也可以调用 POST /api/v1/sitemap/refresh 立即重新生成。
+
+const sitemapMaxURLs = 50000 // 一个站点地图文件最多的地址数（协议规定）
+
+// sitemapEntry 站点地图里的一个地址
+type sitemapEntry struct {
+	Path    string
+	LastMod time.Time
+}
+
+// sitemapCache 最近一次生成的地址列表
+var sitemapCache struct {
+	mu        sync.RWMutex
+	entries   []sitemapEntry
+	generated time.Time
+}
+
+// buildSitemap 从数据库生成地址列表
+func buildSitemap() ([]sitemapEntry, error) {
+	var spots []Spot
+	err := db.Scopes(published).Select("id", "slug", "updated_at").Preload("Tags").
+		Order("id").Find(&spots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	home := sitemapEntry{Path: "/"}
+	entries := []sitemapEntry{}
+	tagMod := map[string]time.Time{}
+	var tagOrder []string
+	for _, s := range spots {
+		entries = append(entries, sitemapEntry{Path: "/spot/" + url.PathEscape(s.Slug), LastMod: s.UpdatedAt})
+		if s.UpdatedAt.After(home.LastMod) {
+			home.LastMod = s.UpdatedAt
+		}
+		for _, t := range s.Tags {
+			mod, seen := tagMod[t.Name]
+			if !seen {
+				tagOrder = append(tagOrder, t.Name)
+			}
+			if s.UpdatedAt.After(mod) {
+				tagMod[t.Name] = s.UpdatedAt
+			}
+		}
+	}
+	for _, name := range tagOrder {
+		entries = append(entries, sitemapEntry{Path: "/tag/" + url.PathEscape(name), LastMod: tagMod[name]})
+	}
+	entries = append([]sitemapEntry{home}, entries...)
+	if len(entries) > sitemapMaxURLs {
+		slog.Warn("站点地图地址太多，超出的没有列出", "max", sitemapMaxURLs, "dropped", len(entries)-sitemapMaxURLs)
+		entries = entries[:sitemapMaxURLs]
+	}
+	return entries, nil
+}
+
+// refreshSitemap 重新生成地址列表
+func refreshSitemap() error {
+	entries, err := buildSitemap()
+	if err != nil {
+		return err
+	}
+	sitemapCache.mu.Lock()
+	sitemapCache.entries = entries
+	sitemapCache.generated = time.Now()
+	sitemapCache.mu.Unlock()
+	return nil
+}
+
+// sitemapJob 定时任务：启动时生成一次，之后定期重新生成
+func sitemapJob() *scheduledJob {
+	return &scheduledJob{
+		Name:     "sitemap",
+		Title:    "job.sitemap",
+		Interval: cfg.Sitemap.Interval,
+		Run: func() (string, error) {
+			return "", refreshSitemap()
+		},
+	}
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// ---------- 页面 ----------
+
+// showSitemap 站点地图：GET /sitemap.xml
+func showSitemap(c *gin.Context) {
+	sitemapCache.mu.RLock()
+	entries, generated := sitemapCache.entries, sitemapCache.generated
+	sitemapCache.mu.RUnlock()
+	if generated.IsZero() {
+		// 后台还没生成完，先现查一次
+		var err error
+		if entries, err = buildSitemap(); err != nil {
+			c.String(http.StatusInternalServerError, tr(c, "error.sitemap_failed"))
+			return
+		}
+	}
+
+	set := sitemapURLSet{URLs: make([]sitemapURL, len(entries))}
+	for i, e := range entries {
+		set.URLs[i].Loc = absoluteURL(c, e.Path)
+		if !e.LastMod.IsZero() {
+			set.URLs[i].LastMod = e.LastMod.Format(time.RFC3339)
+		}
+	}
+	data, err := xml.MarshalIndent(set, "", "  ")
+	if err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.sitemap_failed"))
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+// apiRefreshSitemap 立即重新生成站点地图：POST /api/v1/sitemap/refresh（管理员）
+func apiRefreshSitemap(c *gin.Context) {
+	if err := refreshSitemap(); err != nil {
+		slog.Error("生成站点地图失败", "err", err)
+		apiError(c, http.StatusInternalServerError, tr(c, "error.sitemap_failed"))
+		return
+	}
+	sitemapCache.mu.RLock()
+	n := len(sitemapCache.entries)
+	sitemapCache.mu.RUnlock()
+	c.JSON(http.StatusOK, gin.H{"urls": n})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 景点详情页与 slug ====================
+
+// 每个景点有一个由名称生成的 slug，详情页地址为 /spot/<slug>。
+// 中文名直接保留汉字（浏览器地址栏里能正常显示），空格和标点换成 "-"。
+// 改名时 slug 不变，已经分享出去的链接不会失效。
+
+// slugify 把名称转换成 slug：保留字母和数字（含汉字），其他字符合并成一个 "-"
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	slug := strings.TrimRight(b.String(), "-")
+	if slug == "" {
+		return "spot"
+	}
+	// 纯数字的 slug 会和按ID访问混淆，加个前缀
+	if _, err := strconv.Atoi(slug); err == nil {
+		slug = "spot-" + slug
+	}
+	return slug
+}
+
+// uniqueSlug 生成一个未被占用的 slug，重复时依次加 -2、-3……
+// 回收站里的景点也算占用，恢复后链接不会冲突
+func uniqueSlug(tx *gorm.DB, name string) string {
+	base := slugify(name)
+	candidate := base
+	for i := 2; ; i++ {
+		var count int64
+		tx.Unscoped().Model(&Spot{}).Where("slug = ?", candidate).Count(&count)
+		if count == 0 {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// BeforeCreate 新建景点时自动生成 slug
+func (s *Spot) BeforeCreate(tx *gorm.DB) error {
+	if s.Slug == "" {
+		s.Slug = uniqueSlug(tx.Session(&gorm.Session{NewDB: true}), s.Name)
+	}
+	return nil
+}
+
+// findSpot 按 slug 查找景点；参数是数字时按ID查找，兼容旧链接
+// 管理员可以看到待审核和驳回的景点，其他人只能看到已发布的
+func findSpot(c *gin.Context, key string) (*Spot, error) {
+	load := func() (*Spot, error) {
+		q := dbFor(c).Preload("Tags")
+		if !currentUser(c).IsAdmin() {
+			q = q.Scopes(published)
+		}
+		var spot Spot
+		err := q.Session(&gorm.Session{}).Where("slug = ?", key).First(&spot).Error
+		if err == gorm.ErrRecordNotFound {
+			if id, convErr := strconv.ParseUint(key, 10, 64); convErr == nil {
+				err = q.First(&spot, id).Error
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &spot, nil
+	}
+	// 只缓存已发布的，管理员看到的每次都查
+	if currentUser(c).IsAdmin() {
+		return load()
+	}
+	return cachedSpot("detail", key, load)
+}
+
+// showSpot 景点详情页：GET /spot/:slug
+func showSpot(c *gin.Context) {
+	spot, err := findSpot(c, c.Param("slug"))
+	if err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.spot_slug_not_found", c.Param("slug")))
+		return
+	}
+	// 按ID访问时跳转到规范地址
+	if c.Param("slug") != spot.Slug {
+		c.Redirect(http.StatusMovedPermanently, "/spot/"+url.PathEscape(spot.Slug))
+		return
+	}
+	localizeSpot(c, spot)
+	images := spotImages(spot.ID)
+	// 管理员在详情页下方编辑翻译
+	var translations map[string]SpotTranslation
+	if currentUser(c).IsAdmin() {
+		translations = translationsByLocale(spot.ID)
+	}
+	render(c, http.StatusOK, "spot.html", gin.H{
+		"title":              spot.Name,
+		"meta":               spotMeta(c, spot, images),
+		"spot":               spot,
+		"recommended":        recommendedSpotIDs(c)[spot.ID],
+		"favorited":          favoriteSpotIDs(c)[spot.ID],
+		"myRating":           visitorRating(c, spot.ID),
+		"starChoices":        []int{1, 2, 3, 4, 5},
+		"reasons":            reportReasons,
+		"images":             images,
+		"comments":           spotComments(spot.ID, pageParam(c), false),
+		"itineraries":        myItineraries(c),
+		"checkin":            myCheckin(c, spot.ID),
+		"views":              countView(c, spot),
+		"related":            relatedSpots(spot),
+		"shortURL":           shortURL(c, spot),
+		"translations":       translations,
+		"translationLocales": translationLocales(),
+	})
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ==================== 图片存储 ====================
+
+// 上传的图片存放在哪里由 storage.driver 决定：
+//
+//	local  默认，保存在本地目录 upload.dir，由 /media 直接提供
+//	s3     任何兼容 S3 的对象存储（AWS S3、MinIO 等），签名见 storage_s3.go
+//	oss    阿里云 OSS，签名见 storage_oss.go
+//
+// 数据库里存的始终是 /media/<文件名>，换存储方式不用改数据；
+// 使用对象存储时 /media 会跳转到存储的地址（配置了 signed_url_ttl 时是带签名的临时地址）
+
+// imageStorage 图片存储后端
+type imageStorage interface {
+	// Put 保存文件，同名文件直接覆盖
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open 读取文件，不存在时返回 os.ErrNotExist
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Exists 文件是否已经存在
+	Exists(ctx context.Context, key string) (bool, error)
+	// URL 浏览器访问文件的地址，ttl > 0 时生成 ttl 后过期的签名地址
+	URL(key string, ttl time.Duration) (string, error)
+}
+
+// mediaStorage 当前使用的存储，由 initStorage 设置
+var mediaStorage imageStorage
+
+// initStorage 根据配置创建存储后端
+func initStorage() error {
+	switch cfg.Storage.Driver {
+	case "", "local":
+		mediaStorage = &localStorage{dir: cfg.Upload.Dir}
+	case "s3":
+		s, err := newS3Storage()
+		if err != nil {
+			return err
+		}
+		mediaStorage = s
+	case "oss":
+		s, err := newOSSStorage()
+		if err != nil {
+			return err
+		}
+		mediaStorage = s
+	default:
+		return fmt.Errorf("不支持的存储方式 %q（可选 local / s3 / oss）", cfg.Storage.Driver)
+	}
+	slog.Info("图片存储", "driver", cfg.Storage.Driver)
+	return nil
+}
+
+// storageClient 访问对象存储用的 HTTP 客户端
+var storageClient = &http.Client{Timeout: 30 * time.Second}
+
+// ---------- 本地目录 ----------
+
+type localStorage struct {
+	dir string
+}
+
+func (s *localStorage) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(key))
+}
+
+func (s *localStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免并发请求读到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (s *localStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *localStorage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := os.Stat(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// URL 本地文件就由 /media 提供，没有签名
+func (s *localStorage) URL(key string, ttl time.Duration) (string, error) {
+	return "/media/" + key, nil
+}
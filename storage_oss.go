@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== 阿里云 OSS ====================
+
+// 按 OSS 的 V1 签名（HMAC-SHA1）直接调用 REST 接口，不引入 SDK
+
+type ossStorage struct {
+	endpoint  string // 地域节点，如 oss-cn-hangzhou.aliyuncs.com
+	bucket    string
+	keyID     string
+	keySecret string
+	publicURL string // 不为空时直接用这个前缀拼地址（例如绑定的自定义域名/CDN），不再签名
+	prefix    string // 对象名前缀
+}
+
+func newOSSStorage() (*ossStorage, error) {
+	c := cfg.Storage.OSS
+	if c.Endpoint == "" || c.Bucket == "" || c.AccessKeyID == "" || c.AccessKeySecret == "" {
+		return nil, errors.New("使用 oss 存储需要配置 endpoint、bucket、access_key_id、access_key_secret")
+	}
+	endpoint := strings.TrimPrefix(strings.TrimPrefix(c.Endpoint, "https://"), "http://")
+	return &ossStorage{
+		endpoint:  strings.TrimRight(endpoint, "/"),
+		bucket:    c.Bucket,
+		keyID:     c.AccessKeyID,
+		keySecret: c.AccessKeySecret,
+		publicURL: strings.TrimRight(c.PublicURL, "/"),
+		prefix:    cfg.Storage.Prefix,
+	}, nil
+}
+
+func (s *ossStorage) objectURL(key string) string {
+	return "https://" + s.bucket + "." + s.endpoint + "/" + s.prefix + key
+}
+
+// sign 计算签名：VERB \n Content-MD5 \n Content-Type \n Date(或 Expires) \n /bucket/object
+func (s *ossStorage) sign(method, contentType, date, key string) string {
+	toSign := method + "\n\n" + contentType + "\n" + date + "\n/" + s.bucket + "/" + s.prefix + key
+	h := hmac.New(sha1.New, []byte(s.keySecret))
+	h.Write([]byte(toSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func (s *ossStorage) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	date := time.Now().UTC().Format(http.TimeFormat)
+	req.Header.Set("Date", date)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "OSS "+s.keyID+":"+s.sign(method, contentType, date, key))
+	return storageClient.Do(req)
+}
+
+func (s *ossStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("oss 上传失败: %s %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (s *ossStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("oss 读取失败: %s", resp.Status)
+	}
+}
+
+func (s *ossStorage) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, "")
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("oss 查询失败: %s", resp.Status)
+	}
+}
+
+// URL 配置了 public_url 时直接拼接；ttl > 0 时生成签名地址；否则返回对象的原始地址（需要 Bucket 公共读）
+func (s *ossStorage) URL(key string, ttl time.Duration) (string, error) {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + s.prefix + key, nil
+	}
+	if ttl <= 0 {
+		return s.objectURL(key), nil
+	}
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	q := url.Values{
+		"OSSAccessKeyId": {s.keyID},
+		"Expires":        {expires},
+		"Signature":      {s.sign(http.MethodGet, "", expires, key)},
+	}
+	return s.objectURL(key) + "?" + q.Encode(), nil
+}
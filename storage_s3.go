@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==================== S3 兼容存储 ====================
+
+// 直接按 AWS Signature Version 4 签名请求，不引入 SDK：
+// 只用到 PUT / GET / HEAD 单个对象和预签名 GET 地址
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3EmptyHash       = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" // 空内容的 SHA-256
+)
+
+type s3Storage struct {
+	endpoint  *url.URL // 如 https://s3.ap-east-1.amazonaws.com 或 http://127.0.0.1:9000
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool   // true: endpoint/bucket/key（MinIO 常用）；false: bucket.endpoint/key
+	publicURL string // 不为空时直接用这个前缀拼地址（例如 CDN），不再签名
+	prefix    string // 对象名前缀
+}
+
+func newS3Storage() (*s3Storage, error) {
+	c := cfg.Storage.S3
+	if c.Bucket == "" || c.AccessKey == "" || c.SecretKey == "" {
+		return nil, errors.New("使用 s3 存储需要配置 bucket、access_key、secret_key")
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	endpoint, err := url.Parse(strings.TrimRight(c.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint 格式错误: %q", c.Endpoint)
+	}
+	return &s3Storage{
+		endpoint:  endpoint,
+		region:    c.Region,
+		bucket:    c.Bucket,
+		accessKey: c.AccessKey,
+		secretKey: c.SecretKey,
+		pathStyle: c.PathStyle,
+		publicURL: strings.TrimRight(c.PublicURL, "/"),
+		prefix:    cfg.Storage.Prefix,
+	}, nil
+}
+
+// objectURL 对象的原始地址（不带签名）
+func (s *s3Storage) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + s.prefix + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + s.prefix + key
+	}
+	return &u
+}
+
+func (s *s3Storage) signingKey(date string) []byte {
+	k := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	k = hmacSHA256(k, s.region)
+	k = hmacSHA256(k, "s3")
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Query 按 SigV4 的要求编码查询参数：按名称排序，空格编码成 %20
+func s3Query(q url.Values) string {
+	return strings.ReplaceAll(q.Encode(), "+", "%20")
+}
+
+// signature 计算请求签名
+// headers 是参与签名的请求头（名称为小写），payloadHash 为请求体的 SHA-256 或 UNSIGNED-PAYLOAD
+func (s *s3Storage) signature(method string, u *url.URL, headers map[string]string, payloadHash string, now time.Time) (signedHeaders, sig string) {
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders = strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		s3Query(u.Query()),
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+
+	date := now.Format("20060102")
+	toSign := strings.Join([]string{
+		s3Algorithm,
+		now.Format("20060102T150405Z"),
+		date + "/" + s.region + "/s3/aws4_request",
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+	return signedHeaders, hex.EncodeToString(hmacSHA256(s.signingKey(date), toSign))
+}
+
+// do 发送签名后的请求
+func (s *s3Storage) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	u := s.objectURL(key)
+	now := time.Now().UTC()
+
+	payloadHash := s3EmptyHash
+	if body != nil {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	headers := map[string]string{
+		"host":                 u.Host,
+		"x-amz-date":           now.Format("20060102T150405Z"),
+		"x-amz-content-sha256": payloadHash,
+	}
+	if contentType != "" {
+		headers["content-type"] = contentType
+	}
+	signedHeaders, sig := s.signature(method, u, headers, payloadHash, now)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range headers {
+		if k != "host" {
+			req.Header.Set(k, v)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s/%s/s3/aws4_request, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, now.Format("20060102"), s.region, signedHeaders, sig))
+	return storageClient.Do(req)
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 上传失败: %s %s", resp.Status, msg)
+	}
+	return nil
+}
+
+func (s *s3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 读取失败: %s", resp.Status)
+	}
+}
+
+func (s *s3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, "")
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("s3 查询失败: %s", resp.Status)
+	}
+}
+
+// URL 配置了 public_url 时直接拼接；ttl > 0 时生成预签名地址（最长 7 天）；否则返回对象的原始地址
+func (s *s3Storage) URL(key string, ttl time.Duration) (string, error) {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + s.prefix + key, nil
+	}
+	u := s.objectURL(key)
+	if ttl <= 0 {
+		return u.String(), nil
+	}
+	if ttl > 7*24*time.Hour {
+		ttl = 7 * 24 * time.Hour
+	}
+	return s.presign(u, ttl, time.Now().UTC()), nil
+}
+
+// presign 生成预签名 GET 地址，签名放在查询参数里，只签 host 头
+func (s *s3Storage) presign(u *url.URL, ttl time.Duration, now time.Time) string {
+	q := url.Values{
+		"X-Amz-Algorithm":     {s3Algorithm},
+		"X-Amz-Credential":    {s.accessKey + "/" + now.Format("20060102") + "/" + s.region + "/s3/aws4_request"},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	u.RawQuery = s3Query(q)
+	_, sig := s.signature(http.MethodGet, u, map[string]string{"host": u.Host}, s3UnsignedPayload, now)
+	q.Set("X-Amz-Signature", sig)
+	u.RawQuery = s3Query(q)
+	return u.String()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 投稿审核 ====================
+
+// 未登录访客在首页添加的景点先进入待审核状态，不出现在列表、搜索、接口等任何公开的地方，
+// 管理员在 /admin/submissions 发布或驳回（可以附上说明）。登录用户和接口添加的景点直接发布。
+// 驳回的景点保留在审核页面，之后仍然可以发布。
+
+// 景点的发布状态
+const (
+	SpotPending   = "pending"   // 待审核
+	SpotPublished = "published" // 已发布
+	SpotRejected  = "rejected"  // 已驳回
+)
+
+const maxReviewNote = 500 // 审核说明最多的字符数
+
+// submissionStatusLabels 审核页面的筛选，Label 是 locales/ 里的键
+var submissionStatusLabels = []struct{ Status, Label string }{
+	{SpotPending, "moderation.status.pending"},
+	{SpotRejected, "moderation.status.rejected"},
+}
+
+// published 只查已发布的景点，所有公开的查询都要加上：db.Scopes(published)
+func published(tx *gorm.DB) *gorm.DB {
+	return tx.Where("spots.status = ?", SpotPublished)
+}
+
+// newSpotStatus 首页添加的景点的状态：未登录时待审核
+func newSpotStatus(c *gin.Context) string {
+	if currentUser(c) == nil {
+		return SpotPending
+	}
+	return SpotPublished
+}
+
+// showSubmissions 投稿审核：GET /admin/submissions?status=pending
+func showSubmissions(c *gin.Context) {
+	status := c.DefaultQuery("status", SpotPending)
+	if status != SpotRejected {
+		status = SpotPending
+	}
+	var spots []Spot
+	dbFor(c).Preload("Tags").Where("status = ?", status).Order("id desc").Find(&spots)
+	var pending int64
+	dbFor(c).Model(&Spot{}).Where("status = ?", SpotPending).Count(&pending)
+	render(c, http.StatusOK, "submissions.html", gin.H{
+		"title":    tr(c, "nav.admin.submissions"),
+		"spots":    spots,
+		"statuses": submissionStatusLabels,
+		"status":   status,
+		"pending":  pending,
+	})
+}
+
+// publishSubmission 发布：POST /admin/submissions/:id/publish
+func publishSubmission(c *gin.Context) {
+	reviewSubmission(c, SpotPublished, auditPublish)
+}
+
+// rejectSubmission 驳回：POST /admin/submissions/:id/reject，表单字段 note 是驳回说明
+func rejectSubmission(c *gin.Context) {
+	reviewSubmission(c, SpotRejected, auditReject)
+}
+
+func reviewSubmission(c *gin.Context, status, action string) {
+	var spot Spot
+	if err := dbFor(c).Where("status <> ?", SpotPublished).First(&spot, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.submission_not_found"))
+		return
+	}
+	note := sanitizeText(c.PostForm("note"))
+	if utf8.RuneCountInString(note) > maxReviewNote {
+		c.String(http.StatusBadRequest, tr(c, "error.review_note_too_long", maxReviewNote))
+		return
+	}
+	before := spot
+	if err := dbFor(c).Model(&spot).Select("Status", "ReviewNote").Updates(Spot{Status: status, ReviewNote: note}).Error; err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	// 发布后才计入标签的景点数
+	updateSpotTagCounts(spot.ID)
+	recordAudit(c, action, spot.ID, before, spot)
+	notifyReview(c, &spot)
+	c.Redirect(http.StatusFound, "/admin/submissions")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 搜索联想 ====================
+
+// GET /api/v1/suggest?q=西 给搜索框的自动补全用，每输入一个字调用一次，所以只查名称、只返回几个字段。
+// 先找名称以 q 开头的景点：用 name >= q AND name < q+U+10FFFF 的范围查询，可以走 spots.name 上的索引；
+// 不够 limit 个时再补上名称中间包含 q 的，q 是拼音时也包括名称拼音（全拼或首字母）包含 q 的。
+// 两部分都按推荐次数从多到少。
+
+const (
+	suggestLimit    = 8  // 默认返回的个数
+	suggestMaxLimit = 20 // limit 参数的上限
+	suggestMaxQuery = 50 // q 超过这个长度时不再联想
+)
+
+// suggestion 联想结果的一项
+type suggestion struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// suggestSpots 名称匹配 q 的已发布景点，前缀匹配的在前
+func suggestSpots(q string, limit int) []suggestion {
+	list := []suggestion{}
+	if q == "" || utf8.RuneCountInString(q) > suggestMaxQuery {
+		return list
+	}
+	db.Model(&Spot{}).Scopes(published).Select("id", "name", "slug").
+		Where("name >= ? AND name < ?", q, q+"\U0010FFFF").
+		Order("recommend_count DESC, id ASC").Limit(limit).Scan(&list)
+	// 含 LIKE 通配符时只做前缀匹配
+	if len(list) >= limit || strings.ContainsAny(q, "%_") {
+		return list
+	}
+
+	var more []suggestion
+	q2 := db.Model(&Spot{}).Scopes(published).Select("id", "name", "slug")
+	if py, ok := pinyinQuery(q); ok {
+		q2 = q2.Where("name LIKE ? OR pinyin_name LIKE ?", "%"+q+"%", "%"+py+"%")
+	} else {
+		q2 = q2.Where("name LIKE ?", "%"+q+"%")
+	}
+	if len(list) > 0 {
+		ids := make([]uint, len(list))
+		for i, s := range list {
+			ids[i] = s.ID
+		}
+		q2 = q2.Where("id NOT IN ?", ids)
+	}
+	q2.Order("recommend_count DESC, id ASC").Limit(limit - len(list)).Scan(&more)
+	return append(list, more...)
+}
+
+// apiSuggest 搜索联想：GET /api/v1/suggest?q=西&limit=8
+func apiSuggest(c *gin.Context) {
+	limit := suggestLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > suggestMaxLimit {
+			apiError(c, http.StatusBadRequest, tr(c, "error.limit_range", suggestMaxLimit))
+			return
+		}
+		limit = n
+	}
+	// 结果变化不频繁，允许浏览器短时间缓存，连续输入、删除时不必重复请求
+	c.Header("Cache-Control", "public, max-age=60")
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestSpots(strings.TrimSpace(c.Query("q")), limit)})
+}
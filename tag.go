@@ -0,0 +1,309 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ==================== 分类标签 ====================
+
+// 景点可以打多个标签（山、湖、博物馆、寺庙……），标签在第一次使用时自动创建，
+// 管理员可以在 /admin/tags 改名、合并和删除。
+// 每个标签的景点数存在 tags.spot_count 里，标签或景点变化时只重新统计受影响的标签，
+// 标签云不需要每次都 JOIN 统计。
+
+const (
+	maxSpotTags  = 10 // 每个景点最多的标签数
+	maxTagLength = 20 // 标签名最多的字符数
+)
+
+// Tag 标签
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"uniqueIndex;size:50" json:"name"`
+	SpotCount int       `gorm:"index" json:"-"` // 使用这个标签的已发布景点数（不含回收站里的景点）
+	CreatedAt time.Time `json:"-"`
+}
+
+// SpotTag 景点和标签的对应关系（Spot.Tags 的中间表）
+type SpotTag struct {
+	SpotID uint `gorm:"primaryKey;autoIncrement:false"`
+	TagID  uint `gorm:"primaryKey;autoIncrement:false;index"`
+}
+
+// TagNames 标签名用逗号连起来，填到编辑表单里
+func (s Spot) TagNames() string {
+	names := make([]string, len(s.Tags))
+	for i, t := range s.Tags {
+		names[i] = t.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// tagList 表单/接口提交的标签
+// 表单里是一个用逗号（中英文都可以）、顿号或空格分隔的字符串，JSON 里是字符串数组；
+// 没有提交这个字段时为 nil，表示不修改标签
+type tagList []string
+
+// String 显示在表单里
+func (t tagList) String() string {
+	return strings.Join(normalizeTags(t), ", ")
+}
+
+// normalizeTags 拆分并清洗标签名，去掉空的和重复的，保持原来的顺序
+func normalizeTags(values []string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, v := range values {
+		for _, name := range strings.FieldsFunc(v, isTagSeparator) {
+			name = sanitizeText(name)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// isTagSeparator 标签之间的分隔符；标签名会出现在 /tag/<名称> 里，所以 / 也当作分隔符
+func isTagSeparator(r rune) bool {
+	return r == ',' || r == '，' || r == '、' || r == '/' || unicode.IsSpace(r)
+}
+
+// validTags 校验规则 tags：数量和每个标签的长度
+func validTags(t tagList) bool {
+	names := normalizeTags(t)
+	if len(names) > maxSpotTags {
+		return false
+	}
+	for _, name := range names {
+		if utf8.RuneCountInString(name) > maxTagLength {
+			return false
+		}
+	}
+	return true
+}
+
+// setSpotTags 把景点的标签替换成 names，没有的标签会自动创建
+func setSpotTags(spot *Spot, values tagList) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		return saveSpotTags(tx, spot, values)
+	})
+}
+
+// saveSpotTags 在事务 tx 里替换景点的标签，供需要和其他修改一起提交的地方使用（如 CSV 导入）
+func saveSpotTags(tx *gorm.DB, spot *Spot, values tagList) error {
+	names := normalizeTags(values)
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		tag := Tag{Name: name}
+		if err := tx.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+			return err
+		}
+		tags = append(tags, tag)
+	}
+	// 原来的标签和新的标签都要重新统计
+	var changed []uint
+	if err := tx.Model(&SpotTag{}).Where("spot_id = ?", spot.ID).Pluck("tag_id", &changed).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id = ?", spot.ID).Delete(&SpotTag{}).Error; err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := tx.Create(&SpotTag{SpotID: spot.ID, TagID: tag.ID}).Error; err != nil {
+			return err
+		}
+		changed = append(changed, tag.ID)
+	}
+	if err := updateTagCounts(tx, changed); err != nil {
+		return err
+	}
+	spot.Tags = tags
+	return nil
+}
+
+// updateTagCounts 重新统计这些标签的景点数
+func updateTagCounts(tx *gorm.DB, tagIDs []uint) error {
+	if len(tagIDs) == 0 {
+		return nil
+	}
+	return tx.Exec(`UPDATE tags SET spot_count = (
+		SELECT COUNT(*) FROM spot_tags JOIN spots ON spots.id = spot_tags.spot_id
+		WHERE spot_tags.tag_id = tags.id AND spots.deleted_at IS NULL AND spots.status = ?
+	) WHERE id IN ?`, SpotPublished, tagIDs).Error
+}
+
+// updateSpotTagCounts 景点删除/恢复后，重新统计它们的标签的景点数
+// 统计失败不影响操作本身，只打印错误
+func updateSpotTagCounts(spotIDs ...uint) {
+	if len(spotIDs) == 0 {
+		return
+	}
+	var tagIDs []uint
+	err := db.Model(&SpotTag{}).Distinct("tag_id").Where("spot_id IN ?", spotIDs).Pluck("tag_id", &tagIDs).Error
+	if err == nil {
+		err = updateTagCounts(db, tagIDs)
+	}
+	if err != nil {
+		slog.Error("更新标签景点数失败", "err", err)
+	}
+}
+
+// ---------- 按标签浏览 ----------
+
+// showTag 有某个标签的景点：GET /tag/:name
+func showTag(c *gin.Context) {
+	var tag Tag
+	if err := dbFor(c).Where("name = ?", c.Param("name")).First(&tag).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.tag_name_not_found", c.Param("name")))
+		return
+	}
+	var spots []Spot
+	q := dbFor(c).Scopes(published).Preload("Tags").Order(spotOrder(c)).
+		Where("id IN (?)", dbFor(c).Model(&SpotTag{}).Select("spot_id").Where("tag_id = ?", tag.ID))
+	filterSpots(c, q).Find(&spots)
+	spots = filterOpenNow(c, spots)
+	localizeSpots(c, spots)
+	render(c, http.StatusOK, "index.html", gin.H{
+		"spots":       spots,
+		"recommended": recommendedSpotIDs(c),
+		"favorited":   favoriteSpotIDs(c),
+		"filters":     activeFilters(c),
+		"tag":         tag.Name,
+	})
+}
+
+// tagCloudItem 标签云中的一个标签，Size 是字号（像素）
+type tagCloudItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Size  int    `json:"-"`
+}
+
+// tagCloud 所有有景点的标签，按景点数从多到少排列
+func tagCloud() []tagCloudItem {
+	var tags []Tag
+	db.Where("spot_count > 0").Order("spot_count desc, name").Find(&tags)
+	items := make([]tagCloudItem, len(tags))
+	for i, t := range tags {
+		// 字号按景点数在 12~32 像素之间线性分布，第一个就是最多的
+		size := 12
+		if tags[0].SpotCount > 1 {
+			size += 20 * (t.SpotCount - 1) / (tags[0].SpotCount - 1)
+		}
+		items[i] = tagCloudItem{Name: t.Name, Count: t.SpotCount, Size: size}
+	}
+	return items
+}
+
+// apiTags 标签及景点数，给标签云用：GET /api/v1/tags
+func apiTags(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"tags": tagCloud()})
+}
+
+// showTagCloud 标签云：GET /tags，fetch 调用时返回和 /api/v1/tags 一样的 JSON
+func showTagCloud(c *gin.Context) {
+	if wantsJSON(c) {
+		apiTags(c)
+		return
+	}
+	render(c, http.StatusOK, "tagcloud.html", gin.H{
+		"title": tr(c, "nav.tags"),
+		"tags":  tagCloud(),
+	})
+}
+
+// ---------- 标签管理（管理员） ----------
+
+// showTags 标签管理：GET /admin/tags
+func showTags(c *gin.Context) {
+	var tags []Tag
+	dbFor(c).Order("spot_count desc, name").Find(&tags)
+	render(c, http.StatusOK, "tags.html", gin.H{
+		"title": tr(c, "nav.admin.tags"),
+		"tags":  tags,
+	})
+}
+
+// renameTag 修改标签名：POST /admin/tags/:id/rename
+// 新名称已经存在时合并到那个标签
+func renameTag(c *gin.Context) {
+	var tag Tag
+	if err := dbFor(c).First(&tag, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.tag_not_found"))
+		return
+	}
+	name := sanitizeText(c.PostForm("name"))
+	if name == "" || utf8.RuneCountInString(name) > maxTagLength {
+		c.String(http.StatusBadRequest, tr(c, "error.tag_name_invalid", maxTagLength))
+		return
+	}
+	if name == tag.Name {
+		c.Redirect(http.StatusFound, "/admin/tags")
+		return
+	}
+
+	err := retryTransaction(dbFor(c), func(tx *gorm.DB) error {
+		var target Tag
+		err := tx.Where("name = ?", name).First(&target).Error
+		if err == gorm.ErrRecordNotFound {
+			return tx.Model(&tag).Update("name", name).Error
+		}
+		if err != nil {
+			return err
+		}
+		// 合并：已经同时有两个标签的景点只保留一条
+		var links []SpotTag
+		if err := tx.Where("tag_id = ?", tag.ID).Find(&links).Error; err != nil {
+			return err
+		}
+		for _, l := range links {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&SpotTag{SpotID: l.SpotID, TagID: target.ID}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := deleteTag(tx, tag.ID); err != nil {
+			return err
+		}
+		return updateTagCounts(tx, []uint{target.ID})
+	})
+	if err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin/tags")
+}
+
+// removeTag 删除标签，景点上的这个标签一起去掉：POST /admin/tags/:id/delete
+func removeTag(c *gin.Context) {
+	var tag Tag
+	if err := dbFor(c).First(&tag, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.tag_not_found"))
+		return
+	}
+	if err := retryTransaction(dbFor(c), func(tx *gorm.DB) error { return deleteTag(tx, tag.ID) }); err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.delete_failed"))
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin/tags")
+}
+
+func deleteTag(tx *gorm.DB, id uint) error {
+	if err := tx.Where("tag_id = ?", id).Delete(&SpotTag{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&Tag{}, id).Error
+}
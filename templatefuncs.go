@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"strings"
+	"time"
+)
+
+// ==================== 模板辅助函数 ====================
+
+// templateFuncs 注册到 Gin 的模板函数
+var templateFuncs = template.FuncMap{
+	"timeAgo":      timeAgo,
+	"markdown":     renderMarkdown,
+	"markdownText": markdownText,
+	"truncate":     truncate,
+	"formatDate":   formatDate,
+	"formatTime":   formatTime,
+	"priceText":    priceText,
+	"themeCSS":     themeCSS,
+	"locales":      localeOptions,
+	"t":            translateDefault,
+	"cardThumb":    cardThumb,
+	"galleryThumb": galleryThumb,
+	"months":       allMonths,
+	"dict":         dict,
+	"rankings":     rankingOptions,
+}
+
+// dict 把成对的参数组成 map，用来给 {{template}} 传多个值，如 (dict "comment" . "page" $)
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict 的参数必须成对")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, errors.New("dict 的键必须是字符串")
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+// timeAgo 把时间显示成“3天前”这种相对时间，超过一年显示日期
+func timeAgo(t time.Time) string {
+	return timeAgoIn(cfg.Locale)(t)
+}
+
+// timeAgoIn 某种语言的 timeAgo，页面模板在 loadTemplates 里按语言换掉
+func timeAgoIn(locale string) func(time.Time) string {
+	return func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		d := time.Since(t)
+		switch {
+		case d < time.Minute:
+			return translate(locale, "time.just_now")
+		case d < time.Hour:
+			return translate(locale, "time.minutes_ago", int(d.Minutes()))
+		case d < 24*time.Hour:
+			return translate(locale, "time.hours_ago", int(d.Hours()))
+		case d < 30*24*time.Hour:
+			return translate(locale, "time.days_ago", int(d.Hours()/24))
+		case d < 365*24*time.Hour:
+			return translate(locale, "time.months_ago", int(d.Hours()/24/30))
+		default:
+			return formatDate(t)
+		}
+	}
+}
+
+// truncate 把 s 截到 n 个字符，超出的部分换成省略号，用法 {{markdownText .Description | truncate 120}}
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if n <= 0 || len(r) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(r[:n])) + "…"
+}
+
+// formatDate 按配置的时区显示日期，参数可以是 time.Time 或 *time.Time，零值显示为空
+func formatDate(v interface{}) string {
+	return formatIn(v, "2006-01-02")
+}
+
+// formatTime 按配置的时区显示日期和时间，精确到分钟
+func formatTime(v interface{}) string {
+	return formatIn(v, "2006-01-02 15:04")
+}
+
+func formatIn(v interface{}, layout string) string {
+	var t time.Time
+	switch x := v.(type) {
+	case time.Time:
+		t = x
+	case *time.Time:
+		if x != nil {
+			t = *x
+		}
+	}
+	if t.IsZero() {
+		return ""
+	}
+	if timezone != nil {
+		t = t.In(timezone)
+	}
+	return t.Format(layout)
+}
+
+// priceText 景点票价：有结构化票价时显示“成人 ¥60 / 儿童 ¥30”这种格式，否则显示原来填写的文字
+func priceText(s Spot) string {
+	if p := s.PriceText(); p != "" {
+		return p
+	}
+	return s.Ticket
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 主题 ====================
+
+// 部署时可以在 server.theme_dir 放自己的模板和样式换掉品牌，不用改代码、重新编译：
+//
+//	templates/  同名文件覆盖内置的页面模板和邮件模板（如 layout.html、email/digest.txt），没有的仍用内置的
+//	static/     同名文件覆盖静态站点的文件
+//	assets/     样式、Logo、字体等，通过 /theme/<文件名> 访问；有 custom.css 时每个页面都会在内置样式后面引入
+//
+// 页面模板在启动时加载，改了主题里的模板要重启；assets 里的文件直接读磁盘，改了刷新页面就能看到。
+
+// themeStylesheet 主题样式的文件名
+const themeStylesheet = "custom.css"
+
+// overlayFS 先找 top 里的文件，没有的再找 base，目录的内容是两边合并的结果
+type overlayFS struct {
+	top, base fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if f, err := o.top.Open(name); err == nil {
+		if st, err := f.Stat(); err == nil && !st.IsDir() {
+			return f, nil
+		}
+		f.Close()
+	}
+	return o.base.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(o.base, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	// 主题里没有这个目录不算错
+	top, topErr := fs.ReadDir(o.top, name)
+	if topErr != nil && err != nil {
+		return nil, err
+	}
+	merged := make(map[string]fs.DirEntry, len(entries)+len(top))
+	for _, e := range entries {
+		merged[e.Name()] = e
+	}
+	for _, e := range top {
+		merged[e.Name()] = e
+	}
+	result := make([]fs.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result, nil
+}
+
+// withTheme 配置了主题时，用主题目录下的 sub 子目录覆盖 base
+func withTheme(base fs.FS, sub string) fs.FS {
+	if cfg.Server.ThemeDir == "" {
+		return base
+	}
+	return overlayFS{top: os.DirFS(filepath.Join(cfg.Server.ThemeDir, sub)), base: base}
+}
+
+// themeAssets 把主题的 assets 目录挂到 /theme/ 下，不列出目录内容
+func themeAssets(r *gin.Engine) {
+	if cfg.Server.ThemeDir == "" {
+		return
+	}
+	r.StaticFS("/theme", gin.Dir(filepath.Join(cfg.Server.ThemeDir, "assets"), false))
+}
+
+// themeCSS 主题样式的地址，带上修改时间让浏览器更新缓存；没有主题样式时返回空
+func themeCSS() string {
+	if cfg.Server.ThemeDir == "" {
+		return ""
+	}
+	st, err := os.Stat(filepath.Join(cfg.Server.ThemeDir, "assets", themeStylesheet))
+	if err != nil || st.IsDir() {
+		return ""
+	}
+	return "/theme/" + themeStylesheet + "?v=" + strconv.FormatInt(st.ModTime().Unix(), 10)
+}
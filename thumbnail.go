@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	_ "image/gif" // 注册 GIF 解码器
+	_ "image/png" // 注册 PNG 解码器
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // 注册 WebP 解码器
+)
+
+// ==================== 缩略图 ====================
+
+// 首页卡片和图集不需要原图，按配置的宽度（upload.thumb_sizes）生成 JPEG 缩略图：
+// 上传时在后台生成，没有生成过的在第一次访问时生成，之后都直接用缓存。
+// 缩略图和原图放在同一个存储里，对象名为 thumb/<宽度>/<哈希>.jpg
+
+const (
+	thumbQuality   = 82
+	thumbMaxPixels = 50_000_000 // 原图超过这么多像素不处理，防止解码时占用过多内存
+)
+
+// thumbLocks 同一张缩略图同时只生成一次
+var thumbLocks sync.Map
+
+// thumbKey 缩略图在存储中的对象名，file 是原图文件名
+func thumbKey(size int, file string) string {
+	return fmt.Sprintf("thumb/%d/%s.jpg", size, strings.TrimSuffix(file, path.Ext(file)))
+}
+
+// thumbSizeAllowed 只生成配置里的宽度，避免被请求任意尺寸占满存储
+func thumbSizeAllowed(size int) bool {
+	for _, s := range cfg.Upload.ThumbSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// makeThumbnail 把原图缩放到指定宽度（不放大），编码成 JPEG
+func makeThumbnail(src []byte, width int) ([]byte, error) {
+	conf, _, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	if conf.Width*conf.Height > thumbMaxPixels {
+		return nil, errors.New("图片尺寸过大")
+	}
+	img, _, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+
+	b := img.Bounds()
+	if b.Dx() < width {
+		width = b.Dx()
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	// JPEG 没有透明通道，透明部分填成白色
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ensureThumbnail 缩略图不存在时读取原图生成并保存
+func ensureThumbnail(ctx context.Context, size int, file string) error {
+	key := thumbKey(size, file)
+	mu, _ := thumbLocks.LoadOrStore(key, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	if ok, err := mediaStorage.Exists(ctx, key); err != nil || ok {
+		return err
+	}
+	r, err := mediaStorage.Open(ctx, file)
+	if err != nil {
+		return err
+	}
+	src, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+	thumb, err := makeThumbnail(src, size)
+	if err != nil {
+		return err
+	}
+	return mediaStorage.Put(ctx, key, thumb, "image/jpeg")
+}
+
+// generateThumbnails 上传后在后台生成所有尺寸的缩略图，失败了也没关系，访问时会再生成
+func generateThumbnails(file string) {
+	go func() {
+		for _, size := range cfg.Upload.ThumbSizes {
+			if err := ensureThumbnail(context.Background(), size, file); err != nil {
+				slog.Error("生成缩略图失败", "key", thumbKey(size, file), "err", err)
+			}
+		}
+	}()
+}
+
+// serveThumbnail 访问缩略图：GET /media/thumb/:size/:file
+func serveThumbnail(c *gin.Context) {
+	size, err := strconv.Atoi(c.Param("size"))
+	file := c.Param("file")
+	if err != nil || !thumbSizeAllowed(size) || !mediaName.MatchString(file) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	if err := ensureThumbnail(c.Request.Context(), size, file); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "生成缩略图失败", "key", thumbKey(size, file), "err", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	serveStored(c, thumbKey(size, file))
+}
+
+// thumbURL 模板用：本站上传的图片换成指定宽度的缩略图地址，外部图片原样返回
+func thumbURL(size int, src string) string {
+	file := strings.TrimPrefix(src, "/media/")
+	if file == src || !mediaName.MatchString(file) || !thumbSizeAllowed(size) {
+		return src
+	}
+	return fmt.Sprintf("/media/thumb/%d/%s", size, file)
+}
+
+// thumbSize 第 i 个配置的缩略图宽度，没有这么多时用最后一个，一个都没配置时返回0（不使用缩略图）
+func thumbSize(i int) int {
+	sizes := cfg.Upload.ThumbSizes
+	if len(sizes) == 0 {
+		return 0
+	}
+	if i >= len(sizes) {
+		i = len(sizes) - 1
+	}
+	return sizes[i]
+}
+
+// cardThumb 首页卡片用的缩略图（最小的尺寸）
+func cardThumb(src string) string { return thumbURL(thumbSize(0), src) }
+
+// galleryThumb 详情页和图集用的缩略图（第二个尺寸）
+func galleryThumb(src string) string { return thumbURL(thumbSize(1), src) }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ==================== HTTPS ====================
+
+// 不放在反向代理后面、直接对外提供服务时，可以自己处理 HTTPS：
+//
+//	证书文件  配置 server.tls.cert_file / key_file，证书续期后重启服务
+//	自动证书  配置 server.tls.autocert_domains，启动后第一次访问时向 Let's Encrypt 申请证书，
+//	          保存在 server.tls.autocert_cache 目录，到期前自动续期；这些域名必须解析到本机，80 端口能从外网访问
+//
+// 启用 HTTPS 后 server.addr 一般改成 :443，另外在 server.tls.redirect_addr（默认 :80）监听 HTTP，
+// 把所有请求重定向到 HTTPS；用自动证书时 Let's Encrypt 的 HTTP 验证请求也在这里处理。
+
+// tlsEnabled 是否配置了 HTTPS
+func tlsEnabled() bool {
+	t := cfg.Server.TLS
+	return t.CertFile != "" || len(t.AutocertDomains) > 0
+}
+
+// setupTLS 按配置给 srv 加上证书，返回 HTTP 重定向服务；没有配置 HTTPS 时什么也不做，返回 nil
+func setupTLS(srv *http.Server) (*http.Server, error) {
+	t := cfg.Server.TLS
+	var redirect http.Handler = http.HandlerFunc(redirectToHTTPS)
+	switch {
+	case t.CertFile != "":
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载证书失败：%w", err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+		slog.Info("已启用 HTTPS", "cert", t.CertFile)
+	case len(t.AutocertDomains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(t.AutocertDomains...),
+			Cache:      autocert.DirCache(t.AutocertCache),
+			Email:      t.AutocertEmail,
+		}
+		srv.TLSConfig = m.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+		// 先处理 /.well-known/acme-challenge/ 验证请求，其他的重定向
+		redirect = m.HTTPHandler(redirect)
+		slog.Info("已启用 HTTPS（自动申请证书）", "domains", t.AutocertDomains, "cache", t.AutocertCache)
+	default:
+		return nil, nil
+	}
+	if t.RedirectAddr == "" {
+		return nil, nil
+	}
+	return &http.Server{Addr: t.RedirectAddr, Handler: redirect}, nil
+}
+
+// redirectToHTTPS 把 HTTP 请求重定向到同一个地址的 HTTPS
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	// HTTPS 不在 443 端口时带上端口
+	if _, port, err := net.SplitHostPort(cfg.Server.Addr); err == nil && port != "443" && port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	// 301 会让浏览器把 POST 改成 GET，表单提交要用 308
+	status := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+}
+
+// secureCookie 通过 HTTPS 访问时 Cookie 加上 Secure，只在 HTTPS 下发送
+func secureCookie(c *gin.Context) bool {
+	return c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
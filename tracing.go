@@ -0,0 +1,447 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 链路追踪 ====================
+
+// 配置了 tracing.endpoint（或环境变量 OTEL_EXPORTER_OTLP_ENDPOINT）后，每个请求记为一个 span，
+// 请求里执行的每条 SQL 记为它的子 span，按 OpenTelemetry 的 OTLP/HTTP 协议（JSON 编码）
+// 批量上报到 <endpoint>/v1/traces，在 Jaeger、Tempo 等里面能看到一个慢请求的时间花在了处理代码还是数据库上。
+// 请求头里带了 W3C 的 traceparent 时接着上游的链路记录，并跟随上游的采样决定。
+// SQL 要用 dbFor(c) 执行才能对应到请求；后台任务里的 SQL 没有所属的请求，不记录。
+// 处理请求时记的日志会带上 trace_id，可以从日志跳到链路。
+
+const (
+	traceBatchSize     = 256             // 攒够这么多 span 就上报一次
+	traceFlushInterval = 5 * time.Second // 不够一批时最长等这么久上报
+	traceQueueSize     = 4096            // 等待上报的 span 太多（接收端不可用）时丢弃新的
+)
+
+// span 的类型和状态，取值和 OTLP 一致
+const (
+	spanKindServer = 2
+	spanKindClient = 3
+
+	spanStatusError = 2
+)
+
+// tracer 未启用链路追踪时为 nil
+var tracer *traceExporter
+
+// span 一段被追踪的操作
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // 根 span 全是 0
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	attrs    []otlpAttr
+	status   int
+	message  string
+}
+
+type spanKey struct{}
+
+// setAttr 记一个属性，值支持字符串、整数、布尔
+func (s *span) setAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	var v otlpValue
+	switch x := value.(type) {
+	case string:
+		v.String = &x
+	case int:
+		n := strconv.Itoa(x)
+		v.Int = &n
+	case int64:
+		n := strconv.FormatInt(x, 10)
+		v.Int = &n
+	case bool:
+		v.Bool = &x
+	default:
+		str := fmt.Sprint(x)
+		v.String = &str
+	}
+	s.attrs = append(s.attrs, otlpAttr{Key: key, Value: v})
+}
+
+// fail 把 span 标记为失败
+func (s *span) fail(msg string) {
+	if s == nil {
+		return
+	}
+	s.status = spanStatusError
+	s.message = msg
+}
+
+// finish 结束 span 并放进上报队列
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	tracer.enqueue(s)
+}
+
+// spanFrom 取出 context 里的 span，没有时返回 nil（span 的方法都可以在 nil 上调用）
+func spanFrom(ctx context.Context) *span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
+
+// startChildSpan 在 ctx 里的 span 下开始一个子 span；ctx 里没有 span（没启用、没被采样或不是处理请求）时返回 nil
+func startChildSpan(ctx context.Context, name string, kind int) *span {
+	parent := spanFrom(ctx)
+	if parent == nil {
+		return nil
+	}
+	s := &span{traceID: parent.traceID, parentID: parent.spanID, name: name, kind: kind, start: time.Now()}
+	rand.Read(s.spanID[:])
+	return s
+}
+
+// traceIDString trace ID 的十六进制形式，写日志用
+func (s *span) traceIDString() string {
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// ---------- 请求 ----------
+
+// tracingMiddleware 每个请求记一个 span，放进请求的 context
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s := &span{kind: spanKindServer, start: time.Now()}
+		if traceID, parentID, sampled, ok := parseTraceparent(c.GetHeader("traceparent")); ok {
+			if !sampled {
+				c.Next()
+				return
+			}
+			s.traceID, s.parentID = traceID, parentID
+		} else {
+			if mathrand.Float64() >= cfg.Tracing.SampleRatio {
+				c.Next()
+				return
+			}
+			rand.Read(s.traceID[:])
+		}
+		rand.Read(s.spanID[:])
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), spanKey{}, s))
+
+		c.Next()
+
+		// 用路由模板命名（GET /spot/:id），同一个接口的请求能归到一起
+		route := c.FullPath()
+		s.name = c.Request.Method
+		if route != "" {
+			s.name += " " + route
+			s.setAttr("http.route", route)
+		}
+		status := c.Writer.Status()
+		s.setAttr("http.request.method", c.Request.Method)
+		s.setAttr("url.path", c.Request.URL.Path)
+		s.setAttr("http.response.status_code", status)
+		s.setAttr("client.address", c.ClientIP())
+		s.setAttr("user_agent.original", c.Request.UserAgent())
+		if id := c.GetString("requestID"); id != "" {
+			s.setAttr("request_id", id)
+		}
+		if status >= 500 {
+			s.fail(http.StatusText(status))
+		}
+		s.finish()
+	}
+}
+
+// parseTraceparent 解析 W3C traceparent 请求头：00-<trace-id>-<parent-id>-<flags>
+func parseTraceparent(h string) (traceID [16]byte, parentID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(h, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return
+	}
+	if _, err := hex.Decode(parentID[:], []byte(parts[2])); err != nil || parentID == [8]byte{} {
+		return
+	}
+	return traceID, parentID, flags[0]&1 == 1, true
+}
+
+// ---------- GORM ----------
+
+// dbTracing GORM 插件：context 里有请求的 span 时，每条 SQL 记一个子 span
+type dbTracing struct{}
+
+func (dbTracing) Name() string { return "tracing" }
+
+func (dbTracing) Initialize(db *gorm.DB) error {
+	const instanceKey = "tracing:span"
+	before := func(op string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			if tracer == nil {
+				return
+			}
+			name := op
+			if tx.Statement.Table != "" {
+				name += " " + tx.Statement.Table
+			}
+			if s := startChildSpan(tx.Statement.Context, name, spanKindClient); s != nil {
+				tx.InstanceSet(instanceKey, s)
+			}
+		}
+	}
+	after := func(tx *gorm.DB) {
+		v, ok := tx.InstanceGet(instanceKey)
+		if !ok {
+			return
+		}
+		s := v.(*span)
+		s.setAttr("db.system", dbSystem(tx.Dialector.Name()))
+		s.setAttr("db.query.text", tx.Statement.SQL.String())
+		s.setAttr("db.response.returned_rows", tx.Statement.RowsAffected)
+		if err := tx.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.fail(err.Error())
+		}
+		s.finish()
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("tracing:before_create", before("insert")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", after),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", before("select")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", after),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", before("update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", after),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", before("delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", after),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dbSystem GORM 驱动名换成 OpenTelemetry 约定的数据库名
+func dbSystem(dialector string) string {
+	if dialector == "postgres" {
+		return "postgresql"
+	}
+	return dialector
+}
+
+// ---------- 上报 ----------
+
+// traceExporter 在后台把结束的 span 攒成一批，按 OTLP/HTTP 上报
+type traceExporter struct {
+	url     string
+	spans   chan *span
+	stop    chan struct{}
+	done    chan struct{}
+	client  *http.Client
+	mu      sync.Mutex
+	dropped int // 队列满了丢弃的 span 数，下一次上报时记日志
+}
+
+// startTracing 按配置启动上报，没配置 endpoint 时不启用
+func startTracing() {
+	if cfg.Tracing.Endpoint == "" {
+		return
+	}
+	tracer = &traceExporter{
+		url:    strings.TrimRight(cfg.Tracing.Endpoint, "/") + "/v1/traces",
+		spans:  make(chan *span, traceQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	go tracer.run()
+	slog.Info("已启用链路追踪", "endpoint", tracer.url, "service", cfg.Tracing.ServiceName, "sample_ratio", cfg.Tracing.SampleRatio)
+}
+
+// stopTracing 上报剩下的 span，退出前调用
+func stopTracing(ctx context.Context) {
+	if tracer == nil {
+		return
+	}
+	close(tracer.stop)
+	select {
+	case <-tracer.done:
+	case <-ctx.Done():
+		slog.Error("上报链路追踪数据超时", "err", ctx.Err())
+	}
+}
+
+func (e *traceExporter) enqueue(s *span) {
+	if e == nil {
+		return
+	}
+	select {
+	case e.spans <- s:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+func (e *traceExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+	var batch []*span
+	for {
+		select {
+		case s := <-e.spans:
+			batch = append(batch, s)
+			if len(batch) >= traceBatchSize {
+				e.export(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			e.export(batch)
+			batch = nil
+		case <-e.stop:
+			for {
+				select {
+				case s := <-e.spans:
+					batch = append(batch, s)
+				default:
+					e.export(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// export 上报一批 span，失败只记日志，不重试
+func (e *traceExporter) export(batch []*span) {
+	e.mu.Lock()
+	dropped := e.dropped
+	e.dropped = 0
+	e.mu.Unlock()
+	if dropped > 0 {
+		slog.Warn("链路追踪队列已满，丢弃了部分 span", "dropped", dropped)
+	}
+	if len(batch) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(otlpRequest(batch))
+	if err != nil {
+		slog.Error("生成链路追踪数据失败", "err", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("上报链路追踪数据失败", "err", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range cfg.Tracing.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		slog.Warn("上报链路追踪数据失败", "spans", len(batch), "err", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		slog.Warn("上报链路追踪数据失败", "spans", len(batch), "status", resp.Status)
+	}
+}
+
+// ---------- OTLP JSON ----------
+
+// 下面的结构对应 OTLP 的 ExportTraceServiceRequest，按 protobuf 的 JSON 映射编码：
+// trace ID 和 span ID 用十六进制，64 位整数用字符串
+
+type otlpValue struct {
+	String *string `json:"stringValue,omitempty"`
+	Int    *string `json:"intValue,omitempty"`
+	Bool   *bool   `json:"boolValue,omitempty"`
+}
+
+type otlpAttr struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []otlpAttr `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+// otlpRequest 把一批 span 包装成上报请求
+func otlpRequest(batch []*span) gin.H {
+	spans := make([]otlpSpan, len(batch))
+	for i, s := range batch {
+		o := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        s.attrs,
+		}
+		if s.parentID != [8]byte{} {
+			o.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		o.Status.Code = s.status
+		o.Status.Message = s.message
+		spans[i] = o
+	}
+	service := cfg.Tracing.ServiceName
+	return gin.H{"resourceSpans": []gin.H{{
+		"resource": gin.H{"attributes": []otlpAttr{{Key: "service.name", Value: otlpValue{String: &service}}}},
+		"scopeSpans": []gin.H{{
+			"scope": gin.H{"name": "tourist-spots"},
+			"spans": spans,
+		}},
+	}}}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// ==================== 景点内容翻译 ====================
+
+// 界面文字见 i18n.go，这里是景点自己的名称和描述：每个景点每种语言（默认语言以外）可以有一份翻译，
+// 页面和 API 按当前语言（?lang=、Cookie、Accept-Language）把名称和描述换成译文，没有翻译或者译文留空的字段显示原文。
+// 管理员在页面上看到的总是原文，编辑表单里不会混进译文；翻译在详情页下方管理，也可以通过 API 修改。
+// 搜索、排序和 slug 都只按原文。
+
+// SpotTranslation 景点名称和描述的一种语言的翻译
+type SpotTranslation struct {
+	ID          uint      `gorm:"primaryKey" json:"-"`
+	SpotID      uint      `gorm:"uniqueIndex:idx_spot_translation" json:"-"`
+	Locale      string    `gorm:"uniqueIndex:idx_spot_translation;size:10" json:"locale"` // 语言代码，和 locales 目录下的文件名一致
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+const (
+	maxTranslatedNameLen        = 100
+	maxTranslatedDescriptionLen = 10000
+)
+
+var errBadTranslation = errors.New("bad translation")
+
+// spotTranslations 景点的全部翻译，按语言排序
+func spotTranslations(spotID uint) []SpotTranslation {
+	var rows []SpotTranslation
+	db.Where("spot_id = ?", spotID).Order("locale").Find(&rows)
+	return rows
+}
+
+// translationsByLocale 景点的全部翻译，键是语言代码
+func translationsByLocale(spotID uint) map[string]SpotTranslation {
+	m := map[string]SpotTranslation{}
+	for _, t := range spotTranslations(spotID) {
+		m[t.Locale] = t
+	}
+	return m
+}
+
+// translationLocales 可以翻译成的语言：默认语言以外有语言文件的
+func translationLocales() []localeOption {
+	var options []localeOption
+	for _, o := range localeOptions() {
+		if o.Code != cfg.Locale {
+			options = append(options, o)
+		}
+	}
+	return options
+}
+
+// localizeSpots 把景点的名称和描述换成当前语言的翻译；当前是默认语言或者管理员浏览页面时不换
+func localizeSpots(c *gin.Context, spots []Spot) {
+	locale := currentLocale(c)
+	if locale == cfg.Locale || len(spots) == 0 {
+		return
+	}
+	if currentUser(c).IsAdmin() && !isAPIPath(c) {
+		return
+	}
+	ids := make([]uint, len(spots))
+	for i := range spots {
+		ids[i] = spots[i].ID
+	}
+	var rows []SpotTranslation
+	dbFor(c).Where("locale = ? AND spot_id IN ?", locale, ids).Find(&rows)
+	if len(rows) == 0 {
+		return
+	}
+	byID := make(map[uint]SpotTranslation, len(rows))
+	for _, t := range rows {
+		byID[t.SpotID] = t
+	}
+	for i := range spots {
+		t, ok := byID[spots[i].ID]
+		if !ok {
+			continue
+		}
+		if t.Name != "" {
+			spots[i].Name = t.Name
+		}
+		if t.Description != "" {
+			spots[i].Description = t.Description
+		}
+		spots[i].Locale = locale
+	}
+}
+
+// localizeSpot 同 localizeSpots，只有一个景点
+func localizeSpot(c *gin.Context, spot *Spot) {
+	spots := []Spot{*spot}
+	localizeSpots(c, spots)
+	*spot = spots[0]
+}
+
+// saveTranslation 新增或覆盖景点的一种语言的翻译，名称和描述都为空时删除
+func saveTranslation(c *gin.Context, spot *Spot, locale, name, description string) error {
+	name, description = sanitizeText(name), sanitizeText(description)
+	if locale == cfg.Locale || catalogs[locale] == nil ||
+		utf8.RuneCountInString(name) > maxTranslatedNameLen ||
+		utf8.RuneCountInString(description) > maxTranslatedDescriptionLen {
+		return errBadTranslation
+	}
+	if name == "" && description == "" {
+		return deleteTranslation(c, spot, locale)
+	}
+	before := spotTranslations(spot.ID)
+	t := SpotTranslation{SpotID: spot.ID, Locale: locale, Name: name, Description: description}
+	err := dbFor(c).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "spot_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+	}).Create(&t).Error
+	if err != nil {
+		return err
+	}
+	recordAudit(c, auditUpdate, spot.ID, gin.H{"translations": before}, gin.H{"translations": spotTranslations(spot.ID)})
+	return nil
+}
+
+// deleteTranslation 删除景点的一种语言的翻译，没有这个翻译时什么也不做
+func deleteTranslation(c *gin.Context, spot *Spot, locale string) error {
+	before := spotTranslations(spot.ID)
+	result := dbFor(c).Where("spot_id = ? AND locale = ?", spot.ID, locale).Delete(&SpotTranslation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		recordAudit(c, auditUpdate, spot.ID, gin.H{"translations": before}, gin.H{"translations": spotTranslations(spot.ID)})
+	}
+	return nil
+}
+
+// ---------- 管理页面（详情页下方） ----------
+
+// saveSpotTranslation 保存翻译：POST /admin/spot/:id/translations
+func saveSpotTranslation(c *gin.Context) {
+	spot, ok := gallerySpot(c)
+	if !ok {
+		return
+	}
+	err := saveTranslation(c, spot, c.PostForm("locale"), c.PostForm("name"), c.PostForm("description"))
+	if errors.Is(err, errBadTranslation) {
+		c.String(http.StatusBadRequest, tr(c, "error.translation_invalid", maxTranslatedNameLen, maxTranslatedDescriptionLen))
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	backToSpot(c, spot)
+}
+
+// deleteSpotTranslation 删除翻译：POST /admin/spot/:id/translations/:locale/delete
+func deleteSpotTranslation(c *gin.Context) {
+	spot, ok := gallerySpot(c)
+	if !ok {
+		return
+	}
+	if err := deleteTranslation(c, spot, c.Param("locale")); err != nil {
+		c.String(http.StatusInternalServerError, tr(c, "error.delete_failed"))
+		return
+	}
+	backToSpot(c, spot)
+}
+
+// ---------- API ----------
+
+// apiTranslationSpot 取出 :id 对应的景点（包括未发布的，只有管理员能改翻译）
+func apiTranslationSpot(c *gin.Context) (*Spot, bool) {
+	var spot Spot
+	if err := dbFor(c).First(&spot, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return nil, false
+	}
+	return &spot, true
+}
+
+// apiListTranslations GET /api/v1/spots/:id/translations
+func apiListTranslations(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).Scopes(published).First(&spot, c.Param("id")).Error; err != nil {
+		apiError(c, http.StatusNotFound, tr(c, "error.spot_not_found"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"locale": cfg.Locale, "translations": spotTranslations(spot.ID)})
+}
+
+// apiPutTranslation PUT /api/v1/spots/:id/translations/:locale
+// 请求体 {"name": "West Lake", "description": "..."}，整个替换这种语言的翻译，两个字段都为空时删除
+func apiPutTranslation(c *gin.Context) {
+	spot, ok := apiTranslationSpot(c)
+	if !ok {
+		return
+	}
+	var in struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&in); err != nil {
+		apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+		return
+	}
+	err := saveTranslation(c, spot, c.Param("locale"), in.Name, in.Description)
+	if errors.Is(err, errBadTranslation) {
+		apiError(c, http.StatusBadRequest, tr(c, "error.translation_invalid_api"))
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.save_failed"))
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"locale": cfg.Locale, "translations": spotTranslations(spot.ID)})
+}
+
+// apiDeleteTranslation DELETE /api/v1/spots/:id/translations/:locale
+func apiDeleteTranslation(c *gin.Context) {
+	spot, ok := apiTranslationSpot(c)
+	if !ok {
+		return
+	}
+	if err := deleteTranslation(c, spot, c.Param("locale")); err != nil {
+		apiError(c, http.StatusInternalServerError, tr(c, "error.delete_failed"))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
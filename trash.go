@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 回收站 ====================
+
+// 删除景点只是软删除，回收站里可以恢复或彻底删除，
+// 超过保留天数（trash.retention_days）的会被后台定期彻底删除
+
+// purgeSpots 彻底删除景点及其推荐记录、历史版本、图集
+func purgeSpots(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&Recommendation{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&SpotRevision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&SpotImage{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&SpotTranslation{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&SpotTag{}).Error; err != nil {
+		return err
+	}
+	// 对景点和它的评论的举报，要在删除评论之前
+	comments := tx.Model(&Comment{}).Select("id").Where("spot_id IN ?", ids)
+	if err := tx.Where("(target_type = ? AND target_id IN ?) OR (target_type = ? AND target_id IN (?))",
+		ReportSpot, ids, ReportComment, comments).Delete(&Report{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&Comment{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&Rating{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&Favorite{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&ItineraryStop{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ?", ids).Delete(&CheckIn{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("spot_id IN ? OR other_id IN ?", ids, ids).Delete(&SpotSimilarity{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&Spot{}).Error
+}
+
+// purgeExpiredSpots 彻底删除回收站里超过保留天数的景点，返回删除的数量
+func purgeExpiredSpots() (int, error) {
+	cutoff := time.Now().AddDate(0, 0, -cfg.Trash.RetentionDays)
+	var spots []Spot
+	if err := db.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).Find(&spots).Error; err != nil {
+		return 0, err
+	}
+	ids := make([]uint, len(spots))
+	for i, spot := range spots {
+		ids[i] = spot.ID
+	}
+	err := retryTransaction(db, func(tx *gorm.DB) error {
+		return purgeSpots(tx, ids)
+	})
+	if err == nil {
+		// 自动清理没有操作人，记为 system
+		for _, spot := range spots {
+			writeAudit(AuditEntry{Actor: "system", Action: auditPurge, SpotID: spot.ID}, spot, nil)
+		}
+	}
+	return len(spots), err
+}
+
+// trashPurgeJob 定时任务：每小时清理一次回收站，保留天数为0时不自动清理
+func trashPurgeJob() *scheduledJob {
+	j := &scheduledJob{
+		Name:     "trash",
+		Title:    "job.purge_trash",
+		Interval: time.Hour,
+		Run: func() (string, error) {
+			n, err := purgeExpiredSpots()
+			if err != nil || n == 0 {
+				return "", err
+			}
+			return fmt.Sprintf("从回收站彻底删除 %d 个景点", n), nil
+		},
+	}
+	if cfg.Trash.RetentionDays <= 0 {
+		j.Disabled = "job.disabled.trash_retention"
+	}
+	return j
+}
+
+// ---------- 页面 ----------
+
+// showTrash 回收站列表：GET /admin/trash
+func showTrash(c *gin.Context) {
+	var spots []Spot
+	dbFor(c).Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at desc").Find(&spots)
+	render(c, http.StatusOK, "trash.html", gin.H{
+		"title":         tr(c, "nav.admin.trash"),
+		"spots":         spots,
+		"retentionDays": cfg.Trash.RetentionDays,
+	})
+}
+
+// restoreSpot 恢复景点：POST /admin/restore/:id
+func restoreSpot(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", c.Param("id")).First(&spot).Error; err == nil {
+		dbFor(c).Unscoped().Model(&spot).Update("deleted_at", nil)
+		updateSpotTagCounts(spot.ID)
+		recordAudit(c, auditRestore, spot.ID, nil, spot)
+	}
+	c.Redirect(http.StatusFound, "/admin/trash")
+}
+
+// purgeSpot 彻底删除：POST /admin/purge/:id，只能删除已经在回收站里的景点
+func purgeSpot(c *gin.Context) {
+	var spot Spot
+	if err := dbFor(c).Unscoped().Where("id = ? AND deleted_at IS NOT NULL", c.Param("id")).First(&spot).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.trash_not_found"))
+		return
+	}
+	err := retryTransaction(dbFor(c), func(tx *gorm.DB) error {
+		return purgeSpots(tx, []uint{spot.ID})
+	})
+	if err == nil {
+		recordAudit(c, auditPurge, spot.ID, spot, nil)
+	}
+	c.Redirect(http.StatusFound, "/admin/trash")
+}
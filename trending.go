@@ -0,0 +1,104 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 热门趋势 ====================
+
+// 推荐次数是累计的，老景点会一直排在前面。/trending 只看最近 trending.window（默认 7 天）内的推荐，
+// 每次推荐按时间衰减计分：刚刚的推荐记 1 分，每过 trending.half_life（默认 48 小时）分数减半，
+// 分数相加后从高到低排列。推荐记录（recommendations 表）本来就带时间，撤销推荐时记录会删掉，不再计分。
+// 衰减在 Go 里计算，不依赖数据库的数学函数，窗口内的推荐数量不大。
+
+// trendingSpot 热门景点和它的分数
+type trendingSpot struct {
+	Spot
+	Rank   int     `json:"rank"`           // 名次，从 1 开始
+	Score  float64 `json:"trending_score"` // 衰减后的分数
+	Recent int     `json:"recent_count"`   // 窗口内的推荐次数
+}
+
+// trendingSpots 按衰减后的分数排列的热门景点，最多 limit 个
+func trendingSpots(now time.Time, limit int) []trendingSpot {
+	var events []Recommendation
+	db.Select("spot_id", "created_at").
+		Where("created_at > ?", now.Add(-cfg.Trending.Window)).Find(&events)
+
+	scores := map[uint]*trendingSpot{}
+	halfLife := cfg.Trending.HalfLife.Hours()
+	for _, e := range events {
+		t := scores[e.SpotID]
+		if t == nil {
+			t = &trendingSpot{}
+			scores[e.SpotID] = t
+		}
+		age := now.Sub(e.CreatedAt).Hours()
+		if age < 0 {
+			age = 0
+		}
+		t.Score += math.Pow(0.5, age/halfLife)
+		t.Recent++
+	}
+	if len(scores) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(scores))
+	for id := range scores {
+		ids = append(ids, id)
+	}
+	var spots []Spot
+	db.Scopes(published).Preload("Tags").Where("id IN ?", ids).Find(&spots)
+
+	list := make([]trendingSpot, 0, len(spots))
+	for _, s := range spots {
+		t := scores[s.ID]
+		list = append(list, trendingSpot{Spot: s, Score: math.Round(t.Score*1000) / 1000, Recent: t.Recent})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].ID < list[j].ID
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	for i := range list {
+		list[i].Rank = i + 1
+	}
+	return list
+}
+
+// showTrending 热门趋势：GET /trending，用 fetch 调用时返回 JSON
+func showTrending(c *gin.Context) {
+	list := trendingSpots(time.Now(), cfg.Trending.Limit)
+	if wantsJSON(c) {
+		apiTrendingResponse(c, list)
+		return
+	}
+	render(c, http.StatusOK, "trending.html", gin.H{
+		"title":       tr(c, "nav.trending"),
+		"spots":       list,
+		"windowDays":  int(cfg.Trending.Window.Hours() / 24),
+		"recommended": recommendedSpotIDs(c),
+	})
+}
+
+// apiTrendingSpots GET /api/v1/spots/trending
+func apiTrendingSpots(c *gin.Context) {
+	apiTrendingResponse(c, trendingSpots(time.Now(), cfg.Trending.Limit))
+}
+
+func apiTrendingResponse(c *gin.Context, list []trendingSpot) {
+	if list == nil {
+		list = []trendingSpot{}
+	}
+	c.JSON(http.StatusOK, gin.H{"spots": list})
+}
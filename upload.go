@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ==================== 本地图片上传 ====================
+
+// 添加/编辑景点时可以直接上传图片，代替手动填写图片URL。
+// 文件按内容的 SHA-256 命名，同一张图片只存一份，通过 /media/<文件名> 访问，
+// 保存在哪里见 storage.go
+
+// uploadTypes 允许上传的图片类型 → 扩展名
+// 类型按文件内容判断，不相信浏览器传来的 Content-Type 和文件名
+var uploadTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// mediaName 上传文件名的格式，/media 只提供符合格式的文件
+var mediaName = regexp.MustCompile(`^[0-9a-f]{32}\.(jpg|png|gif|webp)$`)
+
+var (
+	errUploadTooLarge = errors.New("图片太大")
+	errUploadType     = errors.New("只支持 JPG、PNG、GIF、WebP 格式的图片")
+	errUploadStore    = errors.New("保存图片失败，请稍后再试")
+)
+
+// saveUpload 校验上传的图片并交给 mediaStorage 保存，返回访问地址 /media/<hash>.<ext>
+func saveUpload(c *gin.Context, fh *multipart.FileHeader) (string, error) {
+	maxSize := int64(cfg.Upload.MaxSizeMB) << 20
+	if fh.Size > maxSize {
+		return "", fmt.Errorf("%w，不能超过 %dMB", errUploadTooLarge, cfg.Upload.MaxSizeMB)
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// 多读一个字节，防止 Size 与实际内容不符
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return "", err
+	}
+	if int64(len(data)) > maxSize {
+		return "", fmt.Errorf("%w，不能超过 %dMB", errUploadTooLarge, cfg.Upload.MaxSizeMB)
+	}
+	contentType := http.DetectContentType(data)
+	ext, ok := uploadTypes[contentType]
+	if !ok {
+		return "", errUploadType
+	}
+
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:16]) + ext
+	ctx := c.Request.Context()
+	// 同样的图片已经上传过就不再重复保存
+	exists, err := mediaStorage.Exists(ctx, name)
+	if err == nil && !exists {
+		err = mediaStorage.Put(ctx, name, data, contentType)
+	}
+	if err != nil {
+		// 存储的错误信息里有内部地址，只写日志
+		slog.ErrorContext(c.Request.Context(), "保存图片失败", "err", err)
+		return "", errUploadStore
+	}
+	if !exists {
+		generateThumbnails(name)
+	}
+	return "/media/" + name, nil
+}
+
+// formUpload 处理表单里的 image 文件字段，没有选择文件时返回空字符串
+func formUpload(c *gin.Context) (string, error) {
+	fh, err := c.FormFile("image")
+	if errors.Is(err, http.ErrMissingFile) || errors.Is(err, http.ErrNotMultipart) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return saveUpload(c, fh)
+}
+
+// serveMedia 访问上传的图片：GET /media/:file
+func serveMedia(c *gin.Context) {
+	name := c.Param("file")
+	if !mediaName.MatchString(name) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	serveStored(c, name)
+}
+
+// serveStored 返回存储中的文件
+// 本地存储直接返回文件，文件名就是内容哈希，内容不会变，可以让浏览器长期缓存；
+// 对象存储跳转到存储的地址，签名地址只缓存有效期的一半
+func serveStored(c *gin.Context, key string) {
+	if local, ok := mediaStorage.(*localStorage); ok {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.File(local.path(key))
+		return
+	}
+
+	ttl := cfg.Storage.SignedURLTTL
+	u, err := mediaStorage.URL(key, ttl)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if ttl > 0 {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", int(ttl.Seconds()/2)))
+	} else {
+		c.Header("Cache-Control", "public, max-age=86400")
+	}
+	c.Redirect(http.StatusFound, u)
+}
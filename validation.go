@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
+)
+
+// ==================== 表单校验 ====================
+
+// spotInput 新增/修改景点时提交的字段（API 用 JSON，表单用 form）
+// binding 标签由 gin 内置的 validator 校验：
+// notblank 不能为空（只有空格也不行），max 按字符数计算，imageurl 必须是完整的 http(s) 地址或本站上传的图片
+type spotInput struct {
+	Name        string  `json:"name" form:"name" binding:"notblank,max=100"`
+	Description string  `json:"description" form:"description" binding:"max=10000"`
+	Ticket      string  `json:"ticket" form:"ticket" binding:"max=100"` // 票价说明
+	Transport   string  `json:"transport" form:"transport" binding:"max=200"`
+	Province    string  `json:"province" form:"province" binding:"max=20"`
+	City        string  `json:"city" form:"city" binding:"max=30"`
+	Tags        tagList `json:"tags" form:"tags" binding:"tags"`
+	ImageURL    string  `json:"image_url" form:"imageurl" binding:"omitempty,imageurl,max=500"`
+	// 结构化票价，都可以不填；is_free 在表单里是值为 true 的复选框
+	AdultPrice optionalFloat `json:"adult_price" form:"adult_price" binding:"omitempty,price"`
+	ChildPrice optionalFloat `json:"child_price" form:"child_price" binding:"omitempty,price"`
+	IsFree     *bool         `json:"is_free" form:"is_free"`
+	// 开放时间文本，格式见 hours.go
+	OpeningHours hoursText `json:"opening_hours" form:"opening_hours" binding:"max=2000,hours"`
+	// 最佳游览月份（1~12），表单里是多个复选框；JSON 不传时不修改
+	BestMonths []int `json:"best_months" form:"best_months" binding:"months"`
+	// 经纬度可以不填；lat/lng 检查取值范围
+	Latitude  optionalFloat `json:"latitude" form:"latitude" binding:"omitempty,lat"`
+	Longitude optionalFloat `json:"longitude" form:"longitude" binding:"omitempty,lng"`
+}
+
+// optionalFloat 可以不填的小数：表单里的空字符串、JSON 里的 null 或不传都表示没有填写
+// （直接用 *float64 的话，gin 会把表单里的空字符串绑定成 0）
+type optionalFloat struct {
+	Value float64
+	Valid bool
+}
+
+// UnmarshalParam 绑定表单字段
+func (f *optionalFloat) UnmarshalParam(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		*f = optionalFloat{}
+		return nil
+	}
+	// 不是数字时记为 NaN，交给 lat/lng 校验报告具体是哪个字段填错了
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v = math.NaN()
+	}
+	*f = optionalFloat{Value: v, Valid: true}
+	return nil
+}
+
+// UnmarshalJSON 绑定 JSON 字段
+func (f *optionalFloat) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*f = optionalFloat{}
+		return nil
+	}
+	if err := json.Unmarshal(b, &f.Value); err != nil {
+		return err
+	}
+	f.Valid = true
+	return nil
+}
+
+// ptr 转成模型里用的 *float64，没有填写时为 nil
+func (f optionalFloat) ptr() *float64 {
+	if !f.Valid {
+		return nil
+	}
+	v := f.Value
+	return &v
+}
+
+// isFree 没有提交 is_free 时当作不是免费景点
+func (in *spotInput) isFree() bool {
+	return in.IsFree != nil && *in.IsFree
+}
+
+// openingHours 解析开放时间，没有填写时为 nil（已经通过校验，不会出错）
+func (in *spotInput) openingHours() *OpeningHours {
+	h, _ := parseOpeningHours(string(in.OpeningHours))
+	return h
+}
+
+// spot 转换成模型，所有字段都经过清洗（去掉 HTML 标签和首尾空白）
+// 描述是 Markdown 原文，显示时再渲染（见 markdown.go）
+func (in *spotInput) spot() Spot {
+	return Spot{
+		Name:         sanitizeText(in.Name),
+		Description:  sanitizeText(in.Description),
+		Ticket:       sanitizeText(in.Ticket),
+		Transport:    sanitizeText(in.Transport),
+		Province:     sanitizeText(in.Province),
+		City:         sanitizeText(in.City),
+		ImageURL:     sanitizeURL(in.ImageURL),
+		AdultPrice:   in.AdultPrice.ptr(),
+		ChildPrice:   in.ChildPrice.ptr(),
+		IsFree:       in.isFree(),
+		OpeningHours: in.openingHours(),
+		BestMonths:   newMonthSet(in.BestMonths),
+		Latitude:     in.Latitude.ptr(),
+		Longitude:    in.Longitude.ptr(),
+	}
+}
+
+// fieldLabels 错误提示中显示的字段名称
+var fieldLabels = map[string]string{
+	"Name":         "景点名称",
+	"Description":  "景点描述",
+	"Ticket":       "票价说明",
+	"AdultPrice":   "成人票价",
+	"ChildPrice":   "儿童票价",
+	"OpeningHours": "开放时间",
+	"BestMonths":   "最佳季节",
+	"Transport":    "交通方式",
+	"Province":     "省份",
+	"City":         "城市",
+	"Tags":         "标签",
+	"ImageURL":     "图片URL",
+	"Latitude":     "纬度",
+	"Longitude":    "经度",
+}
+
+// initValidation 注册自定义校验规则
+func initValidation() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("notblank", validators.NotBlank)
+		v.RegisterValidation("imageurl", func(fl validator.FieldLevel) bool {
+			return sanitizeURL(fl.Field().String()) != ""
+		})
+		v.RegisterValidation("tags", func(fl validator.FieldLevel) bool {
+			return validTags(fl.Field().Interface().(tagList))
+		})
+		// 校验时把 optionalFloat 当成 float64，没有填写时当成 nil（omitempty 会跳过）
+		v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+			if f := field.Interface().(optionalFloat); f.Valid {
+				return f.Value
+			}
+			return nil
+		}, optionalFloat{})
+		v.RegisterValidation("price", func(fl validator.FieldLevel) bool {
+			return fl.Field().Float() >= 0 && fl.Field().Float() <= maxPrice
+		})
+		v.RegisterValidation("hours", func(fl validator.FieldLevel) bool {
+			_, err := parseOpeningHours(fl.Field().String())
+			return err == nil
+		})
+		v.RegisterValidation("months", func(fl validator.FieldLevel) bool {
+			return validMonths(fl.Field().Interface().([]int))
+		})
+		v.RegisterValidation("lat", func(fl validator.FieldLevel) bool {
+			return fl.Field().Float() >= -90 && fl.Field().Float() <= 90
+		})
+		v.RegisterValidation("lng", func(fl validator.FieldLevel) bool {
+			return fl.Field().Float() >= -180 && fl.Field().Float() <= 180
+		})
+	}
+}
+
+// fieldErrors 把校验错误转换成 字段名 → 中文提示，不是校验错误时（如 JSON 格式错）返回 nil
+func fieldErrors(err error) map[string]string {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil
+	}
+	errs := make(map[string]string, len(verrs))
+	for _, fe := range verrs {
+		label := fieldLabels[fe.Field()]
+		if label == "" {
+			label = fe.Field()
+		}
+		switch fe.Tag() {
+		case "required", "notblank":
+			errs[fe.Field()] = label + "不能为空"
+		case "max":
+			errs[fe.Field()] = fmt.Sprintf("%s不能超过%s个字符", label, fe.Param())
+		case "url", "imageurl":
+			errs[fe.Field()] = label + "格式不正确，需以 http:// 或 https:// 开头"
+		case "lat":
+			errs[fe.Field()] = label + "必须在 -90 到 90 之间"
+		case "lng":
+			errs[fe.Field()] = label + "必须在 -180 到 180 之间"
+		case "months":
+			errs[fe.Field()] = label + "只能选择 1 到 12 月"
+		case "price":
+			errs[fe.Field()] = fmt.Sprintf("%s必须是 0 到 %d 之间的数字", label, maxPrice)
+		case "hours":
+			_, err := parseOpeningHours(string(fe.Value().(hoursText)))
+			errs[fe.Field()] = label + "格式不正确：" + err.Error()
+		case "tags":
+			errs[fe.Field()] = fmt.Sprintf("最多%d个标签，每个不超过%d个字符", maxSpotTags, maxTagLength)
+		default:
+			errs[fe.Field()] = label + "格式不正确"
+		}
+	}
+	return errs
+}
+
+// saveClearableFields 表单修改景点时整体覆盖可以清空的字段（价格、开放时间、最佳季节）
+// updateSpotWithRevision 会跳过空值，清空这些字段或取消“免费”只能单独写
+func saveClearableFields(spot *Spot, in *spotInput) error {
+	return db.Model(spot).Select("AdultPrice", "ChildPrice", "IsFree", "OpeningHours", "BestMonths").Updates(Spot{
+		AdultPrice:   in.AdultPrice.ptr(),
+		ChildPrice:   in.ChildPrice.ptr(),
+		IsFree:       in.isFree(),
+		OpeningHours: in.openingHours(),
+		BestMonths:   newMonthSet(in.BestMonths),
+	}).Error
+}
+
+// bindSpotForm 绑定并校验页面表单，失败时带着错误信息重新渲染首页（打开对应的弹窗），返回 false
+// mode 为 "add" 或 "edit"，决定模板中打开哪个弹窗
+// 表单里上传了图片时，保存图片并用它的地址代替填写的图片URL
+// 未登录访客还要通过验证码（见 captcha.go），在保存图片之前校验
+func bindSpotForm(c *gin.Context, in *spotInput, mode string, extra gin.H) bool {
+	var errs map[string]string
+	if err := c.ShouldBindWith(in, binding.Form); err != nil {
+		errs = fieldErrors(err)
+		if errs == nil {
+			errs = map[string]string{"": "表单格式错误"}
+		}
+	} else if err := verifyCaptcha(c); errors.Is(err, errCaptcha) {
+		errs = map[string]string{"Captcha": "验证码错误或已过期，请重新填写"}
+	} else if err != nil {
+		slog.ErrorContext(c.Request.Context(), "验证码校验失败", "err", err)
+		errs = map[string]string{"Captcha": "验证码服务暂时不可用，请稍后再试"}
+	} else if url, err := formUpload(c); err != nil {
+		errs = map[string]string{"ImageURL": "图片上传失败：" + err.Error()}
+	} else if url != "" {
+		in.ImageURL = url
+	}
+	if errs == nil {
+		return true
+	}
+
+	var spots []Spot
+	dbFor(c).Scopes(published).Preload("Tags").Order("recommend_count desc, id asc").Find(&spots)
+	data := gin.H{
+		"spots":         spots,
+		"recommended":   recommendedSpotIDs(c),
+		"favorited":     favoriteSpotIDs(c),
+		mode + "Errors": errs,
+		mode + "Form":   in,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	render(c, http.StatusBadRequest, "index.html", data)
+	return false
+}
+
+// validateSpotInput 校验不是从请求绑定来的 spotInput（GraphQL、gRPC），规则和 REST 接口一样，
+// 不通过时把各字段的提示合成一句
+func validateSpotInput(in *spotInput) error {
+	err := binding.Validator.ValidateStruct(in)
+	if err == nil {
+		return nil
+	}
+	errs := fieldErrors(err)
+	if errs == nil {
+		return errors.New("参数格式错误")
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, msg := range errs {
+		msgs = append(msgs, msg)
+	}
+	sort.Strings(msgs)
+	return errors.New("参数校验失败：" + strings.Join(msgs, "；"))
+}
+
+// bindSpotJSON 绑定并校验 API 请求体，失败时直接返回 400 和字段错误
+func bindSpotJSON(c *gin.Context, in *spotInput) bool {
+	err := c.ShouldBindJSON(in)
+	if err == nil {
+		return true
+	}
+	if errs := fieldErrors(err); errs != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "参数校验失败", "fields": errs, "request_id": c.GetString("requestID")})
+		return false
+	}
+	apiError(c, http.StatusBadRequest, tr(c, "error.bad_format"))
+	return false
+}
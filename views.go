@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== 浏览次数 ====================
+
+// 详情页每打开一次浏览次数 +1。为了不在每个请求里写数据库，先记在内存里，
+// 后台每隔 views.flush_interval 把攒下的次数一次性加到 spots.view_count；退出时也会写一次。
+// 程序异常退出会丢掉最后一段时间的计数，浏览次数不需要那么精确。
+// 详情页显示的是数据库里的次数加上还没写入的次数。搜索引擎等爬虫的访问不计数。
+
+// viewCounter 还没写入数据库的浏览次数
+type viewCounter struct {
+	mu      sync.Mutex
+	pending map[uint]int64
+}
+
+var spotViews = &viewCounter{pending: map[uint]int64{}}
+
+// add 记一次浏览
+func (v *viewCounter) add(spotID uint) {
+	v.mu.Lock()
+	v.pending[spotID]++
+	v.mu.Unlock()
+}
+
+// get 还没写入的次数
+func (v *viewCounter) get(spotID uint) int64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.pending[spotID]
+}
+
+// flush 把攒下的次数写入数据库，写入失败的次数放回去，下次再写
+func (v *viewCounter) flush() {
+	v.mu.Lock()
+	pending := v.pending
+	v.pending = map[uint]int64{}
+	v.mu.Unlock()
+	if len(pending) == 0 {
+		return
+	}
+
+	err := retryTransaction(db, func(tx *gorm.DB) error {
+		for id, n := range pending {
+			if err := tx.Exec("UPDATE spots SET view_count = view_count + ? WHERE id = ?", n, id).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("保存浏览次数失败", "err", err)
+		v.mu.Lock()
+		for id, n := range pending {
+			v.pending[id] += n
+		}
+		v.mu.Unlock()
+	}
+}
+
+// startViewFlusher 后台定期写入浏览次数，退出时剩下的由 main 最后写一次
+func startViewFlusher() {
+	goBackground(func(ctx context.Context) {
+		for sleepCtx(ctx, cfg.Views.FlushInterval) {
+			holdDB(spotViews.flush)
+		}
+	})
+}
+
+// botMarkers User-Agent 里包含这些词时当作爬虫
+var botMarkers = []string{"bot", "spider", "crawl", "slurp", "curl", "wget", "python-requests"}
+
+// isBot 是否是爬虫或脚本的请求
+func isBot(c *gin.Context) bool {
+	ua := strings.ToLower(c.GetHeader("User-Agent"))
+	if ua == "" {
+		return true
+	}
+	for _, m := range botMarkers {
+		if strings.Contains(ua, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// countView 详情页记一次浏览，返回包括这一次在内的浏览次数
+func countView(c *gin.Context, spot *Spot) int64 {
+	if !isBot(c) {
+		spotViews.add(spot.ID)
+	}
+	return spot.ViewCount + spotViews.get(spot.ID)
+}
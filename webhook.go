@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ==================== Webhook ====================
+
+// 管理员在 /admin/webhooks 登记接收地址和要订阅的事件，景点发生变化时向这些地址 POST 一个 JSON：
+//
+//	{"event": "spot.updated", "action": "update", "occurred_at": "2024-05-01T10:00:00+08:00", "spot": {...}}
+//
+// 事件在写操作日志时触发（见 audit.go），所以页面、API、导入等所有入口都会推送。
+// 投递先写入 webhook_deliveries，再由后台任务发送；失败（超时或非 2xx）后按 30s、1m、2m……重试，
+// 最多 webhook.max_attempts 次。每次投递都记在投递日志里，管理员可以查看和手动重发。
+//
+// 请求头 X-Webhook-Signature 是 "sha256=" 加上用密钥对 "<X-Webhook-Timestamp>.<请求体>" 做的 HMAC-SHA256，
+// 接收方用同样的方法计算并比较，同时检查时间戳，防止伪造和重放。
+
+// 事件类型
+const (
+	eventSpotCreated        = "spot.created"
+	eventSpotUpdated        = "spot.updated"
+	eventSpotDeleted        = "spot.deleted"
+	eventRecommendThreshold = "recommend.threshold"
+	eventPing               = "ping" // 管理页面上“发送测试”，不需要订阅
+)
+
+// webhookEvents 可以订阅的事件，顺序即页面上复选框的顺序；Label 是 locales/ 里的键
+var webhookEvents = []struct{ Event, Label string }{
+	{eventSpotCreated, "webhook.event.spot_created"},
+	{eventSpotUpdated, "webhook.event.spot_updated"},
+	{eventSpotDeleted, "webhook.event.spot_deleted"},
+	{eventRecommendThreshold, "webhook.event.recommend_threshold"},
+}
+
+// auditEvents 操作日志的操作类型对应的事件，推荐 / 取消推荐不在这里，见 notifyRecommend
+var auditEvents = map[string]string{
+	auditCreate:   eventSpotCreated,
+	auditUpdate:   eventSpotUpdated,
+	auditRollback: eventSpotUpdated,
+	auditPublish:  eventSpotUpdated,
+	auditReject:   eventSpotUpdated,
+	auditRestore:  eventSpotUpdated,
+	auditDelete:   eventSpotDeleted,
+	auditPurge:    eventSpotDeleted,
+}
+
+// 投递状态
+const (
+	deliveryPending = "pending"
+	deliverySuccess = "success"
+	deliveryFailed  = "failed"
+)
+
+const (
+	webhookPollInterval = 10 * time.Second // 后台任务检查待投递记录的间隔
+	webhookBaseBackoff  = 30 * time.Second // 第一次重试的等待时间，之后每次翻倍
+	webhookBatchSize    = 100              // 每轮最多投递的条数
+	webhookLogSize      = 100              // 投递日志页面显示的条数
+)
+
+// Webhook 一个接收地址
+type Webhook struct {
+	ID        uint   `gorm:"primaryKey"`
+	URL       string // 接收地址，必须是 http(s)
+	Events    string // 订阅的事件，逗号分隔
+	Secret    string // 签名密钥
+	Active    bool   // 停用后不再产生新的投递，已排队的投递会标记为失败
+	CreatedAt time.Time
+}
+
+// EventList 订阅的事件
+func (w Webhook) EventList() []string {
+	if w.Events == "" {
+		return nil
+	}
+	return strings.Split(w.Events, ",")
+}
+
+// Subscribes 是否订阅了 event
+func (w Webhook) Subscribes(event string) bool {
+	for _, e := range w.EventList() {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery 一次投递（包括所有重试）
+type WebhookDelivery struct {
+	ID            uint      `gorm:"primaryKey"`
+	WebhookID     uint      `gorm:"index"`
+	Event         string    `gorm:"size:50"`
+	Payload       string    // 请求体
+	Status        string    `gorm:"size:20;index"` // pending / success / failed
+	Attempts      int       // 已经投递的次数
+	ResponseCode  int       // 最后一次的 HTTP 状态码，没有收到响应时为 0
+	Error         string    // 最后一次失败的原因
+	NextAttemptAt time.Time `gorm:"index"` // 下次投递的时间
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// StatusLabel 状态的名称在 locales/ 里的键，模板里用 {{t .StatusLabel}}
+func (d WebhookDelivery) StatusLabel() string {
+	switch d.Status {
+	case deliverySuccess:
+		return "webhook.status.success"
+	case deliveryFailed:
+		return "webhook.status.failed"
+	}
+	return "webhook.status.pending"
+}
+
+var webhookClient = &http.Client{}
+
+// webhookWake 有新的投递时叫醒后台任务，不用等到下一轮
+var webhookWake = make(chan struct{}, 1)
+
+func wakeWebhookJob() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// fireWebhook 给订阅了 event 的所有接收地址排队投递，payload 会加上 event 和 occurred_at
+// 失败只打印错误，不影响触发事件的操作
+func fireWebhook(event string, payload gin.H, hooks ...Webhook) {
+	if hooks == nil {
+		var active []Webhook
+		if err := db.Where("active = ?", true).Find(&active).Error; err != nil {
+			slog.Error("查询 webhook 失败", "err", err)
+			return
+		}
+		for _, h := range active {
+			if h.Subscribes(event) {
+				hooks = append(hooks, h)
+			}
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	payload["event"] = event
+	payload["occurred_at"] = time.Now().Format(time.RFC3339)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("生成 webhook 内容失败", "err", err)
+		return
+	}
+	for _, h := range hooks {
+		d := WebhookDelivery{WebhookID: h.ID, Event: event, Payload: string(body), Status: deliveryPending, NextAttemptAt: time.Now()}
+		if err := db.Create(&d).Error; err != nil {
+			slog.Error("保存 webhook 投递失败", "err", err)
+		}
+	}
+	wakeWebhookJob()
+}
+
+// webhookSpot 事件里的景点；彻底删除后已经查不到了，只给出ID
+func webhookSpot(spotID uint) interface{} {
+	var spot Spot
+	if err := db.Unscoped().Preload("Tags").First(&spot, spotID).Error; err != nil {
+		return gin.H{"id": spotID}
+	}
+	return spot
+}
+
+// notifyAudit 写操作日志时触发对应的事件
+func notifyAudit(e AuditEntry) {
+	event, ok := auditEvents[e.Action]
+	if !ok {
+		return
+	}
+	fireWebhook(event, gin.H{"action": e.Action, "actor": e.Actor, "spot": webhookSpot(e.SpotID)})
+}
+
+// notifyRecommend 推荐次数达到阈值的整数倍时触发 recommend.threshold
+// 取消推荐后再推荐回到同一个数时会再触发一次
+func notifyRecommend(spotID uint, count int) {
+	threshold := cfg.Webhook.RecommendThreshold
+	if threshold <= 0 || count <= 0 || count%threshold != 0 {
+		return
+	}
+	fireWebhook(eventRecommendThreshold, gin.H{
+		"threshold":       threshold,
+		"recommend_count": count,
+		"spot":            webhookSpot(spotID),
+	})
+}
+
+// signWebhook 计算签名：HMAC-SHA256(secret, timestamp + "." + body)
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook 投递一次，返回 HTTP 状态码
+func sendWebhook(h *Webhook, d *WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Webhook.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tourist-spots-webhook")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", signWebhook(h.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("接收方返回 %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// deliver 投递一条记录并保存结果，失败时安排下次重试
+func deliver(d *WebhookDelivery) {
+	var h Webhook
+	err := db.First(&h, d.WebhookID).Error
+	if err == nil && !h.Active {
+		err = fmt.Errorf("webhook 已停用")
+	}
+	if err != nil {
+		db.Model(d).Updates(map[string]interface{}{"status": deliveryFailed, "error": err.Error()})
+		return
+	}
+
+	code, err := sendWebhook(&h, d)
+	updates := map[string]interface{}{"attempts": d.Attempts + 1, "response_code": code, "error": ""}
+	switch {
+	case err == nil:
+		updates["status"] = deliverySuccess
+	case d.Attempts+1 >= cfg.Webhook.MaxAttempts:
+		updates["status"] = deliveryFailed
+		updates["error"] = truncateRunes(err.Error(), 500)
+	default:
+		updates["error"] = truncateRunes(err.Error(), 500)
+		updates["next_attempt_at"] = time.Now().Add(webhookBaseBackoff << d.Attempts)
+	}
+	if err := db.Model(d).Updates(updates).Error; err != nil {
+		slog.Error("保存 webhook 投递结果失败", "err", err)
+	}
+}
+
+// deliverPending 投递所有到时间的记录。每次查询和每条投递分别加读锁（见 holdDB），恢复数据库最多等一条投递
+func deliverPending() {
+	for {
+		var batch []WebhookDelivery
+		var err error
+		holdDB(func() {
+			err = db.Where("status = ? AND next_attempt_at <= ?", deliveryPending, time.Now()).
+				Order("id").Limit(webhookBatchSize).Find(&batch).Error
+		})
+		if err != nil {
+			slog.Error("查询 webhook 投递失败", "err", err)
+			return
+		}
+		for i := range batch {
+			holdDB(func() { deliver(&batch[i]) })
+		}
+		if len(batch) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// startWebhookJob 后台投递 webhook：有新投递时立即发送，另外定期检查需要重试的
+func startWebhookJob() {
+	goBackground(func(ctx context.Context) {
+		for {
+			deliverPending()
+			select {
+			case <-webhookWake:
+			case <-time.After(webhookPollInterval):
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+// ---------- 管理页面 ----------
+
+// renderWebhooks 接收地址列表，errMsg 不为空时显示在表单上方
+func renderWebhooks(c *gin.Context, status int, errMsg string) {
+	var hooks []Webhook
+	dbFor(c).Order("id").Find(&hooks)
+	render(c, status, "webhooks.html", gin.H{
+		"title":     "Webhook",
+		"hooks":     hooks,
+		"events":    webhookEvents,
+		"threshold": cfg.Webhook.RecommendThreshold,
+		"error":     errMsg,
+	})
+}
+
+// showWebhooks Webhook 管理：GET /admin/webhooks
+func showWebhooks(c *gin.Context) {
+	renderWebhooks(c, http.StatusOK, "")
+}
+
+// createWebhook 登记接收地址：POST /admin/webhooks，密钥自动生成
+func createWebhook(c *gin.Context) {
+	u := sanitizeURL(strings.TrimSpace(c.PostForm("url")))
+	if u == "" {
+		renderWebhooks(c, http.StatusBadRequest, "接收地址必须是 http:// 或 https:// 开头的地址")
+		return
+	}
+	var events []string
+	for _, e := range webhookEvents {
+		for _, v := range c.PostFormArray("events") {
+			if v == e.Event {
+				events = append(events, e.Event)
+				break
+			}
+		}
+	}
+	if len(events) == 0 {
+		renderWebhooks(c, http.StatusBadRequest, "请至少选择一个事件")
+		return
+	}
+	h := Webhook{URL: u, Events: strings.Join(events, ","), Secret: randomToken(20), Active: true}
+	if err := dbFor(c).Create(&h).Error; err != nil {
+		renderWebhooks(c, http.StatusInternalServerError, "保存失败")
+		return
+	}
+	c.Redirect(http.StatusFound, "/admin/webhooks")
+}
+
+// toggleWebhook 停用 / 启用：POST /admin/webhooks/:id/toggle
+func toggleWebhook(c *gin.Context) {
+	dbFor(c).Model(&Webhook{}).Where("id = ?", c.Param("id")).Update("active", gorm.Expr("NOT active"))
+	c.Redirect(http.StatusFound, "/admin/webhooks")
+}
+
+// deleteWebhook 删除接收地址和它的投递日志：POST /admin/webhooks/:id/delete
+func deleteWebhook(c *gin.Context) {
+	dbFor(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", c.Param("id")).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&Webhook{}, c.Param("id")).Error
+	})
+	c.Redirect(http.StatusFound, "/admin/webhooks")
+}
+
+// pingWebhook 发送一条测试事件：POST /admin/webhooks/:id/ping
+func pingWebhook(c *gin.Context) {
+	var h Webhook
+	if err := dbFor(c).First(&h, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.webhook_not_found"))
+		return
+	}
+	fireWebhook(eventPing, gin.H{"webhook_id": h.ID}, h)
+	c.Redirect(http.StatusFound, fmt.Sprintf("/admin/webhooks/%d", h.ID))
+}
+
+// showWebhookDeliveries 投递日志：GET /admin/webhooks/:id，最近的在前
+func showWebhookDeliveries(c *gin.Context) {
+	var h Webhook
+	if err := dbFor(c).First(&h, c.Param("id")).Error; err != nil {
+		c.String(http.StatusNotFound, tr(c, "error.webhook_not_found"))
+		return
+	}
+	var deliveries []WebhookDelivery
+	dbFor(c).Where("webhook_id = ?", h.ID).Order("id desc").Limit(webhookLogSize).Find(&deliveries)
+	render(c, http.StatusOK, "webhook.html", gin.H{
+		"title":      tr(c, "webhooks.deliveries"),
+		"hook":       h,
+		"deliveries": deliveries,
+	})
+}
+
+// redeliverWebhook 重新投递（次数从头算）：POST /admin/webhooks/:id/deliveries/:delivery/retry
+func redeliverWebhook(c *gin.Context) {
+	dbFor(c).Model(&WebhookDelivery{}).Where("id = ? AND webhook_id = ?", c.Param("delivery"), c.Param("id")).
+		Updates(map[string]interface{}{"status": deliveryPending, "attempts": 0, "next_attempt_at": time.Now()})
+	wakeWebhookJob()
+	c.Redirect(http.StatusFound, "/admin/webhooks/"+c.Param("id"))
+}